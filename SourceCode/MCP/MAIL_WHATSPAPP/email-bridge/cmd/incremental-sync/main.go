@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/user/email-bridge/internal/client"
 	"github.com/user/email-bridge/internal/config"
 	"github.com/user/email-bridge/internal/crypto"
+	"github.com/user/email-bridge/internal/events"
+	"github.com/user/email-bridge/internal/rules"
 	"github.com/user/email-bridge/internal/store"
 )
 
@@ -20,9 +23,11 @@ func main() {
 	batchSize := flag.Int("batch-size", 100, "Number of emails to fetch in each batch")
 	maxEmails := flag.Int("max-emails", 0, "Maximum number of emails to synchronize (0 for all)")
 	attachments := flag.Bool("attachments", false, "Download attachments")
+	attachmentDir := flag.String("attachment-dir", "", "Directory to store downloaded attachments in (defaults to storage.attachments_path in the configuration)")
 	days := flag.Int("days", 0, "Synchronize emails from the last N days (0 for all)")
 	dbPath := flag.String("db", "./email-bridge.db", "Path to the SQLite database")
 	configPath := flag.String("config", "./config.json", "Path to the configuration file")
+	applyRules := flag.Bool("rules", true, "Apply mail rules to emails the database didn't have (disable for the first import of a mailbox)")
 	statusChanges := flag.Bool("status-changes", true, "Check for status changes in existing emails")
 	verbose := flag.Bool("verbose", false, "Enable verbose logging")
 
@@ -41,6 +46,11 @@ func main() {
 		log.Fatalf("Error loading configuration: %v", err)
 	}
 
+	// Store attachments where the server serves them from unless told otherwise
+	if *attachmentDir == "" {
+		*attachmentDir = cfg.Storage.AttachmentsPath
+	}
+
 	// Find account configuration
 	var accountConfig config.AccountConfig
 	found := false
@@ -57,7 +67,8 @@ func main() {
 	}
 
 	// Initialize crypto manager
-	cryptoManager, err := crypto.NewCredentialCrypto(cfg.EncryptionKey)
+	masterKeyPath := filepath.Join(filepath.Dir(*configPath), "keys", "master.key")
+	cryptoManager, err := crypto.NewCredentialCrypto(masterKeyPath)
 	if err != nil {
 		log.Fatalf("Error initializing crypto manager: %v", err)
 	}
@@ -87,6 +98,7 @@ func main() {
 		BatchSize:          *batchSize,
 		MaxEmails:          *maxEmails,
 		SyncAttachments:    *attachments,
+		AttachmentDir:      *attachmentDir,
 		CheckStatusChanges: *statusChanges,
 	}
 
@@ -98,6 +110,17 @@ func main() {
 		}
 	}
 
+	// Apply mail rules to new emails. The rules' IMAP actions use this sync's client,
+	// and forwards wait in the outbox until the server sends them.
+	if *applyRules {
+		client.GetConnectionManager().RegisterClient(fmt.Sprintf("imap-%s", *accountID), imapClient)
+		options.OnNewEmail = rules.NewEngine(db, cfg.Accounts, *attachmentDir).Apply
+	}
+
+	// Log the sync's events, such as folders resynced after the server changed their
+	// UIDVALIDITY, in the event log that API clients resume their event streams from
+	client.GetEmailEventHandler(db).SetEventLog(events.NewHub(db, time.Duration(cfg.Events.RetentionDays)*24*time.Hour).Record)
+
 	// Add progress reporting
 	options.OnProgress = func(folder string, current, total int) {
 		if total > 0 {
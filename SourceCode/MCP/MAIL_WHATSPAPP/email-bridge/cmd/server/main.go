@@ -4,35 +4,121 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
+	"github.com/user/email-bridge/internal/api"
+	"github.com/user/email-bridge/internal/client"
 	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/crypto"
+	"github.com/user/email-bridge/internal/events"
+	"github.com/user/email-bridge/internal/recon"
+	"github.com/user/email-bridge/internal/rules"
+	"github.com/user/email-bridge/internal/store"
+	"github.com/user/email-bridge/internal/webhooks"
 )
 
 func main() {
 	log.Println("Starting Email Bridge Server...")
 
 	// Load configuration
-	cfg, err := config.LoadConfig("config.json")
+	configPath := "config.json"
+	cfg, err := config.LoadConfig(configPath)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// TODO: Initialize database
-	// TODO: Initialize email clients
-	// TODO: Set up API server
+	// Initialize crypto for secure credential storage
+	keyPath := filepath.Join(filepath.Dir(configPath), "keys")
+	cryptoManager, err := crypto.NewCredentialCrypto(filepath.Join(keyPath, "master.key"))
+	if err != nil {
+		log.Fatalf("Failed to initialize crypto: %v", err)
+	}
+
+	// Initialize database
+	db, err := store.NewSQLiteStore(cfg.Database.Path, cryptoManager)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := db.Initialize(); err != nil {
+		db.Close()
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	// Initialize email clients
+	if err := client.InitializeEmailClients(cfg, keyPath, db); err != nil {
+		db.Close()
+		log.Fatalf("Failed to initialize email clients: %v", err)
+	}
+
+	// Set up API server
+	imapClient, smtpClient := defaultClients(cfg)
+	client.GetOutboxSender(nil).SetDefaultClients(imapClient, smtpClient)
+	apiServer := api.NewAPI(db, imapClient, smtpClient)
+	apiServer.SetKeyPath(keyPath)
+	if cfg.Storage.AttachmentsPath != "" {
+		apiServer.SetAttachmentDir(cfg.Storage.AttachmentsPath)
+		client.GetEmailEventHandler(db).SetAttachmentStore(client.NewAttachmentStore(cfg.Storage.AttachmentsPath))
+	}
+	if len(cfg.Server.Clients) > 0 {
+		tokens := make(map[string]string, len(cfg.Server.Clients))
+		for _, apiClient := range cfg.Server.Clients {
+			tokens[apiClient.Token] = apiClient.ID
+		}
+		apiServer.SetClientTokens(tokens)
+	}
+	apiServer.SetApprovalClients(cfg.Approval.Clients)
+
+	// Log email and folder events and stream them to API clients
+	eventHub := events.NewHub(db, time.Duration(cfg.Events.RetentionDays)*24*time.Hour)
+	client.GetEmailEventHandler(db).SetEventLog(eventHub.Record)
+	apiServer.SetEventHub(eventHub)
+
+	// Apply the mail rules to new emails
+	rulesEngine := rules.NewEngine(db, cfg.Accounts, cfg.Storage.AttachmentsPath)
+	client.GetEmailEventHandler(db).RegisterEventHandler(client.EmailEventNew, rulesEngine.HandleEvent)
+
+	// Ingest recon spreadsheets from the attachments of new emails
+	var reconIngester *recon.Ingester
+	if len(cfg.Recon.Rules) > 0 {
+		reconIngester, err = recon.NewIngester(db, cfg.Recon, cfg.Storage.AttachmentsPath)
+		if err != nil {
+			client.ShutdownEmailClients()
+			db.Close()
+			log.Fatalf("Failed to set up recon ingestion: %v", err)
+		}
+		client.GetEmailEventHandler(db).RegisterEventHandler(client.EmailEventNew, reconIngester.HandleEvent)
+		reconIngester.Start()
+		apiServer.SetReconIngester(reconIngester)
+	}
+
+	// Post email and folder events to the webhooks subscribed to them
+	webhookDispatcher := webhooks.NewDispatcher(db)
+	for _, eventType := range client.EmailEventTypes {
+		client.GetEmailEventHandler(db).RegisterEventHandler(eventType, webhookDispatcher.HandleEvent)
+	}
+	webhookDispatcher.Start()
+	apiServer.SetWebhookDispatcher(webhookDispatcher)
 
 	// Create HTTP server
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	srv := &http.Server{
-		Addr: addr,
-		// TODO: Add router handler
+		Addr:    addr,
+		Handler: apiServer.SetupRoutes(),
 	}
 
+	// End the event streams on shutdown, since Shutdown waits for active requests and
+	// doesn't close WebSocket connections
+	streamCtx, endStreams := context.WithCancel(context.Background())
+	srv.BaseContext = func(net.Listener) context.Context { return streamCtx }
+	srv.RegisterOnShutdown(endStreams)
+
 	// Start server in a goroutine
 	go func() {
 		log.Printf("Server listening on %s", addr)
@@ -52,10 +138,52 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Attempt graceful shutdown
+	// Stop accepting API requests first so no handler uses the clients or the database mid-shutdown
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+
+	// Finish the recon job being processed while its account's client is still connected
+	if reconIngester != nil {
+		reconIngester.Stop()
+	}
+
+	// Stop monitors and watchers and disconnect all email clients
+	client.ShutdownEmailClients()
+
+	// Finish the webhook delivery being sent. Events raised after this stay queued and
+	// are sent on the next start.
+	webhookDispatcher.Stop()
+
+	// Close the database last
+	if err := db.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
 	}
 
 	log.Println("Server exited properly")
 }
+
+// defaultClients returns the IMAP and SMTP clients of the first configured account.
+// The API only uses them for requests that don't name an account; requests with an
+// account_id resolve that account's clients from the connection manager.
+func defaultClients(cfg config.Config) (client.IMAPClient, client.SMTPClient) {
+	var imapClient client.IMAPClient
+	var smtpClient client.SMTPClient
+
+	if len(cfg.Accounts) == 0 {
+		return imapClient, smtpClient
+	}
+
+	cm := client.GetConnectionManager()
+	accountID := cfg.Accounts[0].ID
+
+	if c, ok := cm.GetClient(fmt.Sprintf("imap-%s", accountID)); ok {
+		imapClient, _ = c.(client.IMAPClient)
+	}
+
+	if c, ok := cm.GetClient(fmt.Sprintf("smtp-%s", accountID)); ok {
+		smtpClient, _ = c.(client.SMTPClient)
+	}
+
+	return imapClient, smtpClient
+}
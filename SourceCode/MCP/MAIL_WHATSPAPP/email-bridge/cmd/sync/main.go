@@ -10,6 +10,8 @@ import (
 	"github.com/user/email-bridge/internal/client"
 	"github.com/user/email-bridge/internal/config"
 	"github.com/user/email-bridge/internal/crypto"
+	"github.com/user/email-bridge/internal/events"
+	"github.com/user/email-bridge/internal/rules"
 	"github.com/user/email-bridge/internal/store"
 )
 
@@ -20,9 +22,11 @@ func main() {
 	batchSize := flag.Int("batch-size", 100, "Number of emails to fetch in each batch")
 	maxEmails := flag.Int("max-emails", 0, "Maximum number of emails to synchronize (0 for all)")
 	syncAttachments := flag.Bool("attachments", false, "Download attachments")
+	attachmentDir := flag.String("attachment-dir", "", "Directory to store downloaded attachments in (defaults to storage.attachments_path in the configuration)")
 	syncDays := flag.Int("days", 0, "Synchronize emails from the last N days (0 for all)")
 	dbPath := flag.String("db", "./email-bridge.db", "Path to the SQLite database")
 	configPath := flag.String("config", "./config.json", "Path to the configuration file")
+	applyRules := flag.Bool("rules", true, "Apply mail rules to emails the database didn't have (disable for the first import of a mailbox)")
 	flag.Parse()
 
 	// Validate required parameters
@@ -39,6 +43,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Store attachments where the server serves them from unless told otherwise
+	if *attachmentDir == "" {
+		*attachmentDir = cfg.Storage.AttachmentsPath
+	}
+
 	// Find the account in the configuration
 	var accountConfig config.AccountConfig
 	found := false
@@ -92,6 +101,7 @@ func main() {
 		BatchSize:       *batchSize,
 		MaxEmails:       *maxEmails,
 		SyncAttachments: *syncAttachments,
+		AttachmentDir:   *attachmentDir,
 	}
 
 	// Set up date range if specified
@@ -99,6 +109,17 @@ func main() {
 		options.SyncFrom = time.Now().AddDate(0, 0, -*syncDays)
 	}
 
+	// Apply mail rules to new emails. The rules' IMAP actions use this sync's client,
+	// and forwards wait in the outbox until the server sends them.
+	if *applyRules {
+		client.GetConnectionManager().RegisterClient(fmt.Sprintf("imap-%s", *accountID), imapClient)
+		options.OnNewEmail = rules.NewEngine(db, cfg.Accounts, *attachmentDir).Apply
+	}
+
+	// Log the sync's events, such as folders resynced after the server changed their
+	// UIDVALIDITY, in the event log that API clients resume their event streams from
+	client.GetEmailEventHandler(db).SetEventLog(events.NewHub(db, time.Duration(cfg.Events.RetentionDays)*24*time.Hour).Record)
+
 	// Set up progress reporting
 	options.OnProgress = func(folder string, current, total int) {
 		fmt.Printf("\rSynchronizing %s: %d/%d emails (%.1f%%)", folder, current, total, float64(current)/float64(total)*100)
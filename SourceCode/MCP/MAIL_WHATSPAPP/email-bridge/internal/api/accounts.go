@@ -0,0 +1,210 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+// handleAccounts handles account requests
+func (api *API) handleAccounts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.listAccounts(w, r)
+	case http.MethodPost:
+		api.createAccount(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAccountByID handles requests for a specific account
+func (api *API) handleAccountByID(w http.ResponseWriter, r *http.Request) {
+	// The path should be in the format "/accounts/{id}"
+	accountID := strings.TrimPrefix(r.URL.Path, "/accounts/")
+	if accountID == "" || strings.Contains(accountID, "/") {
+		http.Error(w, "Invalid account ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getAccount(w, r, accountID)
+	case http.MethodPut:
+		api.updateAccount(w, r, accountID)
+	case http.MethodDelete:
+		api.deleteAccount(w, r, accountID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listAccounts handles GET requests to list the stored accounts
+func (api *API) listAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := api.store.GetAccounts()
+	if err != nil {
+		http.Error(w, "Failed to list accounts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Accounts []models.Account `json:"accounts"`
+	}{
+		Accounts: make([]models.Account, 0, len(accounts)),
+	}
+	for _, account := range accounts {
+		response.Accounts = append(response.Accounts, withoutSecrets(account))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// createAccount handles POST requests to add an account and start its clients
+func (api *API) createAccount(w http.ResponseWriter, r *http.Request) {
+	var account models.Account
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if msg := validateAccount(account); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := api.store.GetAccount(account.ID); err == nil {
+		http.Error(w, "Account already exists: "+account.ID, http.StatusConflict)
+		return
+	} else if err != sql.ErrNoRows {
+		http.Error(w, "Failed to check account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The store encrypts the credentials before writing them
+	if err := api.store.StoreAccount(account); err != nil {
+		http.Error(w, "Failed to store account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := api.registerAccount(account); err != nil {
+		http.Error(w, "Account was stored but its clients could not be started: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, withoutSecrets(account))
+}
+
+// getAccount handles GET requests for a single account
+func (api *API) getAccount(w http.ResponseWriter, r *http.Request, accountID string) {
+	account, ok := api.storedAccount(w, accountID)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, withoutSecrets(account))
+}
+
+// updateAccount handles PUT requests to change an account and restart its clients.
+// Fields left out of the request body, including credentials, keep their stored values.
+func (api *API) updateAccount(w http.ResponseWriter, r *http.Request, accountID string) {
+	account, ok := api.storedAccount(w, accountID)
+	if !ok {
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	account.ID = accountID
+
+	if msg := validateAccount(account); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if err := api.store.StoreAccount(account); err != nil {
+		http.Error(w, "Failed to store account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Restart the clients with the new settings
+	api.unregisterAccount(accountID)
+	if err := api.registerAccount(account); err != nil {
+		http.Error(w, "Account was updated but its clients could not be restarted: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, withoutSecrets(account))
+}
+
+// deleteAccount handles DELETE requests to stop an account's clients and remove it with its data
+func (api *API) deleteAccount(w http.ResponseWriter, r *http.Request, accountID string) {
+	if _, ok := api.storedAccount(w, accountID); !ok {
+		return
+	}
+
+	api.unregisterAccount(accountID)
+
+	if err := api.store.DeleteAccount(accountID); err != nil {
+		http.Error(w, "Account clients were stopped but the account could not be deleted: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storedAccount loads an account from the store, writing a 404 or 500 response on failure
+func (api *API) storedAccount(w http.ResponseWriter, accountID string) (models.Account, bool) {
+	account, err := api.store.GetAccount(accountID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Account not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve account: "+err.Error(), http.StatusInternalServerError)
+		}
+		return account, false
+	}
+
+	return account, true
+}
+
+// validateAccount returns a message describing the first missing required field, or ""
+func validateAccount(account models.Account) string {
+	switch {
+	case account.ID == "":
+		return "Account must have an id"
+	case strings.Contains(account.ID, "/"):
+		return "Account id must not contain '/'"
+	case account.Email == "":
+		return "Account must have an email"
+	case account.IMAPConfig.Server == "" || account.IMAPConfig.Port == 0:
+		return "Account must have an IMAP server and port"
+	case account.SMTPConfig.Server == "" || account.SMTPConfig.Port == 0:
+		return "Account must have an SMTP server and port"
+	case account.AuthType != "" && account.AuthType != "password" && account.AuthType != "oauth":
+		return "Account auth_type must be 'password' or 'oauth'"
+	case account.AuthType == "oauth" && account.OAuthConfig == nil:
+		return "Account with auth_type 'oauth' must have an oauth_config"
+	}
+	return ""
+}
+
+// withoutSecrets returns a copy of an account with passwords and OAuth secrets removed
+func withoutSecrets(account models.Account) models.Account {
+	account.IMAPConfig.Password = ""
+	account.SMTPConfig.Password = ""
+
+	if account.OAuthConfig != nil {
+		account.OAuthConfig = &models.OAuthConfig{
+			ClientID: account.OAuthConfig.ClientID,
+			Expiry:   account.OAuthConfig.Expiry,
+			TokenURL: account.OAuthConfig.TokenURL,
+		}
+	}
+
+	return account
+}
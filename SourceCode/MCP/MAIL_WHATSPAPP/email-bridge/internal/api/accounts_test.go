@@ -0,0 +1,189 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// accountStore implements the account operations of store.Store
+type accountStore struct {
+	store.Store
+	accounts map[string]models.Account
+}
+
+func (s *accountStore) StoreAccount(account models.Account) error {
+	s.accounts[account.ID] = account
+	return nil
+}
+
+func (s *accountStore) GetAccount(id string) (models.Account, error) {
+	account, ok := s.accounts[id]
+	if !ok {
+		return account, sql.ErrNoRows
+	}
+	return account, nil
+}
+
+func (s *accountStore) GetAccounts() ([]models.Account, error) {
+	accounts := make([]models.Account, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+func (s *accountStore) DeleteAccount(id string) error {
+	delete(s.accounts, id)
+	return nil
+}
+
+// newAccountTestAPI returns an API whose account client registrations are recorded in the returned slices
+func newAccountTestAPI(s store.Store) (*API, *[]string, *[]string) {
+	var registered, unregistered []string
+
+	api := NewAPI(s, nil, nil)
+	api.registerAccount = func(account models.Account) error {
+		registered = append(registered, account.ID)
+		return nil
+	}
+	api.unregisterAccount = func(accountID string) {
+		unregistered = append(unregistered, accountID)
+	}
+
+	return api, &registered, &unregistered
+}
+
+const testAccountJSON = `{
+	"id": "work",
+	"name": "Work",
+	"email": "me@example.com",
+	"imap_config": {"server": "imap.example.com", "port": 993, "username": "me", "password": "imap-secret", "use_tls": true},
+	"smtp_config": {"server": "smtp.example.com", "port": 587, "username": "me", "password": "smtp-secret", "use_tls": true},
+	"auth_type": "oauth",
+	"oauth_config": {"client_id": "client", "client_secret": "client-secret", "refresh_token": "refresh-secret", "access_token": "access-secret"}
+}`
+
+// assertNoSecrets fails the test if a response body contains any credential from testAccountJSON
+func assertNoSecrets(t *testing.T, body string) {
+	t.Helper()
+	for _, secret := range []string{"imap-secret", "smtp-secret", "client-secret", "refresh-secret", "access-secret"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("Response contains secret %q: %s", secret, body)
+		}
+	}
+}
+
+func TestAccountLifecycle(t *testing.T) {
+	s := &accountStore{accounts: map[string]models.Account{}}
+	api, registered, unregistered := newAccountTestAPI(s)
+	handler := api.SetupRoutes()
+
+	// Create
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(testAccountJSON)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	assertNoSecrets(t, rec.Body.String())
+	if s.accounts["work"].IMAPConfig.Password != "imap-secret" {
+		t.Error("Expected the IMAP password to be passed to the store")
+	}
+	if len(*registered) != 1 || (*registered)[0] != "work" {
+		t.Errorf("Expected the account clients to be registered, got %v", *registered)
+	}
+
+	// Create again
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(testAccountJSON)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for a duplicate account, got %d", http.StatusConflict, rec.Code)
+	}
+
+	// List and get
+	for _, target := range []string{"/accounts", "/accounts/work"} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: expected status %d, got %d", target, http.StatusOK, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), `"email":"me@example.com"`) {
+			t.Errorf("GET %s: expected the account in the response, got %s", target, rec.Body.String())
+		}
+		assertNoSecrets(t, rec.Body.String())
+	}
+
+	// Update without credentials keeps the stored ones
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/accounts/work", strings.NewReader(`{"name": "Office"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var updated models.Account
+	if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if updated.Name != "Office" {
+		t.Errorf("Expected name Office, got %s", updated.Name)
+	}
+	if s.accounts["work"].IMAPConfig.Password != "imap-secret" || s.accounts["work"].OAuthConfig.RefreshToken != "refresh-secret" {
+		t.Error("Expected stored credentials to be kept on update")
+	}
+	if len(*unregistered) != 1 || len(*registered) != 2 {
+		t.Errorf("Expected the clients to be restarted on update, got registered %v, unregistered %v", *registered, *unregistered)
+	}
+
+	// Delete
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/accounts/work", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	if _, ok := s.accounts["work"]; ok {
+		t.Error("Expected the account to be deleted from the store")
+	}
+	if len(*unregistered) != 2 {
+		t.Errorf("Expected the clients to be unregistered on delete, got %v", *unregistered)
+	}
+}
+
+func TestAccountRequestErrors(t *testing.T) {
+	s := &accountStore{accounts: map[string]models.Account{}}
+	api, _, _ := newAccountTestAPI(s)
+	handler := api.SetupRoutes()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"invalid body", http.MethodPost, "/accounts", `{`, http.StatusBadRequest},
+		{"missing id", http.MethodPost, "/accounts", `{"email":"me@example.com"}`, http.StatusBadRequest},
+		{"missing servers", http.MethodPost, "/accounts", `{"id":"a","email":"me@example.com"}`, http.StatusBadRequest},
+		{"unknown auth type", http.MethodPost, "/accounts", strings.Replace(testAccountJSON, `"oauth"`, `"kerberos"`, 1), http.StatusBadRequest},
+		{"get unknown", http.MethodGet, "/accounts/missing", "", http.StatusNotFound},
+		{"update unknown", http.MethodPut, "/accounts/missing", `{}`, http.StatusNotFound},
+		{"delete unknown", http.MethodDelete, "/accounts/missing", "", http.StatusNotFound},
+		{"nested path", http.MethodGet, "/accounts/a/b", "", http.StatusBadRequest},
+		{"collection method", http.MethodDelete, "/accounts", "", http.StatusMethodNotAllowed},
+		{"item method", http.MethodPost, "/accounts/missing", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d (%s)", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
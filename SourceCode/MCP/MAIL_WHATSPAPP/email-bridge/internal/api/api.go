@@ -2,34 +2,204 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/events"
 	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/recon"
+	"github.com/user/email-bridge/internal/search"
 	"github.com/user/email-bridge/internal/store"
 )
 
 // API represents the REST API
 type API struct {
-	store      store.Store
-	imapClient client.IMAPClient
-	smtpClient client.SMTPClient
+	store         store.Store
+	imapClient    client.IMAPClient
+	smtpClient    client.SMTPClient
+	attachmentDir string
+	keyPath       string
+
+	// registerAccount and unregisterAccount start and stop the clients of an account
+	registerAccount   func(account models.Account) error
+	unregisterAccount func(accountID string)
+
+	// notifyOutbox wakes the outbox sender after an email is queued
+	notifyOutbox func()
+
+	// clientTokens maps the bearer tokens API clients authenticate with to their IDs.
+	// Every request needs one of them when it isn't empty.
+	clientTokens map[string]string
+
+	// approvalClients are the API clients whose emails are held for approval
+	approvalClients map[string]bool
+
+	// retryRecon queues a failed recon job again. It is nil when recon ingestion is
+	// not configured.
+	retryRecon func(jobID string) (models.ReconJob, error)
+
+	// eventHub streams email and folder events. It is nil when events aren't logged.
+	eventHub *events.Hub
+
+	// replayDelivery queues a dead webhook delivery again. It is nil when webhooks
+	// aren't dispatched.
+	replayDelivery func(deliveryID string) (models.WebhookDelivery, error)
 }
 
 // NewAPI creates a new API instance
 func NewAPI(store store.Store, imapClient client.IMAPClient, smtpClient client.SMTPClient) *API {
-	return &API{
-		store:      store,
-		imapClient: imapClient,
-		smtpClient: smtpClient,
+	api := &API{
+		store:         store,
+		imapClient:    imapClient,
+		smtpClient:    smtpClient,
+		attachmentDir: "attachments",
+		keyPath:       "keys",
+
+		unregisterAccount: client.UnregisterAccount,
+		notifyOutbox:      client.GetOutboxSender(nil).Notify,
+	}
+	api.registerAccount = func(account models.Account) error {
+		return client.RegisterStoredAccount(account, api.keyPath)
+	}
+	return api
+}
+
+// SetAttachmentDir sets the directory where attachments fetched from the server are cached
+func (api *API) SetAttachmentDir(dir string) {
+	api.attachmentDir = dir
+}
+
+// SetKeyPath sets the directory holding the master key that the credentials of
+// accounts created through the API are encrypted with
+func (api *API) SetKeyPath(keyPath string) {
+	api.keyPath = keyPath
+}
+
+// SetClientTokens sets the bearer tokens API clients authenticate with, mapped to the
+// clients' IDs. Once set, every request but health checks needs one of them.
+func (api *API) SetClientTokens(tokens map[string]string) {
+	api.clientTokens = tokens
+}
+
+// SetApprovalClients sets the API clients, identified by their tokens, whose emails are
+// held in the outbox until a person approves them
+func (api *API) SetApprovalClients(clients []string) {
+	api.approvalClients = make(map[string]bool, len(clients))
+	for _, clientID := range clients {
+		api.approvalClients[clientID] = true
+	}
+}
+
+// SetReconIngester sets the ingester that retries failed recon jobs
+func (api *API) SetReconIngester(ingester *recon.Ingester) {
+	api.retryRecon = ingester.Retry
+}
+
+// SetEventHub sets the hub that streams email and folder events to clients
+func (api *API) SetEventHub(hub *events.Hub) {
+	api.eventHub = hub
+}
+
+// errAccountNotFound is returned when a request names an account that has no registered client
+var errAccountNotFound = errors.New("account not found")
+
+// imapClientForAccount returns the IMAP client registered for an account, or the
+// default client when no account is given. The boolean is false when an account
+// was given but has no IMAP client registered.
+func (api *API) imapClientForAccount(accountID string) (client.IMAPClient, bool) {
+	if accountID == "" {
+		return api.imapClient, true
+	}
+
+	c, ok := client.GetConnectionManager().GetClient(fmt.Sprintf("imap-%s", accountID))
+	if !ok {
+		return nil, false
+	}
+
+	imapClient, ok := c.(client.IMAPClient)
+	return imapClient, ok
+}
+
+// connectedIMAPClient returns the IMAP client for an account, reconnecting it if needed
+func (api *API) connectedIMAPClient(accountID string) (client.IMAPClient, error) {
+	imapClient, ok := api.imapClientForAccount(accountID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errAccountNotFound, accountID)
+	}
+
+	if imapClient == nil {
+		return nil, fmt.Errorf("IMAP client not configured")
+	}
+
+	if !imapClient.IsConnected() {
+		if err := imapClient.Connect(); err != nil {
+			return nil, fmt.Errorf("failed to connect to IMAP server: %w", err)
+		}
+	}
+
+	return imapClient, nil
+}
+
+// writeClientError writes the response for a failure to get a connected client
+func writeClientError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errAccountNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusServiceUnavailable)
+}
+
+// smtpClientForAccount returns the SMTP client registered for an account, or the
+// default client when no account is given. The boolean is false when an account
+// was given but has no SMTP client registered.
+func (api *API) smtpClientForAccount(accountID string) (client.SMTPClient, bool) {
+	if accountID == "" {
+		return api.smtpClient, true
+	}
+
+	c, ok := client.GetConnectionManager().GetClient(fmt.Sprintf("smtp-%s", accountID))
+	if !ok {
+		return nil, false
+	}
+
+	smtpClient, ok := c.(client.SMTPClient)
+	return smtpClient, ok
+}
+
+// connectedSMTPClient returns the SMTP client for an account, reconnecting it if needed
+func (api *API) connectedSMTPClient(accountID string) (client.SMTPClient, error) {
+	smtpClient, ok := api.smtpClientForAccount(accountID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errAccountNotFound, accountID)
+	}
+
+	if smtpClient == nil {
+		return nil, fmt.Errorf("SMTP client not configured")
+	}
+
+	if !smtpClient.IsConnected() {
+		if err := smtpClient.Connect(); err != nil {
+			return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+		}
+	}
+
+	return smtpClient, nil
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Warning: Failed to encode response: %v", err)
 	}
 }
 
@@ -50,11 +220,39 @@ func (api *API) SetupRoutes() http.Handler {
 	// Attachment endpoints
 	mux.HandleFunc("/attachments/", api.handleAttachments)
 
+	// Outbox endpoints
+	mux.HandleFunc("/outbox", api.handleOutbox)
+	mux.HandleFunc("/outbox/", api.handleOutboxByID)
+
+	// Approval endpoints
+	mux.HandleFunc("/approvals", api.handleApprovals)
+	mux.HandleFunc("/approvals/", api.handleApprovalByID)
+
+	// Draft endpoints
+	mux.HandleFunc("/drafts", api.handleDrafts)
+	mux.HandleFunc("/drafts/", api.handleDraftByID)
+
+	// Recon job endpoints
+	mux.HandleFunc("/recon/jobs", api.handleReconJobs)
+	mux.HandleFunc("/recon/jobs/", api.handleReconJobByID)
+
+	// Mail rule endpoints
+	mux.HandleFunc("/rules", api.handleRules)
+	mux.HandleFunc("/rules/", api.handleRuleByID)
+
 	// Account endpoints
 	mux.HandleFunc("/accounts", api.handleAccounts)
 	mux.HandleFunc("/accounts/", api.handleAccountByID)
 
-	return mux
+	// Webhook endpoints
+	mux.HandleFunc("/webhooks", api.handleWebhooks)
+	mux.HandleFunc("/webhooks/", api.handleWebhookByID)
+
+	// Event stream endpoints
+	mux.HandleFunc("/events", api.handleEvents)
+	mux.HandleFunc("/events/ws", api.handleEventsWebSocket)
+
+	return api.authenticate(mux)
 }
 
 // handleHealth handles health check requests
@@ -77,63 +275,72 @@ func (api *API) handleEmails(w http.ResponseWriter, r *http.Request) {
 
 // handleEmailByID handles requests for a specific email
 func (api *API) handleEmailByID(w http.ResponseWriter, r *http.Request) {
-	// Extract email ID from URL path
-	path := r.URL.Path
-	// The path should be in the format "/emails/{id}"
-	if len(path) <= len("/emails/") {
+	// The path should be in the format "/emails/{id}" or "/emails/{id}/{action}"
+	emailID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/emails/"), "/")
+	if emailID == "" || strings.Contains(action, "/") {
 		http.Error(w, "Invalid email ID", http.StatusBadRequest)
 		return
 	}
 
-	emailID := path[len("/emails/"):]
-
-	switch r.Method {
-	case http.MethodGet:
-		api.getEmailByID(w, r, emailID)
-	case http.MethodPut:
-		// Will be implemented in task 9.4
-		http.Error(w, "Not implemented", http.StatusNotImplemented)
-	case http.MethodDelete:
-		// Will be implemented in task 9.4
-		http.Error(w, "Not implemented", http.StatusNotImplemented)
+	switch action {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			api.getEmailByID(w, r, emailID)
+		case http.MethodPut:
+			api.updateEmail(w, r, emailID, action)
+		case http.MethodDelete:
+			api.deleteEmail(w, r, emailID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case "status", "folder":
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		api.updateEmail(w, r, emailID, action)
+	case "reply", "forward":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if action == "reply" {
+			api.replyEmail(w, r, emailID)
+		} else {
+			api.forwardEmail(w, r, emailID)
+		}
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		http.NotFound(w, r)
 	}
 }
 
-// handleFolders handles folder requests
-func (api *API) handleFolders(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement folder handlers
-}
-
-// handleAttachments handles attachment requests
-func (api *API) handleAttachments(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement attachment handlers
-}
-
-// handleAccounts handles account requests
-func (api *API) handleAccounts(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement account handlers
-}
-
-// handleAccountByID handles requests for a specific account
-func (api *API) handleAccountByID(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement account by ID handler
-}
-
 // listEmails handles GET requests to list emails with filtering and pagination
 func (api *API) listEmails(w http.ResponseWriter, r *http.Request) {
 	// Parse query parameters
 	query := r.URL.Query()
 
-	// Create search criteria from query parameters
-	criteria := models.SearchCriteria{
-		AccountID:   query.Get("account_id"),
-		Folder:      query.Get("folder"),
-		Query:       query.Get("query"),
-		FromAddress: query.Get("from"),
-		ToAddress:   query.Get("to"),
-		Subject:     query.Get("subject"),
+	// Start from the Gmail-style query in q, if any
+	criteria, err := search.Parse(query.Get("q"))
+	if err != nil {
+		http.Error(w, "Invalid q: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Query parameters take precedence over the matching parts of q
+	for param, field := range map[string]*string{
+		"account_id": &criteria.AccountID,
+		"folder":     &criteria.Folder,
+		"from":       &criteria.FromAddress,
+		"to":         &criteria.ToAddress,
+		"subject":    &criteria.Subject,
+	} {
+		if value := query.Get(param); value != "" {
+			*field = value
+		}
+	}
+	if text := query.Get("query"); text != "" {
+		criteria.Query = strings.TrimSpace(criteria.Query + " " + text)
 	}
 
 	// Parse date filters if provided
@@ -196,59 +403,51 @@ func (api *API) listEmails(w http.ResponseWriter, r *http.Request) {
 		criteria.Offset = offset
 	}
 
-	// Parse sort parameter
-	sortBy := query.Get("sort_by")
-	sortOrder := query.Get("sort_order")
+	// Sorting and cursor pagination are applied by the store
+	criteria.SortBy = query.Get("sort_by")
+	switch criteria.SortBy {
+	case "", store.SortByDate, store.SortBySubject, store.SortByFrom, store.SortByRelevance:
+	default:
+		http.Error(w, "Invalid sort_by value. Use 'date', 'subject', 'from' or 'relevance'.", http.StatusBadRequest)
+		return
+	}
+	criteria.SortOrder = query.Get("sort_order")
+	if criteria.SortOrder != "" && criteria.SortOrder != "asc" && criteria.SortOrder != "desc" {
+		http.Error(w, "Invalid sort_order value. Use 'asc' or 'desc'.", http.StatusBadRequest)
+		return
+	}
+	criteria.Cursor = query.Get("cursor")
 
-	// Apply sorting (this will be handled in the response formatting)
+	// Fetch one email more than requested to tell whether there is a next page
+	limit := criteria.Limit
+	if limit > 0 {
+		criteria.Limit++
+	}
 
 	// Search emails based on criteria
 	emails, err := api.store.SearchEmails(criteria)
 	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor: "+err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Failed to search emails: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	criteria.Limit = limit
+
+	nextCursor := ""
+	if limit > 0 && len(emails) > limit {
+		emails = emails[:limit]
+		nextCursor = emails[limit-1].Cursor
+	}
 
 	// Count total emails matching criteria without pagination
-	// This is a simplified approach - in a real implementation, you might want to
-	// use a separate COUNT query for better performance
-	originalLimit := criteria.Limit
-	originalOffset := criteria.Offset
-	criteria.Limit = 0
-	criteria.Offset = 0
-
-	allEmails, err := api.store.SearchEmails(criteria)
+	totalCount, err := api.store.CountEmails(criteria)
 	if err != nil {
 		http.Error(w, "Failed to count total emails: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	totalCount := len(allEmails)
-
-	// Restore original pagination settings
-	criteria.Limit = originalLimit
-	criteria.Offset = originalOffset
-
-	// Apply custom sorting if needed (the database query already sorts by date DESC)
-	if sortBy != "" {
-		switch sortBy {
-		case "date":
-			// Already sorted by date in the database query
-		case "subject":
-			sort.Slice(emails, func(i, j int) bool {
-				if sortOrder == "desc" {
-					return emails[i].Subject > emails[j].Subject
-				}
-				return emails[i].Subject < emails[j].Subject
-			})
-		case "from":
-			sort.Slice(emails, func(i, j int) bool {
-				if sortOrder == "desc" {
-					return emails[i].From.Email > emails[j].From.Email
-				}
-				return emails[i].From.Email < emails[j].From.Email
-			})
-		}
-	}
 
 	// Create response with pagination metadata
 	response := struct {
@@ -256,11 +455,13 @@ func (api *API) listEmails(w http.ResponseWriter, r *http.Request) {
 		TotalCount int            `json:"total_count"`
 		Limit      int            `json:"limit"`
 		Offset     int            `json:"offset"`
+		NextCursor string         `json:"next_cursor,omitempty"`
 	}{
 		Emails:     emails,
 		TotalCount: totalCount,
 		Limit:      criteria.Limit,
 		Offset:     criteria.Offset,
+		NextCursor: nextCursor,
 	}
 
 	// Set content type and encode response
@@ -316,39 +517,103 @@ func (api *API) getEmailByID(w http.ResponseWriter, r *http.Request, emailID str
 	}
 }
 
-// sendEmail handles POST requests to send a new email
-func (api *API) sendEmail(w http.ResponseWriter, r *http.Request) {
-	// Check if SMTP client is available
-	if api.smtpClient == nil {
-		http.Error(w, "SMTP client not configured", http.StatusServiceUnavailable)
-		return
+// composeRequest is the body of requests that compose a new email
+type composeRequest struct {
+	AccountID   string           `json:"account_id"`
+	From        models.Address   `json:"from"`
+	To          []models.Address `json:"to"`
+	Cc          []models.Address `json:"cc"`
+	Bcc         []models.Address `json:"bcc"`
+	Subject     string           `json:"subject"`
+	TextContent string           `json:"text_content"`
+	HtmlContent string           `json:"html_content"`
+	Attachments []struct {
+		Path        string `json:"path"`
+		Filename    string `json:"filename"`
+		ContentType string `json:"content_type"`
+		ContentID   string `json:"content_id,omitempty"`
+	} `json:"attachments"`
+}
+
+// email creates the email a request composes in a folder. It returns an error if an
+// attachment file can't be read.
+func (req composeRequest) email(folder string) (models.Email, error) {
+	email := models.Email{
+		ID:          generateEmailID(),
+		AccountID:   req.AccountID,
+		MessageID:   generateMessageID(req.From.Email),
+		From:        req.From,
+		To:          req.To,
+		Cc:          req.Cc,
+		Bcc:         req.Bcc,
+		Subject:     req.Subject,
+		TextContent: req.TextContent,
+		HtmlContent: req.HtmlContent,
+		Date:        time.Now(),
+		Folder:      folder,
 	}
 
-	// Check if SMTP client is connected
-	if !api.smtpClient.IsConnected() {
-		// Try to reconnect
-		if err := api.smtpClient.Connect(); err != nil {
-			http.Error(w, "Failed to connect to SMTP server: "+err.Error(), http.StatusServiceUnavailable)
-			return
+	// Process attachments if any
+	if len(req.Attachments) > 0 {
+		email.HasAttachments = true
+		email.Attachments = make([]models.Attachment, 0, len(req.Attachments))
+
+		for _, att := range req.Attachments {
+			attachment, err := localAttachment(att.Path, att.Filename, att.ContentType)
+			if err != nil {
+				return email, err
+			}
+			attachment.ID = generateAttachmentID()
+			attachment.EmailID = email.ID
+			attachment.ContentID = att.ContentID
+
+			email.Attachments = append(email.Attachments, attachment)
 		}
 	}
 
+	return email, nil
+}
+
+// validateOutgoing returns an error if an email can't be sent as it is
+func validateOutgoing(email models.Email) error {
+	if len(email.To) == 0 && len(email.Cc) == 0 && len(email.Bcc) == 0 {
+		return errors.New("Email must have at least one recipient")
+	}
+
+	if email.From.Email == "" {
+		return errors.New("Email must have a sender")
+	}
+
+	if email.Subject == "" {
+		return errors.New("Email must have a subject")
+	}
+
+	if email.TextContent == "" && email.HtmlContent == "" {
+		return errors.New("Email must have content (text or HTML)")
+	}
+
+	return nil
+}
+
+// checkOutboxClient writes an error response and returns false if the account of an
+// email has no SMTP client for the outbox to send it with
+func (api *API) checkOutboxClient(w http.ResponseWriter, accountID string) bool {
+	if smtpClient, ok := api.smtpClientForAccount(accountID); !ok {
+		http.Error(w, fmt.Sprintf("%v: %s", errAccountNotFound, accountID), http.StatusNotFound)
+		return false
+	} else if smtpClient == nil {
+		http.Error(w, "SMTP client not configured", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// sendEmail handles POST requests to send a new email
+func (api *API) sendEmail(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var emailRequest struct {
-		AccountID   string           `json:"account_id"`
-		From        models.Address   `json:"from"`
-		To          []models.Address `json:"to"`
-		Cc          []models.Address `json:"cc"`
-		Bcc         []models.Address `json:"bcc"`
-		Subject     string           `json:"subject"`
-		TextContent string           `json:"text_content"`
-		HtmlContent string           `json:"html_content"`
-		Attachments []struct {
-			Path        string `json:"path"`
-			Filename    string `json:"filename"`
-			ContentType string `json:"content_type"`
-			ContentID   string `json:"content_id,omitempty"`
-		} `json:"attachments"`
+		composeRequest
+		SendAt *time.Time `json:"send_at,omitempty"` // RFC 3339; omitted to send now
 	}
 
 	// Decode JSON request
@@ -357,112 +622,53 @@ func (api *API) sendEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate required fields
-	if len(emailRequest.To) == 0 && len(emailRequest.Cc) == 0 && len(emailRequest.Bcc) == 0 {
-		http.Error(w, "Email must have at least one recipient", http.StatusBadRequest)
-		return
-	}
-
-	if emailRequest.From.Email == "" {
-		http.Error(w, "Email must have a sender", http.StatusBadRequest)
+	// Create email model
+	email, err := emailRequest.email("Sent") // Default folder for sent emails
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if emailRequest.Subject == "" {
-		http.Error(w, "Email must have a subject", http.StatusBadRequest)
+	// Validate required fields
+	if err := validateOutgoing(email); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if emailRequest.TextContent == "" && emailRequest.HtmlContent == "" {
-		http.Error(w, "Email must have content (text or HTML)", http.StatusBadRequest)
+	// The outbox sends the email with the account's SMTP client, so it must have one
+	if !api.checkOutboxClient(w, email.AccountID) {
 		return
 	}
 
-	// Create email model
-	email := models.Email{
-		ID:          generateEmailID(),
-		AccountID:   emailRequest.AccountID,
-		MessageID:   generateMessageID(emailRequest.From.Email),
-		From:        emailRequest.From,
-		To:          emailRequest.To,
-		Cc:          emailRequest.Cc,
-		Bcc:         emailRequest.Bcc,
-		Subject:     emailRequest.Subject,
-		TextContent: emailRequest.TextContent,
-		HtmlContent: emailRequest.HtmlContent,
-		Date:        time.Now(),
-		Folder:      "Sent", // Default folder for sent emails
-	}
-
-	// Process attachments if any
-	if len(emailRequest.Attachments) > 0 {
-		email.HasAttachments = true
-		email.Attachments = make([]models.Attachment, 0, len(emailRequest.Attachments))
-
-		for _, att := range emailRequest.Attachments {
-			// Validate attachment path
-			if att.Path == "" {
-				http.Error(w, "Attachment must have a path", http.StatusBadRequest)
-				return
-			}
-
-			// Get file info for size
-			fileInfo, err := os.Stat(att.Path)
-			if err != nil {
-				http.Error(w, "Invalid attachment path: "+err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			// Create attachment model
-			attachment := models.Attachment{
-				ID:          generateAttachmentID(),
-				EmailID:     email.ID,
-				Filename:    att.Filename,
-				ContentType: att.ContentType,
-				ContentID:   att.ContentID,
-				Size:        fileInfo.Size(),
-				Path:        att.Path,
-			}
-
-			// Use default filename if not provided
-			if attachment.Filename == "" {
-				attachment.Filename = filepath.Base(att.Path)
-			}
-
-			// Use default content type if not provided
-			if attachment.ContentType == "" {
-				// Try to detect content type
-				file, err := os.Open(att.Path)
-				if err == nil {
-					defer file.Close()
-					buffer := make([]byte, 512) // Only the first 512 bytes are used for detection
-					_, err = file.Read(buffer)
-					if err == nil {
-						attachment.ContentType = http.DetectContentType(buffer)
-					}
-				}
-
-				// If detection failed, use a default
-				if attachment.ContentType == "" {
-					attachment.ContentType = "application/octet-stream"
-				}
-			}
+	api.queueEmail(w, r, email, emailRequest.SendAt)
+}
 
-			email.Attachments = append(email.Attachments, attachment)
-		}
+// deliverEmail sends an email, stores it in the Sent folder and writes the response.
+// An email from a client that needs approval is queued in the outbox instead.
+func (api *API) deliverEmail(w http.ResponseWriter, r *http.Request, smtpClient client.SMTPClient, email models.Email) {
+	if submitter := requestClientID(r); api.requiresApproval(submitter) {
+		api.queueEmail(w, r, email, nil)
+		return
 	}
 
 	// Send the email
-	if err := api.smtpClient.SendEmail(email); err != nil {
+	raw, err := smtpClient.SendEmailMessage(email)
+	if err != nil {
 		http.Error(w, "Failed to send email: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	defer raw.Close()
 
 	// Store the sent email in the database
 	if err := api.store.StoreEmail(email); err != nil {
 		// Log the error but don't fail the request since the email was sent
 		// In a production system, you might want to handle this differently
 		log.Printf("Warning: Failed to store sent email: %v", err)
+	} else if imapClient, _ := api.imapClientForAccount(email.AccountID); imapClient != nil {
+		// Keep a copy in the Sent folder on the server as well
+		if email.ID, err = client.AppendSentEmail(api.store, imapClient, email, raw); err != nil {
+			log.Printf("Warning: Failed to store sent email on the server: %v", err)
+		}
 	}
 
 	// Return success response
@@ -476,12 +682,53 @@ func (api *API) sendEmail(w http.ResponseWriter, r *http.Request) {
 		MessageID: email.MessageID,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, "Failed to encode response: "+err.Error(), http.StatusInternalServerError)
-		return
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// localAttachment describes a file on disk as an attachment, defaulting the filename to
+// the file's base name and detecting the content type when none is given
+func localAttachment(path string, filename string, contentType string) (models.Attachment, error) {
+	if path == "" {
+		return models.Attachment{}, fmt.Errorf("Attachment must have a path")
+	}
+
+	// Get file info for size
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return models.Attachment{}, fmt.Errorf("Invalid attachment path: %w", err)
 	}
+
+	attachment := models.Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        fileInfo.Size(),
+		Path:        path,
+	}
+
+	// Use default filename if not provided
+	if attachment.Filename == "" {
+		attachment.Filename = filepath.Base(path)
+	}
+
+	// Use default content type if not provided
+	if attachment.ContentType == "" {
+		// Try to detect content type
+		if file, err := os.Open(path); err == nil {
+			buffer := make([]byte, 512) // Only the first 512 bytes are used for detection
+			n, err := file.Read(buffer)
+			file.Close()
+			if err == nil {
+				attachment.ContentType = http.DetectContentType(buffer[:n])
+			}
+		}
+
+		// If detection failed, use a default
+		if attachment.ContentType == "" {
+			attachment.ContentType = "application/octet-stream"
+		}
+	}
+
+	return attachment, nil
 }
 
 // generateEmailID generates a unique ID for an email
@@ -491,8 +738,11 @@ func generateEmailID() string {
 
 // generateMessageID generates a Message-ID for an email
 func generateMessageID(fromEmail string) string {
-	host := strings.Split(fromEmail, "@")[1]
-	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), strings.Split(fromEmail, "@")[0], host)
+	local, host, ok := strings.Cut(fromEmail, "@")
+	if !ok {
+		host = "localhost"
+	}
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), local, host)
 }
 
 // generateAttachmentID generates a unique ID for an attachment
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// clientIDKey is the request context key holding the ID of the API client making a
+// request
+type clientIDKey struct{}
+
+// authenticate identifies the API client making each request by the bearer token in its
+// Authorization header. When client tokens are set, requests without a known token are
+// refused, except health checks.
+func (api *API) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(api.clientTokens) == 0 || r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		clientID := ""
+		if ok {
+			for clientToken, id := range api.clientTokens {
+				if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(clientToken)) == 1 {
+					clientID = id
+				}
+			}
+		}
+		if clientID == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "A valid API token is required", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIDKey{}, clientID)))
+	})
+}
+
+// requestClientID returns the ID of the API client making a request, or an empty
+// string when client tokens aren't set
+func requestClientID(r *http.Request) string {
+	clientID, _ := r.Context().Value(clientIDKey{}).(string)
+	return clientID
+}
+
+// requiresApproval reports whether the emails of an API client are held for approval
+func (api *API) requiresApproval(clientID string) bool {
+	return clientID != "" && api.approvalClients[clientID]
+}
+
+// handleApprovals handles requests to list the emails pending approval
+func (api *API) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	messages, err := api.store.PendingOutboxMessages(r.URL.Query().Get("account_id"))
+	if err != nil {
+		http.Error(w, "Failed to list approvals: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Messages []models.OutboxMessage `json:"messages"`
+	}{
+		Messages: []models.OutboxMessage{},
+	}
+	for _, message := range messages {
+		if message.Status == models.OutboxPendingApproval {
+			response.Messages = append(response.Messages, message)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleApprovalByID handles requests for a specific email pending approval
+func (api *API) handleApprovalByID(w http.ResponseWriter, r *http.Request) {
+	// The path should be in the format "/approvals/{id}" or "/approvals/{id}/{action}"
+	queueID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/approvals/"), "/")
+	if queueID == "" || strings.Contains(action, "/") {
+		http.Error(w, "Invalid queue ID", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			api.getApproval(w, queueID)
+		case http.MethodPut:
+			api.editApproval(w, r, queueID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case "approve", "reject":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		api.reviewApproval(w, r, queueID, action == "approve")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// getApproval handles GET requests for an outbox message and its audit trail
+func (api *API) getApproval(w http.ResponseWriter, queueID string) {
+	message, err := api.store.GetOutboxMessage(queueID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Outbox message not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve outbox message: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	audit, err := api.store.GetOutboxAuditEntries(queueID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve audit trail: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Message models.OutboxMessage      `json:"message"`
+		Audit   []models.OutboxAuditEntry `json:"audit"`
+	}{
+		Message: message,
+		Audit:   audit,
+	}
+	if response.Audit == nil {
+		response.Audit = []models.OutboxAuditEntry{}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// editApproval handles PUT requests to replace the content of an email pending approval
+func (api *API) editApproval(w http.ResponseWriter, r *http.Request, queueID string) {
+	reviewer, ok := api.reviewer(w, r)
+	if !ok {
+		return
+	}
+
+	var request composeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	message, err := api.store.GetOutboxMessage(queueID)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	// An email stays with its account and keeps its IDs and threading
+	request.AccountID = message.AccountID
+	email, err := request.email(message.Email.Folder)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	email.ID = message.Email.ID
+	email.MessageID = message.Email.MessageID
+	email.Headers = message.Email.Headers
+	email.Date = message.Email.Date
+	for i := range email.Attachments {
+		email.Attachments[i].EmailID = email.ID
+	}
+
+	if err := validateOutgoing(email); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry := models.OutboxAuditEntry{
+		Action:    models.AuditEdited,
+		Actor:     reviewer,
+		Email:     &email,
+		CreatedAt: time.Now(),
+	}
+	if err := api.store.EditPendingOutboxMessage(queueID, email, entry); err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	message.Email = email
+	writeJSON(w, http.StatusOK, message)
+}
+
+// reviewApproval handles POST requests to approve or reject an email pending approval.
+// An approved email is queued to be sent, at its send time if it was scheduled.
+func (api *API) reviewApproval(w http.ResponseWriter, r *http.Request, queueID string, approve bool) {
+	reviewer, ok := api.reviewer(w, r)
+	if !ok {
+		return
+	}
+
+	var reviewRequest struct {
+		Note string `json:"note,omitempty"`
+	}
+
+	// The body is optional
+	if err := json.NewDecoder(r.Body).Decode(&reviewRequest); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	message, err := api.store.GetOutboxMessage(queueID)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	now := time.Now()
+	entry := models.OutboxAuditEntry{
+		Action:    models.AuditRejected,
+		Actor:     reviewer,
+		Note:      reviewRequest.Note,
+		CreatedAt: now,
+	}
+	status := models.OutboxRejected
+	nextAttempt := message.NextAttempt
+	if approve {
+		entry.Action = models.AuditApproved
+		status = models.OutboxQueued
+		if message.SendAt == nil || message.SendAt.Before(now) {
+			nextAttempt = now
+		}
+	}
+
+	if err := api.store.ReviewOutboxMessage(queueID, status, nextAttempt, entry); err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	if approve {
+		api.notifyOutbox()
+	}
+
+	message.Status = status
+	message.NextAttempt = nextAttempt
+	writeJSON(w, http.StatusOK, message)
+}
+
+// reviewer returns the API client reviewing an email, or writes an error response and
+// returns false if clients aren't identified or the request comes from a client whose
+// own emails need approval
+func (api *API) reviewer(w http.ResponseWriter, r *http.Request) (string, bool) {
+	reviewer := requestClientID(r)
+	if reviewer == "" {
+		http.Error(w, "Reviewing emails requires API client tokens", http.StatusForbidden)
+		return "", false
+	}
+	if api.requiresApproval(reviewer) {
+		http.Error(w, "Client "+reviewer+" can't review emails", http.StatusForbidden)
+		return "", false
+	}
+	return reviewer, true
+}
+
+// writeReviewError writes the response for an error reviewing an outbox message
+func writeReviewError(w http.ResponseWriter, err error) {
+	switch err {
+	case sql.ErrNoRows:
+		http.Error(w, "Outbox message not found", http.StatusNotFound)
+	case store.ErrOutboxNotPendingApproval:
+		http.Error(w, "Failed to review outbox message: "+err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Failed to review outbox message: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// audit records an action on an outbox message. A failure is logged, since the action
+// itself has already succeeded.
+func (api *API) audit(message models.OutboxMessage, action string, actor string, note string, email *models.Email) {
+	entry := models.OutboxAuditEntry{
+		OutboxID:  message.ID,
+		Action:    action,
+		Actor:     actor,
+		Note:      note,
+		Email:     email,
+		CreatedAt: time.Now(),
+	}
+	if err := api.store.AddOutboxAuditEntry(entry); err != nil {
+		log.Printf("Warning: Failed to record %s of outbox message %s: %v", action, message.ID, err)
+	}
+}
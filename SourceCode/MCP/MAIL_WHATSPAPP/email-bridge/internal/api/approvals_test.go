@@ -0,0 +1,215 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// approvalStore keeps queued messages and their audit trail in memory
+type approvalStore struct {
+	*outboxStore
+	audit []models.OutboxAuditEntry
+}
+
+func (s *approvalStore) AddOutboxAuditEntry(entry models.OutboxAuditEntry) error {
+	s.audit = append(s.audit, entry)
+	return nil
+}
+
+func (s *approvalStore) GetOutboxAuditEntries(outboxID string) ([]models.OutboxAuditEntry, error) {
+	var entries []models.OutboxAuditEntry
+	for _, entry := range s.audit {
+		if entry.OutboxID == outboxID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (s *approvalStore) pending(id string) (models.OutboxMessage, error) {
+	message, ok := s.outbox[id]
+	if !ok {
+		return message, sql.ErrNoRows
+	}
+	if message.Status != models.OutboxPendingApproval {
+		return message, store.ErrOutboxNotPendingApproval
+	}
+	return message, nil
+}
+
+func (s *approvalStore) EditPendingOutboxMessage(id string, email models.Email, entry models.OutboxAuditEntry) error {
+	message, err := s.pending(id)
+	if err != nil {
+		return err
+	}
+	message.Email = email
+	s.outbox[id] = message
+	entry.OutboxID = id
+	return s.AddOutboxAuditEntry(entry)
+}
+
+func (s *approvalStore) ReviewOutboxMessage(id string, status string, nextAttempt time.Time, entry models.OutboxAuditEntry) error {
+	message, err := s.pending(id)
+	if err != nil {
+		return err
+	}
+	message.Status = status
+	message.NextAttempt = nextAttempt
+	s.outbox[id] = message
+	entry.OutboxID = id
+	if entry.Action == models.AuditApproved {
+		entry.Email = &message.Email
+	}
+	return s.AddOutboxAuditEntry(entry)
+}
+
+func TestApprovals(t *testing.T) {
+	s := &approvalStore{outboxStore: &outboxStore{outbox: make(map[string]models.OutboxMessage)}}
+	smtpClient := &fakeSMTPClient{}
+	api := NewAPI(s, nil, smtpClient)
+	notified := 0
+	api.notifyOutbox = func() { notified++ }
+	api.SetClientTokens(map[string]string{
+		"agent-token":     "agent",
+		"dashboard-token": "dashboard",
+		"alice-token":     "alice",
+		"bob-token":       "bob",
+	})
+	api.SetApprovalClients([]string{"agent"})
+	handler := api.SetupRoutes()
+
+	// Clients are identified by their tokens
+	request := func(method, path, clientID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if clientID != "" {
+			req.Header.Set("Authorization", "Bearer "+clientID+"-token")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	send := func(clientID string) string {
+		body := `{"from":{"email":"me@example.com"},"to":[{"email":"finance@example.com"}],"subject":"Summary","text_content":"Hi"}`
+		rec := request(http.MethodPost, "/emails", clientID, body)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d (%s)", http.StatusAccepted, rec.Code, rec.Body.String())
+		}
+		var response struct {
+			QueueID string `json:"queue_id"`
+			Status  string `json:"status"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return response.QueueID
+	}
+
+	// Emails of other clients are queued as usual
+	if id := send("dashboard"); s.outbox[id].Status != models.OutboxQueued || notified != 1 {
+		t.Fatalf("Expected the dashboard's email to be queued, got %s", s.outbox[id].Status)
+	}
+
+	// Leaving out the token or naming another client doesn't avoid approval
+	body := `{"from":{"email":"me@example.com"},"to":[{"email":"finance@example.com"}],"subject":"Summary","text_content":"Hi"}`
+	if rec := request(http.MethodPost, "/emails", "", body); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	if rec := request(http.MethodPost, "/emails", "mallory", body); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d with an unknown token, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	if len(s.outbox) != 1 {
+		t.Fatalf("Expected only the dashboard's email to be queued, got %d", len(s.outbox))
+	}
+
+	held := send("agent")
+	if s.outbox[held].Status != models.OutboxPendingApproval || notified != 1 {
+		t.Fatalf("Expected the agent's email to be held without waking the sender, got %s", s.outbox[held].Status)
+	}
+
+	rec := request(http.MethodGet, "/approvals", "alice", "")
+	var list struct {
+		Messages []models.OutboxMessage `json:"messages"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list.Messages) != 1 || list.Messages[0].ID != held {
+		t.Fatalf("Expected only the held email to be listed, got %+v (%v)", list.Messages, err)
+	}
+
+	// Reviewers must authenticate and can't be clients that need approval
+	if rec := request(http.MethodPost, "/approvals/"+held+"/approve", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	if rec := request(http.MethodPost, "/approvals/"+held+"/approve", "agent", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for the agent approving its own email, got %d", http.StatusForbidden, rec.Code)
+	}
+	if s.outbox[held].Status != models.OutboxPendingApproval {
+		t.Fatalf("Expected the email to still be held, got %s", s.outbox[held].Status)
+	}
+
+	body = `{"from":{"email":"me@example.com"},"to":[{"email":"finance@example.com"}],"subject":"Monthly summary","text_content":"Hi"}`
+	if rec := request(http.MethodPut, "/approvals/"+held, "alice", body); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d editing, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if email := s.outbox[held].Email; email.Subject != "Monthly summary" || email.ID == "" {
+		t.Errorf("Expected the edit to keep the email ID, got %+v", email)
+	}
+
+	if rec := request(http.MethodPost, "/approvals/"+held+"/approve", "alice", `{"note":"fine"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d approving, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if s.outbox[held].Status != models.OutboxQueued || notified != 2 {
+		t.Errorf("Expected the approved email to be queued and the sender woken, got %s", s.outbox[held].Status)
+	}
+	if rec := request(http.MethodPost, "/approvals/"+held+"/reject", "alice", ""); rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d rejecting an approved email, got %d", http.StatusConflict, rec.Code)
+	}
+
+	rec = request(http.MethodGet, "/approvals/"+held, "alice", "")
+	var detail struct {
+		Audit []models.OutboxAuditEntry `json:"audit"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&detail); err != nil || len(detail.Audit) != 3 {
+		t.Fatalf("Expected 3 audit entries, got %+v (%v)", detail.Audit, err)
+	}
+	submitted, approved := detail.Audit[0], detail.Audit[2]
+	if submitted.Action != models.AuditSubmitted || submitted.Actor != "agent" || submitted.Email.Subject != "Summary" {
+		t.Errorf("Unexpected submission entry %+v", submitted)
+	}
+	if approved.Action != models.AuditApproved || approved.Actor != "alice" || approved.Note != "fine" || approved.Email.Subject != "Monthly summary" {
+		t.Errorf("Unexpected approval entry %+v", approved)
+	}
+
+	rejected := send("agent")
+	if rec := request(http.MethodPost, "/approvals/"+rejected+"/reject", "bob", `{"note":"wrong recipient"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d rejecting, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if s.outbox[rejected].Status != models.OutboxRejected || notified != 2 {
+		t.Errorf("Expected the email to be rejected without waking the sender, got %s", s.outbox[rejected].Status)
+	}
+	if rec := request(http.MethodPost, "/approvals/missing/approve", "bob", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing message, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	// The client that submitted an email can withdraw it while it is pending approval
+	withdrawn := send("agent")
+	if rec := request(http.MethodDelete, "/outbox/"+withdrawn, "agent", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d withdrawing, got %d (%s)", http.StatusNoContent, rec.Code, rec.Body.String())
+	}
+	if s.outbox[withdrawn].Status != models.OutboxCancelled {
+		t.Errorf("Expected the withdrawn email to be cancelled, got %s", s.outbox[withdrawn].Status)
+	}
+	if entries, _ := s.GetOutboxAuditEntries(withdrawn); len(entries) != 2 ||
+		entries[1].Action != models.AuditCancelled || entries[1].Actor != "agent" {
+		t.Errorf("Expected the withdrawal to be recorded, got %+v", entries)
+	}
+
+	if len(smtpClient.sent) != 0 {
+		t.Errorf("Expected nothing to be sent by the requests, got %d", len(smtpClient.sent))
+	}
+}
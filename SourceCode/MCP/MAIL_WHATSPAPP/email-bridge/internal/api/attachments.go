@@ -0,0 +1,144 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/models"
+)
+
+// handleAttachments handles attachment requests
+func (api *API) handleAttachments(w http.ResponseWriter, r *http.Request) {
+	// The path should be in the format "/attachments/{id}" or "/attachments/{id}/preview"
+	attachmentID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/attachments/"), "/")
+	if attachmentID == "" || (action != "" && action != "preview") {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if action == "preview" {
+		api.previewAttachment(w, r, attachmentID)
+		return
+	}
+	api.downloadAttachment(w, r, attachmentID)
+}
+
+// localAttachment returns an attachment, fetching it from the IMAP server when it is
+// not available locally. It writes the error response and returns false on failure.
+func (api *API) localAttachment(w http.ResponseWriter, attachmentID string) (models.Attachment, bool) {
+	attachment, err := api.store.GetAttachment(attachmentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve attachment: "+err.Error(), http.StatusInternalServerError)
+		}
+		return attachment, false
+	}
+
+	if !fileExists(attachment.Path) {
+		attachment, err = api.cacheAttachment(attachment)
+		if err != nil {
+			http.Error(w, "Failed to download attachment: "+err.Error(), http.StatusBadGateway)
+			return attachment, false
+		}
+	}
+
+	return attachment, true
+}
+
+// downloadAttachment streams the content of an attachment, serving it from disk when
+// it has already been stored and fetching it from the IMAP server otherwise
+func (api *API) downloadAttachment(w http.ResponseWriter, r *http.Request, attachmentID string) {
+	attachment, ok := api.localAttachment(w, attachmentID)
+	if !ok {
+		return
+	}
+
+	file, err := os.Open(attachment.Path)
+	if err != nil {
+		http.Error(w, "Failed to open attachment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, "Failed to read attachment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", attachment.Filename))
+	http.ServeContent(w, r, attachment.Filename, info.ModTime(), file)
+}
+
+// cacheAttachment fetches an attachment from the IMAP server by the UID of its email and
+// its body section, writes it to the attachment directory and records the path and hash
+// in the store
+func (api *API) cacheAttachment(attachment models.Attachment) (models.Attachment, error) {
+	email, err := api.store.GetEmail(attachment.EmailID)
+	if err != nil {
+		return attachment, fmt.Errorf("failed to get email %s: %w", attachment.EmailID, err)
+	}
+
+	imapClient, err := api.connectedIMAPClient(email.AccountID)
+	if err != nil {
+		return attachment, err
+	}
+
+	content, err := imapClient.GetAttachment(email.Folder, attachment)
+	if err != nil {
+		return attachment, err
+	}
+	defer content.Close()
+
+	// Attachments are stored by content, so one received many times is stored once
+	path, hash, size, err := client.NewAttachmentStore(api.attachmentDir).Save(content)
+	if err != nil {
+		return attachment, err
+	}
+
+	attachment.Path = path
+	attachment.Hash = hash
+	attachment.Size = size
+	if err := api.store.StoreAttachment(attachment); err != nil {
+		// The file is in place and can still be served, so only log the failure
+		log.Printf("Warning: Failed to store attachment path: %v", err)
+	}
+
+	return attachment, nil
+}
+
+// contentDisposition formats a Content-Disposition header value, encoding non-ASCII filenames
+func contentDisposition(disposition string, filename string) string {
+	if filename == "" {
+		return disposition
+	}
+	return mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+}
+
+// fileExists reports whether a regular file exists at the given path
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
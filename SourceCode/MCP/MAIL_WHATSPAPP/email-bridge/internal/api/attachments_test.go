@@ -0,0 +1,162 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// attachmentStore implements the attachment operations of store.Store
+type attachmentStore struct {
+	store.Store
+	emails      map[string]models.Email
+	attachments map[string]models.Attachment
+}
+
+func (s *attachmentStore) GetEmail(id string) (models.Email, error) {
+	email, ok := s.emails[id]
+	if !ok {
+		return email, sql.ErrNoRows
+	}
+	return email, nil
+}
+
+func (s *attachmentStore) GetAttachment(id string) (models.Attachment, error) {
+	attachment, ok := s.attachments[id]
+	if !ok {
+		return attachment, sql.ErrNoRows
+	}
+	return attachment, nil
+}
+
+func (s *attachmentStore) StoreAttachment(attachment models.Attachment) error {
+	s.attachments[attachment.ID] = attachment
+	return nil
+}
+
+func TestDownloadAttachmentFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.pdf")
+	if err := os.WriteFile(path, []byte("stored content"), 0600); err != nil {
+		t.Fatalf("Failed to write attachment file: %v", err)
+	}
+
+	s := &attachmentStore{
+		attachments: map[string]models.Attachment{
+			"disk-account-1-1": {
+				ID:          "disk-account-1-1",
+				EmailID:     "disk-account-1",
+				Filename:    "report.pdf",
+				ContentType: "application/pdf",
+				Path:        path,
+			},
+		},
+	}
+
+	// No IMAP client is registered, so the content can only come from disk
+	handler := NewAPI(s, nil, nil).SetupRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/attachments/disk-account-1-1", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("Expected Content-Type application/pdf, got %s", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename=report.pdf" {
+		t.Errorf("Unexpected Content-Disposition %q", got)
+	}
+	if rec.Body.String() != "stored content" {
+		t.Errorf("Expected the stored content, got %q", rec.Body.String())
+	}
+}
+
+func TestDownloadAttachmentFromServer(t *testing.T) {
+	s := &attachmentStore{
+		emails: map[string]models.Email{
+			"cache-account-5": {ID: "cache-account-5", AccountID: "cache-account", Folder: "INBOX"},
+		},
+		attachments: map[string]models.Attachment{
+			"cache-account-5-1": {
+				ID:          "cache-account-5-1",
+				EmailID:     "cache-account-5",
+				Filename:    "data.csv",
+				ContentType: "text/csv",
+				Section:     "2",
+			},
+		},
+	}
+
+	imapClient := &fakeIMAPClient{attachments: map[string]string{"cache-account-5-1": "a,b\n1,2\n"}}
+	api := newTestAPI(t, "cache-account", imapClient, s)
+	api.SetAttachmentDir(t.TempDir())
+	handler := api.SetupRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/attachments/cache-account-5-1", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/csv" {
+		t.Errorf("Expected Content-Type text/csv, got %s", got)
+	}
+	if rec.Body.String() != "a,b\n1,2\n" {
+		t.Errorf("Expected the server content, got %q", rec.Body.String())
+	}
+
+	// The content is cached on disk and the path recorded in the store
+	cached := s.attachments["cache-account-5-1"]
+	if !strings.HasPrefix(cached.Path, api.attachmentDir) {
+		t.Fatalf("Expected the attachment to be cached under %s, got path %q", api.attachmentDir, cached.Path)
+	}
+	data, err := os.ReadFile(cached.Path)
+	if err != nil {
+		t.Fatalf("Failed to read cached attachment: %v", err)
+	}
+	if string(data) != "a,b\n1,2\n" {
+		t.Errorf("Unexpected cached content %q", string(data))
+	}
+	if cached.Size != int64(len(data)) {
+		t.Errorf("Expected size %d, got %d", len(data), cached.Size)
+	}
+}
+
+func TestDownloadAttachmentNotFound(t *testing.T) {
+	s := &attachmentStore{attachments: map[string]models.Attachment{}}
+	handler := NewAPI(s, nil, nil).SetupRoutes()
+
+	tests := []struct {
+		method string
+		target string
+		want   int
+	}{
+		{http.MethodGet, "/attachments/missing-1-1", http.StatusNotFound},
+		{http.MethodGet, "/attachments/", http.StatusBadRequest},
+		{http.MethodGet, "/attachments/a/b", http.StatusBadRequest},
+		{http.MethodPost, "/attachments/missing-1-1", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d (%s)", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
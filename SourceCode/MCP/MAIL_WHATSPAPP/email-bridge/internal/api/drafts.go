@@ -0,0 +1,367 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/models"
+)
+
+// draftsFolder is the local folder of drafts that aren't on the server
+const draftsFolder = "Drafts"
+
+// draftRequest is the body of requests that create or edit a draft
+type draftRequest struct {
+	composeRequest
+	// InReplyTo is the ID of a stored email the draft replies to. The draft is
+	// threaded with it, and its subject and recipients default to those of a reply.
+	InReplyTo string `json:"in_reply_to,omitempty"`
+}
+
+// handleDrafts handles draft requests
+func (api *API) handleDrafts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.listDrafts(w, r)
+	case http.MethodPost:
+		api.createDraft(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDraftByID handles requests for a specific draft
+func (api *API) handleDraftByID(w http.ResponseWriter, r *http.Request) {
+	// The path should be in the format "/drafts/{id}" or "/drafts/{id}/send"
+	draftID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/drafts/"), "/")
+	if draftID == "" || strings.Contains(action, "/") {
+		http.Error(w, "Invalid draft ID", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			api.getDraft(w, draftID)
+		case http.MethodPut:
+			api.updateDraft(w, r, draftID)
+		case http.MethodDelete:
+			api.deleteDraft(w, draftID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case "send":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		api.sendDraft(w, r, draftID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// listDrafts handles GET requests to list drafts, optionally of one account
+func (api *API) listDrafts(w http.ResponseWriter, r *http.Request) {
+	drafts, err := api.store.GetDrafts(r.URL.Query().Get("account_id"))
+	if err != nil {
+		http.Error(w, "Failed to list drafts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Drafts []models.Draft `json:"drafts"`
+	}{
+		Drafts: drafts,
+	}
+	if response.Drafts == nil {
+		response.Drafts = []models.Draft{}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getDraft handles GET requests for a draft
+func (api *API) getDraft(w http.ResponseWriter, draftID string) {
+	draft, ok := api.storedDraft(w, draftID)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, draft)
+}
+
+// createDraft handles POST requests to save a new draft
+func (api *API) createDraft(w http.ResponseWriter, r *http.Request) {
+	var request draftRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	email, ok := api.draftEmail(w, request)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	draft := models.Draft{
+		ID:        generateDraftID(),
+		AccountID: email.AccountID,
+		Email:     email,
+		Revision:  1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	draft, err := api.saveDraft(draft)
+	if err != nil {
+		http.Error(w, "Failed to save draft: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, draft)
+}
+
+// updateDraft handles PUT requests to replace the content of a draft with a new revision
+func (api *API) updateDraft(w http.ResponseWriter, r *http.Request, draftID string) {
+	draft, ok := api.storedDraft(w, draftID)
+	if !ok {
+		return
+	}
+
+	var request draftRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A draft stays with its account
+	request.AccountID = draft.AccountID
+
+	email, ok := api.draftEmail(w, request)
+	if !ok {
+		return
+	}
+
+	// The email keeps its IDs across revisions, and its threading unless the
+	// revision replies to another email
+	email.ID = draft.Email.ID
+	email.MessageID = draft.Email.MessageID
+	if request.InReplyTo == "" {
+		email.Headers = draft.Email.Headers
+	}
+	for i := range email.Attachments {
+		email.Attachments[i].EmailID = email.ID
+	}
+
+	draft.Email = email
+	draft.Revision++
+	draft.UpdatedAt = time.Now()
+
+	draft, err := api.saveDraft(draft)
+	if err != nil {
+		http.Error(w, "Failed to save draft: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, draft)
+}
+
+// deleteDraft handles DELETE requests to discard a draft
+func (api *API) deleteDraft(w http.ResponseWriter, draftID string) {
+	draft, ok := api.storedDraft(w, draftID)
+	if !ok {
+		return
+	}
+
+	if err := api.removeDraft(draft); err != nil {
+		http.Error(w, "Failed to delete draft: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendDraft handles POST requests to send a draft. It is queued in the outbox like
+// emails sent with POST /emails, then deleted.
+func (api *API) sendDraft(w http.ResponseWriter, r *http.Request, draftID string) {
+	var sendRequest struct {
+		SendAt *time.Time `json:"send_at,omitempty"` // RFC 3339; omitted to send now
+	}
+
+	// The body is optional
+	if err := json.NewDecoder(r.Body).Decode(&sendRequest); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	draft, ok := api.storedDraft(w, draftID)
+	if !ok {
+		return
+	}
+
+	if err := validateOutgoing(draft.Email); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !api.checkOutboxClient(w, draft.AccountID) {
+		return
+	}
+
+	// The sent email is a new email in the Sent folder
+	email := draft.Email
+	email.ID = generateEmailID()
+	email.Folder = "Sent"
+	email.Date = time.Now()
+	email.Attachments = make([]models.Attachment, len(draft.Email.Attachments))
+	for i, attachment := range draft.Email.Attachments {
+		attachment.ID = generateAttachmentID()
+		attachment.EmailID = email.ID
+		email.Attachments[i] = attachment
+	}
+
+	message, err := api.addToOutbox(email, sendRequest.SendAt, requestClientID(r))
+	if err != nil {
+		http.Error(w, "Failed to queue email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The email is queued, so the draft is no longer needed
+	if err := api.removeDraft(draft); err != nil {
+		log.Printf("Warning: Failed to delete sent draft %s: %v", draft.ID, err)
+	}
+
+	writeQueued(w, message)
+}
+
+// draftEmail creates the email of a draft request. It writes an error response and
+// returns false if the request is invalid.
+func (api *API) draftEmail(w http.ResponseWriter, request draftRequest) (models.Email, bool) {
+	var original models.Email
+	if request.InReplyTo != "" {
+		var ok bool
+		if original, ok = api.storedEmail(w, request.InReplyTo); !ok {
+			return original, false
+		}
+		if request.AccountID == "" {
+			request.AccountID = original.AccountID
+		}
+	}
+
+	smtpClient, ok := api.smtpClientForAccount(request.AccountID)
+	if !ok {
+		http.Error(w, fmt.Sprintf("%v: %s", errAccountNotFound, request.AccountID), http.StatusNotFound)
+		return models.Email{}, false
+	}
+
+	request.From = senderAddress(request.From, smtpClient)
+	if request.From.Email == "" {
+		http.Error(w, "Draft must have a sender", http.StatusBadRequest)
+		return models.Email{}, false
+	}
+
+	if request.InReplyTo != "" {
+		if request.Subject == "" {
+			request.Subject = client.PrefixSubject("Re:", original.Subject)
+		}
+		if len(request.To) == 0 && len(request.Cc) == 0 && len(request.Bcc) == 0 {
+			request.To, _ = replyRecipients(original, request.From.Email, false)
+		}
+	}
+
+	email, err := request.email(draftsFolder)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return email, false
+	}
+	if request.InReplyTo != "" {
+		email.Headers = threadHeaders(original)
+	}
+
+	return email, true
+}
+
+// saveDraft stores a revision of a draft and appends it to the Drafts folder on the
+// server, then removes the previous revision from the server. If the revision can't
+// be appended, the draft is only saved locally and the previous revision is kept.
+func (api *API) saveDraft(draft models.Draft) (models.Draft, error) {
+	previous := draft
+
+	if imapClient, _ := api.imapClientForAccount(draft.AccountID); imapClient != nil {
+		folder, emailID, err := client.AppendDraft(imapClient, draft.Email)
+		if err != nil {
+			log.Printf("Warning: Failed to store draft %s on the server: %v", draft.ID, err)
+		} else {
+			draft.Folder = folder
+			draft.EmailID = emailID
+		}
+	}
+
+	if err := api.store.StoreDraft(draft); err != nil {
+		return draft, err
+	}
+
+	if previous.EmailID != "" && previous.EmailID != draft.EmailID {
+		api.removeDraftRevision(previous)
+	}
+
+	return draft, nil
+}
+
+// removeDraft deletes a draft along with its revision on the server
+func (api *API) removeDraft(draft models.Draft) error {
+	if err := api.store.DeleteDraft(draft.ID); err != nil {
+		return err
+	}
+
+	api.removeDraftRevision(draft)
+	return nil
+}
+
+// removeDraftRevision removes the revision of a draft from the server. A revision
+// that can't be removed is left behind with a warning.
+func (api *API) removeDraftRevision(draft models.Draft) {
+	if draft.Folder == "" || draft.EmailID == "" {
+		return
+	}
+
+	imapClient, _ := api.imapClientForAccount(draft.AccountID)
+	if imapClient == nil {
+		return
+	}
+
+	if err := client.RemoveDraft(api.store, imapClient, draft.Folder, draft.EmailID); err != nil {
+		log.Printf("Warning: Failed to remove revision %s of draft %s from the server: %v", draft.EmailID, draft.ID, err)
+	}
+}
+
+// storedDraft returns a draft from the store, or writes an error response and returns
+// false if it can't be retrieved
+func (api *API) storedDraft(w http.ResponseWriter, draftID string) (models.Draft, bool) {
+	draft, err := api.store.GetDraft(draftID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Draft not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve draft: "+err.Error(), http.StatusInternalServerError)
+		}
+		return draft, false
+	}
+
+	return draft, true
+}
+
+// generateDraftID generates a unique ID for a draft
+func generateDraftID() string {
+	return fmt.Sprintf("draft_%d", time.Now().UnixNano())
+}
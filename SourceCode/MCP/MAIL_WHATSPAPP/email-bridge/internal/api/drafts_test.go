@@ -0,0 +1,156 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+// draftStore keeps drafts and queued messages in memory
+type draftStore struct {
+	*outboxStore
+	drafts map[string]models.Draft
+	emails map[string]models.Email
+}
+
+func (s *draftStore) StoreDraft(draft models.Draft) error {
+	s.drafts[draft.ID] = draft
+	return nil
+}
+
+func (s *draftStore) GetDraft(id string) (models.Draft, error) {
+	draft, ok := s.drafts[id]
+	if !ok {
+		return draft, sql.ErrNoRows
+	}
+	return draft, nil
+}
+
+func (s *draftStore) GetDrafts(accountID string) ([]models.Draft, error) {
+	var drafts []models.Draft
+	for _, draft := range s.drafts {
+		drafts = append(drafts, draft)
+	}
+	return drafts, nil
+}
+
+func (s *draftStore) DeleteDraft(id string) error {
+	if _, ok := s.drafts[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(s.drafts, id)
+	return nil
+}
+
+func (s *draftStore) GetEmail(id string) (models.Email, error) {
+	email, ok := s.emails[id]
+	if !ok {
+		return email, sql.ErrNoRows
+	}
+	return email, nil
+}
+
+func TestDrafts(t *testing.T) {
+	s := &draftStore{
+		outboxStore: &outboxStore{outbox: make(map[string]models.OutboxMessage)},
+		drafts:      make(map[string]models.Draft),
+		emails: map[string]models.Email{
+			"account-9": {
+				ID:        "account-9",
+				MessageID: "<invoice@example.com>",
+				From:      models.Address{Email: "vendor@example.com"},
+				To:        []models.Address{{Email: "me@example.com"}},
+				Subject:   "Invoice 42",
+			},
+		},
+	}
+	imapClient := &fakeIMAPClient{folders: []models.Folder{
+		{Name: "INBOX", IsInbox: true, CanSelect: true},
+		{Name: "Brouillons", IsDrafts: true, CanSelect: true},
+	}}
+	smtpClient := &fakeSMTPClient{sender: "me@example.com"}
+	api := NewAPI(s, imapClient, smtpClient)
+	api.notifyOutbox = func() {}
+	handler := api.SetupRoutes()
+
+	serve := func(method, target, body string, want int, v interface{}) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		if rec.Code != want {
+			t.Fatalf("%s %s: expected status %d, got %d (%s)", method, target, want, rec.Code, rec.Body.String())
+		}
+		if v != nil {
+			if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+	}
+
+	// A reply staged as a draft is threaded and addressed like a reply
+	var draft models.Draft
+	serve(http.MethodPost, "/drafts", `{"in_reply_to":"account-9","text_content":"Paid."}`, http.StatusCreated, &draft)
+	if draft.Email.Subject != "Re: Invoice 42" || draft.Email.From.Email != "me@example.com" ||
+		len(draft.Email.To) != 1 || draft.Email.To[0].Email != "vendor@example.com" ||
+		draft.Email.Headers["In-Reply-To"] != "<invoice@example.com>" {
+		t.Errorf("Unexpected reply draft %+v", draft.Email)
+	}
+	if draft.Revision != 1 || draft.Folder != "Brouillons" || draft.EmailID != "account-1" {
+		t.Errorf("Expected the draft to be appended to Brouillons, got %+v", draft)
+	}
+	if !reflect.DeepEqual(imapClient.appended, []string{`Brouillons/\Draft \Seen`}) {
+		t.Errorf("Unexpected appended messages %v", imapClient.appended)
+	}
+
+	// An edit replaces the previous revision on the server and keeps the threading
+	var edited models.Draft
+	serve(http.MethodPut, "/drafts/"+draft.ID, `{"to":[{"email":"accounts@example.com"}],"subject":"Re: Invoice 42","text_content":"Paid in full."}`, http.StatusOK, &edited)
+	if edited.Revision != 2 || edited.EmailID != "account-2" || edited.Email.TextContent != "Paid in full." {
+		t.Errorf("Unexpected edited draft %+v", edited)
+	}
+	if edited.Email.ID != draft.Email.ID || edited.Email.Headers["In-Reply-To"] != "<invoice@example.com>" {
+		t.Errorf("Expected the edit to keep the email's IDs and threading, got %+v", edited.Email)
+	}
+	if !reflect.DeepEqual(imapClient.expunged, []string{"Brouillons/account-1"}) {
+		t.Errorf("Expected the first revision to be expunged, got %v", imapClient.expunged)
+	}
+
+	var list struct {
+		Drafts []models.Draft `json:"drafts"`
+	}
+	serve(http.MethodGet, "/drafts", "", http.StatusOK, &list)
+	if len(list.Drafts) != 1 || list.Drafts[0].Revision != 2 {
+		t.Errorf("Expected the edited draft to be listed, got %+v", list.Drafts)
+	}
+
+	// Sending queues the email and deletes the draft
+	var queued struct {
+		QueueID string `json:"queue_id"`
+	}
+	serve(http.MethodPost, "/drafts/"+draft.ID+"/send", "", http.StatusAccepted, &queued)
+	message := s.outbox[queued.QueueID]
+	if message.Email.Folder != "Sent" || message.Email.TextContent != "Paid in full." || message.Email.MessageID != draft.Email.MessageID {
+		t.Errorf("Unexpected queued email %+v", message.Email)
+	}
+	if _, ok := s.drafts[draft.ID]; ok {
+		t.Error("Expected the sent draft to be deleted")
+	}
+	if !reflect.DeepEqual(imapClient.expunged, []string{"Brouillons/account-1", "Brouillons/account-2"}) {
+		t.Errorf("Expected the sent revision to be expunged, got %v", imapClient.expunged)
+	}
+	serve(http.MethodGet, "/drafts/"+draft.ID, "", http.StatusNotFound, nil)
+
+	// A draft that can't be sent yet is kept
+	serve(http.MethodPost, "/drafts", `{"subject":"Notes"}`, http.StatusCreated, &draft)
+	serve(http.MethodPost, "/drafts/"+draft.ID+"/send", "", http.StatusUnprocessableEntity, nil)
+	serve(http.MethodDelete, "/drafts/"+draft.ID, "", http.StatusNoContent, nil)
+	if len(s.drafts) != 0 || len(s.outbox) != 1 {
+		t.Errorf("Expected the draft to be discarded without sending, got %d drafts and %d queued", len(s.drafts), len(s.outbox))
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/models"
+)
+
+// updateEmail handles PUT requests to change the read status or folder of an email on
+// the server. The field is the one the path names ("status" or "folder"), or "" for either.
+func (api *API) updateEmail(w http.ResponseWriter, r *http.Request, emailID string, field string) {
+	var updateRequest struct {
+		IsRead *bool  `json:"is_read"`
+		Folder string `json:"folder"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&updateRequest); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case field == "status" && updateRequest.IsRead == nil:
+		http.Error(w, "Status update requires is_read", http.StatusBadRequest)
+		return
+	case field == "folder" && updateRequest.Folder == "":
+		http.Error(w, "Folder update requires folder", http.StatusBadRequest)
+		return
+	case updateRequest.IsRead == nil && updateRequest.Folder == "":
+		http.Error(w, "Email update requires is_read or folder", http.StatusBadRequest)
+		return
+	}
+
+	email, ok := api.storedEmail(w, emailID)
+	if !ok {
+		return
+	}
+
+	imapClient, err := api.connectedIMAPClient(email.AccountID)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	eventHandler := client.GetEmailEventHandler(api.store)
+
+	if updateRequest.IsRead != nil {
+		if *updateRequest.IsRead {
+			err = imapClient.MarkAsRead(email.Folder, email.ID)
+		} else {
+			err = imapClient.MarkAsUnread(email.Folder, email.ID)
+		}
+		if err != nil {
+			http.Error(w, "Failed to update email status: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Update the local database and notify listeners
+		if err := eventHandler.HandleStatusChange(email.ID, models.EmailStatus{IsRead: *updateRequest.IsRead}); err != nil {
+			http.Error(w, "Email status was updated on the server but the local store was not updated: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		email.IsRead = *updateRequest.IsRead
+	}
+
+	if updateRequest.Folder != "" && updateRequest.Folder != email.Folder {
+		newEmailID, err := imapClient.MoveEmail(email.Folder, email.ID, updateRequest.Folder)
+		if err != nil {
+			http.Error(w, "Failed to move email: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Update the local database and notify listeners
+		if err := eventHandler.HandleEmailMoved(email.ID, newEmailID, email.Folder, updateRequest.Folder); err != nil {
+			http.Error(w, "Email was moved on the server but the local store was not updated: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if newEmailID != "" {
+			email.ID = newEmailID
+		}
+		email.Folder = updateRequest.Folder
+	}
+
+	response := struct {
+		Success bool   `json:"success"`
+		EmailID string `json:"email_id"`
+		Folder  string `json:"folder"`
+		IsRead  bool   `json:"is_read"`
+	}{
+		Success: true,
+		EmailID: email.ID,
+		Folder:  email.Folder,
+		IsRead:  email.IsRead,
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// deleteEmail handles DELETE requests to move an email to the trash folder, or
+// expunge it when the server has none or it is already in the trash
+func (api *API) deleteEmail(w http.ResponseWriter, r *http.Request, emailID string) {
+	email, ok := api.storedEmail(w, emailID)
+	if !ok {
+		return
+	}
+
+	imapClient, err := api.connectedIMAPClient(email.AccountID)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	if err := imapClient.DeleteEmail(email.Folder, email.ID); err != nil {
+		http.Error(w, "Failed to delete email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Update the local database and notify listeners. A copy moved to the trash
+	// folder is stored again when that folder is synchronized.
+	eventHandler := client.GetEmailEventHandler(api.store)
+	if err := eventHandler.HandleDeletedEmail(email.ID); err != nil {
+		http.Error(w, "Email was deleted on the server but the local store was not updated: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storedEmail loads an email from the store, writing a 404 or 500 response on failure
+func (api *API) storedEmail(w http.ResponseWriter, emailID string) (models.Email, bool) {
+	email, err := api.store.GetEmail(emailID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Email not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve email: "+err.Error(), http.StatusInternalServerError)
+		}
+		return email, false
+	}
+
+	return email, true
+}
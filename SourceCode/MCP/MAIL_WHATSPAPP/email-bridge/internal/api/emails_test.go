@@ -0,0 +1,169 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// emailStore implements the email operations of store.Store
+type emailStore struct {
+	store.Store
+	emails map[string]models.Email
+}
+
+func (s *emailStore) StoreEmail(email models.Email) error {
+	s.emails[email.ID] = email
+	return nil
+}
+
+func (s *emailStore) GetEmail(id string) (models.Email, error) {
+	email, ok := s.emails[id]
+	if !ok {
+		return email, sql.ErrNoRows
+	}
+	return email, nil
+}
+
+func (s *emailStore) UpdateEmailStatus(id string, status models.EmailStatus) error {
+	email := s.emails[id]
+	email.IsRead = status.IsRead
+	s.emails[id] = email
+	return nil
+}
+
+func (s *emailStore) MoveEmail(id string, folder string) error {
+	email := s.emails[id]
+	email.Folder = folder
+	s.emails[id] = email
+	return nil
+}
+
+func (s *emailStore) DeleteEmail(id string) error {
+	delete(s.emails, id)
+	return nil
+}
+
+// newEmailTestStore returns a store holding the unread INBOX email "ops-account-7"
+func newEmailTestStore() *emailStore {
+	return &emailStore{emails: map[string]models.Email{
+		"ops-account-7": {ID: "ops-account-7", AccountID: "ops-account", Folder: "INBOX"},
+	}}
+}
+
+func TestUpdateEmailStatus(t *testing.T) {
+	s := newEmailTestStore()
+	imapClient := &fakeIMAPClient{}
+	handler := newTestAPI(t, "ops-account", imapClient, s).SetupRoutes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/emails/ops-account-7/status", strings.NewReader(`{"is_read": true}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if len(imapClient.read) != 1 || imapClient.read[0] != "INBOX/ops-account-7" {
+		t.Errorf("Expected the email to be marked as read on the server, got %v", imapClient.read)
+	}
+	if !s.emails["ops-account-7"].IsRead {
+		t.Error("Expected the stored email to be marked as read")
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/emails/ops-account-7", strings.NewReader(`{"is_read": false}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if len(imapClient.unread) != 1 || s.emails["ops-account-7"].IsRead {
+		t.Errorf("Expected the email to be marked as unread, got %v", imapClient.unread)
+	}
+}
+
+func TestMoveEmailFolder(t *testing.T) {
+	s := newEmailTestStore()
+	imapClient := &fakeIMAPClient{movedID: "ops-account-31"}
+	handler := newTestAPI(t, "ops-account", imapClient, s).SetupRoutes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/emails/ops-account-7/folder", strings.NewReader(`{"folder": "Archive"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if len(imapClient.moved) != 1 || imapClient.moved[0] != "INBOX/ops-account-7" {
+		t.Errorf("Expected the email to be moved on the server, got %v", imapClient.moved)
+	}
+
+	var response struct {
+		EmailID string `json:"email_id"`
+		Folder  string `json:"folder"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.EmailID != "ops-account-31" || response.Folder != "Archive" {
+		t.Errorf("Unexpected response %+v", response)
+	}
+
+	// The stored email is re-keyed to its UID in the new folder
+	if _, ok := s.emails["ops-account-7"]; ok {
+		t.Error("Expected the old email ID to be removed from the store")
+	}
+	if s.emails["ops-account-31"].Folder != "Archive" {
+		t.Errorf("Expected the stored email to be in Archive, got %+v", s.emails["ops-account-31"])
+	}
+}
+
+func TestDeleteEmail(t *testing.T) {
+	s := newEmailTestStore()
+	imapClient := &fakeIMAPClient{}
+	handler := newTestAPI(t, "ops-account", imapClient, s).SetupRoutes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/emails/ops-account-7", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusNoContent, rec.Code, rec.Body.String())
+	}
+	if len(imapClient.deletedEmails) != 1 || imapClient.deletedEmails[0] != "INBOX/ops-account-7" {
+		t.Errorf("Expected the email to be deleted on the server, got %v", imapClient.deletedEmails)
+	}
+	if _, ok := s.emails["ops-account-7"]; ok {
+		t.Error("Expected the email to be removed from the store")
+	}
+}
+
+func TestEmailUpdateRequestErrors(t *testing.T) {
+	handler := newTestAPI(t, "ops-account", &fakeIMAPClient{}, newEmailTestStore()).SetupRoutes()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"invalid body", http.MethodPut, "/emails/ops-account-7", `{`, http.StatusBadRequest},
+		{"empty update", http.MethodPut, "/emails/ops-account-7", `{}`, http.StatusBadRequest},
+		{"status without is_read", http.MethodPut, "/emails/ops-account-7/status", `{"folder": "Archive"}`, http.StatusBadRequest},
+		{"folder without folder", http.MethodPut, "/emails/ops-account-7/folder", `{"is_read": true}`, http.StatusBadRequest},
+		{"unknown email", http.MethodPut, "/emails/ops-account-8/status", `{"is_read": true}`, http.StatusNotFound},
+		{"delete unknown email", http.MethodDelete, "/emails/ops-account-8", "", http.StatusNotFound},
+		{"unknown action", http.MethodPut, "/emails/ops-account-7/flags", `{}`, http.StatusNotFound},
+		{"action method", http.MethodPost, "/emails/ops-account-7/status", `{}`, http.StatusMethodNotAllowed},
+		{"nested path", http.MethodPut, "/emails/ops-account-7/status/x", `{}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d (%s)", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/user/email-bridge/internal/events"
+	"github.com/user/email-bridge/internal/models"
+	"golang.org/x/net/websocket"
+)
+
+// handleEvents handles GET requests to stream email and folder events as Server-Sent
+// Events. The account_id and folder parameters filter the events. A client resumes
+// after the event in the Last-Event-ID header, which browsers send when they
+// reconnect, or in the last_event_id parameter; without either it gets live events
+// only.
+func (api *API) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, afterID, ok := api.eventStreamRequest(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Keep reverse proxies such as nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(event models.Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	heartbeat := func() error {
+		if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	// The stream ends when the client goes away. A client that fell behind reconnects
+	// and resumes from its last event.
+	api.eventHub.Stream(r.Context(), filter, afterID, send, heartbeat)
+}
+
+// handleEventsWebSocket handles GET requests to stream email and folder events over a
+// WebSocket, with the same parameters as handleEvents. Each event is sent as a JSON
+// text message, and idle connections get ping frames.
+func (api *API) handleEventsWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, afterID, ok := api.eventStreamRequest(w, r)
+	if !ok {
+		return
+	}
+
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		// Read until the client closes the connection, which answers its pings
+		go func() {
+			io.Copy(io.Discard, ws)
+			cancel()
+		}()
+
+		send := func(event models.Event) error {
+			return websocket.JSON.Send(ws, event)
+		}
+		ws.PayloadType = websocket.PingFrame
+		heartbeat := func() error {
+			_, err := ws.Write(nil)
+			return err
+		}
+
+		api.eventHub.Stream(ctx, filter, afterID, send, heartbeat)
+	}}
+	server.ServeHTTP(w, r)
+}
+
+// eventStreamRequest reads the filter and the ID to resume after of a request to
+// stream events. It writes an error response and returns false if the request is
+// invalid or events aren't logged.
+func (api *API) eventStreamRequest(w http.ResponseWriter, r *http.Request) (events.Filter, int64, bool) {
+	query := r.URL.Query()
+	filter := events.Filter{
+		AccountID: query.Get("account_id"),
+		Folder:    query.Get("folder"),
+	}
+
+	if api.eventHub == nil {
+		http.Error(w, "Event stream not configured", http.StatusServiceUnavailable)
+		return filter, 0, false
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("last_event_id")
+	}
+	if lastEventID == "" {
+		return filter, -1, true
+	}
+
+	afterID, err := strconv.ParseInt(lastEventID, 10, 64)
+	if err != nil || afterID < 0 {
+		http.Error(w, "Invalid last event ID", http.StatusBadRequest)
+		return filter, 0, false
+	}
+
+	return filter, afterID, true
+}
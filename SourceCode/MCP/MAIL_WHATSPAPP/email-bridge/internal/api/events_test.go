@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/events"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+	"golang.org/x/net/websocket"
+)
+
+// eventStore keeps the event log in memory
+type eventStore struct {
+	store.Store
+	mutex  sync.Mutex
+	events []models.Event
+}
+
+func (s *eventStore) AppendEvent(event models.Event) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	event.ID = int64(len(s.events) + 1)
+	s.events = append(s.events, event)
+	return event.ID, nil
+}
+
+func (s *eventStore) GetEventsAfter(afterID int64, accountID, folder string, limit int) ([]models.Event, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	filter := events.Filter{AccountID: accountID, Folder: folder}
+	var list []models.Event
+	for _, event := range s.events {
+		if event.ID > afterID && filter.Matches(event) && len(list) < limit {
+			list = append(list, event)
+		}
+	}
+	return list, nil
+}
+
+func (s *eventStore) DeleteEventsBefore(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestEventStream(t *testing.T) {
+	s := &eventStore{}
+	hub := events.NewHub(s, 0)
+	api := NewAPI(s, nil, nil)
+	api.SetEventHub(hub)
+	server := httptest.NewServer(api.SetupRoutes())
+	defer server.Close()
+
+	hub.Record(client.EmailEvent{Type: client.EmailEventNew, Email: models.Email{ID: "acct-1", AccountID: "acct", Folder: "INBOX"}})
+	hub.Record(client.EmailEvent{Type: client.EmailEventNew, Email: models.Email{ID: "other-1", AccountID: "other", Folder: "INBOX"}})
+	hub.Record(client.EmailEvent{Type: client.EmailEventRead, Email: models.Email{ID: "acct-1", AccountID: "acct", Folder: "INBOX"}})
+
+	t.Run("SSE", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/events?account_id=acct", nil)
+		req.Header.Set("Last-Event-ID", "0")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("Unexpected response %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+
+		lines := make(chan string, 20)
+		go func() {
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			close(lines)
+		}()
+		expected := []string{
+			"id: 1", "event: new", `data: {"id":1,"type":"new","account_id":"acct","folder":"INBOX","email_id":"acct-1"`, "",
+			"id: 3", "event: read", `data: {"id":3,"type":"read"`, "",
+		}
+		for _, prefix := range expected {
+			select {
+			case line := <-lines:
+				if !strings.HasPrefix(line, prefix) || (prefix == "" && line != "") {
+					t.Fatalf("Expected a line starting with %q, got %q", prefix, line)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Timed out waiting for %q", prefix)
+			}
+		}
+	})
+
+	t.Run("WebSocket", func(t *testing.T) {
+		wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/events/ws?folder=INBOX&last_event_id=1"
+		ws, err := websocket.Dial(wsURL, "", server.URL)
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		defer ws.Close()
+
+		for _, id := range []int64{2, 3} {
+			var event models.Event
+			ws.SetReadDeadline(time.Now().Add(time.Second))
+			if err := websocket.JSON.Receive(ws, &event); err != nil {
+				t.Fatalf("Failed to receive event %d: %v", id, err)
+			}
+			if event.ID != id || event.Email == nil || event.Email.Folder != "INBOX" {
+				t.Errorf("Expected event %d, got %+v", id, event)
+			}
+		}
+
+		// Live events follow the logged ones
+		go hub.Record(client.EmailEvent{Type: client.EmailEventDeleted, Email: models.Email{ID: "acct-1", AccountID: "acct", Folder: "INBOX"}})
+		var event models.Event
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		if err := websocket.JSON.Receive(ws, &event); err != nil || event.ID != 4 || event.Type != "deleted" {
+			t.Errorf("Expected the deleted event, got %+v (%v)", event, err)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		api    *API
+		method string
+		target string
+		code   int
+	}{
+		{"invalid last event ID", api, http.MethodGet, "/events?last_event_id=abc", http.StatusBadRequest},
+		{"invalid method", api, http.MethodPost, "/events", http.StatusMethodNotAllowed},
+		{"not configured", NewAPI(s, nil, nil), http.MethodGet, "/events", http.StatusServiceUnavailable},
+		{"WebSocket not configured", NewAPI(s, nil, nil), http.MethodGet, "/events/ws", http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		test.api.SetupRoutes().ServeHTTP(rec, httptest.NewRequest(test.method, test.target, nil))
+		if rec.Code != test.code {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.code, rec.Code)
+		}
+	}
+}
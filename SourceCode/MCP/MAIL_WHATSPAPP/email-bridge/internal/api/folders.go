@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/models"
+)
+
+// handleFolders handles folder requests
+func (api *API) handleFolders(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.listFolders(w, r)
+	case http.MethodPost:
+		api.createFolder(w, r)
+	case http.MethodPatch:
+		api.renameFolder(w, r)
+	case http.MethodDelete:
+		api.deleteFolder(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listFolders handles GET requests to list the folders of an account
+func (api *API) listFolders(w http.ResponseWriter, r *http.Request) {
+	accountID := r.URL.Query().Get("account_id")
+
+	imapClient, err := api.connectedIMAPClient(accountID)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	// Get folders with special-use flags and subscription state from the server
+	folders, err := imapClient.GetFoldersDetailed()
+	if err != nil {
+		http.Error(w, "Failed to list folders: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if folders == nil {
+		folders = []models.Folder{}
+	}
+
+	response := struct {
+		Folders []models.Folder `json:"folders"`
+	}{
+		Folders: folders,
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// createFolder handles POST requests to create a folder on the server
+func (api *API) createFolder(w http.ResponseWriter, r *http.Request) {
+	var folderRequest struct {
+		AccountID string `json:"account_id"`
+		Name      string `json:"name"`
+		Subscribe bool   `json:"subscribe"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&folderRequest); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if folderRequest.AccountID == "" || folderRequest.Name == "" {
+		http.Error(w, "Folder must have an account_id and a name", http.StatusBadRequest)
+		return
+	}
+
+	imapClient, err := api.connectedIMAPClient(folderRequest.AccountID)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	if err := imapClient.CreateFolder(folderRequest.Name); err != nil {
+		http.Error(w, "Failed to create folder: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if folderRequest.Subscribe {
+		if err := imapClient.SubscribeFolder(folderRequest.Name); err != nil {
+			// The folder exists on the server, so only log the failure
+			log.Printf("Warning: Failed to subscribe to folder %s: %v", folderRequest.Name, err)
+		}
+	}
+
+	// Update the local database and notify listeners
+	eventHandler := client.GetEmailEventHandler(api.store)
+	if err := eventHandler.HandleFolderCreated(folderRequest.AccountID, folderRequest.Name); err != nil {
+		http.Error(w, "Folder was created on the server but the local store was not updated: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Success bool   `json:"success"`
+		Name    string `json:"name"`
+	}{
+		Success: true,
+		Name:    folderRequest.Name,
+	}
+
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// renameFolder handles PATCH requests to rename a folder on the server
+func (api *API) renameFolder(w http.ResponseWriter, r *http.Request) {
+	var folderRequest struct {
+		AccountID string `json:"account_id"`
+		Name      string `json:"name"`
+		NewName   string `json:"new_name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&folderRequest); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if folderRequest.AccountID == "" || folderRequest.Name == "" || folderRequest.NewName == "" {
+		http.Error(w, "Folder rename requires account_id, name and new_name", http.StatusBadRequest)
+		return
+	}
+
+	imapClient, err := api.connectedIMAPClient(folderRequest.AccountID)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	if err := imapClient.RenameFolder(folderRequest.Name, folderRequest.NewName); err != nil {
+		http.Error(w, "Failed to rename folder: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Update the local database and notify listeners
+	eventHandler := client.GetEmailEventHandler(api.store)
+	if err := eventHandler.HandleFolderRenamed(folderRequest.AccountID, folderRequest.Name, folderRequest.NewName); err != nil {
+		http.Error(w, "Folder was renamed on the server but the local store was not updated: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Success bool   `json:"success"`
+		Name    string `json:"name"`
+	}{
+		Success: true,
+		Name:    folderRequest.NewName,
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// deleteFolder handles DELETE requests to delete a folder on the server
+func (api *API) deleteFolder(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	accountID := query.Get("account_id")
+	name := query.Get("name")
+
+	if accountID == "" || name == "" {
+		http.Error(w, "Folder delete requires account_id and name", http.StatusBadRequest)
+		return
+	}
+
+	imapClient, err := api.connectedIMAPClient(accountID)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	if err := imapClient.DeleteFolder(name); err != nil {
+		http.Error(w, "Failed to delete folder: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Update the local database and notify listeners
+	eventHandler := client.GetEmailEventHandler(api.store)
+	if err := eventHandler.HandleFolderDeleted(accountID, name); err != nil {
+		http.Error(w, "Folder was deleted on the server but the local store was not updated: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
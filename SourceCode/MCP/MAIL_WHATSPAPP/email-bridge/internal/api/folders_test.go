@@ -0,0 +1,253 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// fakeIMAPClient implements the folder, email and attachment operations of client.IMAPClient.
+// Any other method panics through the nil embedded interface.
+type fakeIMAPClient struct {
+	client.IMAPClient
+	folders []models.Folder
+	created []string
+	renamed [][2]string
+	deleted []string
+	// attachments maps attachment IDs to the content on the server
+	attachments map[string]string
+	// read, unread, moved and deletedEmails record email operations as "folder/emailID"
+	read          []string
+	unread        []string
+	moved         []string
+	deletedEmails []string
+	// movedID is the ID MoveEmail reports for the moved email
+	movedID string
+	// appended records appended messages as "folder/flags", and expunged the
+	// expunged emails as "folder/emailID"
+	appended []string
+	expunged []string
+}
+
+func (f *fakeIMAPClient) Connect() error    { return nil }
+func (f *fakeIMAPClient) IsConnected() bool { return true }
+
+func (f *fakeIMAPClient) GetFoldersDetailed() ([]models.Folder, error) {
+	return f.folders, nil
+}
+
+func (f *fakeIMAPClient) CreateFolder(name string) error {
+	f.created = append(f.created, name)
+	return nil
+}
+
+func (f *fakeIMAPClient) RenameFolder(oldName string, newName string) error {
+	f.renamed = append(f.renamed, [2]string{oldName, newName})
+	return nil
+}
+
+func (f *fakeIMAPClient) DeleteFolder(name string) error {
+	f.deleted = append(f.deleted, name)
+	return nil
+}
+
+func (f *fakeIMAPClient) SubscribeFolder(name string) error { return nil }
+
+func (f *fakeIMAPClient) GetAttachment(folder string, attachment models.Attachment) (io.ReadCloser, error) {
+	content, ok := f.attachments[attachment.ID]
+	if !ok {
+		return nil, errors.New("attachment not on server")
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func (f *fakeIMAPClient) MarkAsRead(folder string, emailID string) error {
+	f.read = append(f.read, folder+"/"+emailID)
+	return nil
+}
+
+func (f *fakeIMAPClient) MarkAsUnread(folder string, emailID string) error {
+	f.unread = append(f.unread, folder+"/"+emailID)
+	return nil
+}
+
+func (f *fakeIMAPClient) MoveEmail(folder string, emailID string, destination string) (string, error) {
+	f.moved = append(f.moved, folder+"/"+emailID)
+	return f.movedID, nil
+}
+
+func (f *fakeIMAPClient) DeleteEmail(folder string, emailID string) error {
+	f.deletedEmails = append(f.deletedEmails, folder+"/"+emailID)
+	return nil
+}
+
+func (f *fakeIMAPClient) AppendEmail(folder string, raw client.RawMessage, flags []string) (string, error) {
+	f.appended = append(f.appended, folder+"/"+strings.Join(flags, " "))
+	return fmt.Sprintf("account-%d", len(f.appended)), nil
+}
+
+func (f *fakeIMAPClient) ExpungeEmail(folder string, emailID string) error {
+	f.expunged = append(f.expunged, folder+"/"+emailID)
+	return nil
+}
+
+// folderStore implements the folder operations of store.Store
+type folderStore struct {
+	store.Store
+	err error
+}
+
+func (s *folderStore) CreateFolder(accountID string, name string) error { return s.err }
+func (s *folderStore) RenameFolder(accountID string, oldName string, newName string) error {
+	return s.err
+}
+func (s *folderStore) DeleteFolder(accountID string, name string) error { return s.err }
+
+// newTestAPI registers imapClient for accountID and returns an API backed by s
+func newTestAPI(t *testing.T, accountID string, imapClient *fakeIMAPClient, s store.Store) *API {
+	t.Helper()
+
+	clientID := "imap-" + accountID
+	client.GetConnectionManager().RegisterClient(clientID, imapClient)
+	t.Cleanup(func() { client.GetConnectionManager().UnregisterClient(clientID) })
+
+	return NewAPI(s, nil, nil)
+}
+
+func TestHandleFoldersMethodRouting(t *testing.T) {
+	api := newTestAPI(t, "routing-account", &fakeIMAPClient{}, &folderStore{})
+	handler := api.SetupRoutes()
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{http.MethodGet, "/folders?account_id=routing-account", "", http.StatusOK},
+		{http.MethodPost, "/folders", `{"account_id":"routing-account","name":"Projects"}`, http.StatusCreated},
+		{http.MethodPatch, "/folders", `{"account_id":"routing-account","name":"Projects","new_name":"Archive"}`, http.StatusOK},
+		{http.MethodDelete, "/folders?account_id=routing-account&name=Archive", "", http.StatusNoContent},
+		{http.MethodPut, "/folders", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("%s %s: expected status %d, got %d (%s)", tt.method, tt.target, tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleFoldersBadRequest(t *testing.T) {
+	handler := NewAPI(&folderStore{}, nil, nil).SetupRoutes()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"create invalid body", http.MethodPost, "/folders", `{`},
+		{"create missing name", http.MethodPost, "/folders", `{"account_id":"a"}`},
+		{"create missing account", http.MethodPost, "/folders", `{"name":"Projects"}`},
+		{"rename invalid body", http.MethodPatch, "/folders", `not json`},
+		{"rename missing new name", http.MethodPatch, "/folders", `{"account_id":"a","name":"Projects"}`},
+		{"delete missing name", http.MethodDelete, "/folders?account_id=a", ""},
+		{"delete missing account", http.MethodDelete, "/folders?name=Projects", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d (%s)", http.StatusBadRequest, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleFoldersUnknownAccount(t *testing.T) {
+	// The default client must not be used for an account that isn't registered
+	defaultClient := &fakeIMAPClient{}
+	handler := NewAPI(&folderStore{}, defaultClient, nil).SetupRoutes()
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{http.MethodGet, "/folders?account_id=missing", ""},
+		{http.MethodPost, "/folders", `{"account_id":"missing","name":"Projects"}`},
+		{http.MethodPatch, "/folders", `{"account_id":"missing","name":"Projects","new_name":"Archive"}`},
+		{http.MethodDelete, "/folders?account_id=missing&name=Projects", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("expected status %d, got %d (%s)", http.StatusNotFound, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if len(defaultClient.created) != 0 || len(defaultClient.renamed) != 0 || len(defaultClient.deleted) != 0 {
+		t.Error("Expected the default client not to be used for an unknown account")
+	}
+}
+
+func TestHandleFoldersStoreFailure(t *testing.T) {
+	imapClient := &fakeIMAPClient{}
+	api := newTestAPI(t, "store-failure-account", imapClient, &folderStore{err: errors.New("disk full")})
+	handler := api.SetupRoutes()
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{http.MethodPost, "/folders", `{"account_id":"store-failure-account","name":"Projects"}`},
+		{http.MethodPatch, "/folders", `{"account_id":"store-failure-account","name":"Projects","new_name":"Archive"}`},
+		{http.MethodDelete, "/folders?account_id=store-failure-account&name=Archive", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), "on the server") {
+				t.Errorf("expected the response to say the server-side change was applied, got %q", rec.Body.String())
+			}
+		})
+	}
+
+	// The server-side operations still happened
+	if len(imapClient.created) != 1 || len(imapClient.renamed) != 1 || len(imapClient.deleted) != 1 {
+		t.Errorf("Expected one create, rename and delete on the server, got %v, %v, %v", imapClient.created, imapClient.renamed, imapClient.deleted)
+	}
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// handleOutbox handles requests to list the messages waiting to be sent
+func (api *API) handleOutbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	messages, err := api.store.PendingOutboxMessages(r.URL.Query().Get("account_id"))
+	if err != nil {
+		http.Error(w, "Failed to list outbox: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Messages []models.OutboxMessage `json:"messages"`
+	}{
+		Messages: messages,
+	}
+	if response.Messages == nil {
+		response.Messages = []models.OutboxMessage{}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleOutboxByID handles requests for a specific outbox message
+func (api *API) handleOutboxByID(w http.ResponseWriter, r *http.Request) {
+	// The path should be in the format "/outbox/{id}"
+	queueID := strings.TrimPrefix(r.URL.Path, "/outbox/")
+	if queueID == "" || strings.Contains(queueID, "/") {
+		http.Error(w, "Invalid queue ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getOutboxMessage(w, queueID)
+	case http.MethodDelete:
+		api.cancelOutboxMessage(w, r, queueID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// getOutboxMessage handles GET requests for the delivery state of an outbox message
+func (api *API) getOutboxMessage(w http.ResponseWriter, queueID string) {
+	message, err := api.store.GetOutboxMessage(queueID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Outbox message not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve outbox message: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, message)
+}
+
+// cancelOutboxMessage handles DELETE requests to cancel a message before it is sent.
+// A message pending approval can be withdrawn too, which is recorded in its audit trail.
+func (api *API) cancelOutboxMessage(w http.ResponseWriter, r *http.Request, queueID string) {
+	message, err := api.store.GetOutboxMessage(queueID)
+	if err == nil {
+		err = api.store.CancelOutboxMessage(queueID)
+	}
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			http.Error(w, "Outbox message not found", http.StatusNotFound)
+		case store.ErrOutboxNotQueued:
+			http.Error(w, "Failed to cancel outbox message: "+err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Failed to cancel outbox message: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if message.Status == models.OutboxPendingApproval {
+		api.audit(message, models.AuditCancelled, requestClientID(r), "", nil)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// queueEmail adds an email to the outbox and writes a 202 response with its queue ID.
+// The outbox sender sends it in the background, at sendAt if it is set, and stores it
+// in the Sent folder.
+func (api *API) queueEmail(w http.ResponseWriter, r *http.Request, email models.Email, sendAt *time.Time) {
+	message, err := api.addToOutbox(email, sendAt, requestClientID(r))
+	if err != nil {
+		http.Error(w, "Failed to queue email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeQueued(w, message)
+}
+
+// addToOutbox adds an email submitted by an API client to the outbox, to be sent at
+// sendAt if it is set, and wakes the outbox sender. The email of a client that needs
+// approval is held until it is approved.
+func (api *API) addToOutbox(email models.Email, sendAt *time.Time, submitter string) (models.OutboxMessage, error) {
+	now := time.Now()
+	message := models.OutboxMessage{
+		ID:          generateOutboxID(),
+		AccountID:   email.AccountID,
+		Email:       email,
+		Status:      models.OutboxQueued,
+		NextAttempt: now,
+		CreatedAt:   now,
+	}
+
+	// A send time in the past sends the email straight away
+	if sendAt != nil && sendAt.After(now) {
+		message.SendAt = sendAt
+		message.NextAttempt = *sendAt
+		message.Email.Date = *sendAt
+	}
+
+	if api.requiresApproval(submitter) {
+		message.Status = models.OutboxPendingApproval
+	}
+
+	if err := api.store.QueueOutboxMessage(message); err != nil {
+		return message, err
+	}
+
+	if message.Status == models.OutboxPendingApproval {
+		api.audit(message, models.AuditSubmitted, submitter, "", &message.Email)
+	} else {
+		api.notifyOutbox()
+	}
+
+	return message, nil
+}
+
+// writeQueued writes the 202 response for an email added to the outbox
+func writeQueued(w http.ResponseWriter, message models.OutboxMessage) {
+	response := struct {
+		Success   bool       `json:"success"`
+		QueueID   string     `json:"queue_id"`
+		Status    string     `json:"status"`
+		SendAt    *time.Time `json:"send_at,omitempty"`
+		EmailID   string     `json:"email_id"`
+		MessageID string     `json:"message_id"`
+	}{
+		Success:   true,
+		QueueID:   message.ID,
+		Status:    message.Status,
+		SendAt:    message.SendAt,
+		EmailID:   message.Email.ID,
+		MessageID: message.Email.MessageID,
+	}
+
+	writeJSON(w, http.StatusAccepted, response)
+}
+
+// generateOutboxID generates a unique ID for an outbox message
+func generateOutboxID() string {
+	return fmt.Sprintf("outbox_%d", time.Now().UnixNano())
+}
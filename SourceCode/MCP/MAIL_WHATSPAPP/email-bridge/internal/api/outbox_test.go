@@ -0,0 +1,186 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// outboxStore keeps queued messages in memory
+type outboxStore struct {
+	store.Store
+	outbox map[string]models.OutboxMessage
+}
+
+func (s *outboxStore) QueueOutboxMessage(message models.OutboxMessage) error {
+	s.outbox[message.ID] = message
+	return nil
+}
+
+func (s *outboxStore) GetOutboxMessage(id string) (models.OutboxMessage, error) {
+	message, ok := s.outbox[id]
+	if !ok {
+		return message, sql.ErrNoRows
+	}
+	return message, nil
+}
+
+func (s *outboxStore) PendingOutboxMessages(accountID string) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+	for _, message := range s.outbox {
+		pending := message.Status == models.OutboxQueued || message.Status == models.OutboxPendingApproval
+		if pending && (accountID == "" || message.AccountID == accountID) {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func (s *outboxStore) CancelOutboxMessage(id string) error {
+	message, ok := s.outbox[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if message.Status != models.OutboxQueued && message.Status != models.OutboxPendingApproval {
+		return store.ErrOutboxNotQueued
+	}
+	message.Status = models.OutboxCancelled
+	s.outbox[id] = message
+	return nil
+}
+
+func TestSendEmailQueues(t *testing.T) {
+	s := &outboxStore{outbox: make(map[string]models.OutboxMessage)}
+	smtpClient := &fakeSMTPClient{}
+	api := NewAPI(s, nil, smtpClient)
+	notified := 0
+	api.notifyOutbox = func() { notified++ }
+	handler := api.SetupRoutes()
+
+	body := `{"from":{"email":"me@example.com"},"to":[{"email":"finance@example.com"}],"subject":"Summary","text_content":"Attached."}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/emails", strings.NewReader(body)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		QueueID string `json:"queue_id"`
+		Status  string `json:"status"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.QueueID == "" || response.Status != models.OutboxQueued {
+		t.Fatalf("Unexpected response %+v", response)
+	}
+
+	// The email is sent in the background, not by the request
+	if len(smtpClient.sent) != 0 || notified != 1 {
+		t.Errorf("Expected the email to be queued and the sender woken, got %d sent and %d notifications", len(smtpClient.sent), notified)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/outbox/"+response.QueueID, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var message models.OutboxMessage
+	if err := json.NewDecoder(rec.Body).Decode(&message); err != nil {
+		t.Fatalf("Failed to decode outbox message: %v", err)
+	}
+	if message.Status != models.OutboxQueued || message.Email.Subject != "Summary" {
+		t.Errorf("Unexpected outbox message %+v", message)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/outbox/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing message, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	// Accounts without an SMTP client are rejected before queueing
+	body = `{"account_id":"unknown","from":{"email":"me@example.com"},"to":[{"email":"a@example.com"}],"subject":"Hi","text_content":"Hi"}`
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/emails", strings.NewReader(body)))
+	if rec.Code != http.StatusNotFound || len(s.outbox) != 1 {
+		t.Errorf("Expected status %d without queueing, got %d with %d queued", http.StatusNotFound, rec.Code, len(s.outbox))
+	}
+}
+
+func TestScheduledSend(t *testing.T) {
+	s := &outboxStore{outbox: make(map[string]models.OutboxMessage)}
+	api := NewAPI(s, nil, &fakeSMTPClient{})
+	api.notifyOutbox = func() {}
+	handler := api.SetupRoutes()
+
+	queue := func(sendAt string) (*httptest.ResponseRecorder, string) {
+		body := `{"from":{"email":"me@example.com"},"to":[{"email":"finance@example.com"}],"subject":"Summary","text_content":"Hi","send_at":"` + sendAt + `"}`
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/emails", strings.NewReader(body)))
+		var response struct {
+			QueueID string `json:"queue_id"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec, response.QueueID
+	}
+
+	sendAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	rec, scheduled := queue(sendAt.Format(time.RFC3339))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+	message := s.outbox[scheduled]
+	if message.SendAt == nil || !message.SendAt.Equal(sendAt) || !message.NextAttempt.Equal(sendAt) {
+		t.Errorf("Expected the message to be due at %v, got %+v", sendAt, message)
+	}
+	if !message.Email.Date.Equal(sendAt) {
+		t.Errorf("Expected the email to be dated when it is sent, got %v", message.Email.Date)
+	}
+
+	// A send time in the past sends straight away
+	_, immediate := queue(time.Now().Add(-time.Hour).Format(time.RFC3339))
+	if message := s.outbox[immediate]; message.SendAt != nil || message.NextAttempt.After(time.Now()) {
+		t.Errorf("Expected a past send time to send now, got %+v", message)
+	}
+
+	if rec, _ := queue("tomorrow"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid send time, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/outbox", nil))
+	var list struct {
+		Messages []models.OutboxMessage `json:"messages"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list.Messages) != 2 {
+		t.Fatalf("Expected 2 pending messages, got %d (%v)", len(list.Messages), err)
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		want int
+	}{
+		{"cancel", scheduled, http.StatusNoContent},
+		{"already cancelled", scheduled, http.StatusConflict},
+		{"missing", "missing", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/outbox/"+tt.id, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d (%s)", tt.name, tt.want, rec.Code, rec.Body.String())
+		}
+	}
+	if s.outbox[scheduled].Status != models.OutboxCancelled {
+		t.Errorf("Expected the scheduled message to be cancelled, got %s", s.outbox[scheduled].Status)
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/user/email-bridge/internal/spreadsheet"
+)
+
+const (
+	// defaultPreviewRows is the number of rows in a preview page when no limit is given
+	defaultPreviewRows = 20
+	// maxPreviewRows caps the rows of a preview page
+	maxPreviewRows = 1000
+)
+
+// previewRow is a record of a spreadsheet with its row number in the sheet
+type previewRow struct {
+	Number int      `json:"number"`
+	Values []string `json:"values"`
+}
+
+// previewAttachment handles GET requests for the sheets, headers and a page of rows of
+// a spreadsheet attachment. The sheet is read from the start for each page, so only
+// the rows of the page are held in memory; next_cursor is the row number the page
+// ends at, and the next page starts after it.
+func (api *API) previewAttachment(w http.ResponseWriter, r *http.Request, attachmentID string) {
+	query := r.URL.Query()
+
+	limit := defaultPreviewRows
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPreviewRows {
+			http.Error(w, "Invalid limit value. Must be between 1 and "+strconv.Itoa(maxPreviewRows)+".", http.StatusBadRequest)
+			return
+		}
+	}
+
+	after := 0
+	if cursor := query.Get("cursor"); cursor != "" {
+		var err error
+		after, err = strconv.Atoi(cursor)
+		if err != nil || after < 1 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	attachment, ok := api.localAttachment(w, attachmentID)
+	if !ok {
+		return
+	}
+
+	// Stored files are named by their hash, so the format comes from the filename
+	format, ok := spreadsheet.FormatOf(attachment.Filename)
+	if !ok {
+		http.Error(w, "Preview is only available for .xlsx, .xlsb and .csv attachments", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	workbook, err := spreadsheet.OpenFormat(attachment.Path, format)
+	if err != nil {
+		http.Error(w, "Failed to parse spreadsheet: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	defer workbook.Close()
+
+	sheet, err := workbook.Sheet(query.Get("sheet"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	rows, err := workbook.Rows(sheet)
+	if err != nil {
+		http.Error(w, "Failed to read sheet: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	table, err := spreadsheet.NewTable(rows)
+	if err != nil {
+		rows.Close()
+		http.Error(w, "Failed to parse spreadsheet: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	defer table.Close()
+
+	page := []previewRow{}
+	nextCursor := ""
+	for table.Next() {
+		if table.Number() <= after {
+			continue
+		}
+		// A record beyond the page means there is a next page
+		if len(page) == limit {
+			nextCursor = strconv.Itoa(page[len(page)-1].Number)
+			break
+		}
+		page = append(page, previewRow{
+			Number: table.Number(),
+			Values: append([]string(nil), table.Record()...),
+		})
+	}
+	if err := table.Err(); err != nil {
+		http.Error(w, "Failed to parse spreadsheet: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	headers := table.Headers()
+	if headers == nil {
+		headers = []string{}
+	}
+
+	response := struct {
+		AttachmentID string       `json:"attachment_id"`
+		Filename     string       `json:"filename"`
+		Format       string       `json:"format"`
+		Sheets       []string     `json:"sheets"`
+		Sheet        string       `json:"sheet"`
+		Headers      []string     `json:"headers"`
+		Rows         []previewRow `json:"rows"`
+		Limit        int          `json:"limit"`
+		NextCursor   string       `json:"next_cursor,omitempty"`
+	}{
+		AttachmentID: attachment.ID,
+		Filename:     attachment.Filename,
+		Format:       string(format),
+		Sheets:       workbook.Sheets(),
+		Sheet:        sheet,
+		Headers:      headers,
+		Rows:         page,
+		Limit:        limit,
+		NextCursor:   nextCursor,
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
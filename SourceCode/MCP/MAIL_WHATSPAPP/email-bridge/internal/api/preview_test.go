@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+func TestPreviewAttachment(t *testing.T) {
+	dir := t.TempDir()
+	var csv strings.Builder
+	csv.WriteString("Transaction Reference,Paid Amount,Rate,Rate\n")
+	for i := 1; i <= 45; i++ {
+		fmt.Fprintf(&csv, "TX%03d,%d,0.045,\n", i, 11600+i)
+		if i == 10 {
+			// Empty rows are skipped
+			csv.WriteString(",,,\n")
+		}
+	}
+	// Stored attachments are named by their hash
+	path := filepath.Join(dir, "3f2a")
+	if err := os.WriteFile(path, []byte(csv.String()), 0600); err != nil {
+		t.Fatalf("Failed to write attachment file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "scan"), []byte("%PDF-1.4"), 0600); err != nil {
+		t.Fatalf("Failed to write attachment file: %v", err)
+	}
+
+	s := &attachmentStore{
+		attachments: map[string]models.Attachment{
+			"brand-1-1": {ID: "brand-1-1", EmailID: "brand-1", Filename: "Brand Settlement.csv", Path: path},
+			"brand-1-2": {ID: "brand-1-2", EmailID: "brand-1", Filename: "scan.pdf", Path: filepath.Join(dir, "scan")},
+		},
+	}
+	handler := NewAPI(s, nil, nil).SetupRoutes()
+
+	type page struct {
+		Sheets     []string     `json:"sheets"`
+		Sheet      string       `json:"sheet"`
+		Format     string       `json:"format"`
+		Headers    []string     `json:"headers"`
+		Rows       []previewRow `json:"rows"`
+		Limit      int          `json:"limit"`
+		NextCursor string       `json:"next_cursor"`
+	}
+	get := func(target string) (page, *httptest.ResponseRecorder) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var p page
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatalf("Failed to decode preview: %v", err)
+			}
+		}
+		return p, rec
+	}
+
+	p, rec := get("/attachments/brand-1-1/preview")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if p.Format != "csv" || p.Sheet != "3f2a" || len(p.Sheets) != 1 || p.Limit != defaultPreviewRows {
+		t.Errorf("Unexpected preview %+v", p)
+	}
+	if strings.Join(p.Headers, "|") != "Transaction Reference|Paid Amount|Rate|Rate (2)" {
+		t.Errorf("Unexpected headers %q", p.Headers)
+	}
+	if len(p.Rows) != defaultPreviewRows || p.Rows[0].Number != 2 || strings.Join(p.Rows[0].Values, "|") != "TX001|11601|0.045|" {
+		t.Errorf("Unexpected first row %+v", p.Rows[0])
+	}
+
+	// Pages continue after the cursor until the last one, which has no cursor
+	var references []string
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		p, rec = get("/attachments/brand-1-1/preview?limit=20&cursor=" + cursor)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		for _, row := range p.Rows {
+			references = append(references, row.Values[0])
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		cursor = p.NextCursor
+	}
+	if len(references) != 45 || references[10] != "TX011" || references[44] != "TX045" {
+		t.Errorf("Expected all 45 rows across the pages, got %d: %v", len(references), references)
+	}
+
+	tests := []struct {
+		target string
+		code   int
+	}{
+		{"/attachments/brand-1-1/preview?limit=0", http.StatusBadRequest},
+		{"/attachments/brand-1-1/preview?limit=5000", http.StatusBadRequest},
+		{"/attachments/brand-1-1/preview?cursor=abc", http.StatusBadRequest},
+		{"/attachments/brand-1-1/preview?sheet=Summary", http.StatusNotFound},
+		{"/attachments/brand-1-2/preview", http.StatusUnsupportedMediaType},
+		{"/attachments/missing/preview", http.StatusNotFound},
+		{"/attachments/brand-1-1/rows", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if _, rec := get(test.target); rec.Code != test.code {
+			t.Errorf("GET %s: expected status %d, got %d (%s)", test.target, test.code, rec.Code, rec.Body.String())
+		}
+	}
+}
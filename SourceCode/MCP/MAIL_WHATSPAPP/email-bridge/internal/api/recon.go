@@ -0,0 +1,101 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/recon"
+)
+
+// handleReconJobs handles requests to list recon jobs
+func (api *API) handleReconJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobs, err := api.store.GetReconJobs(r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, "Failed to list recon jobs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Jobs []models.ReconJob `json:"jobs"`
+	}{
+		Jobs: jobs,
+	}
+	if response.Jobs == nil {
+		response.Jobs = []models.ReconJob{}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleReconJobByID handles requests for a specific recon job
+func (api *API) handleReconJobByID(w http.ResponseWriter, r *http.Request) {
+	// The path should be in the format "/recon/jobs/{id}" or "/recon/jobs/{id}/retry"
+	jobID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/recon/jobs/"), "/")
+	if jobID == "" || strings.Contains(action, "/") {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		api.getReconJob(w, jobID)
+	case "retry":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		api.retryReconJob(w, jobID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// getReconJob handles GET requests for a recon job
+func (api *API) getReconJob(w http.ResponseWriter, jobID string) {
+	job, err := api.store.GetReconJob(jobID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Recon job not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve recon job: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
+
+// retryReconJob handles POST requests to queue a failed recon job again
+func (api *API) retryReconJob(w http.ResponseWriter, jobID string) {
+	if api.retryRecon == nil {
+		http.Error(w, "Recon ingestion not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	job, err := api.retryRecon(jobID)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			http.Error(w, "Recon job not found", http.StatusNotFound)
+		case errors.Is(err, recon.ErrJobNotFailed):
+			http.Error(w, "Recon job is "+job.Status+" and can't be retried", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to retry recon job: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/recon"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// reconStore keeps recon jobs in memory
+type reconStore struct {
+	store.Store
+	jobs []models.ReconJob
+}
+
+func (s *reconStore) GetReconJob(id string) (models.ReconJob, error) {
+	for _, job := range s.jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return models.ReconJob{}, sql.ErrNoRows
+}
+
+func (s *reconStore) GetReconJobs(status string) ([]models.ReconJob, error) {
+	var jobs []models.ReconJob
+	for _, job := range s.jobs {
+		if status == "" || job.Status == status {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func TestReconJobs(t *testing.T) {
+	s := &reconStore{jobs: []models.ReconJob{
+		{ID: "recon_1", Rule: "benow", Filename: "Benow File 1.xlsb", Status: models.ReconSubmitted, Rows: 19320},
+		{ID: "recon_2", Rule: "brand", Filename: "Brand File 1.xlsx", Status: models.ReconFailed, Error: "recon backend returned 500"},
+	}}
+	api := NewAPI(s, nil, nil)
+	handler := api.SetupRoutes()
+
+	request := func(method string, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := request(http.MethodGet, "/recon/jobs?status=failed")
+	var list struct {
+		Jobs []models.ReconJob `json:"jobs"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected response %d (%v)", rec.Code, err)
+	}
+	if len(list.Jobs) != 1 || list.Jobs[0].ID != "recon_2" {
+		t.Errorf("Expected only the failed job, got %+v", list.Jobs)
+	}
+	if rec := request(http.MethodGet, "/recon/jobs?status=queued"); rec.Body.String() != "{\"jobs\":[]}\n" {
+		t.Errorf("Expected an empty list, got %s", rec.Body.String())
+	}
+
+	rec = request(http.MethodGet, "/recon/jobs/recon_1")
+	var job models.ReconJob
+	if err := json.NewDecoder(rec.Body).Decode(&job); err != nil || job.Rows != 19320 {
+		t.Errorf("Unexpected job %+v (%v)", job, err)
+	}
+	if rec := request(http.MethodGet, "/recon/jobs/missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing job, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	// Retrying needs the ingester
+	if rec := request(http.MethodPost, "/recon/jobs/recon_2/retry"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d without an ingester, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	api.retryRecon = func(jobID string) (models.ReconJob, error) {
+		job, err := s.GetReconJob(jobID)
+		if err != nil {
+			return job, err
+		}
+		if job.Status != models.ReconFailed {
+			return job, recon.ErrJobNotFailed
+		}
+		job.Status = models.ReconQueued
+		return job, nil
+	}
+	tests := []struct {
+		target string
+		code   int
+	}{
+		{"/recon/jobs/recon_2/retry", http.StatusAccepted},
+		{"/recon/jobs/recon_1/retry", http.StatusConflict},
+		{"/recon/jobs/missing/retry", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if rec := request(http.MethodPost, test.target); rec.Code != test.code {
+			t.Errorf("POST %s: expected status %d, got %d (%s)", test.target, test.code, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := request(http.MethodGet, "/recon/jobs/recon_2/retry"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
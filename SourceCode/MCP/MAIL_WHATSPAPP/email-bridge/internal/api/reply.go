@@ -0,0 +1,271 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/models"
+)
+
+// senderClient is implemented by SMTP clients that know the address of their account
+type senderClient interface {
+	Sender() models.Address
+}
+
+// replyEmail handles POST requests to reply to a stored email through the SMTP client
+// of its account. The reply is threaded with In-Reply-To and References.
+func (api *API) replyEmail(w http.ResponseWriter, r *http.Request, emailID string) {
+	var replyRequest struct {
+		From            models.Address `json:"from"`
+		ReplyAll        bool           `json:"reply_all"`
+		TextContent     string         `json:"text_content"`
+		HtmlContent     string         `json:"html_content"`
+		AttachmentPaths []string       `json:"attachment_paths"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&replyRequest); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if replyRequest.TextContent == "" && replyRequest.HtmlContent == "" {
+		http.Error(w, "Reply must have content (text or HTML)", http.StatusBadRequest)
+		return
+	}
+
+	original, ok := api.storedEmail(w, emailID)
+	if !ok {
+		return
+	}
+
+	smtpClient, err := api.connectedSMTPClient(original.AccountID)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	from := senderAddress(replyRequest.From, smtpClient)
+	if from.Email == "" {
+		http.Error(w, "Reply must have a sender", http.StatusBadRequest)
+		return
+	}
+
+	to, cc := replyRecipients(original, from.Email, replyRequest.ReplyAll)
+	if len(to) == 0 {
+		http.Error(w, "Email has no address to reply to", http.StatusUnprocessableEntity)
+		return
+	}
+
+	email := models.Email{
+		ID:          generateEmailID(),
+		AccountID:   original.AccountID,
+		MessageID:   generateMessageID(from.Email),
+		From:        from,
+		To:          to,
+		Cc:          cc,
+		Subject:     client.PrefixSubject("Re:", original.Subject),
+		TextContent: replyRequest.TextContent,
+		HtmlContent: replyRequest.HtmlContent,
+		Date:        time.Now(),
+		Folder:      "Sent", // Default folder for sent emails
+		Headers:     threadHeaders(original),
+	}
+
+	for i, path := range replyRequest.AttachmentPaths {
+		attachment, err := localAttachment(path, "", "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		attachment.ID = fmt.Sprintf("%s-%d", email.ID, i+1)
+		attachment.EmailID = email.ID
+		email.Attachments = append(email.Attachments, attachment)
+	}
+	email.HasAttachments = len(email.Attachments) > 0
+
+	api.deliverEmail(w, r, smtpClient, email)
+}
+
+// forwardEmail handles POST requests to forward a stored email through the SMTP client
+// of its account. The original is quoted inline below the note in the request and its
+// attachments are included unless include_attachments is false.
+func (api *API) forwardEmail(w http.ResponseWriter, r *http.Request, emailID string) {
+	var forwardRequest struct {
+		From               models.Address   `json:"from"`
+		To                 []models.Address `json:"to"`
+		Cc                 []models.Address `json:"cc"`
+		Bcc                []models.Address `json:"bcc"`
+		TextContent        string           `json:"text_content"`
+		HtmlContent        string           `json:"html_content"`
+		AttachmentPaths    []string         `json:"attachment_paths"`
+		IncludeAttachments *bool            `json:"include_attachments"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&forwardRequest); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(forwardRequest.To) == 0 && len(forwardRequest.Cc) == 0 && len(forwardRequest.Bcc) == 0 {
+		http.Error(w, "Email must have at least one recipient", http.StatusBadRequest)
+		return
+	}
+
+	original, ok := api.storedEmail(w, emailID)
+	if !ok {
+		return
+	}
+
+	smtpClient, err := api.connectedSMTPClient(original.AccountID)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	from := senderAddress(forwardRequest.From, smtpClient)
+	if from.Email == "" {
+		http.Error(w, "Forward must have a sender", http.StatusBadRequest)
+		return
+	}
+
+	email := models.Email{
+		ID:          generateEmailID(),
+		AccountID:   original.AccountID,
+		MessageID:   generateMessageID(from.Email),
+		From:        from,
+		To:          forwardRequest.To,
+		Cc:          forwardRequest.Cc,
+		Bcc:         forwardRequest.Bcc,
+		Subject:     client.PrefixSubject("Fwd:", original.Subject),
+		TextContent: client.ForwardedText(forwardRequest.TextContent, original),
+		Date:        time.Now(),
+		Folder:      "Sent", // Default folder for sent emails
+	}
+	if forwardRequest.HtmlContent != "" || original.HtmlContent != "" {
+		email.HtmlContent = client.ForwardedHTML(forwardRequest.HtmlContent, original)
+	}
+
+	// Forward the original attachments, downloading any that aren't on disk yet
+	if forwardRequest.IncludeAttachments == nil || *forwardRequest.IncludeAttachments {
+		for _, attachment := range original.Attachments {
+			if !fileExists(attachment.Path) {
+				attachment, err = api.cacheAttachment(attachment)
+				if err != nil {
+					http.Error(w, "Failed to download attachment: "+err.Error(), http.StatusBadGateway)
+					return
+				}
+			}
+
+			attachment.ID = fmt.Sprintf("%s-%d", email.ID, len(email.Attachments)+1)
+			attachment.EmailID = email.ID
+			attachment.Section = ""
+			email.Attachments = append(email.Attachments, attachment)
+		}
+	}
+
+	for _, path := range forwardRequest.AttachmentPaths {
+		attachment, err := localAttachment(path, "", "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		attachment.ID = fmt.Sprintf("%s-%d", email.ID, len(email.Attachments)+1)
+		attachment.EmailID = email.ID
+		email.Attachments = append(email.Attachments, attachment)
+	}
+	email.HasAttachments = len(email.Attachments) > 0
+
+	api.deliverEmail(w, r, smtpClient, email)
+}
+
+// senderAddress returns the requested sender, or the address of the SMTP client's account
+func senderAddress(requested models.Address, smtpClient client.SMTPClient) models.Address {
+	if requested.Email != "" {
+		return requested
+	}
+	if sc, ok := smtpClient.(senderClient); ok {
+		return sc.Sender()
+	}
+	return models.Address{}
+}
+
+// replyRecipients returns the To and Cc of a reply sent from self. A reply goes to the
+// Reply-To addresses of the original, or its sender; replying to a message self sent goes
+// to its recipients instead. A reply-all also goes to the other To and Cc recipients.
+func replyRecipients(original models.Email, self string, replyAll bool) ([]models.Address, []models.Address) {
+	seen := make(map[string]bool)
+	add := func(list []models.Address, addr models.Address) []models.Address {
+		key := strings.ToLower(addr.Email)
+		if key == "" || seen[key] {
+			return list
+		}
+		seen[key] = true
+		return append(list, addr)
+	}
+
+	replyTo := []models.Address{original.From}
+	if list, err := mail.ParseAddressList(headerValue(original.Headers, "Reply-To")); err == nil && len(list) > 0 {
+		replyTo = replyTo[:0]
+		for _, addr := range list {
+			replyTo = append(replyTo, models.Address{Name: addr.Name, Email: addr.Address})
+		}
+	}
+
+	if len(replyTo) == 1 && strings.EqualFold(replyTo[0].Email, self) {
+		replyTo = original.To
+	}
+
+	// Never send the reply to ourselves
+	if self != "" {
+		seen[strings.ToLower(self)] = true
+	}
+
+	var to, cc []models.Address
+	for _, addr := range replyTo {
+		to = add(to, addr)
+	}
+
+	if replyAll {
+		for _, addr := range original.To {
+			to = add(to, addr)
+		}
+		for _, addr := range original.Cc {
+			cc = add(cc, addr)
+		}
+	}
+
+	return to, cc
+}
+
+// threadHeaders returns the In-Reply-To and References headers of a reply to an email
+func threadHeaders(original models.Email) map[string]string {
+	messageID := strings.TrimSpace(original.MessageID)
+	if messageID == "" {
+		return nil
+	}
+	if !strings.HasPrefix(messageID, "<") {
+		messageID = "<" + messageID + ">"
+	}
+
+	references := strings.TrimSpace(headerValue(original.Headers, "References") + " " + messageID)
+
+	return map[string]string{
+		"In-Reply-To": messageID,
+		"References":  references,
+	}
+}
+
+// headerValue returns the value of a stored header, whose key may have any case
+func headerValue(headers map[string]string, key string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/models"
+)
+
+// fakeSMTPClient records the emails it sends for the account address sender
+type fakeSMTPClient struct {
+	client.SMTPClient
+	sender string
+	sent   []models.Email
+}
+
+func (f *fakeSMTPClient) Connect() error    { return nil }
+func (f *fakeSMTPClient) IsConnected() bool { return true }
+
+func (f *fakeSMTPClient) SendEmail(email models.Email) error {
+	f.sent = append(f.sent, email)
+	return nil
+}
+
+func (f *fakeSMTPClient) SendEmailMessage(email models.Email) (*client.MessageFile, error) {
+	f.sent = append(f.sent, email)
+	return client.NewMessageFile(func(w io.Writer) error {
+		_, err := io.WriteString(w, "Subject: "+email.Subject+"\r\n\r\n")
+		return err
+	})
+}
+
+func (f *fakeSMTPClient) Sender() models.Address {
+	return models.Address{Email: f.sender}
+}
+
+// registerTestSMTPClient registers smtpClient for accountID
+func registerTestSMTPClient(t *testing.T, accountID string, smtpClient *fakeSMTPClient) {
+	t.Helper()
+
+	clientID := "smtp-" + accountID
+	client.GetConnectionManager().RegisterClient(clientID, smtpClient)
+	t.Cleanup(func() { client.GetConnectionManager().UnregisterClient(clientID) })
+}
+
+// newReplyTestStore returns a store holding the email "reply-account-3", sent by
+// alice to me and bob with carol in Cc
+func newReplyTestStore() *emailStore {
+	return &emailStore{emails: map[string]models.Email{
+		"reply-account-3": {
+			ID:          "reply-account-3",
+			AccountID:   "reply-account",
+			MessageID:   "<3@example.com>",
+			Folder:      "INBOX",
+			From:        models.Address{Name: "Alice", Email: "alice@example.com"},
+			To:          []models.Address{{Email: "me@example.com"}, {Email: "bob@example.com"}},
+			Cc:          []models.Address{{Email: "carol@example.com"}, {Email: "ME@example.com"}},
+			Subject:     "Quarterly numbers",
+			TextContent: "See attached.",
+			Headers:     map[string]string{"references": "<1@example.com>"},
+		},
+	}}
+}
+
+func TestReplyRecipients(t *testing.T) {
+	original := newReplyTestStore().emails["reply-account-3"]
+
+	withReplyTo := original
+	withReplyTo.Headers = map[string]string{"Reply-To": "Team <team@example.com>"}
+
+	ownMessage := original
+	ownMessage.From = models.Address{Email: "me@example.com"}
+	ownMessage.To = []models.Address{{Email: "dave@example.com"}}
+
+	tests := []struct {
+		name     string
+		original models.Email
+		replyAll bool
+		wantTo   []string
+		wantCc   []string
+	}{
+		{"reply", original, false, []string{"alice@example.com"}, nil},
+		{"reply all", original, true, []string{"alice@example.com", "bob@example.com"}, []string{"carol@example.com"}},
+		{"reply to", withReplyTo, false, []string{"team@example.com"}, nil},
+		{"own message", ownMessage, false, []string{"dave@example.com"}, nil},
+	}
+
+	emails := func(addresses []models.Address) []string {
+		var list []string
+		for _, addr := range addresses {
+			list = append(list, addr.Email)
+		}
+		return list
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			to, cc := replyRecipients(tt.original, "me@example.com", tt.replyAll)
+			if got := emails(to); !reflect.DeepEqual(got, tt.wantTo) {
+				t.Errorf("Expected To %v, got %v", tt.wantTo, got)
+			}
+			if got := emails(cc); !reflect.DeepEqual(got, tt.wantCc) {
+				t.Errorf("Expected Cc %v, got %v", tt.wantCc, got)
+			}
+		})
+	}
+}
+
+func TestReplyEmail(t *testing.T) {
+	s := newReplyTestStore()
+	smtpClient := &fakeSMTPClient{sender: "me@example.com"}
+	registerTestSMTPClient(t, "reply-account", smtpClient)
+	handler := NewAPI(s, nil, nil).SetupRoutes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/emails/reply-account-3/reply",
+		strings.NewReader(`{"reply_all": true, "text_content": "Thanks"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	if len(smtpClient.sent) != 1 {
+		t.Fatalf("Expected one email to be sent, got %d", len(smtpClient.sent))
+	}
+	reply := smtpClient.sent[0]
+
+	if reply.From.Email != "me@example.com" {
+		t.Errorf("Expected the reply to be sent from the account, got %s", reply.From.Email)
+	}
+	if reply.Subject != "Re: Quarterly numbers" {
+		t.Errorf("Unexpected subject %q", reply.Subject)
+	}
+	if reply.Headers["In-Reply-To"] != "<3@example.com>" || reply.Headers["References"] != "<1@example.com> <3@example.com>" {
+		t.Errorf("Unexpected thread headers %v", reply.Headers)
+	}
+	if len(reply.To) != 2 || len(reply.Cc) != 1 {
+		t.Errorf("Expected 2 To and 1 Cc recipients, got %v and %v", reply.To, reply.Cc)
+	}
+	if _, ok := s.emails[reply.ID]; !ok {
+		t.Error("Expected the reply to be stored")
+	}
+}
+
+func TestForwardEmail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "numbers.csv")
+	if err := os.WriteFile(path, []byte("q,total\n1,10\n"), 0600); err != nil {
+		t.Fatalf("Failed to write attachment file: %v", err)
+	}
+
+	s := newReplyTestStore()
+	original := s.emails["reply-account-3"]
+	original.HasAttachments = true
+	original.Attachments = []models.Attachment{
+		{ID: "reply-account-3-1", EmailID: "reply-account-3", Filename: "numbers.csv", ContentType: "text/csv", Path: path, Section: "2"},
+	}
+	s.emails["reply-account-3"] = original
+
+	smtpClient := &fakeSMTPClient{sender: "me@example.com"}
+	registerTestSMTPClient(t, "reply-account", smtpClient)
+	handler := NewAPI(s, nil, nil).SetupRoutes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/emails/reply-account-3/forward",
+		strings.NewReader(`{"to": [{"email": "dave@example.com"}], "text_content": "FYI"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	if len(smtpClient.sent) != 1 {
+		t.Fatalf("Expected one email to be sent, got %d", len(smtpClient.sent))
+	}
+	forward := smtpClient.sent[0]
+
+	if forward.Subject != "Fwd: Quarterly numbers" {
+		t.Errorf("Unexpected subject %q", forward.Subject)
+	}
+	if !strings.HasPrefix(forward.TextContent, "FYI") || !strings.Contains(forward.TextContent, "See attached.") {
+		t.Errorf("Expected the note followed by the original text, got %q", forward.TextContent)
+	}
+	if len(forward.Attachments) != 1 || forward.Attachments[0].Path != path || forward.Attachments[0].EmailID != forward.ID {
+		t.Errorf("Expected the original attachment to be forwarded, got %+v", forward.Attachments)
+	}
+
+	// Forwarding without the attachments
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/emails/reply-account-3/forward",
+		strings.NewReader(`{"to": [{"email": "dave@example.com"}], "include_attachments": false}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	if len(smtpClient.sent) != 2 || len(smtpClient.sent[1].Attachments) != 0 {
+		t.Error("Expected the forward without attachments to be sent")
+	}
+}
+
+func TestReplyRequestErrors(t *testing.T) {
+	registerTestSMTPClient(t, "reply-account", &fakeSMTPClient{sender: "me@example.com"})
+	handler := NewAPI(newReplyTestStore(), nil, nil).SetupRoutes()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"reply without content", http.MethodPost, "/emails/reply-account-3/reply", `{}`, http.StatusBadRequest},
+		{"reply unknown email", http.MethodPost, "/emails/reply-account-9/reply", `{"text_content": "Hi"}`, http.StatusNotFound},
+		{"forward without recipients", http.MethodPost, "/emails/reply-account-3/forward", `{}`, http.StatusBadRequest},
+		{"forward missing attachment", http.MethodPost, "/emails/reply-account-3/forward", `{"to": [{"email": "dave@example.com"}], "attachment_paths": ["/does/not/exist"]}`, http.StatusBadRequest},
+		{"reply method", http.MethodGet, "/emails/reply-account-3/reply", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d (%s)", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
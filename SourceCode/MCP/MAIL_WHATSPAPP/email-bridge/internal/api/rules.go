@@ -0,0 +1,205 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/rules"
+)
+
+// ruleRequest is the body of requests that create or replace a mail rule
+type ruleRequest struct {
+	Name      string `json:"name"`
+	AccountID string `json:"account_id"`
+	// Enabled defaults to true for new rules and to the current value on updates
+	Enabled        *bool                 `json:"enabled"`
+	Priority       int                   `json:"priority"`
+	StopProcessing bool                  `json:"stop_processing"`
+	Conditions     models.RuleConditions `json:"conditions"`
+	Actions        []models.RuleAction   `json:"actions"`
+}
+
+// handleRules handles mail rule requests
+func (api *API) handleRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.listRules(w, r)
+	case http.MethodPost:
+		api.createRule(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRuleByID handles requests for a specific mail rule
+func (api *API) handleRuleByID(w http.ResponseWriter, r *http.Request) {
+	// The path should be in the format "/rules/{id}"
+	ruleID := strings.TrimPrefix(r.URL.Path, "/rules/")
+	if ruleID == "" || strings.Contains(ruleID, "/") {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getRule(w, ruleID)
+	case http.MethodPut:
+		api.updateRule(w, r, ruleID)
+	case http.MethodDelete:
+		api.deleteRule(w, ruleID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listRules handles GET requests to list the mail rules in the order they are
+// evaluated, optionally those that apply to one account
+func (api *API) listRules(w http.ResponseWriter, r *http.Request) {
+	all, err := api.store.GetMailRules()
+	if err != nil {
+		http.Error(w, "Failed to list rules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Rules []models.MailRule `json:"rules"`
+	}{
+		Rules: []models.MailRule{},
+	}
+
+	accountID := r.URL.Query().Get("account_id")
+	for _, rule := range all {
+		if accountID == "" || rule.AccountID == "" || rule.AccountID == accountID {
+			response.Rules = append(response.Rules, rule)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getRule handles GET requests for a mail rule
+func (api *API) getRule(w http.ResponseWriter, ruleID string) {
+	rule, ok := api.storedRule(w, ruleID)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rule)
+}
+
+// createRule handles POST requests to add a mail rule
+func (api *API) createRule(w http.ResponseWriter, r *http.Request) {
+	var request ruleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	rule := models.MailRule{
+		ID:        generateRuleID(),
+		Enabled:   true,
+		CreatedAt: now,
+	}
+	api.saveRule(w, r, rule, request, http.StatusCreated)
+}
+
+// updateRule handles PUT requests to replace the name, conditions and actions of a
+// mail rule
+func (api *API) updateRule(w http.ResponseWriter, r *http.Request, ruleID string) {
+	rule, ok := api.storedRule(w, ruleID)
+	if !ok {
+		return
+	}
+
+	var request ruleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	api.saveRule(w, r, rule, request, http.StatusOK)
+}
+
+// saveRule applies a request to a rule, validates it and stores it, writing the rule
+// with the given status. Forwards and webhooks send emails out without approval, so a
+// client whose emails need approval can't set them up.
+func (api *API) saveRule(w http.ResponseWriter, r *http.Request, rule models.MailRule, request ruleRequest, status int) {
+	if submitter := requestClientID(r); api.requiresApproval(submitter) && sendsEmailsOut(request.Actions) {
+		http.Error(w, "Client "+submitter+" can't create rules that forward emails or call webhooks", http.StatusForbidden)
+		return
+	}
+
+	rule.Name = request.Name
+	rule.AccountID = request.AccountID
+	if request.Enabled != nil {
+		rule.Enabled = *request.Enabled
+	}
+	rule.Priority = request.Priority
+	rule.StopProcessing = request.StopProcessing
+	rule.Conditions = request.Conditions
+	rule.Actions = request.Actions
+	rule.UpdatedAt = time.Now()
+
+	if err := rules.Validate(rule); err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := api.store.StoreMailRule(rule); err != nil {
+		http.Error(w, "Failed to save rule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, status, rule)
+}
+
+// sendsEmailsOut reports whether rule actions send emails outside the mailbox
+func sendsEmailsOut(actions []models.RuleAction) bool {
+	for _, action := range actions {
+		if action.Type == models.RuleActionForward || action.Type == models.RuleActionWebhook {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteRule handles DELETE requests to remove a mail rule
+func (api *API) deleteRule(w http.ResponseWriter, ruleID string) {
+	if err := api.store.DeleteMailRule(ruleID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete rule: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storedRule retrieves a mail rule. It writes an error response and returns false if
+// there is none.
+func (api *API) storedRule(w http.ResponseWriter, ruleID string) (models.MailRule, bool) {
+	rule, err := api.store.GetMailRule(ruleID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve rule: "+err.Error(), http.StatusInternalServerError)
+		}
+		return rule, false
+	}
+
+	return rule, true
+}
+
+// generateRuleID generates a unique ID for a mail rule
+func generateRuleID() string {
+	return fmt.Sprintf("rule_%d", time.Now().UnixNano())
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// ruleStore keeps mail rules in memory
+type ruleStore struct {
+	store.Store
+	rules []models.MailRule
+}
+
+func (s *ruleStore) StoreMailRule(rule models.MailRule) error {
+	for i := range s.rules {
+		if s.rules[i].ID == rule.ID {
+			s.rules[i] = rule
+			return nil
+		}
+	}
+	s.rules = append(s.rules, rule)
+	return nil
+}
+
+func (s *ruleStore) GetMailRule(id string) (models.MailRule, error) {
+	for _, rule := range s.rules {
+		if rule.ID == id {
+			return rule, nil
+		}
+	}
+	return models.MailRule{}, sql.ErrNoRows
+}
+
+func (s *ruleStore) GetMailRules() ([]models.MailRule, error) {
+	return s.rules, nil
+}
+
+func (s *ruleStore) DeleteMailRule(id string) error {
+	for i, rule := range s.rules {
+		if rule.ID == id {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func TestMailRules(t *testing.T) {
+	s := &ruleStore{}
+	handler := NewAPI(s, nil, nil).SetupRoutes()
+
+	request := func(method string, target string, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := request(http.MethodPost, "/rules", `{
+		"name": "Settlement files",
+		"account_id": "acct",
+		"conditions": {"from": "@benow\\.in$", "attachment_type": "\\.xlsb$"},
+		"actions": [{"type": "tag", "tag": "recon"}, {"type": "move", "folder": "Settlements"}]
+	}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	var rule models.MailRule
+	if err := json.NewDecoder(rec.Body).Decode(&rule); err != nil {
+		t.Fatalf("Failed to decode rule: %v", err)
+	}
+	if rule.ID == "" || !rule.Enabled || rule.Conditions.From != "@benow\\.in$" || len(rule.Actions) != 2 {
+		t.Errorf("Unexpected rule %+v", rule)
+	}
+
+	// Rules for all accounts are listed with those of the account
+	s.rules = append(s.rules, models.MailRule{ID: "global", Enabled: true, Actions: []models.RuleAction{{Type: models.RuleActionFlag}}})
+	s.rules = append(s.rules, models.MailRule{ID: "other", AccountID: "other", Actions: []models.RuleAction{{Type: models.RuleActionFlag}}})
+	var list struct {
+		Rules []models.MailRule `json:"rules"`
+	}
+	rec = request(http.MethodGet, "/rules?account_id=acct", "")
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list.Rules) != 2 {
+		t.Errorf("Expected the account's rule and the global rule, got %+v (%v)", list.Rules, err)
+	}
+
+	// Updates replace the rule but keep it enabled unless told otherwise
+	rec = request(http.MethodPut, "/rules/"+rule.ID, `{"name": "Settlements", "priority": 5, "actions": [{"type": "mark_read"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	updated, _ := s.GetMailRule(rule.ID)
+	if updated.Name != "Settlements" || updated.Priority != 5 || !updated.Enabled || updated.AccountID != "" ||
+		updated.Conditions.From != "" || !updated.CreatedAt.Equal(rule.CreatedAt) {
+		t.Errorf("Unexpected updated rule %+v", updated)
+	}
+	rec = request(http.MethodPut, "/rules/"+rule.ID, `{"enabled": false, "actions": [{"type": "mark_read"}]}`)
+	if updated, _ := s.GetMailRule(rule.ID); rec.Code != http.StatusOK || updated.Enabled {
+		t.Errorf("Expected the rule to be disabled, got %d %+v", rec.Code, updated)
+	}
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		code   int
+	}{
+		{http.MethodGet, "/rules/" + rule.ID, "", http.StatusOK},
+		{http.MethodGet, "/rules/missing", "", http.StatusNotFound},
+		{http.MethodPost, "/rules", `{"actions": []}`, http.StatusBadRequest},
+		{http.MethodPost, "/rules", `{"conditions": {"subject": "("}, "actions": [{"type": "flag"}]}`, http.StatusBadRequest},
+		{http.MethodPost, "/rules", `{"actions": [{"type": "delete"}]}`, http.StatusBadRequest},
+		{http.MethodPost, "/rules", `not json`, http.StatusBadRequest},
+		{http.MethodPut, "/rules/missing", `{"actions": [{"type": "flag"}]}`, http.StatusNotFound},
+		{http.MethodPatch, "/rules/" + rule.ID, "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/rules/a/b", "", http.StatusBadRequest},
+		{http.MethodDelete, "/rules/" + rule.ID, "", http.StatusNoContent},
+		{http.MethodDelete, "/rules/" + rule.ID, "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if rec := request(test.method, test.target, test.body); rec.Code != test.code {
+			t.Errorf("%s %s: expected status %d, got %d (%s)", test.method, test.target, test.code, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// TestMailRulesApproval tests that a client whose emails need approval can't set up
+// rules that send emails out, which would skip the approval
+func TestMailRulesApproval(t *testing.T) {
+	s := &ruleStore{}
+	api := NewAPI(s, nil, nil)
+	api.SetClientTokens(map[string]string{"agent-token": "agent", "alice-token": "alice"})
+	api.SetApprovalClients([]string{"agent"})
+	handler := api.SetupRoutes()
+
+	request := func(method, target, clientID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+clientID+"-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	forward := `{"actions": [{"type": "forward", "to": [{"email": "outside@example.com"}]}]}`
+	webhook := `{"actions": [{"type": "webhook", "url": "https://example.com/hook"}]}`
+	for _, body := range []string{forward, webhook} {
+		if rec := request(http.MethodPost, "/rules", "agent", body); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d for the agent, got %d (%s)", http.StatusForbidden, rec.Code, rec.Body.String())
+		}
+	}
+	if len(s.rules) != 0 {
+		t.Fatalf("Expected no rules to be stored, got %+v", s.rules)
+	}
+
+	// Other actions are fine, but a rule can't be changed to send emails out either
+	rec := request(http.MethodPost, "/rules", "agent", `{"actions": [{"type": "flag"}]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	ruleID := s.rules[0].ID
+	if rec := request(http.MethodPut, "/rules/"+ruleID, "agent", forward); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d updating, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	// Clients whose emails are sent straight away can
+	if rec := request(http.MethodPut, "/rules/"+ruleID, "alice", forward); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d for alice, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// searchStore records the criteria of the last search and returns its emails
+type searchStore struct {
+	store.Store
+	criteria models.SearchCriteria
+	emails   []models.Email
+	err      error
+}
+
+func (s *searchStore) SearchEmails(criteria models.SearchCriteria) ([]models.Email, error) {
+	s.criteria = criteria
+	return s.emails, s.err
+}
+
+func (s *searchStore) CountEmails(criteria models.SearchCriteria) (int, error) {
+	return len(s.emails), nil
+}
+
+func TestListEmailsQueryLanguage(t *testing.T) {
+	s := &searchStore{}
+	handler := NewAPI(s, nil, nil).SetupRoutes()
+
+	// Query parameters take precedence over the same operator in q
+	target := "/emails?q=" + "from%3Aalice+in%3AINBOX+-is%3Aread+(invoice+OR+receipt)" + "&folder=Archive&query=march"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	if s.criteria.FromAddress != "alice" {
+		t.Errorf("Expected from alice, got %q", s.criteria.FromAddress)
+	}
+	if s.criteria.Folder != "Archive" {
+		t.Errorf("Expected the folder parameter to override in:, got %q", s.criteria.Folder)
+	}
+	if s.criteria.IsRead == nil || *s.criteria.IsRead {
+		t.Errorf("Expected unread emails, got %v", s.criteria.IsRead)
+	}
+	if s.criteria.Query != "march" {
+		t.Errorf("Expected query march, got %q", s.criteria.Query)
+	}
+	if s.criteria.Expression == nil || s.criteria.Expression.Op != models.SearchOr {
+		t.Errorf("Expected the OR group in the expression, got %+v", s.criteria.Expression)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/emails?q=%28from%3Aalice", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid query, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestListEmailsCursor(t *testing.T) {
+	s := &searchStore{}
+	for i := 1; i <= 3; i++ {
+		s.emails = append(s.emails, models.Email{ID: fmt.Sprintf("acct-%d", i), Cursor: fmt.Sprintf("cursor-%d", i)})
+	}
+	handler := NewAPI(s, nil, nil).SetupRoutes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/emails?limit=2&sort_by=subject&sort_order=desc&cursor=cursor-0", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	// One extra email is fetched to tell whether there is a next page
+	if s.criteria.Limit != 3 || s.criteria.Cursor != "cursor-0" {
+		t.Errorf("Unexpected criteria %+v", s.criteria)
+	}
+	if s.criteria.SortBy != store.SortBySubject || s.criteria.SortOrder != "desc" {
+		t.Errorf("Expected the sort to be passed to the store, got %q %q", s.criteria.SortBy, s.criteria.SortOrder)
+	}
+
+	var response struct {
+		Emails     []models.Email `json:"emails"`
+		TotalCount int            `json:"total_count"`
+		Limit      int            `json:"limit"`
+		NextCursor string         `json:"next_cursor"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Emails) != 2 || response.Limit != 2 || response.TotalCount != 3 {
+		t.Errorf("Unexpected page %+v", response)
+	}
+	if response.NextCursor != "cursor-2" {
+		t.Errorf("Expected the cursor of the last email, got %q", response.NextCursor)
+	}
+
+	// The last page has no next cursor
+	s.emails = s.emails[:2]
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/emails?limit=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var last map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&last); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if _, ok := last["next_cursor"]; ok {
+		t.Errorf("Expected no next cursor on the last page, got %v", last["next_cursor"])
+	}
+
+	s.err = fmt.Errorf("%w: bad encoding", store.ErrInvalidCursor)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/emails?cursor=nope", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid cursor, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/emails?sort_by=size", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid sort, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
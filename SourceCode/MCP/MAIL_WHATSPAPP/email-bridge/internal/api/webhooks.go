@@ -0,0 +1,342 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/webhooks"
+)
+
+const (
+	// defaultDeliveryLimit is how many webhook deliveries are listed by default
+	defaultDeliveryLimit = 100
+	// maxDeliveryLimit caps how many webhook deliveries are listed at once
+	maxDeliveryLimit = 1000
+)
+
+// webhookRequest is the body of requests that create or replace a webhook
+type webhookRequest struct {
+	AccountID  string   `json:"account_id"`
+	EventTypes []string `json:"event_types"`
+	URL        string   `json:"url"`
+	// Secret defaults to a random secret for new webhooks and to the current one on
+	// updates
+	Secret string `json:"secret"`
+	// Enabled defaults to true for new webhooks and to the current value on updates
+	Enabled *bool `json:"enabled"`
+}
+
+// SetWebhookDispatcher sets the dispatcher that replays dead webhook deliveries
+func (api *API) SetWebhookDispatcher(dispatcher *webhooks.Dispatcher) {
+	api.replayDelivery = dispatcher.Replay
+}
+
+// handleWebhooks handles webhook requests
+func (api *API) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.listWebhooks(w, r)
+	case http.MethodPost:
+		api.createWebhook(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWebhookByID handles requests for a specific webhook and for the delivery log
+func (api *API) handleWebhookByID(w http.ResponseWriter, r *http.Request) {
+	// The path should be in the format "/webhooks/{id}" or "/webhooks/deliveries..."
+	path := strings.TrimPrefix(r.URL.Path, "/webhooks/")
+	if path == "deliveries" || strings.HasPrefix(path, "deliveries/") {
+		api.handleWebhookDeliveries(w, r, strings.TrimPrefix(strings.TrimPrefix(path, "deliveries"), "/"))
+		return
+	}
+
+	webhookID := path
+	if webhookID == "" || strings.Contains(webhookID, "/") {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getWebhook(w, webhookID)
+	case http.MethodPut:
+		api.updateWebhook(w, r, webhookID)
+	case http.MethodDelete:
+		api.deleteWebhook(w, webhookID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listWebhooks handles GET requests to list the webhooks, optionally those that get
+// the events of one account
+func (api *API) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	all, err := api.store.GetWebhooks()
+	if err != nil {
+		http.Error(w, "Failed to list webhooks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Webhooks []models.Webhook `json:"webhooks"`
+	}{
+		Webhooks: []models.Webhook{},
+	}
+
+	accountID := r.URL.Query().Get("account_id")
+	for _, webhook := range all {
+		if accountID == "" || webhook.AccountID == "" || webhook.AccountID == accountID {
+			webhook.Secret = ""
+			response.Webhooks = append(response.Webhooks, webhook)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getWebhook handles GET requests for a webhook. Its secret is not returned.
+func (api *API) getWebhook(w http.ResponseWriter, webhookID string) {
+	webhook, ok := api.storedWebhook(w, webhookID)
+	if !ok {
+		return
+	}
+
+	webhook.Secret = ""
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// createWebhook handles POST requests to add a webhook. The response holds the secret
+// its requests are signed with, which is not returned again.
+func (api *API) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var request webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if request.Secret == "" {
+		secret, err := webhooks.GenerateSecret()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		request.Secret = secret
+	}
+
+	now := time.Now()
+	webhook := models.Webhook{
+		ID:        generateWebhookID(),
+		Enabled:   true,
+		CreatedAt: now,
+	}
+	if !api.saveWebhook(w, &webhook, request) {
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, webhook)
+}
+
+// updateWebhook handles PUT requests to replace the account, event types and URL of a
+// webhook
+func (api *API) updateWebhook(w http.ResponseWriter, r *http.Request, webhookID string) {
+	webhook, ok := api.storedWebhook(w, webhookID)
+	if !ok {
+		return
+	}
+
+	var request webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Secret == "" {
+		request.Secret = webhook.Secret
+	}
+
+	if !api.saveWebhook(w, &webhook, request) {
+		return
+	}
+
+	webhook.Secret = ""
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// saveWebhook applies a request to a webhook, validates it and stores it. It writes an
+// error response and returns false if it couldn't.
+func (api *API) saveWebhook(w http.ResponseWriter, webhook *models.Webhook, request webhookRequest) bool {
+	webhook.AccountID = request.AccountID
+	webhook.EventTypes = request.EventTypes
+	webhook.URL = request.URL
+	webhook.Secret = request.Secret
+	if request.Enabled != nil {
+		webhook.Enabled = *request.Enabled
+	}
+	webhook.UpdatedAt = time.Now()
+
+	if err := webhooks.Validate(*webhook); err != nil {
+		http.Error(w, "Invalid webhook: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if err := api.store.StoreWebhook(*webhook); err != nil {
+		http.Error(w, "Failed to save webhook: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+// deleteWebhook handles DELETE requests to remove a webhook with its deliveries
+func (api *API) deleteWebhook(w http.ResponseWriter, webhookID string) {
+	if err := api.store.DeleteWebhook(webhookID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete webhook: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storedWebhook retrieves a webhook. It writes an error response and returns false if
+// there is none.
+func (api *API) storedWebhook(w http.ResponseWriter, webhookID string) (models.Webhook, bool) {
+	webhook, err := api.store.GetWebhook(webhookID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve webhook: "+err.Error(), http.StatusInternalServerError)
+		}
+		return webhook, false
+	}
+
+	return webhook, true
+}
+
+// handleWebhookDeliveries handles requests for the webhook delivery log. The path after
+// "/webhooks/deliveries/" is empty, "{id}" or "{id}/replay".
+func (api *API) handleWebhookDeliveries(w http.ResponseWriter, r *http.Request, path string) {
+	if path == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		api.listWebhookDeliveries(w, r)
+		return
+	}
+
+	deliveryID, action, _ := strings.Cut(path, "/")
+	if strings.Contains(action, "/") {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		api.getWebhookDelivery(w, deliveryID)
+	case "replay":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		api.replayWebhookDelivery(w, deliveryID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// listWebhookDeliveries handles GET requests to list webhook deliveries, most recent
+// first, optionally those of one webhook or with one status. status=dead lists the
+// dead-letter list.
+func (api *API) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := defaultDeliveryLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit value. Must be a positive integer.", http.StatusBadRequest)
+			return
+		}
+		if limit > maxDeliveryLimit {
+			limit = maxDeliveryLimit
+		}
+	}
+
+	deliveries, err := api.store.GetWebhookDeliveries(query.Get("webhook_id"), query.Get("status"), limit)
+	if err != nil {
+		http.Error(w, "Failed to list webhook deliveries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Deliveries []models.WebhookDelivery `json:"deliveries"`
+	}{
+		Deliveries: deliveries,
+	}
+	if response.Deliveries == nil {
+		response.Deliveries = []models.WebhookDelivery{}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getWebhookDelivery handles GET requests for a webhook delivery
+func (api *API) getWebhookDelivery(w http.ResponseWriter, deliveryID string) {
+	delivery, err := api.store.GetWebhookDelivery(deliveryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Webhook delivery not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve webhook delivery: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+// replayWebhookDelivery handles POST requests to queue a dead webhook delivery again
+func (api *API) replayWebhookDelivery(w http.ResponseWriter, deliveryID string) {
+	if api.replayDelivery == nil {
+		http.Error(w, "Webhooks not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	delivery, err := api.replayDelivery(deliveryID)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			http.Error(w, "Webhook delivery not found", http.StatusNotFound)
+		case errors.Is(err, webhooks.ErrDeliveryNotDead):
+			http.Error(w, "Webhook delivery is "+delivery.Status+" and can't be replayed", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to replay webhook delivery: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, delivery)
+}
+
+// generateWebhookID generates a unique ID for a webhook
+func generateWebhookID() string {
+	return fmt.Sprintf("webhook_%d", time.Now().UnixNano())
+}
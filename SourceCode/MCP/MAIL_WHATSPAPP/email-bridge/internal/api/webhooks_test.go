@@ -0,0 +1,190 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+	"github.com/user/email-bridge/internal/webhooks"
+)
+
+// webhookStore keeps webhooks and their deliveries in memory
+type webhookStore struct {
+	store.Store
+	webhooks   []models.Webhook
+	deliveries []models.WebhookDelivery
+}
+
+func (s *webhookStore) StoreWebhook(webhook models.Webhook) error {
+	for i := range s.webhooks {
+		if s.webhooks[i].ID == webhook.ID {
+			s.webhooks[i] = webhook
+			return nil
+		}
+	}
+	s.webhooks = append(s.webhooks, webhook)
+	return nil
+}
+
+func (s *webhookStore) GetWebhook(id string) (models.Webhook, error) {
+	for _, webhook := range s.webhooks {
+		if webhook.ID == id {
+			return webhook, nil
+		}
+	}
+	return models.Webhook{}, sql.ErrNoRows
+}
+
+func (s *webhookStore) GetWebhooks() ([]models.Webhook, error) {
+	return s.webhooks, nil
+}
+
+func (s *webhookStore) DeleteWebhook(id string) error {
+	for i, webhook := range s.webhooks {
+		if webhook.ID == id {
+			s.webhooks = append(s.webhooks[:i], s.webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s *webhookStore) GetWebhookDelivery(id string) (models.WebhookDelivery, error) {
+	for _, delivery := range s.deliveries {
+		if delivery.ID == id {
+			return delivery, nil
+		}
+	}
+	return models.WebhookDelivery{}, sql.ErrNoRows
+}
+
+func (s *webhookStore) GetWebhookDeliveries(webhookID, status string, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if (webhookID == "" || delivery.WebhookID == webhookID) && (status == "" || delivery.Status == status) &&
+			len(deliveries) < limit {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func TestWebhooks(t *testing.T) {
+	s := &webhookStore{}
+	api := NewAPI(s, nil, nil)
+	handler := api.SetupRoutes()
+
+	request := func(method string, target string, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := request(http.MethodPost, "/webhooks", `{
+		"account_id": "acct",
+		"event_types": ["new"],
+		"url": "https://recon.example.com/hooks/email"
+	}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	var webhook models.Webhook
+	if err := json.NewDecoder(rec.Body).Decode(&webhook); err != nil {
+		t.Fatalf("Failed to decode webhook: %v", err)
+	}
+	if webhook.ID == "" || !webhook.Enabled || len(webhook.Secret) != 64 || webhook.EventTypes[0] != "new" {
+		t.Errorf("Unexpected webhook %+v", webhook)
+	}
+
+	// The secret is only returned when the webhook is created
+	rec = request(http.MethodGet, "/webhooks/"+webhook.ID, "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), webhook.Secret) {
+		t.Errorf("Expected the webhook without its secret, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = request(http.MethodGet, "/webhooks?account_id=acct", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), webhook.ID) || strings.Contains(rec.Body.String(), webhook.Secret) {
+		t.Errorf("Expected the webhook to be listed without its secret, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec = request(http.MethodGet, "/webhooks?account_id=other", ""); strings.Contains(rec.Body.String(), webhook.ID) {
+		t.Errorf("Expected the webhook not to be listed for another account, got %s", rec.Body.String())
+	}
+
+	// Updates keep the secret and the enabled state unless told otherwise
+	rec = request(http.MethodPut, "/webhooks/"+webhook.ID, `{"url": "https://recon.example.com/v2", "event_types": ["new", "moved"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	updated, _ := s.GetWebhook(webhook.ID)
+	if updated.URL != "https://recon.example.com/v2" || updated.Secret != webhook.Secret || !updated.Enabled ||
+		updated.AccountID != "" || len(updated.EventTypes) != 2 {
+		t.Errorf("Unexpected updated webhook %+v", updated)
+	}
+
+	s.deliveries = []models.WebhookDelivery{
+		{ID: "delivery-1", WebhookID: webhook.ID, EventType: "new", Status: models.WebhookDeliveryDelivered},
+		{ID: "delivery-2", WebhookID: webhook.ID, EventType: "new", Status: models.WebhookDeliveryDead, LastError: "webhook returned 500"},
+	}
+	var list struct {
+		Deliveries []models.WebhookDelivery `json:"deliveries"`
+	}
+	rec = request(http.MethodGet, "/webhooks/deliveries?status=dead", "")
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list.Deliveries) != 1 || list.Deliveries[0].ID != "delivery-2" {
+		t.Errorf("Expected the dead delivery, got %+v (%v)", list.Deliveries, err)
+	}
+
+	var replayed []string
+	api.replayDelivery = func(deliveryID string) (models.WebhookDelivery, error) {
+		delivery, err := s.GetWebhookDelivery(deliveryID)
+		if err != nil {
+			return delivery, err
+		}
+		if delivery.Status != models.WebhookDeliveryDead {
+			return delivery, webhooks.ErrDeliveryNotDead
+		}
+		replayed = append(replayed, deliveryID)
+		return delivery, nil
+	}
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		code   int
+	}{
+		{http.MethodGet, "/webhooks/deliveries?webhook_id=" + webhook.ID + "&limit=1", "", http.StatusOK},
+		{http.MethodGet, "/webhooks/deliveries?limit=0", "", http.StatusBadRequest},
+		{http.MethodGet, "/webhooks/deliveries/delivery-1", "", http.StatusOK},
+		{http.MethodGet, "/webhooks/deliveries/missing", "", http.StatusNotFound},
+		{http.MethodPost, "/webhooks/deliveries/delivery-2/replay", "", http.StatusAccepted},
+		{http.MethodPost, "/webhooks/deliveries/delivery-1/replay", "", http.StatusConflict},
+		{http.MethodPost, "/webhooks/deliveries/missing/replay", "", http.StatusNotFound},
+		{http.MethodGet, "/webhooks/deliveries/delivery-2/replay", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/webhooks", `{"url": "ftp://example.com"}`, http.StatusBadRequest},
+		{http.MethodPost, "/webhooks", `{"url": "https://example.com", "event_types": ["arrived"]}`, http.StatusBadRequest},
+		{http.MethodPost, "/webhooks", `not json`, http.StatusBadRequest},
+		{http.MethodPut, "/webhooks/missing", `{"url": "https://example.com"}`, http.StatusNotFound},
+		{http.MethodPatch, "/webhooks/" + webhook.ID, "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/webhooks/a/b", "", http.StatusBadRequest},
+		{http.MethodDelete, "/webhooks/" + webhook.ID, "", http.StatusNoContent},
+		{http.MethodDelete, "/webhooks/" + webhook.ID, "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if rec := request(test.method, test.target, test.body); rec.Code != test.code {
+			t.Errorf("%s %s: expected status %d, got %d (%s)", test.method, test.target, test.code, rec.Code, rec.Body.String())
+		}
+	}
+	if len(replayed) != 1 || replayed[0] != "delivery-2" {
+		t.Errorf("Expected delivery-2 to be replayed, got %v", replayed)
+	}
+
+	// Replaying needs the dispatcher
+	api.replayDelivery = nil
+	if rec := request(http.MethodPost, "/webhooks/deliveries/delivery-2/replay", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d without a dispatcher, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
@@ -0,0 +1,203 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// attachmentGracePeriod is how long a newly written attachment file is kept even if no
+// stored attachment refers to it yet, since it is written before its email is stored
+const attachmentGracePeriod = 10 * time.Minute
+
+// AttachmentStore keeps the contents of attachments in a directory, in files named by
+// the SHA-256 hash of their content, so that an attachment received many times is
+// stored once. Files are laid out as <dir>/sha256/<first two hex digits>/<hash>.
+type AttachmentStore struct {
+	dir string
+}
+
+// NewAttachmentStore creates an attachment store in a directory
+func NewAttachmentStore(dir string) *AttachmentStore {
+	return &AttachmentStore{dir: dir}
+}
+
+// Save writes content to the store, unless content with the same hash is already
+// stored, and returns the path of the file, the hex-encoded hash and the size
+func (a *AttachmentStore) Save(content io.Reader) (string, string, int64, error) {
+	root := filepath.Join(a.dir, "sha256")
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return "", "", 0, fmt.Errorf("failed to create attachment directory: %w", err)
+	}
+
+	// Write to a temporary file first so that a failed write never leaves a partial file
+	// behind under a hash
+	tmp, err := os.CreateTemp(root, ".download-*")
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to create attachment file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to write attachment file: %w", err)
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	path := a.path(hash)
+
+	if _, err := os.Stat(path); err == nil {
+		// Already stored; mark it as in use so it isn't pruned before its new
+		// attachment is stored
+		now := time.Now()
+		if err := os.Chtimes(path, now, now); err != nil {
+			return "", "", 0, fmt.Errorf("failed to update attachment file: %w", err)
+		}
+		return path, hash, size, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", "", 0, fmt.Errorf("failed to create attachment directory: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", "", 0, fmt.Errorf("failed to store attachment file: %w", err)
+	}
+
+	return path, hash, size, nil
+}
+
+// Download fetches an attachment of an email from the IMAP server into the store and
+// records its path, hash and size in s
+func (a *AttachmentStore) Download(s store.Store, imapClient IMAPClient, email models.Email, attachment models.Attachment) (models.Attachment, error) {
+	if !imapClient.IsConnected() {
+		if err := imapClient.Connect(); err != nil {
+			return attachment, fmt.Errorf("failed to connect to IMAP server: %w", err)
+		}
+	}
+
+	content, err := imapClient.GetAttachment(email.Folder, attachment)
+	if err != nil {
+		return attachment, fmt.Errorf("failed to download attachment: %w", err)
+	}
+	defer content.Close()
+
+	path, hash, size, err := a.Save(content)
+	if err != nil {
+		return attachment, err
+	}
+
+	attachment.Path = path
+	attachment.Hash = hash
+	attachment.Size = size
+	if err := s.StoreAttachment(attachment); err != nil {
+		return attachment, fmt.Errorf("failed to store attachment path: %w", err)
+	}
+	return attachment, nil
+}
+
+// Release removes the files of an email's attachments that no stored attachment refers
+// to any more. It is called after the email is deleted from the store.
+func (a *AttachmentStore) Release(s store.Store, email models.Email) error {
+	for _, attachment := range email.Attachments {
+		if attachment.Hash == "" {
+			continue
+		}
+		if _, err := a.remove(s, attachment.Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune removes the files that no stored attachment refers to, which deleting emails
+// without releasing them leaves behind, and returns how many were removed
+func (a *AttachmentStore) Prune(s store.Store) (int, error) {
+	root := filepath.Join(a.dir, "sha256")
+	removed := 0
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+
+		hash := info.Name()
+		if path != a.path(hash) {
+			return nil // Not a file of the store
+		}
+
+		ok, err := a.remove(s, hash)
+		if ok {
+			removed++
+		}
+		return err
+	})
+
+	return removed, err
+}
+
+// remove deletes the file with a hash unless a stored attachment refers to it or it was
+// written within the grace period, and reports whether it was deleted
+func (a *AttachmentStore) remove(s store.Store, hash string) (bool, error) {
+	path := a.path(hash)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if time.Since(info.ModTime()) < attachmentGracePeriod {
+		return false, nil
+	}
+
+	referenced, err := s.AttachmentHashReferenced(hash)
+	if err != nil {
+		return false, fmt.Errorf("failed to check references to attachment %s: %w", hash, err)
+	}
+	if referenced {
+		return false, nil
+	}
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to remove attachment file: %w", err)
+	}
+	return true, nil
+}
+
+// path returns the path of the file with a hash
+func (a *AttachmentStore) path(hash string) string {
+	prefix := hash
+	if len(prefix) > 2 {
+		prefix = prefix[:2]
+	}
+	return filepath.Join(a.dir, "sha256", prefix, hash)
+}
+
+// pruneAttachments removes the files in an attachment directory that no stored
+// attachment refers to. Failures are only logged, since they leave nothing broken.
+func pruneAttachments(s store.Store, dir string) {
+	if _, err := NewAttachmentStore(dir).Prune(s); err != nil {
+		fmt.Printf("Warning: Failed to prune attachments in %s: %v\n", dir, err)
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/assert"
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+)
+
+// age makes a file look older than the grace period so it can be removed
+func age(t *testing.T, path string) {
+	old := time.Now().Add(-2 * attachmentGracePeriod)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Failed to age %s: %v", path, err)
+	}
+}
+
+func TestAttachmentStore(t *testing.T) {
+	dir := t.TempDir()
+	attachments := NewAttachmentStore(dir)
+	s := newMemoryStore()
+
+	path, hash, size, err := attachments.Save(strings.NewReader("hello"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", hash)
+	assert.Equal(t, int64(5), size)
+	assert.Equal(t, filepath.Join(dir, "sha256", "2c", hash), path)
+
+	// The same content is stored once
+	again, _, _, err := attachments.Save(strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, path, again)
+	other, _, _, err := attachments.Save(strings.NewReader("other"))
+	assert.NoError(t, err)
+
+	first := models.Email{ID: "acct-1", Attachments: []models.Attachment{{ID: "acct-1-1", Path: path, Hash: hash}}}
+	second := models.Email{ID: "acct-2", Attachments: []models.Attachment{{ID: "acct-2-1", Path: path, Hash: hash}}}
+	s.emails[first.ID] = first
+	s.emails[second.ID] = second
+
+	// Newly written files are kept until their emails have had time to be stored
+	assert.NoError(t, attachments.Release(s, models.Email{Attachments: []models.Attachment{{Hash: hash}}}))
+	removed, err := attachments.Prune(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	assert.FileExists(t, other)
+
+	age(t, path)
+	age(t, other)
+
+	// A file is kept while another email refers to it
+	delete(s.emails, first.ID)
+	assert.NoError(t, attachments.Release(s, first))
+	assert.FileExists(t, path)
+
+	delete(s.emails, second.ID)
+	assert.NoError(t, attachments.Release(s, second))
+	assert.NoFileExists(t, path)
+
+	// Files left behind by deletions that didn't release them are pruned
+	removed, err = attachments.Prune(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.NoFileExists(t, other)
+
+	// Pruning a store that was never written to does nothing
+	removed, err = NewAttachmentStore(filepath.Join(dir, "missing")).Prune(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+}
+
+func TestParseMessageSavesAttachments(t *testing.T) {
+	dir := t.TempDir()
+	client := NewIMAPClientImpl(config.AccountConfig{ID: "account"})
+
+	msg := &imap.Message{
+		Uid:           7,
+		Envelope:      &imap.Envelope{Subject: "Attachments", MessageId: "<a@example.com>"},
+		BodyStructure: attachmentTestStructure(),
+		Body: map[*imap.BodySectionName]imap.Literal{
+			{}: bytes.NewBufferString(attachmentTestMessage),
+		},
+	}
+
+	email, err := client.parseMessageWithAttachments(msg, "INBOX", NewAttachmentStore(dir))
+	if !assert.NoError(t, err) || !assert.NotEmpty(t, email.Attachments) {
+		return
+	}
+
+	report := email.Attachments[0]
+	assert.Equal(t, "report.pdf", report.Filename)
+	assert.Equal(t, int64(5), report.Size)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", report.Hash)
+	content, err := os.ReadFile(report.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	for _, attachment := range email.Attachments {
+		assert.True(t, strings.HasPrefix(attachment.Path, dir), "attachment %s stored outside %s", attachment.ID, dir)
+	}
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/user/email-bridge/internal/config"
@@ -62,16 +63,22 @@ type IMAPClient interface {
 	MonitorMailbox(callback func(models.Email)) error
 	// StopMonitoring stops monitoring for new emails
 	StopMonitoring() error
-	// MarkAsRead marks an email as read
-	MarkAsRead(emailID string) error
-	// MarkAsUnread marks an email as unread
-	MarkAsUnread(emailID string) error
-	// MoveEmail moves an email to a different folder
-	MoveEmail(emailID string, folder string) error
-	// DeleteEmail deletes an email
-	DeleteEmail(emailID string) error
-	// GetAttachment downloads an attachment
-	GetAttachment(emailID string, attachmentID string) (models.Attachment, error)
+	// MarkAsRead marks an email in a folder as read
+	MarkAsRead(folder string, emailID string) error
+	// MarkAsUnread marks an email in a folder as unread
+	MarkAsUnread(folder string, emailID string) error
+	// AddFlag sets a flag or keyword, such as \Flagged, on an email in a folder
+	AddFlag(folder string, emailID string, flag string) error
+	// MoveEmail moves an email to a different folder and returns its ID there, or "" if unknown
+	MoveEmail(folder string, emailID string, destination string) (string, error)
+	// DeleteEmail moves an email to the trash folder, or expunges it if that isn't possible
+	DeleteEmail(folder string, emailID string) error
+	// ExpungeEmail deletes an email for good, without moving it to the trash folder
+	ExpungeEmail(folder string, emailID string) error
+	// AppendEmail adds a MIME message to a folder and returns its email ID there, or "" if unknown
+	AppendEmail(folder string, raw RawMessage, flags []string) (string, error)
+	// GetAttachment downloads the decoded content of an attachment of an email in a folder
+	GetAttachment(folder string, attachment models.Attachment) (io.ReadCloser, error)
 }
 
 // SMTPClient is the interface for SMTP operations
@@ -79,6 +86,9 @@ type SMTPClient interface {
 	EmailClient
 	// SendEmail sends an email
 	SendEmail(email models.Email) error
+	// SendEmailMessage sends an email and returns the MIME message that was sent, which
+	// the caller must close
+	SendEmailMessage(email models.Email) (*MessageFile, error)
 }
 
 // NewIMAPClient creates a new IMAP client
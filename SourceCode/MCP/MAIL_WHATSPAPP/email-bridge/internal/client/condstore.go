@@ -0,0 +1,340 @@
+package client
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+const (
+	// capCondstore lets a fetch ask only for the emails whose flags changed since a
+	// mod-sequence (RFC 7162)
+	capCondstore = "CONDSTORE"
+	// capQResync adds the UIDs expunged since a mod-sequence to such fetches
+	capQResync = "QRESYNC"
+	// statusHighestModSeq is the STATUS item holding a folder's HIGHESTMODSEQ
+	statusHighestModSeq imap.StatusItem = "HIGHESTMODSEQ"
+	// maxVanishedLookups caps how many UIDs reported expunged are looked up in the store
+	// one at a time. Servers may report ranges covering every UID ever expunged, for
+	// which checking the stored emails against the folder is cheaper.
+	maxVanishedLookups = 10000
+)
+
+// enableQResync enables QRESYNC on the connection if the server supports it, so that
+// syncs learn which emails were expunged from VANISHED responses. ENABLE is only
+// allowed before a folder is selected, so it is tried once per connection; connections
+// where it isn't enabled still sync flag changes with CONDSTORE.
+func (c *IMAPClientImpl) enableQResync() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.connected || c.client == nil || c.qresyncChecked == c.client {
+		return
+	}
+	c.qresyncChecked = c.client
+
+	if ok, err := c.client.Support(capQResync); err != nil || !ok {
+		return
+	}
+
+	enabled, err := c.client.Enable([]string{capQResync})
+	if err != nil {
+		return
+	}
+	for _, capability := range enabled {
+		if strings.EqualFold(capability, capQResync) {
+			c.qresyncConn = c.client
+		}
+	}
+}
+
+// folderModSeq returns the HIGHESTMODSEQ of a folder, or 0 if the server doesn't
+// support CONDSTORE or keep mod-sequences for the folder. It is read with STATUS before
+// the folder is selected, so changes made while the folder is synced are fetched again
+// by the next sync. The caller must hold the client mutex.
+func (c *IMAPClientImpl) folderModSeq(folder string) uint64 {
+	if c.qresyncConn == nil || c.qresyncConn != c.client {
+		if ok, err := c.client.Support(capCondstore); err != nil || !ok {
+			return 0
+		}
+	}
+
+	status, err := c.client.Status(folder, []imap.StatusItem{statusHighestModSeq})
+	if err != nil {
+		fmt.Printf("Warning: Failed to get the HIGHESTMODSEQ of folder %s: %v\n", folder, err)
+		return 0
+	}
+
+	modSeq, _ := parseModSeq(status.Items[statusHighestModSeq])
+	return modSeq
+}
+
+// syncChanges brings the read state of a folder's stored emails up to date and removes
+// the ones that are no longer in the folder. If the folder's changes were synced up to
+// a mod-sequence before, only the emails changed since are fetched, and with QRESYNC
+// the server reports the expunged ones too. Otherwise every stored email is checked
+// against the folder.
+func (c *IMAPClientImpl) syncChanges(s store.Store, folder string, accountID string, syncStatus store.SyncStatus, highestModSeq uint64) error {
+	if syncStatus.HighestModSeq == 0 || highestModSeq < syncStatus.HighestModSeq {
+		if err := c.syncEmailStatusChanges(s, folder, accountID); err != nil {
+			return fmt.Errorf("failed to sync email status changes: %w", err)
+		}
+		if err := c.syncMovedEmails(s, accountID, folder); err != nil {
+			return fmt.Errorf("failed to sync moved emails: %w", err)
+		}
+		return nil
+	}
+
+	c.mutex.Lock()
+	qresync := c.qresyncConn != nil && c.qresyncConn == c.client
+	c.mutex.Unlock()
+
+	var vanished *imap.SeqSet
+	if highestModSeq > syncStatus.HighestModSeq {
+		var err error
+		vanished, err = c.syncChangedSince(s, folder, accountID, syncStatus.HighestModSeq, syncStatus.LastUID, qresync)
+		if err != nil {
+			return fmt.Errorf("failed to sync email status changes: %w", err)
+		}
+	} else if qresync {
+		// Nothing changed or was expunged
+		vanished = new(imap.SeqSet)
+	}
+
+	// Without QRESYNC, expunges aren't reported and don't necessarily change the
+	// folder's HIGHESTMODSEQ
+	if vanished == nil {
+		if err := c.syncMovedEmails(s, accountID, folder); err != nil {
+			return fmt.Errorf("failed to sync moved emails: %w", err)
+		}
+		return nil
+	}
+
+	if err := c.removeVanished(s, folder, accountID, vanished, syncStatus.LastUID); err != nil {
+		return fmt.Errorf("failed to sync expunged emails: %w", err)
+	}
+	return nil
+}
+
+// syncChangedSince fetches the flags of the emails up to lastUID that changed since a
+// mod-sequence and updates the stored ones. With vanished, it also returns the UIDs the
+// server reports expunged since; otherwise, or if the server couldn't be asked for
+// them, it returns nil.
+func (c *IMAPClientImpl) syncChangedSince(s store.Store, folder string, accountID string, modSeq uint64, lastUID uint32, vanished bool) (*imap.SeqSet, error) {
+	if lastUID == 0 {
+		// No emails of this folder were synced
+		if vanished {
+			return new(imap.SeqSet), nil
+		}
+		return nil, nil
+	}
+
+	// CHANGEDSINCE applies to the selected folder, and another one may have been
+	// selected since the folder was synced, so the folder is selected again and the
+	// mutex held until the fetch is done
+	c.mutex.Lock()
+	if !c.connected || c.client == nil {
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("not connected to IMAP server")
+	}
+
+	if _, err := c.client.Select(folder, false); err != nil {
+		c.mutex.Unlock()
+		// Handle connection error
+		if c.handleConnectionError(err) {
+			// Try again once if it was a connection error that was fixed. QRESYNC is not
+			// enabled on the new connection.
+			return c.syncChangedSince(s, folder, accountID, modSeq, lastUID, false)
+		}
+		return nil, fmt.Errorf("failed to select folder %s: %w", folder, err)
+	}
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddRange(1, lastUID)
+
+	messages := make(chan *imap.Message, 10)
+	handler := &changedSinceHandler{
+		fetch:    &responses.Fetch{Messages: messages, SeqSet: seqSet, Uid: true},
+		vanished: new(imap.SeqSet),
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer close(messages)
+		status, err := c.client.Execute(changedSinceCommand(seqSet, modSeq, vanished), handler)
+		if err == nil {
+			err = status.Err()
+		}
+		done <- err
+	}()
+
+	// Keep reading the responses after a failure, which would otherwise block the
+	// connection
+	var updateErr error
+	for msg := range messages {
+		if updateErr != nil {
+			continue
+		}
+		updateErr = updateReadState(s, folder, fmt.Sprintf("%s-%d", accountID, msg.Uid), msg.Flags)
+	}
+
+	err := <-done
+	c.mutex.Unlock()
+	if err != nil {
+		// Handle connection error
+		if c.handleConnectionError(err) {
+			// Try again once if it was a connection error that was fixed. QRESYNC is not
+			// enabled on the new connection.
+			return c.syncChangedSince(s, folder, accountID, modSeq, lastUID, false)
+		}
+		return nil, fmt.Errorf("failed to fetch changed emails: %w", err)
+	}
+	if updateErr != nil {
+		return nil, fmt.Errorf("failed to update email status: %w", updateErr)
+	}
+
+	if !vanished {
+		return nil, nil
+	}
+	return handler.vanished, nil
+}
+
+// removeVanished deletes the stored emails of a folder that the server reported
+// expunged, up to lastUID. When the UIDs are too many to look up one at a time, the
+// stored emails are checked against the folder instead.
+func (c *IMAPClientImpl) removeVanished(s store.Store, folder string, accountID string, vanished *imap.SeqSet, lastUID uint32) error {
+	var ranges []imap.Seq
+	lookups := 0
+	for _, seq := range vanished.Set {
+		// A range ending in "*" ends at the highest UID
+		if seq.Start == 0 {
+			seq.Start = lastUID
+		}
+		if seq.Stop == 0 || seq.Stop > lastUID {
+			seq.Stop = lastUID
+		}
+		if seq.Start > seq.Stop {
+			continue
+		}
+
+		ranges = append(ranges, seq)
+		lookups += int(seq.Stop-seq.Start) + 1
+	}
+
+	if lookups > maxVanishedLookups {
+		return c.syncMovedEmails(s, accountID, folder)
+	}
+
+	for _, seq := range ranges {
+		for uid := uint64(seq.Start); uid <= uint64(seq.Stop); uid++ {
+			emailID := fmt.Sprintf("%s-%d", accountID, uid)
+			email, err := s.GetEmail(emailID)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get email %s: %w", emailID, err)
+			}
+
+			// The ID may be that of an email stored from another folder
+			if email.Folder != folder {
+				continue
+			}
+
+			if err := s.DeleteEmail(emailID); err != nil {
+				return fmt.Errorf("failed to delete expunged email: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// updateReadState sets whether a stored email of a folder is read from its flags.
+// Emails that aren't stored, or were stored from another folder, are skipped.
+func updateReadState(s store.Store, folder string, emailID string, flags []string) error {
+	email, err := s.GetEmail(emailID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if email.Folder != folder {
+		return nil
+	}
+
+	isRead := false
+	for _, flag := range flags {
+		if flag == imap.SeenFlag {
+			isRead = true
+			break
+		}
+	}
+	if email.IsRead == isRead {
+		return nil
+	}
+
+	return s.UpdateEmailStatus(emailID, models.EmailStatus{IsRead: isRead})
+}
+
+// changedSinceCommand builds a UID FETCH of the UIDs and flags of the emails in a set
+// that changed since a mod-sequence. With vanished, the server also reports the UIDs
+// in the set expunged since, which requires QRESYNC to be enabled.
+func changedSinceCommand(seqSet *imap.SeqSet, modSeq uint64, vanished bool) imap.Commander {
+	modifiers := []interface{}{imap.RawString("CHANGEDSINCE"), imap.RawString(strconv.FormatUint(modSeq, 10))}
+	if vanished {
+		modifiers = append(modifiers, imap.RawString("VANISHED"))
+	}
+
+	return &commands.Uid{Cmd: &imap.Command{
+		Name: "FETCH",
+		Arguments: []interface{}{
+			seqSet,
+			[]interface{}{imap.RawString(imap.FetchUid), imap.RawString(imap.FetchFlags)},
+			modifiers,
+		},
+	}}
+}
+
+// changedSinceHandler handles the responses of a CHANGEDSINCE fetch: FETCH responses
+// for the changed emails and VANISHED responses with the UIDs expunged
+type changedSinceHandler struct {
+	fetch    *responses.Fetch
+	vanished *imap.SeqSet
+}
+
+// Handle implements responses.Handler
+func (h *changedSinceHandler) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != "VANISHED" {
+		return h.fetch.Handle(resp)
+	}
+
+	// VANISHED (EARLIER) uid-set, or VANISHED uid-set for emails expunged meanwhile
+	if len(fields) == 0 {
+		return responses.ErrUnhandled
+	}
+	uids, err := imap.ParseString(fields[len(fields)-1])
+	if err != nil {
+		return fmt.Errorf("invalid VANISHED response: %w", err)
+	}
+	return h.vanished.Add(uids)
+}
+
+// parseModSeq parses a mod-sequence, which unlike other IMAP numbers can exceed 32 bits
+func parseModSeq(f interface{}) (uint64, error) {
+	s, err := imap.ParseString(f)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
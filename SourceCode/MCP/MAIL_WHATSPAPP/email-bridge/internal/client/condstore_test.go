@@ -0,0 +1,226 @@
+package client
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// modSeqIMAPConn is a fakeIMAPConn that supports CONDSTORE and optionally QRESYNC. It
+// answers CHANGEDSINCE fetches with the messages it was told changed and expunged.
+type modSeqIMAPConn struct {
+	*fakeIMAPConn
+	qresync       bool
+	highestModSeq uint64
+	changed       []uint32
+	expunged      string
+
+	enabled    bool
+	commands   []string
+	fetchedIn  []string
+	uidFetches int
+}
+
+func (f *modSeqIMAPConn) Support(cap string) (bool, error) {
+	return cap == capCondstore || (cap == capQResync && f.qresync), nil
+}
+
+func (f *modSeqIMAPConn) Enable(caps []string) ([]string, error) {
+	f.enabled = true
+	return caps, nil
+}
+
+func (f *modSeqIMAPConn) Status(name string, items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	status := imap.NewMailboxStatus(name, items)
+	status.Items[statusHighestModSeq] = strconv.FormatUint(f.highestModSeq, 10)
+	return status, nil
+}
+
+func (f *modSeqIMAPConn) UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	f.uidFetches++
+	return f.fakeIMAPConn.UidFetch(seqset, items, ch)
+}
+
+func (f *modSeqIMAPConn) Execute(cmdr imap.Commander, h responses.Handler) (*imap.StatusResp, error) {
+	var buf bytes.Buffer
+	if err := cmdr.Command().WriteTo(imap.NewWriter(&buf)); err != nil {
+		return nil, err
+	}
+	f.commands = append(f.commands, strings.TrimSpace(buf.String()))
+	f.fetchedIn = append(f.fetchedIn, f.selected)
+
+	for _, m := range f.fakeIMAPConn.emails[f.selected] {
+		for _, uid := range f.changed {
+			if m.uid != uid {
+				continue
+			}
+			flags := []interface{}{}
+			if m.isRead {
+				flags = append(flags, imap.SeenFlag)
+			}
+			fields := []interface{}{"UID", strconv.Itoa(int(uid)), "FLAGS", flags, "MODSEQ", []interface{}{"20"}}
+			if err := h.Handle(&imap.DataResp{Tag: "*", Fields: []interface{}{"1", "FETCH", fields}}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if f.expunged != "" {
+		resp := &imap.DataResp{Tag: "*", Fields: []interface{}{"VANISHED", []interface{}{"EARLIER"}, f.expunged}}
+		if err := h.Handle(resp); err != nil {
+			return nil, err
+		}
+	}
+
+	return &imap.StatusResp{Type: imap.StatusRespOk}, nil
+}
+
+// TestIncrementalSyncModSeq tests that flag changes and expunges are synced from the
+// emails changed since the last sync when the server supports CONDSTORE and QRESYNC
+func TestIncrementalSyncModSeq(t *testing.T) {
+	date := time.Now().Add(-time.Hour)
+	newStore := func() *memoryStore {
+		return &memoryStore{
+			emails: map[string]models.Email{
+				"acct-1": {ID: "acct-1", AccountID: "acct", Folder: "INBOX", IsRead: false},
+				"acct-2": {ID: "acct-2", AccountID: "acct", Folder: "INBOX", IsRead: false},
+				"acct-4": {ID: "acct-4", AccountID: "acct", Folder: "INBOX", IsRead: true},
+				"acct-5": {ID: "acct-5", AccountID: "acct", Folder: "Archive", IsRead: false},
+			},
+			syncStatus: map[string]store.SyncStatus{
+				"INBOX": {
+					AccountID: "acct", FolderID: "INBOX", LastSync: date,
+					UIDValidity: "12345", LastUID: 5, HighestModSeq: 10,
+				},
+			},
+		}
+	}
+	newConn := func(qresync bool) *modSeqIMAPConn {
+		return &modSeqIMAPConn{
+			fakeIMAPConn: &fakeIMAPConn{
+				folders: []string{"INBOX"},
+				emails: map[string][]fakeMessage{
+					"INBOX": {
+						{uid: 1, subject: "Unchanged", date: date},
+						{uid: 2, subject: "Read elsewhere", date: date, isRead: true},
+						{uid: 5, subject: "Read too", date: date, isRead: true},
+					},
+				},
+				uidValidity: "12345",
+			},
+			qresync:       qresync,
+			highestModSeq: 20,
+			changed:       []uint32{2, 5},
+			expunged:      "3:4",
+		}
+	}
+	options := IncrementalSyncOptions{AccountID: "acct", Folder: "INBOX", BatchSize: 100, CheckStatusChanges: true}
+
+	// With QRESYNC, only the changed and expunged emails are synced
+	conn := newConn(true)
+	s := newStore()
+	imapClient := &IMAPClientImpl{config: config.AccountConfig{ID: "acct"}, client: conn, connected: true}
+	if err := imapClient.IncrementalSync(s, options); err != nil {
+		t.Fatalf("Error during incremental sync: %v", err)
+	}
+
+	if !conn.enabled || len(conn.commands) != 1 || !strings.HasSuffix(conn.commands[0], "UID FETCH 1:5 (UID FLAGS) (CHANGEDSINCE 10 VANISHED)") {
+		t.Errorf("Expected a CHANGEDSINCE fetch with VANISHED, got %v", conn.commands)
+	}
+	if conn.uidFetches != 0 {
+		t.Errorf("Expected no full flag or UID fetches, got %d", conn.uidFetches)
+	}
+	if !s.emails["acct-2"].IsRead || s.emails["acct-1"].IsRead {
+		t.Errorf("Expected only acct-2 to be marked read, got %+v", s.emails)
+	}
+	if _, ok := s.emails["acct-4"]; ok {
+		t.Errorf("Expected the expunged email acct-4 to be deleted")
+	}
+	// acct-5 was stored from another folder
+	if email, ok := s.emails["acct-5"]; !ok || email.IsRead {
+		t.Errorf("Expected the email of another folder to be left alone, got %+v", email)
+	}
+	if status := s.syncStatus["INBOX"]; status.HighestModSeq != 20 {
+		t.Errorf("Expected HighestModSeq to be updated to 20, got %d", status.HighestModSeq)
+	}
+
+	// Nothing is fetched when the folder hasn't changed since
+	if err := imapClient.IncrementalSync(s, options); err != nil {
+		t.Fatalf("Error during incremental sync: %v", err)
+	}
+	if len(conn.commands) != 1 || conn.uidFetches != 0 {
+		t.Errorf("Expected nothing to be fetched, got %v and %d UID fetches", conn.commands, conn.uidFetches)
+	}
+
+	// With CONDSTORE alone, expunges are found by checking the stored emails
+	conn = newConn(false)
+	s = newStore()
+	imapClient = &IMAPClientImpl{config: config.AccountConfig{ID: "acct"}, client: conn, connected: true}
+	if err := imapClient.IncrementalSync(s, options); err != nil {
+		t.Fatalf("Error during incremental sync: %v", err)
+	}
+	if conn.enabled || len(conn.commands) != 1 || !strings.HasSuffix(conn.commands[0], "(CHANGEDSINCE 10)") {
+		t.Errorf("Expected a CHANGEDSINCE fetch without VANISHED, got %v", conn.commands)
+	}
+	if conn.uidFetches != 1 {
+		t.Errorf("Expected the UIDs of the stored emails to be checked, got %d UID fetches", conn.uidFetches)
+	}
+	if _, ok := s.emails["acct-4"]; ok || !s.emails["acct-2"].IsRead {
+		t.Errorf("Expected acct-2 to be read and acct-4 deleted, got %+v", s.emails)
+	}
+
+	// Folders synced before without a mod-sequence are checked in full once
+	conn = newConn(true)
+	s = newStore()
+	status := s.syncStatus["INBOX"]
+	status.HighestModSeq = 0
+	s.syncStatus["INBOX"] = status
+	imapClient = &IMAPClientImpl{config: config.AccountConfig{ID: "acct"}, client: conn, connected: true}
+	if err := imapClient.IncrementalSync(s, options); err != nil {
+		t.Fatalf("Error during incremental sync: %v", err)
+	}
+	if len(conn.commands) != 0 || conn.uidFetches != 2 {
+		t.Errorf("Expected a full check, got %v and %d UID fetches", conn.commands, conn.uidFetches)
+	}
+	if status := s.syncStatus["INBOX"]; status.HighestModSeq != 20 {
+		t.Errorf("Expected HighestModSeq to be set to 20, got %d", status.HighestModSeq)
+	}
+}
+
+// TestSyncChangedSinceSelectsFolder tests that the folder is selected again before the
+// CHANGEDSINCE fetch, when another folder was selected after it
+func TestSyncChangedSinceSelectsFolder(t *testing.T) {
+	conn := &modSeqIMAPConn{
+		fakeIMAPConn: &fakeIMAPConn{
+			folders: []string{"INBOX", "Archive"},
+			emails: map[string][]fakeMessage{
+				"INBOX": {{uid: 2, subject: "Read elsewhere", date: time.Now(), isRead: true}},
+			},
+			uidValidity: "12345",
+			selected:    "Archive",
+		},
+		changed: []uint32{2},
+	}
+	s := &memoryStore{emails: map[string]models.Email{
+		"acct-2": {ID: "acct-2", AccountID: "acct", Folder: "INBOX"},
+	}}
+
+	imapClient := &IMAPClientImpl{config: config.AccountConfig{ID: "acct"}, client: conn, connected: true}
+	if _, err := imapClient.syncChangedSince(s, "INBOX", "acct", 10, 2, false); err != nil {
+		t.Fatalf("Error syncing changes: %v", err)
+	}
+
+	if len(conn.fetchedIn) != 1 || conn.fetchedIn[0] != "INBOX" {
+		t.Errorf("Expected the fetch to run in INBOX, got %v", conn.fetchedIn)
+	}
+	if !s.emails["acct-2"].IsRead {
+		t.Errorf("Expected acct-2 to be marked read, got %+v", s.emails["acct-2"])
+	}
+}
@@ -164,6 +164,11 @@ func (cm *CredentialManager) DecryptCredentials(account *config.AccountConfig) e
 func (cm *CredentialManager) GetDecryptedAccount(account config.AccountConfig) (config.AccountConfig, error) {
 	// Create a copy of the account to avoid modifying the original
 	decryptedAccount := account
+	if account.OAuthConfig != nil {
+		// The OAuth configuration is shared through its pointer, so copy it too
+		oauthConfig := *account.OAuthConfig
+		decryptedAccount.OAuthConfig = &oauthConfig
+	}
 
 	// Decrypt the credentials
 	if err := cm.DecryptCredentials(&decryptedAccount); err != nil {
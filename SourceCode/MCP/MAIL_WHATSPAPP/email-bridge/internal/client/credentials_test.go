@@ -91,4 +91,7 @@ func TestCredentialManager(t *testing.T) {
 	if account.IMAPConfig.Password == "password123" {
 		t.Error("Original IMAP password was modified")
 	}
+	if account.OAuthConfig.ClientSecret == "client-secret" {
+		t.Error("Original OAuth client secret was modified")
+	}
 }
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/emersion/go-imap"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// draftFlags are the flags of the drafts appended to the server
+var draftFlags = []string{imap.DraftFlag, imap.SeenFlag}
+
+// AppendDraft appends an email to the \Drafts folder on the IMAP server with the
+// \Draft flag, so that other mail clients show it. It returns the folder and the email
+// ID of the appended message. The ID is "" if the message could not be located, and
+// both are "" if the server has no Drafts folder.
+func AppendDraft(imapClient IMAPClient, email models.Email) (string, string, error) {
+	if !imapClient.IsConnected() {
+		if err := imapClient.Connect(); err != nil {
+			return "", "", fmt.Errorf("failed to connect to IMAP server: %w", err)
+		}
+	}
+
+	folder, err := specialFolder(imapClient, func(folder models.Folder) bool { return folder.IsDrafts })
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find the Drafts folder: %w", err)
+	}
+	if folder == "" {
+		return "", "", nil
+	}
+
+	raw, err := NewMessageFile(func(w io.Writer) error {
+		return writeMessage(w, email, "")
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create draft message: %w", err)
+	}
+	defer raw.Close()
+
+	emailID, err := imapClient.AppendEmail(folder, raw, draftFlags)
+	if err != nil {
+		return "", "", err
+	}
+
+	return folder, emailID, nil
+}
+
+// RemoveDraft deletes a draft revision appended by AppendDraft from the server, for
+// good rather than to the trash folder, along with the copy a sync may have stored
+func RemoveDraft(s store.Store, imapClient IMAPClient, folder string, emailID string) error {
+	if !imapClient.IsConnected() {
+		if err := imapClient.Connect(); err != nil {
+			return fmt.Errorf("failed to connect to IMAP server: %w", err)
+		}
+	}
+
+	if err := imapClient.ExpungeEmail(folder, emailID); err != nil {
+		return err
+	}
+
+	if _, err := s.GetEmail(emailID); err == nil {
+		if err := GetEmailEventHandler(s).HandleDeletedEmail(emailID); err != nil {
+			return fmt.Errorf("failed to delete stored draft: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// specialFolder returns the name of the first selectable folder of the server that
+// matches, or "" if there is none
+func specialFolder(imapClient IMAPClient, match func(models.Folder) bool) (string, error) {
+	folders, err := imapClient.GetFoldersDetailed()
+	if err != nil && folders == nil {
+		return "", err
+	}
+
+	for _, folder := range folders {
+		if match(folder) && folder.CanSelect {
+			return folder.Name, nil
+		}
+	}
+
+	return "", nil
+}
@@ -1,155 +1,16 @@
 package client
 
 import (
-	"sync"
 	"testing"
 	"time"
 
 	"github.com/user/email-bridge/internal/models"
-	"github.com/user/email-bridge/internal/store"
 )
 
-// MockIMAPClient is a mock implementation of the IMAPClient interface for testing
-type MockIMAPClient struct {
-	connected      bool
-	monitoring     bool
-	monitoringFunc func(models.Email)
-	mutex          sync.Mutex
-}
-
-func (m *MockIMAPClient) Connect() error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	m.connected = true
-	return nil
-}
-
-func (m *MockIMAPClient) Disconnect() error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	m.connected = false
-	m.monitoring = false
-	return nil
-}
-
-func (m *MockIMAPClient) IsConnected() bool {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	return m.connected
-}
-
-func (m *MockIMAPClient) FetchEmails(criteria models.SearchCriteria) ([]models.Email, error) {
-	return []models.Email{}, nil
-}
-
-func (m *MockIMAPClient) GetFolders() ([]string, error) {
-	return []string{"INBOX"}, nil
-}
-
-func (m *MockIMAPClient) MonitorMailbox(callback func(models.Email)) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	m.monitoring = true
-	m.monitoringFunc = callback
-	return nil
-}
-
-func (m *MockIMAPClient) StopMonitoring() error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	m.monitoring = false
-	return nil
-}
-
-func (m *MockIMAPClient) MarkAsRead(emailID string) error {
-	return nil
-}
-
-func (m *MockIMAPClient) MarkAsUnread(emailID string) error {
-	return nil
-}
-
-func (m *MockIMAPClient) MoveEmail(emailID string, folder string) error {
-	return nil
-}
-
-func (m *MockIMAPClient) DeleteEmail(emailID string) error {
-	return nil
-}
-
-func (m *MockIMAPClient) GetAttachment(emailID string, attachmentID string) (models.Attachment, error) {
-	return models.Attachment{}, nil
-}
-
-// MockStore is a mock implementation of the store.Store interface for testing
-type MockStore struct {
-	emails map[string]models.Email
-	mutex  sync.Mutex
-}
-
-func NewMockStore() *MockStore {
-	return &MockStore{
-		emails: make(map[string]models.Email),
-		mutex:  sync.Mutex{},
-	}
-}
-
-func (s *MockStore) StoreEmail(email models.Email) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	s.emails[email.ID] = email
-	return nil
-}
-
-func (s *MockStore) GetEmail(id string) (models.Email, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	email, ok := s.emails[id]
-	if !ok {
-		return models.Email{}, store.ErrEmailNotFound
-	}
-	return email, nil
-}
-
-func (s *MockStore) SearchEmails(criteria models.SearchCriteria) ([]models.Email, error) {
-	return []models.Email{}, nil
-}
-
-func (s *MockStore) UpdateEmailStatus(id string, status models.EmailStatus) error {
-	return nil
-}
-
-func (s *MockStore) MoveEmail(id string, folder string) error {
-	return nil
-}
-
-func (s *MockStore) DeleteEmail(id string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	delete(s.emails, id)
-	return nil
-}
-
-func (s *MockStore) StoreAttachment(attachment models.Attachment) error {
-	return nil
-}
-
-func (s *MockStore) GetAttachment(id string) (models.Attachment, error) {
-	return models.Attachment{}, nil
-}
-
-func (s *MockStore) GetFolders(accountID string) ([]string, error) {
-	return []string{"INBOX"}, nil
-}
-
-func (s *MockStore) Close() error {
-	return nil
-}
-
 // TestEmailMonitor tests the email monitor functionality
 func TestEmailMonitor(t *testing.T) {
 	// Create a mock store
-	mockStore := NewMockStore()
+	mockStore := newMemoryStore()
 
 	// Create an email monitor
 	monitor := GetEmailMonitor(mockStore)
@@ -226,7 +87,7 @@ func TestEmailMonitor(t *testing.T) {
 // TestEmailMonitorMultipleClients tests the email monitor with multiple clients
 func TestEmailMonitorMultipleClients(t *testing.T) {
 	// Create a mock store
-	mockStore := NewMockStore()
+	mockStore := newMemoryStore()
 
 	// Create an email monitor
 	monitor := GetEmailMonitor(mockStore)
@@ -1,7 +1,10 @@
 package client
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -22,12 +25,17 @@ type EmailSyncOptions struct {
 	MaxEmails int
 	// SyncAttachments determines whether to download attachments
 	SyncAttachments bool
+	// AttachmentDir is the directory downloaded attachments are stored in
+	AttachmentDir string
 	// SyncFrom is the date from which to start synchronization (zero value for all)
 	SyncFrom time.Time
 	// SyncTo is the date until which to synchronize (zero value for all)
 	SyncTo time.Time
 	// OnProgress is a callback function for progress updates
 	OnProgress func(folder string, current, total int)
+	// OnNewEmail is called with each email that was not stored before the sync, such
+	// as to apply mail rules to it. It is called without the client mutex held.
+	OnNewEmail func(email models.Email)
 }
 
 // DefaultEmailSyncOptions returns default synchronization options
@@ -37,6 +45,7 @@ func DefaultEmailSyncOptions(accountID string) EmailSyncOptions {
 		BatchSize:       100,
 		MaxEmails:       0, // No limit
 		SyncAttachments: false,
+		AttachmentDir:   "attachments",
 		OnProgress:      nil,
 	}
 }
@@ -67,6 +76,9 @@ func (c *IMAPClientImpl) SyncEmails(s store.Store, options EmailSyncOptions) err
 		}
 	}
 
+	// Before any folder is selected, let the server report expunged emails
+	c.enableQResync()
+
 	// Synchronize each folder
 	for _, folder := range folders {
 		if err := c.syncFolder(s, folder, options); err != nil {
@@ -74,6 +86,11 @@ func (c *IMAPClientImpl) SyncEmails(s store.Store, options EmailSyncOptions) err
 		}
 	}
 
+	// Emails the sync deleted may have left attachment files behind
+	if options.SyncAttachments {
+		pruneAttachments(s, options.AttachmentDir)
+	}
+
 	return nil
 }
 
@@ -85,6 +102,9 @@ func (c *IMAPClientImpl) syncFolder(s store.Store, folder string, options EmailS
 		return fmt.Errorf("not connected to IMAP server")
 	}
 
+	// Changes up to the folder's current mod-sequence are included in the full sync
+	highestModSeq := c.folderModSeq(folder)
+
 	// Select the mailbox
 	mbox, err := c.client.Select(folder, false) // Read-only mode
 	if err != nil {
@@ -113,16 +133,26 @@ func (c *IMAPClientImpl) syncFolder(s store.Store, folder string, options EmailS
 	}
 
 	// Check if the mailbox has changed since last sync
-	if syncStatus.UIDValidity != "" && syncStatus.UIDValidity == mbox.UidValidity {
-		// The mailbox hasn't changed structurally, we can do an incremental sync
+	if syncStatus.UIDValidity != "" && syncStatus.UIDValidity == formatUIDValidity(mbox.UidValidity) {
+		// The mailbox hasn't changed structurally, we can do an incremental sync.
+		// incrementalSync takes the client mutex itself, so release it first.
+		c.mutex.Unlock()
 		if err := c.incrementalSync(s, folder, mbox, syncStatus, options); err != nil {
-			c.mutex.Unlock()
 			return fmt.Errorf("failed to perform incremental sync: %w", err)
 		}
-		c.mutex.Unlock()
 		return nil
 	}
 
+	// The server changed the folder's UIDVALIDITY, so the IDs of its stored emails may
+	// now be those of other emails. Re-map them, then sync the folder from scratch.
+	if syncStatus.UIDValidity != "" {
+		c.mutex.Unlock()
+		if err := c.resyncFolder(s, folder, options.AccountID, syncStatus.UIDValidity, mbox.UidValidity); err != nil {
+			return fmt.Errorf("failed to resync folder %s: %w", folder, err)
+		}
+		return c.syncFolder(s, folder, options)
+	}
+
 	// Build search criteria
 	searchCriteria := imap.NewSearchCriteria()
 
@@ -181,7 +211,15 @@ func (c *IMAPClientImpl) syncFolder(s store.Store, folder string, options EmailS
 	syncStatus.AccountID = options.AccountID
 	syncStatus.FolderID = folderID
 	syncStatus.LastSync = time.Now()
-	syncStatus.UIDValidity = mbox.UidValidity
+	syncStatus.UIDValidity = formatUIDValidity(mbox.UidValidity)
+	syncStatus.HighestModSeq = highestModSeq
+
+	// Remember the highest UID we've seen so the next incremental sync starts after it
+	for _, uid := range uids {
+		if uid > syncStatus.LastUID {
+			syncStatus.LastUID = uid
+		}
+	}
 
 	if err := s.UpdateSyncStatus(syncStatus); err != nil {
 		return fmt.Errorf("failed to update sync status: %w", err)
@@ -190,13 +228,30 @@ func (c *IMAPClientImpl) syncFolder(s store.Store, folder string, options EmailS
 	return nil
 }
 
-// syncEmailBatch synchronizes a batch of emails
+// syncEmailBatch synchronizes a batch of emails, then passes the ones that were not
+// stored before to options.OnNewEmail
 func (c *IMAPClientImpl) syncEmailBatch(s store.Store, folder string, uids []uint32, options EmailSyncOptions) error {
+	arrived, err := c.fetchEmailBatch(s, folder, uids, options)
+
+	// Emails stored before a failure are reported too, since a later sync won't find
+	// them new
+	if options.OnNewEmail != nil {
+		for _, email := range arrived {
+			options.OnNewEmail(email)
+		}
+	}
+
+	return err
+}
+
+// fetchEmailBatch fetches and stores a batch of emails. When options.OnNewEmail is set,
+// it returns the stored emails that were not in the store before.
+func (c *IMAPClientImpl) fetchEmailBatch(s store.Store, folder string, uids []uint32, options EmailSyncOptions) ([]models.Email, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
 	if !c.connected || c.client == nil {
-		return fmt.Errorf("not connected to IMAP server")
+		return nil, fmt.Errorf("not connected to IMAP server")
 	}
 
 	// Create sequence set for fetching
@@ -225,10 +280,16 @@ func (c *IMAPClientImpl) syncEmailBatch(s store.Store, folder string, uids []uin
 	var wg sync.WaitGroup
 	var processErr error
 	var processErrMutex sync.Mutex
+	var arrived []models.Email
 
 	// Use a semaphore to limit concurrent processing
 	semaphore := make(chan struct{}, 5) // Process up to 5 emails concurrently
 
+	var attachments *AttachmentStore
+	if options.SyncAttachments {
+		attachments = NewAttachmentStore(options.AttachmentDir)
+	}
+
 	for msg := range messages {
 		if processErr != nil {
 			continue // Skip processing if an error occurred
@@ -241,8 +302,8 @@ func (c *IMAPClientImpl) syncEmailBatch(s store.Store, folder string, uids []uin
 			defer wg.Done()
 			defer func() { <-semaphore }() // Release semaphore
 
-			// Parse the message
-			email, err := c.parseMessage(msg, folder)
+			// Parse the message, downloading its attachments if requested
+			email, err := c.parseMessageWithAttachments(msg, folder, attachments)
 			if err != nil {
 				processErrMutex.Lock()
 				processErr = fmt.Errorf("failed to parse message: %w", err)
@@ -253,6 +314,12 @@ func (c *IMAPClientImpl) syncEmailBatch(s store.Store, folder string, uids []uin
 			// Set account ID
 			email.AccountID = options.AccountID
 
+			isNew := false
+			if options.OnNewEmail != nil {
+				_, err := s.GetEmail(email.ID)
+				isNew = errors.Is(err, sql.ErrNoRows)
+			}
+
 			// Store the email in the database
 			err = s.StoreEmail(email)
 			if err != nil {
@@ -262,9 +329,10 @@ func (c *IMAPClientImpl) syncEmailBatch(s store.Store, folder string, uids []uin
 				return
 			}
 
-			// Download attachments if requested
-			if options.SyncAttachments && email.HasAttachments {
-				// This will be implemented in task 7.3
+			if isNew {
+				processErrMutex.Lock()
+				arrived = append(arrived, email)
+				processErrMutex.Unlock()
 			}
 		}(msg)
 	}
@@ -277,17 +345,18 @@ func (c *IMAPClientImpl) syncEmailBatch(s store.Store, folder string, uids []uin
 		// Handle connection error
 		if c.handleConnectionError(err) {
 			// Try again once if it was a connection error that was fixed
-			return c.syncEmailBatch(s, folder, uids, options)
+			more, err := c.fetchEmailBatch(s, folder, uids, options)
+			return append(arrived, more...), err
 		}
-		return fmt.Errorf("failed to fetch emails: %w", err)
+		return arrived, fmt.Errorf("failed to fetch emails: %w", err)
 	}
 
 	// Check for processing error
 	if processErr != nil {
-		return processErr
+		return arrived, processErr
 	}
 
-	return nil
+	return arrived, nil
 }
 
 // SyncEmailsWithProgress synchronizes emails with progress reporting
@@ -329,7 +398,9 @@ func (c *IMAPClientImpl) incrementalSync(s store.Store, folder string, mbox *ima
 		BatchSize:          options.BatchSize,
 		MaxEmails:          options.MaxEmails,
 		SyncAttachments:    options.SyncAttachments,
+		AttachmentDir:      options.AttachmentDir,
 		OnProgress:         options.OnProgress,
+		OnNewEmail:         options.OnNewEmail,
 		CheckStatusChanges: true,
 	}
 
@@ -360,8 +431,8 @@ func (c *IMAPClientImpl) syncEmailStatusChanges(s store.Store, folder string, ac
 	uids := make([]uint32, 0, len(emails))
 
 	for _, email := range emails {
-		// Extract UID from the email ID or metadata
-		uid, err := extractUID(email)
+		// Extract UID from the email ID
+		uid, err := EmailUID(email.ID)
 		if err != nil {
 			// Skip emails where we can't extract the UID
 			continue
@@ -436,21 +507,7 @@ func (c *IMAPClientImpl) syncEmailStatusChanges(s store.Store, folder string, ac
 	return nil
 }
 
-// extractUID extracts the UID from an email
-// This is a helper function that needs to be implemented based on how UIDs are stored
-func extractUID(email models.Email) (uint32, error) {
-	// This is a placeholder implementation
-	// In a real implementation, the UID might be stored in the email ID or in metadata
-
-	// Example: If the UID is stored in a header field
-	if uidStr, ok := email.Headers["X-IMAP-UID"]; ok {
-		var uid uint32
-		_, err := fmt.Sscanf(uidStr, "%d", &uid)
-		if err != nil {
-			return 0, fmt.Errorf("failed to parse UID: %w", err)
-		}
-		return uid, nil
-	}
-
-	return 0, fmt.Errorf("UID not found in email")
+// formatUIDValidity converts a mailbox UIDVALIDITY value to the string form kept in sync_status
+func formatUIDValidity(uidValidity uint32) string {
+	return strconv.FormatUint(uint64(uidValidity), 10)
 }
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"database/sql"
 	"sync"
 	"testing"
 	"time"
@@ -91,6 +92,10 @@ func (s *testStore) SearchEmails(criteria models.SearchCriteria) ([]models.Email
 	return []models.Email{}, nil
 }
 
+func (s *testStore) CountEmails(criteria models.SearchCriteria) (int, error) {
+	return 0, nil
+}
+
 func (s *testStore) UpdateEmailStatus(id string, status models.EmailStatus) error {
 	return nil
 }
@@ -103,6 +108,10 @@ func (s *testStore) DeleteEmail(id string) error {
 	return nil
 }
 
+func (s *testStore) RemapEmails(deleted []string, emails []models.Email) error {
+	return nil
+}
+
 func (s *testStore) StoreAttachment(attachment models.Attachment) error {
 	return nil
 }
@@ -151,6 +160,154 @@ func (s *testStore) DeleteAccount(id string) error {
 	return nil
 }
 
+func (s *testStore) GetOAuthToken(accountID string) (models.OAuthToken, error) {
+	return models.OAuthToken{}, sql.ErrNoRows
+}
+
+func (s *testStore) StoreOAuthToken(token models.OAuthToken) error {
+	return nil
+}
+
+func (s *testStore) QueueOutboxMessage(message models.OutboxMessage) error {
+	return nil
+}
+
+func (s *testStore) GetOutboxMessage(id string) (models.OutboxMessage, error) {
+	return models.OutboxMessage{}, nil
+}
+
+func (s *testStore) EditPendingOutboxMessage(id string, email models.Email, entry models.OutboxAuditEntry) error {
+	return sql.ErrNoRows
+}
+
+func (s *testStore) ReviewOutboxMessage(id string, status string, nextAttempt time.Time, entry models.OutboxAuditEntry) error {
+	return sql.ErrNoRows
+}
+
+func (s *testStore) AddOutboxAuditEntry(entry models.OutboxAuditEntry) error {
+	return nil
+}
+
+func (s *testStore) GetOutboxAuditEntries(outboxID string) ([]models.OutboxAuditEntry, error) {
+	return nil, nil
+}
+
+func (s *testStore) AttachmentHashReferenced(hash string) (bool, error) {
+	return false, nil
+}
+
+func (s *testStore) StoreReconJob(job models.ReconJob) error {
+	return nil
+}
+
+func (s *testStore) GetReconJob(id string) (models.ReconJob, error) {
+	return models.ReconJob{}, sql.ErrNoRows
+}
+
+func (s *testStore) GetReconJobs(status string) ([]models.ReconJob, error) {
+	return nil, nil
+}
+
+func (s *testStore) GetReconJobByAttachment(attachmentID string) (models.ReconJob, error) {
+	return models.ReconJob{}, sql.ErrNoRows
+}
+
+func (s *testStore) StoreMailRule(rule models.MailRule) error {
+	return nil
+}
+
+func (s *testStore) GetMailRule(id string) (models.MailRule, error) {
+	return models.MailRule{}, sql.ErrNoRows
+}
+
+func (s *testStore) GetMailRules() ([]models.MailRule, error) {
+	return nil, nil
+}
+
+func (s *testStore) DeleteMailRule(id string) error {
+	return sql.ErrNoRows
+}
+
+func (s *testStore) AppendEvent(event models.Event) (int64, error) {
+	return 0, nil
+}
+
+func (s *testStore) GetEventsAfter(afterID int64, accountID, folder string, limit int) ([]models.Event, error) {
+	return nil, nil
+}
+
+func (s *testStore) DeleteEventsBefore(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *testStore) StoreWebhook(webhook models.Webhook) error {
+	return nil
+}
+
+func (s *testStore) GetWebhook(id string) (models.Webhook, error) {
+	return models.Webhook{}, sql.ErrNoRows
+}
+
+func (s *testStore) GetWebhooks() ([]models.Webhook, error) {
+	return nil, nil
+}
+
+func (s *testStore) DeleteWebhook(id string) error {
+	return sql.ErrNoRows
+}
+
+func (s *testStore) StoreWebhookDelivery(delivery models.WebhookDelivery) error {
+	return nil
+}
+
+func (s *testStore) GetWebhookDelivery(id string) (models.WebhookDelivery, error) {
+	return models.WebhookDelivery{}, sql.ErrNoRows
+}
+
+func (s *testStore) GetWebhookDeliveries(webhookID, status string, limit int) ([]models.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (s *testStore) ClaimWebhookDelivery(now time.Time, lease time.Duration) (models.WebhookDelivery, error) {
+	return models.WebhookDelivery{}, sql.ErrNoRows
+}
+
+func (s *testStore) DeleteWebhookDeliveriesBefore(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *testStore) StoreDraft(draft models.Draft) error {
+	return nil
+}
+
+func (s *testStore) GetDraft(id string) (models.Draft, error) {
+	return models.Draft{}, sql.ErrNoRows
+}
+
+func (s *testStore) GetDrafts(accountID string) ([]models.Draft, error) {
+	return nil, nil
+}
+
+func (s *testStore) DeleteDraft(id string) error {
+	return nil
+}
+
+func (s *testStore) ClaimOutboxMessage(now time.Time, lease time.Duration) (models.OutboxMessage, error) {
+	return models.OutboxMessage{}, sql.ErrNoRows
+}
+
+func (s *testStore) PendingOutboxMessages(accountID string) ([]models.OutboxMessage, error) {
+	return nil, nil
+}
+
+func (s *testStore) CancelOutboxMessage(id string) error {
+	return nil
+}
+
+func (s *testStore) UpdateOutboxMessage(message models.OutboxMessage) error {
+	return nil
+}
+
 func (s *testStore) GetSyncStatus(accountID, folderID string) (store.SyncStatus, error) {
 	if status, ok := s.syncStatus[folderID]; ok {
 		return status, nil
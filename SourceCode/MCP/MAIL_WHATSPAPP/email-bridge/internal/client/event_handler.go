@@ -2,6 +2,7 @@ package client
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/user/email-bridge/internal/models"
@@ -31,22 +32,42 @@ const (
 	FolderEventDeleted EmailEventType = "folder_deleted"
 	// FolderEventSynced represents a folder sync event
 	FolderEventSynced EmailEventType = "folder_synced"
+	// FolderEventUIDValidityChanged represents a folder resynced after its UIDVALIDITY
+	// changed
+	FolderEventUIDValidityChanged EmailEventType = "folder_uidvalidity_changed"
 )
 
+// EmailEventTypes lists the types of email and folder events
+var EmailEventTypes = []EmailEventType{
+	EmailEventNew,
+	EmailEventRead,
+	EmailEventUnread,
+	EmailEventMoved,
+	EmailEventDeleted,
+	FolderEventCreated,
+	FolderEventRenamed,
+	FolderEventDeleted,
+	FolderEventSynced,
+	FolderEventUIDValidityChanged,
+}
+
 // EmailEvent represents an email event
 type EmailEvent struct {
 	Type      EmailEventType
 	Email     models.Email
-	AccountID string          // Used for folder events
-	OldValue  string          // Used for moved/renamed events (old folder)
-	NewValue  string          // Used for moved/renamed events (new folder)
-	Folders   []models.Folder // Used for folder sync events
+	AccountID string               // Used for folder events
+	OldValue  string               // Used for moved/renamed events (old folder)
+	NewValue  string               // Used for moved/renamed events (new folder)
+	Folders   []models.Folder      // Used for folder sync events
+	Resync    *models.FolderResync // Used for UIDVALIDITY change events
 }
 
 // EmailEventHandler handles email events
 type EmailEventHandler struct {
 	store         store.Store
+	attachments   *AttachmentStore
 	eventHandlers map[EmailEventType][]func(EmailEvent)
+	eventLog      func(EmailEvent)
 	mutex         sync.RWMutex
 }
 
@@ -69,9 +90,31 @@ func GetEmailEventHandler(store store.Store) *EmailEventHandler {
 		}
 	}
 
+	// Update the store if provided
+	if store != nil {
+		globalEventHandler.store = store
+	}
+
 	return globalEventHandler
 }
 
+// SetAttachmentStore sets the store of downloaded attachments, whose files are removed
+// when the last email referring to them is deleted
+func (h *EmailEventHandler) SetAttachmentStore(attachments *AttachmentStore) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.attachments = attachments
+}
+
+// SetEventLog sets a function that records every event before the handlers are
+// notified. Unlike the handlers it runs synchronously, so events are recorded in the
+// order they happen.
+func (h *EmailEventHandler) SetEventLog(eventLog func(EmailEvent)) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.eventLog = eventLog
+}
+
 // RegisterEventHandler registers a handler for a specific event type
 func (h *EmailEventHandler) RegisterEventHandler(eventType EmailEventType, handler func(EmailEvent)) {
 	h.mutex.Lock()
@@ -162,6 +205,91 @@ func (h *EmailEventHandler) HandleFolderChange(emailID string, oldFolder, newFol
 	return nil
 }
 
+// HandleEmailMoved handles an email this bridge moved on the server. IMAP UIDs are
+// per folder, so the moved email has a new ID; the stored email is re-keyed to
+// newEmailID, or only has its folder updated when the new ID is unknown.
+func (h *EmailEventHandler) HandleEmailMoved(emailID string, newEmailID string, oldFolder, newFolder string) error {
+	if newEmailID == "" || newEmailID == emailID {
+		return h.HandleFolderChange(emailID, oldFolder, newFolder)
+	}
+
+	moved, err := h.rekeyEmail(emailID, newEmailID, newFolder)
+	if err != nil {
+		return err
+	}
+
+	// Create the event
+	event := EmailEvent{
+		Type:     EmailEventMoved,
+		Email:    moved,
+		OldValue: oldFolder,
+		NewValue: newFolder,
+	}
+
+	// Notify handlers
+	h.notifyHandlers(event)
+
+	return nil
+}
+
+// HandleEmailAppended handles an email this bridge stored and then appended to a folder
+// on the server, such as a sent email. The stored email is re-keyed to the ID of the
+// server's copy, so that syncing the folder doesn't store it twice. It is left as it is
+// when the new ID is unknown.
+func (h *EmailEventHandler) HandleEmailAppended(emailID string, newEmailID string, folder string) error {
+	if newEmailID == "" || newEmailID == emailID {
+		return nil
+	}
+
+	_, err := h.rekeyEmail(emailID, newEmailID, folder)
+	return err
+}
+
+// rekeyEmail stores an email under a new ID in a folder and deletes it under its old ID
+func (h *EmailEventHandler) rekeyEmail(emailID string, newEmailID string, folder string) (models.Email, error) {
+	// Get the email from the store
+	email, err := h.store.GetEmail(emailID)
+	if err != nil {
+		return email, fmt.Errorf("failed to get email: %w", err)
+	}
+
+	rekeyed := rekey(email, newEmailID, folder)
+
+	// A sync may already have stored the email under its new ID. UIDs are only unique
+	// within a folder, so the ID may also be held by an email of another folder, and
+	// then the email is kept under its old ID rather than lost.
+	if existing, err := h.store.GetEmail(newEmailID); err == nil {
+		if existing.Folder != folder {
+			return rekeyed, fmt.Errorf("email ID %s is already used by an email in folder %s", newEmailID, existing.Folder)
+		}
+	} else if err := h.store.StoreEmail(rekeyed); err != nil {
+		return rekeyed, fmt.Errorf("failed to store email %s: %w", newEmailID, err)
+	}
+
+	if err := h.store.DeleteEmail(emailID); err != nil {
+		return rekeyed, fmt.Errorf("failed to delete email: %w", err)
+	}
+
+	return rekeyed, nil
+}
+
+// rekey returns a copy of an email with a new ID in a folder. Its attachments are
+// re-keyed too, since their IDs start with the email ID.
+func rekey(email models.Email, newEmailID string, folder string) models.Email {
+	rekeyed := email
+	rekeyed.ID = newEmailID
+	rekeyed.Folder = folder
+	rekeyed.Attachments = make([]models.Attachment, len(email.Attachments))
+	for i, attachment := range email.Attachments {
+		if strings.HasPrefix(attachment.ID, email.ID+"-") {
+			attachment.ID = newEmailID + strings.TrimPrefix(attachment.ID, email.ID)
+		}
+		attachment.EmailID = newEmailID
+		rekeyed.Attachments[i] = attachment
+	}
+	return rekeyed
+}
+
 // HandleDeletedEmail handles an email deleted event
 func (h *EmailEventHandler) HandleDeletedEmail(emailID string) error {
 	// Get the email from the store before deleting it
@@ -175,6 +303,7 @@ func (h *EmailEventHandler) HandleDeletedEmail(emailID string) error {
 		if err := h.store.DeleteEmail(emailID); err != nil {
 			return fmt.Errorf("failed to delete email: %w", err)
 		}
+		h.releaseAttachments(email)
 	}
 
 	// Create the event
@@ -189,11 +318,30 @@ func (h *EmailEventHandler) HandleDeletedEmail(emailID string) error {
 	return nil
 }
 
+// releaseAttachments removes the attachment files of a deleted email that no other
+// email refers to
+func (h *EmailEventHandler) releaseAttachments(email models.Email) {
+	h.mutex.RLock()
+	attachments := h.attachments
+	h.mutex.RUnlock()
+
+	if attachments == nil {
+		return
+	}
+	if err := attachments.Release(h.store, email); err != nil {
+		fmt.Printf("Warning: Failed to remove attachments of email %s: %v\n", email.ID, err)
+	}
+}
+
 // notifyHandlers notifies all registered handlers for an event
 func (h *EmailEventHandler) notifyHandlers(event EmailEvent) {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 
+	if h.eventLog != nil {
+		h.eventLog(event)
+	}
+
 	// Get handlers for this event type
 	handlers, ok := h.eventHandlers[event.Type]
 	if !ok {
@@ -273,6 +421,59 @@ func (h *EmailEventHandler) HandleFolderDeleted(accountID string, folderName str
 	return nil
 }
 
+// HandleUIDValidityChanged handles a folder whose UIDVALIDITY the server changed. The
+// stored emails of the folder in resync.Remapped are re-keyed to their new IDs and the
+// ones in resync.Removed are deleted. The store does it in one go, since a new ID may
+// be the old ID of another email of the folder, and leaves the folder as it was if any
+// of it fails. Unlike moves and deletions, a single event reports the whole resync.
+func (h *EmailEventHandler) HandleUIDValidityChanged(accountID string, folder string, resync models.FolderResync) error {
+	if h.store != nil {
+		remapped := make([]models.Email, 0, len(resync.Remapped))
+		for emailID, newEmailID := range resync.Remapped {
+			email, err := h.store.GetEmail(emailID)
+			if err != nil {
+				return fmt.Errorf("failed to get email %s: %w", emailID, err)
+			}
+			remapped = append(remapped, rekey(email, newEmailID, folder))
+		}
+
+		removed := make([]models.Email, 0, len(resync.Removed))
+		for _, emailID := range resync.Removed {
+			email, err := h.store.GetEmail(emailID)
+			if err != nil {
+				return fmt.Errorf("failed to get email %s: %w", emailID, err)
+			}
+			removed = append(removed, email)
+		}
+
+		deleted := append(make([]string, 0, len(resync.Remapped)+len(resync.Removed)), resync.Removed...)
+		for emailID := range resync.Remapped {
+			deleted = append(deleted, emailID)
+		}
+		if err := h.store.RemapEmails(deleted, remapped); err != nil {
+			return fmt.Errorf("failed to re-map emails of folder %s: %w", folder, err)
+		}
+
+		// The re-keyed emails keep their attachment files
+		for _, email := range removed {
+			h.releaseAttachments(email)
+		}
+	}
+
+	// Create the event
+	event := EmailEvent{
+		Type:      FolderEventUIDValidityChanged,
+		AccountID: accountID,
+		NewValue:  folder,
+		Resync:    &resync,
+	}
+
+	// Notify handlers
+	h.notifyHandlers(event)
+
+	return nil
+}
+
 // SyncFolders synchronizes folders between the server and local database
 func (h *EmailEventHandler) SyncFolders(client IMAPClient, accountID string, options models.FolderSyncOptions) error {
 	// Set the account ID in the options
@@ -6,93 +6,16 @@ import (
 	"time"
 
 	"github.com/user/email-bridge/internal/models"
-	"github.com/user/email-bridge/internal/store"
 )
 
-// MockStore implements the store.Store interface for testing
-type MockStore struct {
-	emails map[string]models.Email
-	mutex  sync.RWMutex
-}
-
-func NewMockStore() *MockStore {
-	return &MockStore{
-		emails: make(map[string]models.Email),
-		mutex:  sync.RWMutex{},
-	}
-}
-
-func (s *MockStore) StoreEmail(email models.Email) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	s.emails[email.ID] = email
-	return nil
-}
-
-func (s *MockStore) GetEmail(id string) (models.Email, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-	email, ok := s.emails[id]
-	if !ok {
-		return models.Email{}, store.ErrEmailNotFound
-	}
-	return email, nil
-}
-
-func (s *MockStore) UpdateEmailStatus(id string, status models.EmailStatus) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	email, ok := s.emails[id]
-	if !ok {
-		return store.ErrEmailNotFound
-	}
-	email.IsRead = status.IsRead
-	s.emails[id] = email
-	return nil
-}
-
-func (s *MockStore) MoveEmail(id string, folder string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	email, ok := s.emails[id]
-	if !ok {
-		return store.ErrEmailNotFound
-	}
-	email.Folder = folder
-	s.emails[id] = email
-	return nil
-}
-
-func (s *MockStore) DeleteEmail(id string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	if _, ok := s.emails[id]; !ok {
-		return store.ErrEmailNotFound
-	}
-	delete(s.emails, id)
-	return nil
-}
-
-// Implement other required methods from the store.Store interface
-func (s *MockStore) SearchEmails(criteria models.SearchCriteria) ([]models.Email, error) {
-	return nil, nil
-}
-
-func (s *MockStore) GetFolders(accountID string) ([]string, error) {
-	return nil, nil
-}
-
-func (s *MockStore) StoreAttachment(attachment models.Attachment) error {
-	return nil
-}
-
-func (s *MockStore) GetAttachment(id string) (models.Attachment, error) {
-	return models.Attachment{}, nil
-}
-
 func TestEmailEventHandler(t *testing.T) {
+	// Reset the global event handler so handlers from other tests don't fire
+	eventHandlerMutex.Lock()
+	globalEventHandler = nil
+	eventHandlerMutex.Unlock()
+
 	// Create a mock store
-	mockStore := NewMockStore()
+	mockStore := newMemoryStore()
 
 	// Create an event handler
 	handler := GetEmailEventHandler(mockStore)
@@ -269,8 +192,119 @@ func TestEmailEventHandler(t *testing.T) {
 
 		// Verify the email was deleted
 		_, err = mockStore.GetEmail(testEmail.ID)
-		if err != store.ErrEmailNotFound {
-			t.Errorf("Expected error %v, got %v", store.ErrEmailNotFound, err)
+		if err != errEmailNotFound {
+			t.Errorf("Expected error %v, got %v", errEmailNotFound, err)
 		}
 	})
 }
+
+func TestHandleEmailMoved(t *testing.T) {
+	// Reset the global event handler so handlers from other tests don't fire
+	eventHandlerMutex.Lock()
+	globalEventHandler = nil
+	eventHandlerMutex.Unlock()
+
+	mockStore := newMemoryStore()
+	handler := GetEmailEventHandler(mockStore)
+
+	mockStore.StoreEmail(models.Email{
+		ID:        "account-7",
+		AccountID: "account",
+		Folder:    "INBOX",
+		Attachments: []models.Attachment{
+			{ID: "account-7-1", EmailID: "account-7", Filename: "report.pdf", Section: "2"},
+		},
+	})
+
+	events := make(chan EmailEvent, 1)
+	handler.RegisterEventHandler(EmailEventMoved, func(event EmailEvent) {
+		events <- event
+	})
+
+	if err := handler.HandleEmailMoved("account-7", "account-31", "INBOX", "Archive"); err != nil {
+		t.Fatalf("HandleEmailMoved failed: %v", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Email.ID != "account-31" || event.OldValue != "INBOX" || event.NewValue != "Archive" {
+			t.Errorf("Unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+
+	if _, err := mockStore.GetEmail("account-7"); err != errEmailNotFound {
+		t.Errorf("Expected the old email ID to be removed, got %v", err)
+	}
+
+	moved, err := mockStore.GetEmail("account-31")
+	if err != nil {
+		t.Fatalf("Failed to get moved email: %v", err)
+	}
+	if moved.Folder != "Archive" {
+		t.Errorf("Expected folder Archive, got %s", moved.Folder)
+	}
+	if len(moved.Attachments) != 1 || moved.Attachments[0].ID != "account-31-1" || moved.Attachments[0].EmailID != "account-31" {
+		t.Errorf("Expected the attachment to be re-keyed, got %+v", moved.Attachments)
+	}
+
+	// An email of another folder with the new ID is neither skipped as the moved email
+	// nor overwritten, and the moved email is kept under its old ID
+	mockStore.StoreEmail(models.Email{ID: "account-8", AccountID: "account", Folder: "INBOX", Subject: "Moved"})
+	mockStore.StoreEmail(models.Email{ID: "account-9", AccountID: "account", Folder: "Receipts", Subject: "Receipt"})
+	if err := handler.HandleEmailMoved("account-8", "account-9", "INBOX", "Archive"); err == nil {
+		t.Fatal("Expected an error when the new ID is used by another folder's email")
+	}
+	if email, err := mockStore.GetEmail("account-8"); err != nil || email.Subject != "Moved" {
+		t.Errorf("Expected the moved email to be kept, got %+v (%v)", email, err)
+	}
+	if email, _ := mockStore.GetEmail("account-9"); email.Folder != "Receipts" || email.Subject != "Receipt" {
+		t.Errorf("Expected the other folder's email to be left alone, got %+v", email)
+	}
+}
+
+func TestEventLog(t *testing.T) {
+	// Reset the global event handler so handlers from other tests don't fire
+	eventHandlerMutex.Lock()
+	globalEventHandler = nil
+	eventHandlerMutex.Unlock()
+
+	mockStore := newMemoryStore()
+	handler := GetEmailEventHandler(mockStore)
+
+	// Watchers left running by other tests may log events from their goroutines
+	var mutex sync.Mutex
+	var logged []EmailEventType
+	handler.SetEventLog(func(event EmailEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		logged = append(logged, event.Type)
+	})
+	t.Cleanup(func() { handler.SetEventLog(nil) })
+
+	email := models.Email{ID: "account-7", AccountID: "account", Folder: "INBOX"}
+	if err := handler.HandleNewEmail(email); err != nil {
+		t.Fatalf("HandleNewEmail failed: %v", err)
+	}
+	if err := handler.HandleStatusChange(email.ID, models.EmailStatus{IsRead: true}); err != nil {
+		t.Fatalf("HandleStatusChange failed: %v", err)
+	}
+	if err := handler.HandleFolderCreated("account", "Archive"); err != nil {
+		t.Fatalf("HandleFolderCreated failed: %v", err)
+	}
+
+	// The log runs before the handlers return, in the order of the events
+	mutex.Lock()
+	defer mutex.Unlock()
+	expected := []EmailEventType{EmailEventNew, EmailEventRead, FolderEventCreated}
+	if len(logged) != len(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, logged)
+	}
+	for i := range expected {
+		if logged[i] != expected[i] {
+			t.Errorf("Expected events %v, got %v", expected, logged)
+			break
+		}
+	}
+}
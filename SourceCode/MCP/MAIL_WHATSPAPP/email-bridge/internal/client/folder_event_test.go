@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/user/email-bridge/internal/models"
 )
 
@@ -40,8 +41,8 @@ func TestHandleFolderEvents(t *testing.T) {
 	mockStore.AssertExpectations(t)
 }
 
-// TestSyncFolders tests the SyncFolders method
-func TestSyncFolders(t *testing.T) {
+// TestEventHandlerSyncFolders tests the SyncFolders method of the event handler
+func TestEventHandlerSyncFolders(t *testing.T) {
 	// Create a mock store
 	mockStore := new(MockStore)
 
@@ -66,12 +67,9 @@ func TestSyncFolders(t *testing.T) {
 		},
 	}
 
-	// Local folders
-	localFolders := []string{"INBOX", "Sent"}
-
 	// Set up expectations
 	mockClient.On("GetFoldersDetailed").Return(folders, nil)
-	mockStore.On("GetFolders", "test-account").Return(localFolders, nil)
+	mockClient.On("SyncFolders", mockStore, mock.Anything).Return(nil)
 
 	// Create sync options
 	options := models.FolderSyncOptions{
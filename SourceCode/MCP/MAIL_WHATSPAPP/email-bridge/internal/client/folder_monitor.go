@@ -0,0 +1,504 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/utf7"
+	"github.com/user/email-bridge/internal/models"
+)
+
+const (
+	// capNotify lets a connection be told about new emails in several folders (RFC 5465)
+	capNotify = "NOTIFY"
+	// capIdle lets a connection be told about new emails in the selected folder (RFC 2177)
+	capIdle = "IDLE"
+
+	// defaultIdleConnections is how many folders are watched with IDLE when the
+	// monitoring configuration doesn't say
+	defaultIdleConnections = 2
+	// defaultMonitorPollInterval is how often the folders that aren't watched are
+	// polled when the monitoring configuration doesn't say
+	defaultMonitorPollInterval = time.Minute
+	// idleRestartInterval is how long an IDLE command runs before it is restarted, since
+	// servers may log out clients that have been idle for 30 minutes
+	idleRestartInterval = 25 * time.Minute
+	// watchRetryInterval is how long a watch waits to reconnect after its connection
+	// failed. Its folders are polled meanwhile.
+	watchRetryInterval = 30 * time.Second
+)
+
+// folderWatch is a set of folders watched on a connection of its own: any number of
+// folders with NOTIFY, or a single folder with IDLE
+type folderWatch struct {
+	folders []string
+	notify  bool
+}
+
+// planWatches chooses how to watch folders given the server's capabilities. With
+// NOTIFY, one connection watches all the folders; otherwise up to idleConnections
+// folders get a connection each. Both need IDLE to wait for the server's responses.
+// The folders left out are polled.
+func planWatches(folders []string, notify, idle bool, idleConnections int) []folderWatch {
+	if !idle || idleConnections < 0 || len(folders) == 0 {
+		return nil
+	}
+	if notify {
+		return []folderWatch{{folders: folders, notify: true}}
+	}
+
+	var watches []folderWatch
+	for _, folder := range folders {
+		if len(watches) == idleConnections {
+			break
+		}
+		watches = append(watches, folderWatch{folders: []string{folder}})
+	}
+	return watches
+}
+
+// folderMonitor watches an account's folders for new emails and passes them to a
+// callback. The watches only tell which folders changed; new emails are always
+// fetched on the client's own connection.
+type folderMonitor struct {
+	client          *IMAPClientImpl
+	callback        func(models.Email)
+	folders         []string
+	idleConnections int
+	pollInterval    time.Duration
+
+	// changed receives the folders the watches report changes in
+	changed chan string
+
+	mutex   sync.Mutex
+	watched map[string]bool
+
+	// uidNext and uidValidity are the folders' UIDNEXT and UIDVALIDITY when they were
+	// last checked. Only run uses them.
+	uidNext     map[string]uint32
+	uidValidity map[string]uint32
+}
+
+// newFolderMonitor creates a monitor for the folders in the client account's
+// monitoring configuration, or INBOX
+func newFolderMonitor(c *IMAPClientImpl, callback func(models.Email)) *folderMonitor {
+	m := &folderMonitor{
+		client:          c,
+		callback:        callback,
+		folders:         []string{"INBOX"},
+		idleConnections: defaultIdleConnections,
+		pollInterval:    defaultMonitorPollInterval,
+		changed:         make(chan string, 16),
+		watched:         make(map[string]bool),
+		uidNext:         make(map[string]uint32),
+		uidValidity:     make(map[string]uint32),
+	}
+
+	if cfg := c.config.Monitoring; cfg != nil {
+		if len(cfg.Folders) > 0 {
+			m.folders = cfg.Folders
+		}
+		if cfg.IdleConnections != 0 {
+			m.idleConnections = cfg.IdleConnections
+		}
+		if cfg.PollIntervalSeconds > 0 {
+			m.pollInterval = time.Duration(cfg.PollIntervalSeconds) * time.Second
+		}
+	}
+
+	return m
+}
+
+// run monitors the folders until stop is closed
+func (m *folderMonitor) run(stop <-chan struct{}) {
+	// The emails already in the folders aren't new
+	for _, folder := range m.folders {
+		m.check(folder)
+	}
+
+	m.startWatches(stop)
+
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case folder := <-m.changed:
+			if m.isMonitored(folder) {
+				m.check(folder)
+			}
+		case <-ticker.C:
+			for _, folder := range m.folders {
+				if !m.isWatched(folder) {
+					m.check(folder)
+				}
+			}
+		}
+	}
+}
+
+// startWatches opens the connections watching the folders the server lets it. The
+// first connection tells which extensions the server supports.
+func (m *folderMonitor) startWatches(stop <-chan struct{}) {
+	if m.idleConnections < 0 {
+		return
+	}
+
+	conn, err := m.client.dialWatchConn()
+	if err != nil {
+		fmt.Printf("Warning: Failed to connect to watch the folders of account %s, polling them instead: %v\n",
+			m.client.config.ID, err)
+		return
+	}
+
+	notify, _ := conn.Support(capNotify)
+	idle, _ := conn.Support(capIdle)
+	watches := planWatches(m.folders, notify, idle, m.idleConnections)
+	if len(watches) == 0 {
+		conn.Logout()
+		return
+	}
+
+	for i, watch := range watches {
+		var watchConn imapConn
+		if i == 0 {
+			watchConn = conn
+		}
+		go m.watch(watch, watchConn, stop)
+	}
+}
+
+// watch watches folders on a connection until stop is closed, reconnecting when the
+// connection fails. A nil connection is opened first.
+func (m *folderMonitor) watch(watch folderWatch, conn imapConn, stop <-chan struct{}) {
+	for {
+		var err error
+		if conn == nil {
+			conn, err = m.client.dialWatchConn()
+		}
+		if err == nil {
+			err = m.watchConn(watch, conn, stop)
+			m.setWatched(watch.folders, false)
+			conn.Logout()
+			conn = nil
+			if err == nil {
+				// Monitoring was stopped
+				return
+			}
+		}
+
+		fmt.Printf("Warning: Stopped watching folders %s: %v. Retrying in %v...\n",
+			strings.Join(watch.folders, ", "), err, watchRetryInterval)
+
+		select {
+		case <-time.After(watchRetryInterval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// watchConn watches folders on a connection until stop is closed or the connection
+// fails. It returns nil when stopped.
+func (m *folderMonitor) watchConn(watch folderWatch, conn imapConn, stop <-chan struct{}) error {
+	selected := ""
+	if watch.notify {
+		status, err := conn.Execute(notifyCommand(watch.folders), nil)
+		if err == nil {
+			err = status.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to enable NOTIFY: %w", err)
+		}
+	} else {
+		selected = watch.folders[0]
+		if _, err := conn.Select(selected, true); err != nil {
+			return fmt.Errorf("failed to select folder %s: %w", selected, err)
+		}
+	}
+
+	// Check for the emails that arrived while the folders weren't watched
+	m.setWatched(watch.folders, true)
+	for _, folder := range watch.folders {
+		if !m.report(folder, stop) {
+			return nil
+		}
+	}
+
+	for {
+		idleStop := make(chan struct{})
+		handler := &watchHandler{
+			Idle:     &responses.Idle{Stop: idleStop, RepliesCh: make(chan []byte, 10)},
+			selected: selected,
+			changed:  func(folder string) { m.report(folder, stop) },
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			status, err := conn.Execute(&commands.Idle{}, handler)
+			if err == nil {
+				err = status.Err()
+			}
+			done <- err
+		}()
+
+		restart := time.NewTimer(idleRestartInterval)
+		select {
+		case <-stop:
+			restart.Stop()
+			close(idleStop)
+			<-done
+			return nil
+		case <-restart.C:
+			close(idleStop)
+			if err := <-done; err != nil {
+				return err
+			}
+		case err := <-done:
+			restart.Stop()
+			close(idleStop)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// report passes a folder a watch reported changes in to run. It returns false if the
+// monitor was stopped.
+func (m *folderMonitor) report(folder string, stop <-chan struct{}) bool {
+	select {
+	case m.changed <- folder:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// check passes the emails that arrived in a folder since it was last checked to the
+// callback. The first check only records where the folder's emails end.
+func (m *folderMonitor) check(folder string) {
+	uidNext, uidValidity, err := m.client.folderUIDNext(folder)
+	if err != nil {
+		fmt.Printf("Error checking folder %s for new emails: %v\n", folder, err)
+		return
+	}
+
+	last, checked := m.uidNext[folder]
+	if checked && m.uidValidity[folder] == uidValidity && uidNext > last {
+		emails, err := m.client.fetchNewEmails(folder, last, uidNext-1)
+		if err != nil {
+			// The emails are fetched again by the next check
+			fmt.Printf("Error fetching new emails in folder %s: %v\n", folder, err)
+			return
+		}
+		for _, email := range emails {
+			m.callback(email)
+		}
+	}
+
+	m.uidNext[folder] = uidNext
+	m.uidValidity[folder] = uidValidity
+}
+
+// isMonitored reports whether a folder is one of the monitored folders
+func (m *folderMonitor) isMonitored(folder string) bool {
+	for _, monitored := range m.folders {
+		if monitored == folder {
+			return true
+		}
+	}
+	return false
+}
+
+// isWatched reports whether a watch is watching a folder
+func (m *folderMonitor) isWatched(folder string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.watched[folder]
+}
+
+// setWatched records whether a watch is watching folders
+func (m *folderMonitor) setWatched(folders []string, watched bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, folder := range folders {
+		m.watched[folder] = watched
+	}
+}
+
+// watchHandler handles the responses to an IDLE command on a watch connection. EXISTS
+// responses report new emails in the selected folder, and with NOTIFY, STATUS responses
+// report them in the other folders.
+type watchHandler struct {
+	*responses.Idle
+	selected string
+	changed  func(folder string)
+}
+
+// Handle implements responses.Handler
+func (h *watchHandler) Handle(resp imap.Resp) error {
+	if err := h.Idle.Handle(resp); err != responses.ErrUnhandled {
+		return err
+	}
+
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok {
+		return responses.ErrUnhandled
+	}
+
+	switch name {
+	case "EXISTS":
+		if h.selected != "" {
+			h.changed(h.selected)
+		}
+		// Leave the response to the client too, which keeps the selected folder's state
+		return responses.ErrUnhandled
+	case "STATUS":
+		if len(fields) == 0 {
+			return responses.ErrUnhandled
+		}
+		folder, err := imap.ParseString(fields[0])
+		if err != nil {
+			return responses.ErrUnhandled
+		}
+		if decoded, err := utf7.Encoding.NewDecoder().String(folder); err == nil {
+			folder = decoded
+		}
+		h.changed(folder)
+		return nil
+	}
+
+	return responses.ErrUnhandled
+}
+
+// notifyCommand builds a NOTIFY SET command asking to be told about new and expunged
+// emails in folders. While no folder is selected, the server tells with STATUS
+// responses.
+func notifyCommand(folders []string) imap.Commander {
+	mailboxes := make([]interface{}, len(folders))
+	for i, folder := range folders {
+		name, err := utf7.Encoding.NewEncoder().String(folder)
+		if err != nil {
+			name = folder
+		}
+		mailboxes[i] = name
+	}
+
+	return &imap.Command{
+		Name: "NOTIFY",
+		Arguments: []interface{}{
+			imap.RawString("SET"),
+			[]interface{}{
+				imap.RawString("mailboxes"),
+				mailboxes,
+				[]interface{}{imap.RawString("MessageNew"), imap.RawString("MessageExpunge")},
+			},
+		},
+	}
+}
+
+// dialWatchConn opens a connection to watch folders on
+func (c *IMAPClientImpl) dialWatchConn() (imapConn, error) {
+	if c.dialConn != nil {
+		return c.dialConn()
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// folderUIDNext returns the UIDNEXT and UIDVALIDITY of a folder
+func (c *IMAPClientImpl) folderUIDNext(folder string) (uint32, uint32, error) {
+	c.mutex.Lock()
+	if !c.connected || c.client == nil {
+		c.mutex.Unlock()
+		return 0, 0, fmt.Errorf("not connected to IMAP server")
+	}
+
+	status, err := c.client.Status(folder, []imap.StatusItem{imap.StatusUidNext, imap.StatusUidValidity})
+	c.mutex.Unlock()
+	if err != nil {
+		// Handle connection error
+		if c.handleConnectionError(err) {
+			// Try again once if it was a connection error that was fixed
+			return c.folderUIDNext(folder)
+		}
+		return 0, 0, fmt.Errorf("failed to get the status of folder %s: %w", folder, err)
+	}
+
+	return status.UidNext, status.UidValidity, nil
+}
+
+// fetchNewEmails fetches the emails of a folder with UIDs from first to last
+func (c *IMAPClientImpl) fetchNewEmails(folder string, first, last uint32) ([]models.Email, error) {
+	c.mutex.Lock()
+	if !c.connected || c.client == nil {
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("not connected to IMAP server")
+	}
+
+	if _, err := c.client.Select(folder, false); err != nil {
+		c.mutex.Unlock()
+		// Handle connection error
+		if c.handleConnectionError(err) {
+			// Try again once if it was a connection error that was fixed
+			return c.fetchNewEmails(folder, first, last)
+		}
+		return nil, fmt.Errorf("failed to select folder %s: %w", folder, err)
+	}
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddRange(first, last)
+
+	// Define items to fetch
+	items := []imap.FetchItem{
+		imap.FetchEnvelope,
+		imap.FetchFlags,
+		imap.FetchInternalDate,
+		imap.FetchRFC822Size,
+		imap.FetchUid,
+		imap.FetchBodyStructure,
+		"BODY.PEEK[]",
+	}
+
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.client.UidFetch(seqSet, items, messages)
+	}()
+
+	var emails []models.Email
+	for msg := range messages {
+		email, err := c.parseMessage(msg, folder)
+		if err != nil {
+			// Log the error but continue processing other messages
+			fmt.Printf("Error parsing message: %v\n", err)
+			continue
+		}
+		emails = append(emails, email)
+	}
+
+	err := <-done
+	c.mutex.Unlock()
+	if err != nil {
+		// Handle connection error
+		if c.handleConnectionError(err) {
+			// Try again once if it was a connection error that was fixed
+			return c.fetchNewEmails(folder, first, last)
+		}
+		return nil, fmt.Errorf("failed to fetch new emails: %w", err)
+	}
+
+	return emails, nil
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+)
+
+// TestFolderMonitorCheck tests that checking a folder reports the emails that arrived
+// since the last check, in a folder other than INBOX
+func TestFolderMonitorCheck(t *testing.T) {
+	date := time.Now().Add(-time.Hour)
+	conn := &fakeIMAPConn{
+		folders: []string{"INBOX", "Receipts"},
+		emails: map[string][]fakeMessage{
+			"Receipts": {{uid: 1, subject: "Old", date: date}},
+		},
+		uidValidity: "12345",
+	}
+	imapClient := &IMAPClientImpl{
+		config: config.AccountConfig{
+			ID:         "acct",
+			Monitoring: &config.MonitoringConfig{Folders: []string{"Receipts"}},
+		},
+		client:    conn,
+		connected: true,
+	}
+
+	var arrived []models.Email
+	m := newFolderMonitor(imapClient, func(email models.Email) {
+		arrived = append(arrived, email)
+	})
+	if len(m.folders) != 1 || m.folders[0] != "Receipts" || m.idleConnections != defaultIdleConnections {
+		t.Fatalf("Expected the configured folders with the default pool, got %+v", m)
+	}
+
+	// The first check only records where the folder's emails end
+	m.check("Receipts")
+	if len(arrived) != 0 {
+		t.Fatalf("Expected no emails on the first check, got %+v", arrived)
+	}
+
+	conn.emails["Receipts"] = append(conn.emails["Receipts"],
+		fakeMessage{uid: 2, subject: "New", date: date},
+		fakeMessage{uid: 3, subject: "Newer", date: date})
+	m.check("Receipts")
+	if len(arrived) != 2 || arrived[0].ID != "acct-2" || arrived[1].ID != "acct-3" || arrived[1].Folder != "Receipts" {
+		t.Fatalf("Expected acct-2 and acct-3 from Receipts, got %+v", arrived)
+	}
+
+	// Nothing is reported twice
+	m.check("Receipts")
+	if len(arrived) != 2 {
+		t.Errorf("Expected no more emails, got %+v", arrived)
+	}
+
+	// A UIDVALIDITY change starts over rather than reporting the folder's emails as new
+	conn.uidValidity = "67890"
+	conn.emails["Receipts"] = append(conn.emails["Receipts"], fakeMessage{uid: 4, subject: "After", date: date})
+	m.check("Receipts")
+	if len(arrived) != 2 {
+		t.Errorf("Expected no emails after the UIDVALIDITY change, got %+v", arrived)
+	}
+}
+
+// TestPlanWatches tests that folders are watched with NOTIFY when the server supports
+// it, with up to the configured number of IDLE connections otherwise, and not at all
+// without IDLE
+func TestPlanWatches(t *testing.T) {
+	folders := []string{"INBOX", "Receipts", "Alerts"}
+
+	watches := planWatches(folders, true, true, 2)
+	if len(watches) != 1 || !watches[0].notify || len(watches[0].folders) != 3 {
+		t.Errorf("Expected a single NOTIFY watch, got %+v", watches)
+	}
+
+	watches = planWatches(folders, false, true, 2)
+	if len(watches) != 2 || watches[0].notify || watches[0].folders[0] != "INBOX" || watches[1].folders[0] != "Receipts" {
+		t.Errorf("Expected IDLE watches of INBOX and Receipts, got %+v", watches)
+	}
+
+	if watches := planWatches(folders, true, false, 2); len(watches) != 0 {
+		t.Errorf("Expected no watches without IDLE, got %+v", watches)
+	}
+	if watches := planWatches(folders, true, true, -1); len(watches) != 0 {
+		t.Errorf("Expected no watches when they are turned off, got %+v", watches)
+	}
+}
+
+// TestWatchHandler tests that EXISTS responses report the selected folder and STATUS
+// responses the folder they name
+func TestWatchHandler(t *testing.T) {
+	var changed []string
+	newHandler := func(selected string) *watchHandler {
+		return &watchHandler{
+			Idle:     &responses.Idle{Stop: make(chan struct{}), RepliesCh: make(chan []byte, 10)},
+			selected: selected,
+			changed:  func(folder string) { changed = append(changed, folder) },
+		}
+	}
+
+	h := newHandler("INBOX")
+	exists := &imap.DataResp{Tag: "*", Fields: []interface{}{"3", "EXISTS"}}
+	if err := h.Handle(exists); err != responses.ErrUnhandled {
+		t.Errorf("Expected EXISTS to be left to the client, got %v", err)
+	}
+
+	h = newHandler("")
+	status := &imap.DataResp{Tag: "*", Fields: []interface{}{"STATUS", "&AMk-v&AOk-nements", []interface{}{"UIDNEXT", "5"}}}
+	if err := h.Handle(status); err != nil {
+		t.Errorf("Expected STATUS to be handled, got %v", err)
+	}
+	if err := h.Handle(exists); err != responses.ErrUnhandled {
+		t.Errorf("Expected EXISTS to be left to the client, got %v", err)
+	}
+
+	if len(changed) != 2 || changed[0] != "INBOX" || changed[1] != "Événements" {
+		t.Errorf("Expected INBOX and Événements to be reported, got %v", changed)
+	}
+}
+
+// TestNotifyCommand tests that NOTIFY asks for new and expunged emails in the folders,
+// with their names encoded
+func TestNotifyCommand(t *testing.T) {
+	var buf bytes.Buffer
+	if err := notifyCommand([]string{"INBOX", "Événements"}).Command().WriteTo(imap.NewWriter(&buf)); err != nil {
+		t.Fatalf("Error writing command: %v", err)
+	}
+
+	expected := `NOTIFY SET (mailboxes ("INBOX" "&AMk-v&AOk-nements") (MessageNew MessageExpunge))`
+	if !strings.HasSuffix(strings.TrimSpace(buf.String()), expected) {
+		t.Errorf("Expected %s, got %s", expected, buf.String())
+	}
+}
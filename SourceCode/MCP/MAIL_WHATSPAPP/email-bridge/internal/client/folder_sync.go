@@ -32,6 +32,8 @@ func (c *IMAPClientImpl) GetFoldersDetailed() ([]models.Folder, error) {
 			AccountID: c.config.ID,
 			Name:      m.Name,
 			Path:      m.Name,
+			// By default, folders can be selected unless marked otherwise
+			CanSelect: true,
 		}
 
 		// Check if this is a special folder
@@ -44,23 +46,28 @@ func (c *IMAPClientImpl) GetFoldersDetailed() ([]models.Folder, error) {
 		folder.IsArchive = strings.Contains(lowerName, "archive")
 		folder.IsImportant = strings.Contains(lowerName, "important") || strings.Contains(lowerName, "starred")
 
-		// Check folder attributes from flags
+		// Check folder attributes from flags, including RFC 6154 special-use attributes
 		for _, flag := range m.Attributes {
 			switch flag {
 			case imap.NoSelectAttr:
 				folder.CanSelect = false
 			case imap.HasChildrenAttr:
 				folder.CanCreate = true
-			case imap.MarkedAttr:
+			case imap.MarkedAttr, imap.ImportantAttr, imap.FlaggedAttr:
 				folder.IsImportant = true
+			case imap.SentAttr:
+				folder.IsSent = true
+			case imap.TrashAttr:
+				folder.IsTrash = true
+			case imap.DraftsAttr:
+				folder.IsDrafts = true
+			case imap.JunkAttr:
+				folder.IsJunk = true
+			case imap.ArchiveAttr, imap.AllAttr:
+				folder.IsArchive = true
 			}
 		}
 
-		// By default, folders can be selected unless marked otherwise
-		if !folder.CanSelect {
-			folder.CanSelect = true
-		}
-
 		folders = append(folders, folder)
 	}
 
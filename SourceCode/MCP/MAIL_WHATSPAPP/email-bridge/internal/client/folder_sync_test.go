@@ -9,184 +9,12 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/user/email-bridge/internal/config"
 	"github.com/user/email-bridge/internal/models"
-	"github.com/user/email-bridge/internal/store"
 )
 
-// MockIMAPClient is a mock implementation of the go-imap client
-type MockIMAPClient struct {
-	mock.Mock
-}
-
-func (m *MockIMAPClient) List(ref, pattern string, ch chan *imap.MailboxInfo) error {
-	args := m.Called(ref, pattern, ch)
-
-	// Send mock data to the channel
-	folders := args.Get(0).([]imap.MailboxInfo)
-	for _, folder := range folders {
-		ch <- &folder
-	}
-	close(ch)
-
-	return args.Error(1)
-}
-
-func (m *MockIMAPClient) Lsub(ref, pattern string, ch chan *imap.MailboxInfo) error {
-	args := m.Called(ref, pattern, ch)
-
-	// Send mock data to the channel
-	folders := args.Get(0).([]imap.MailboxInfo)
-	for _, folder := range folders {
-		ch <- &folder
-	}
-	close(ch)
-
-	return args.Error(1)
-}
-
-func (m *MockIMAPClient) Create(name string) error {
-	args := m.Called(name)
-	return args.Error(0)
-}
-
-func (m *MockIMAPClient) Delete(name string) error {
-	args := m.Called(name)
-	return args.Error(0)
-}
-
-func (m *MockIMAPClient) Rename(oldName, newName string) error {
-	args := m.Called(oldName, newName)
-	return args.Error(0)
-}
-
-func (m *MockIMAPClient) Subscribe(name string) error {
-	args := m.Called(name)
-	return args.Error(0)
-}
-
-func (m *MockIMAPClient) Unsubscribe(name string) error {
-	args := m.Called(name)
-	return args.Error(0)
-}
-
-// MockStore is a mock implementation of the store.Store interface
-type MockStore struct {
-	mock.Mock
-}
-
-func (m *MockStore) Initialize() error {
-	args := m.Called()
-	return args.Error(0)
-}
-
-func (m *MockStore) Close() error {
-	args := m.Called()
-	return args.Error(0)
-}
-
-func (m *MockStore) StoreEmail(email models.Email) error {
-	args := m.Called(email)
-	return args.Error(0)
-}
-
-func (m *MockStore) GetEmail(id string) (models.Email, error) {
-	args := m.Called(id)
-	return args.Get(0).(models.Email), args.Error(1)
-}
-
-func (m *MockStore) SearchEmails(criteria models.SearchCriteria) ([]models.Email, error) {
-	args := m.Called(criteria)
-	return args.Get(0).([]models.Email), args.Error(1)
-}
-
-func (m *MockStore) UpdateEmailStatus(id string, status models.EmailStatus) error {
-	args := m.Called(id, status)
-	return args.Error(0)
-}
-
-func (m *MockStore) MoveEmail(id string, folder string) error {
-	args := m.Called(id, folder)
-	return args.Error(0)
-}
-
-func (m *MockStore) DeleteEmail(id string) error {
-	args := m.Called(id)
-	return args.Error(0)
-}
-
-func (m *MockStore) StoreAttachment(attachment models.Attachment) error {
-	args := m.Called(attachment)
-	return args.Error(0)
-}
-
-func (m *MockStore) GetAttachment(id string) (models.Attachment, error) {
-	args := m.Called(id)
-	return args.Get(0).(models.Attachment), args.Error(1)
-}
-
-func (m *MockStore) GetFolders(accountID string) ([]string, error) {
-	args := m.Called(accountID)
-	return args.Get(0).([]string), args.Error(1)
-}
-
-func (m *MockStore) CreateFolder(accountID string, name string) error {
-	args := m.Called(accountID, name)
-	return args.Error(0)
-}
-
-func (m *MockStore) RenameFolder(accountID string, oldName string, newName string) error {
-	args := m.Called(accountID, oldName, newName)
-	return args.Error(0)
-}
-
-func (m *MockStore) DeleteFolder(accountID string, name string) error {
-	args := m.Called(accountID, name)
-	return args.Error(0)
-}
-
-func (m *MockStore) StoreAccount(account models.Account) error {
-	args := m.Called(account)
-	return args.Error(0)
-}
-
-func (m *MockStore) GetAccount(id string) (models.Account, error) {
-	args := m.Called(id)
-	return args.Get(0).(models.Account), args.Error(1)
-}
-
-func (m *MockStore) GetAccounts() ([]models.Account, error) {
-	args := m.Called()
-	return args.Get(0).([]models.Account), args.Error(1)
-}
-
-func (m *MockStore) DeleteAccount(id string) error {
-	args := m.Called(id)
-	return args.Error(0)
-}
-
-func (m *MockStore) GetSyncStatus(accountID, folderID string) (store.SyncStatus, error) {
-	args := m.Called(accountID, folderID)
-	return args.Get(0).(store.SyncStatus), args.Error(1)
-}
-
-func (m *MockStore) UpdateSyncStatus(status store.SyncStatus) error {
-	args := m.Called(status)
-	return args.Error(0)
-}
-
-func (m *MockStore) GetAllSyncStatus(accountID string) ([]store.SyncStatus, error) {
-	args := m.Called(accountID)
-	return args.Get(0).([]store.SyncStatus), args.Error(1)
-}
-
-func (m *MockStore) DeleteSyncStatus(accountID, folderID string) error {
-	args := m.Called(accountID, folderID)
-	return args.Error(0)
-}
-
 // TestGetFoldersDetailed tests the GetFoldersDetailed method
 func TestGetFoldersDetailed(t *testing.T) {
 	// Create a mock IMAP client
-	mockClient := new(MockIMAPClient)
+	mockClient := new(MockIMAPConn)
 
 	// Create test folders
 	folders := []imap.MailboxInfo{
@@ -287,7 +115,7 @@ func TestGetFoldersDetailed(t *testing.T) {
 // TestSyncFolders tests the SyncFolders method
 func TestSyncFolders(t *testing.T) {
 	// Create a mock IMAP client
-	mockClient := new(MockIMAPClient)
+	mockClient := new(MockIMAPConn)
 
 	// Create a mock store
 	mockStore := new(MockStore)
@@ -371,7 +199,7 @@ func TestSyncFolders(t *testing.T) {
 // TestCreateFolder tests the CreateFolder method
 func TestCreateFolder(t *testing.T) {
 	// Create a mock IMAP client
-	mockClient := new(MockIMAPClient)
+	mockClient := new(MockIMAPConn)
 
 	// Set up expectations
 	mockClient.On("Create", "New Folder").Return(nil)
@@ -397,7 +225,7 @@ func TestCreateFolder(t *testing.T) {
 // TestRenameFolder tests the RenameFolder method
 func TestRenameFolder(t *testing.T) {
 	// Create a mock IMAP client
-	mockClient := new(MockIMAPClient)
+	mockClient := new(MockIMAPConn)
 
 	// Set up expectations
 	mockClient.On("Rename", "Old Folder", "New Folder").Return(nil)
@@ -423,7 +251,7 @@ func TestRenameFolder(t *testing.T) {
 // TestDeleteFolder tests the DeleteFolder method
 func TestDeleteFolder(t *testing.T) {
 	// Create a mock IMAP client
-	mockClient := new(MockIMAPClient)
+	mockClient := new(MockIMAPConn)
 
 	// Set up expectations
 	mockClient.On("Delete", "Folder to Delete").Return(nil)
@@ -449,7 +277,7 @@ func TestDeleteFolder(t *testing.T) {
 // TestSubscribeFolder tests the SubscribeFolder method
 func TestSubscribeFolder(t *testing.T) {
 	// Create a mock IMAP client
-	mockClient := new(MockIMAPClient)
+	mockClient := new(MockIMAPConn)
 
 	// Set up expectations
 	mockClient.On("Subscribe", "Folder to Subscribe").Return(nil)
@@ -475,7 +303,7 @@ func TestSubscribeFolder(t *testing.T) {
 // TestUnsubscribeFolder tests the UnsubscribeFolder method
 func TestUnsubscribeFolder(t *testing.T) {
 	// Create a mock IMAP client
-	mockClient := new(MockIMAPClient)
+	mockClient := new(MockIMAPConn)
 
 	// Set up expectations
 	mockClient.On("Unsubscribe", "Folder to Unsubscribe").Return(nil)
@@ -35,18 +35,12 @@ func TestFolderWatcher(t *testing.T) {
 		},
 	}
 
-	// Local folders
-	localFolders := []string{"INBOX", "Sent"}
-
 	// Set up expectations for GetFoldersDetailed
 	mockClient.On("GetFoldersDetailed").Return(folders, nil)
 
 	// Set up expectations for SyncFolders
 	mockClient.On("SyncFolders", mockStore, mock.Anything).Return(nil)
 
-	// Set up expectations for GetFolders
-	mockStore.On("GetFolders", "test-account").Return(localFolders, nil)
-
 	// Create the folder watcher with a short sync interval for testing
 	watcher := GetFolderWatcher(mockStore)
 	watcher.SetSyncInterval(100 * time.Millisecond)
@@ -87,18 +81,12 @@ func TestSyncFoldersForAccount(t *testing.T) {
 		},
 	}
 
-	// Local folders
-	localFolders := []string{"INBOX"}
-
 	// Set up expectations for GetFoldersDetailed
 	mockClient.On("GetFoldersDetailed").Return(folders, nil)
 
 	// Set up expectations for SyncFolders
 	mockClient.On("SyncFolders", mockStore, mock.Anything).Return(nil)
 
-	// Set up expectations for GetFolders
-	mockStore.On("GetFolders", "test-account").Return(localFolders, nil)
-
 	// Create the folder watcher
 	watcher := GetFolderWatcher(mockStore)
 
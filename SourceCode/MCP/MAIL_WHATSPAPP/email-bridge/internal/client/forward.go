@@ -0,0 +1,80 @@
+package client
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+// PrefixSubject prefixes a subject with "Re:" or "Fwd:" unless it already starts with it
+func PrefixSubject(prefix string, subject string) string {
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(subject)), strings.ToLower(prefix)) {
+		return subject
+	}
+	return prefix + " " + subject
+}
+
+// ForwardedText returns the plain text of a forward: the note followed by the original
+func ForwardedText(note string, original models.Email) string {
+	var b strings.Builder
+	if note != "" {
+		b.WriteString(note)
+		b.WriteString("\r\n\r\n")
+	}
+
+	b.WriteString("---------- Forwarded message ---------\r\n")
+	b.WriteString("From: " + formatAddressList([]models.Address{original.From}) + "\r\n")
+	b.WriteString("Date: " + original.Date.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("Subject: " + original.Subject + "\r\n")
+	b.WriteString("To: " + formatAddressList(original.To) + "\r\n")
+	if len(original.Cc) > 0 {
+		b.WriteString("Cc: " + formatAddressList(original.Cc) + "\r\n")
+	}
+	b.WriteString("\r\n")
+	b.WriteString(original.TextContent)
+
+	return b.String()
+}
+
+// ForwardedHTML returns the HTML of a forward: the note followed by the original
+func ForwardedHTML(note string, original models.Email) string {
+	var b strings.Builder
+	if note != "" {
+		b.WriteString(note)
+		b.WriteString("<br><br>")
+	}
+
+	b.WriteString("<div>---------- Forwarded message ---------<br>")
+	b.WriteString("From: " + html.EscapeString(formatAddressList([]models.Address{original.From})) + "<br>")
+	b.WriteString("Date: " + html.EscapeString(original.Date.Format(time.RFC1123Z)) + "<br>")
+	b.WriteString("Subject: " + html.EscapeString(original.Subject) + "<br>")
+	b.WriteString("To: " + html.EscapeString(formatAddressList(original.To)) + "<br>")
+	if len(original.Cc) > 0 {
+		b.WriteString("Cc: " + html.EscapeString(formatAddressList(original.Cc)) + "<br>")
+	}
+	b.WriteString("<br></div>")
+
+	if original.HtmlContent != "" {
+		b.WriteString(original.HtmlContent)
+	} else {
+		b.WriteString("<pre>" + html.EscapeString(original.TextContent) + "</pre>")
+	}
+
+	return b.String()
+}
+
+// formatAddressList formats addresses as "Name <email>", separated by commas
+func formatAddressList(addresses []models.Address) string {
+	formatted := make([]string, 0, len(addresses))
+	for _, addr := range addresses {
+		if addr.Name != "" {
+			formatted = append(formatted, fmt.Sprintf("%s <%s>", addr.Name, addr.Email))
+		} else {
+			formatted = append(formatted, addr.Email)
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
@@ -0,0 +1,22 @@
+package client
+
+import "testing"
+
+func TestPrefixSubject(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		subject string
+		want    string
+	}{
+		{"Re:", "Hello", "Re: Hello"},
+		{"Re:", "RE: Hello", "RE: Hello"},
+		{"Fwd:", "Hello", "Fwd: Hello"},
+		{"Fwd:", "fwd: Hello", "fwd: Hello"},
+	}
+
+	for _, tt := range tests {
+		if got := PrefixSubject(tt.prefix, tt.subject); got != tt.want {
+			t.Errorf("PrefixSubject(%q, %q) = %q, want %q", tt.prefix, tt.subject, got, tt.want)
+		}
+	}
+}
@@ -5,25 +5,63 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-message"
 	"github.com/emersion/go-message/mail"
 	"github.com/user/email-bridge/internal/config"
 	"github.com/user/email-bridge/internal/models"
 )
 
+// imapConn is the part of the go-imap client used by IMAPClientImpl.
+// It is satisfied by *client.Client and allows the connection to be replaced in tests.
+type imapConn interface {
+	Select(name string, readOnly bool) (*imap.MailboxStatus, error)
+	List(ref, name string, ch chan *imap.MailboxInfo) error
+	Lsub(ref, name string, ch chan *imap.MailboxInfo) error
+	Create(name string) error
+	Delete(name string) error
+	Rename(existingName, newName string) error
+	Subscribe(name string) error
+	Unsubscribe(name string) error
+	UidSearch(criteria *imap.SearchCriteria) ([]uint32, error)
+	UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error
+	UidStore(seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error
+	UidMove(seqset *imap.SeqSet, dest string) error
+	Append(mbox string, flags []string, date time.Time, msg imap.Literal) error
+	Expunge(ch chan uint32) error
+	Idle(stop <-chan struct{}, opts *client.IdleOptions) error
+	Support(cap string) (bool, error)
+	Status(name string, items []imap.StatusItem) (*imap.MailboxStatus, error)
+	Enable(caps []string) ([]string, error)
+	Execute(cmdr imap.Commander, h responses.Handler) (*imap.StatusResp, error)
+	Logout() error
+}
+
 // IMAPClientImpl implements the IMAPClient interface
 type IMAPClientImpl struct {
 	config     config.AccountConfig
-	client     *client.Client
+	client     imapConn
 	connected  bool
 	monitoring bool
 	mutex      sync.Mutex
 	stopChan   chan struct{}
+
+	// qresyncChecked is the connection QRESYNC was last tried on, and qresyncConn the
+	// one it was enabled on
+	qresyncChecked imapConn
+	qresyncConn    imapConn
+
+	// dialConn opens the extra connections folders are watched on. dial is used when
+	// it is nil.
+	dialConn func() (imapConn, error)
 }
 
 // NewIMAPClientImpl creates a new IMAP client
@@ -46,18 +84,30 @@ func (c *IMAPClientImpl) Connect() error {
 		return nil
 	}
 
+	imapClient, err := c.dial()
+	if err != nil {
+		return err
+	}
+
+	c.client = imapClient
+	c.connected = true
+	return nil
+}
+
+// dial opens and authenticates a new connection to the IMAP server
+func (c *IMAPClientImpl) dial() (*client.Client, error) {
 	var err error
 	var imapClient *client.Client
 
 	// Get decrypted credentials
 	cm, err := GetCredentialManager("./keys/master.key")
 	if err != nil {
-		return fmt.Errorf("failed to initialize credential manager: %w", err)
+		return nil, fmt.Errorf("failed to initialize credential manager: %w", err)
 	}
 
 	decryptedConfig, err := cm.GetDecryptedAccount(c.config)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt credentials: %w", err)
+		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
 	}
 
 	// Connect to the server
@@ -72,24 +122,25 @@ func (c *IMAPClientImpl) Connect() error {
 	}
 
 	if err != nil {
-		return fmt.Errorf("failed to connect to IMAP server: %w", err)
+		return nil, fmt.Errorf("failed to connect to IMAP server: %w", err)
 	}
 
 	// Authenticate
 	if decryptedConfig.AuthType == "oauth" && decryptedConfig.OAuthConfig != nil {
-		// TODO: Implement OAuth authentication
-		return fmt.Errorf("OAuth authentication not implemented yet")
+		// Login with an OAuth2 access token
+		if err := authenticateIMAPOAuth(imapClient, decryptedConfig); err != nil {
+			imapClient.Logout()
+			return nil, err
+		}
 	} else {
 		// Login with username and password
 		if err := imapClient.Login(decryptedConfig.IMAPConfig.Username, decryptedConfig.IMAPConfig.Password); err != nil {
 			imapClient.Logout()
-			return fmt.Errorf("failed to authenticate with IMAP server: %w", err)
+			return nil, fmt.Errorf("failed to authenticate with IMAP server: %w", err)
 		}
 	}
 
-	c.client = imapClient
-	c.connected = true
-	return nil
+	return imapClient, nil
 }
 
 // Disconnect closes the connection to the IMAP server
@@ -187,7 +238,7 @@ func (c *IMAPClientImpl) FetchEmails(criteria models.SearchCriteria) ([]models.E
 		folder = criteria.Folder
 	}
 
-	mbox, err := c.client.Select(folder, false)
+	_, err := c.client.Select(folder, false)
 	if err != nil {
 		// Handle connection error
 		if c.handleConnectionError(err) {
@@ -388,7 +439,8 @@ func (c *IMAPClientImpl) handleConnectionError(err error) bool {
 	return true
 }
 
-// MonitorMailbox starts monitoring for new emails
+// MonitorMailbox starts watching the folders in the account's monitoring configuration,
+// or INBOX, for new emails
 func (c *IMAPClientImpl) MonitorMailbox(callback func(models.Email)) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -406,247 +458,569 @@ func (c *IMAPClientImpl) MonitorMailbox(callback func(models.Email)) error {
 	c.monitoring = true
 
 	// Start monitoring in a goroutine
-	go c.monitorLoop(callback)
+	go c.monitorLoop(callback, c.stopChan)
 
 	return nil
 }
 
-// monitorLoop is the main loop for monitoring emails
-// It implements either IMAP IDLE (if supported) or polling
-func (c *IMAPClientImpl) monitorLoop(callback func(models.Email)) {
-	// Track the last UID we've seen to detect new emails
-	lastSeenUID := uint32(0)
-	folder := "INBOX" // Default to INBOX, could be configurable
+// monitorLoop watches the account's monitored folders for new emails until stop is
+// closed
+func (c *IMAPClientImpl) monitorLoop(callback func(models.Email), stop <-chan struct{}) {
+	newFolderMonitor(c, callback).run(stop)
+}
 
-	// Check if the server supports IDLE
-	supportsIdle := c.supportsIMAP4rev1Extension("IDLE")
+// supportsIMAP4rev1Extension checks if the server supports a specific IMAP4rev1 extension
+func (c *IMAPClientImpl) supportsIMAP4rev1Extension(extension string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	// Main monitoring loop
-	for {
-		select {
-		case <-c.stopChan:
-			// Monitoring was stopped
-			return
-		default:
-			// Continue monitoring
-		}
-
-		// Check if we're still connected
-		if !c.IsConnected() {
-			// Try to reconnect
-			if err := c.reconnect(); err != nil {
-				// Log the error and wait before retrying
-				fmt.Printf("Error reconnecting to IMAP server: %v. Retrying in 30 seconds...\n", err)
-				time.Sleep(30 * time.Second)
-				continue
-			}
-		}
+	if !c.connected || c.client == nil {
+		return false
+	}
 
-		// Lock for the duration of this iteration
-		c.mutex.Lock()
+	// Check the capabilities advertised by the server
+	supported, err := c.client.Support(extension)
+	if err != nil {
+		return false
+	}
 
-		// Select the mailbox
-		mbox, err := c.client.Select(folder, false) // Read-only mode
-		if err != nil {
-			c.mutex.Unlock()
-			fmt.Printf("Error selecting folder %s: %v. Retrying in 10 seconds...\n", folder, err)
-			time.Sleep(10 * time.Second)
-			continue
-		}
+	return supported
+}
 
-		// Check for new messages
-		if mbox.Messages > 0 {
-			// If we haven't seen any messages yet, get the latest UID
-			if lastSeenUID == 0 {
-				// Search for all messages
-				criteria := imap.NewSearchCriteria()
-				uids, err := c.client.UidSearch(criteria)
-				if err == nil && len(uids) > 0 {
-					// Remember the highest UID
-					for _, uid := range uids {
-						if uid > lastSeenUID {
-							lastSeenUID = uid
-						}
-					}
-				}
-			} else {
-				// Search for new messages with UID greater than the last one we've seen
-				criteria := imap.NewSearchCriteria()
-				criteria.Uid = new(imap.SeqSet)
-				criteria.Uid.AddRange(lastSeenUID+1, 0) // From lastSeenUID+1 to infinity
-
-				uids, err := c.client.UidSearch(criteria)
-				if err == nil && len(uids) > 0 {
-					// Fetch and process new messages
-					seqSet := new(imap.SeqSet)
-					seqSet.AddNum(uids...)
-
-					// Define items to fetch
-					items := []imap.FetchItem{
-						imap.FetchEnvelope,
-						imap.FetchFlags,
-						imap.FetchInternalDate,
-						imap.FetchRFC822Size,
-						imap.FetchUid,
-						imap.FetchBodyStructure,
-						"BODY.PEEK[]",
-					}
-
-					// Fetch messages
-					messages := make(chan *imap.Message, 10)
-					done := make(chan error, 1)
-					go func() {
-						done <- c.client.UidFetch(seqSet, items, messages)
-					}()
-
-					// Process messages
-					for msg := range messages {
-						email, err := c.parseMessage(msg, folder)
-						if err != nil {
-							// Log the error but continue processing other messages
-							fmt.Printf("Error parsing message: %v\n", err)
-							continue
-						}
-
-						// Update the last seen UID
-						if msg.Uid > lastSeenUID {
-							lastSeenUID = msg.Uid
-						}
-
-						// Call the callback with the new email
-						// We do this outside the mutex lock to avoid deadlocks
-						// if the callback interacts with the client
-						c.mutex.Unlock()
-						callback(email)
-						c.mutex.Lock()
-					}
-
-					if err := <-done; err != nil {
-						fmt.Printf("Error fetching messages: %v\n", err)
-					}
-				}
-			}
-		}
+// StopMonitoring stops monitoring for new emails
+func (c *IMAPClientImpl) StopMonitoring() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.monitoring {
+		return nil
+	}
+
+	close(c.stopChan)
+	c.stopChan = make(chan struct{})
+	c.monitoring = false
+	return nil
+}
+
+// MarkAsRead sets the \Seen flag of an email in a folder
+func (c *IMAPClientImpl) MarkAsRead(folder string, emailID string) error {
+	return c.storeFlag(folder, emailID, imap.AddFlags, imap.SeenFlag)
+}
+
+// MarkAsUnread clears the \Seen flag of an email in a folder
+func (c *IMAPClientImpl) MarkAsUnread(folder string, emailID string) error {
+	return c.storeFlag(folder, emailID, imap.RemoveFlags, imap.SeenFlag)
+}
 
+// AddFlag sets a system flag or a keyword on an email in a folder
+func (c *IMAPClientImpl) AddFlag(folder string, emailID string, flag string) error {
+	return c.storeFlag(folder, emailID, imap.AddFlags, flag)
+}
+
+// storeFlag adds or removes a flag on the message with the UID encoded in the email ID
+func (c *IMAPClientImpl) storeFlag(folder string, emailID string, op imap.FlagsOp, flag string) error {
+	uid, err := EmailUID(emailID)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	if !c.connected || c.client == nil {
 		c.mutex.Unlock()
+		return fmt.Errorf("not connected to IMAP server")
+	}
 
-		// Use IDLE if supported, otherwise poll
-		if supportsIdle {
-			// Use IMAP IDLE
-			idleDone := make(chan error, 1)
-
-			// Start IDLE mode
-			c.mutex.Lock()
-			if c.client != nil && c.connected {
-				go func() {
-					idleDone <- c.client.Idle(c.stopChan, nil)
-				}()
-			}
-			c.mutex.Unlock()
+	if err := c.selectMessage(folder, uid); err != nil {
+		c.mutex.Unlock()
+		// Handle connection error
+		if c.handleConnectionError(err) {
+			// Try again once if it was a connection error that was fixed
+			return c.storeFlag(folder, emailID, op, flag)
+		}
+		return err
+	}
 
-			// Wait for IDLE to complete or be interrupted
-			select {
-			case err := <-idleDone:
-				if err != nil {
-					fmt.Printf("IDLE error: %v. Retrying in 5 seconds...\n", err)
-					time.Sleep(5 * time.Second)
-				}
-			case <-c.stopChan:
-				// Monitoring was stopped
-				return
-			}
-		} else {
-			// Use polling with a reasonable interval
-			select {
-			case <-time.After(1 * time.Minute):
-				// Continue the loop and check for new messages
-			case <-c.stopChan:
-				// Monitoring was stopped
-				return
-			}
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+
+	err = c.client.UidStore(seqSet, imap.FormatFlagsOp(op, true), []interface{}{flag}, nil)
+	c.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to update flags: %w", err)
+	}
+
+	return nil
+}
+
+// MoveEmail moves an email from a folder to another with UID MOVE. On servers without
+// the MOVE extension the message is copied, flagged \Deleted and expunged instead.
+// Since UIDs are per folder, the moved message gets a new UID. MoveEmail returns the
+// email ID for it, or "" if the message could not be located in the destination.
+func (c *IMAPClientImpl) MoveEmail(folder string, emailID string, destination string) (string, error) {
+	uid, err := EmailUID(emailID)
+	if err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	if !c.connected || c.client == nil {
+		c.mutex.Unlock()
+		return "", fmt.Errorf("not connected to IMAP server")
+	}
+
+	if err := c.selectMessage(folder, uid); err != nil {
+		c.mutex.Unlock()
+		// Handle connection error
+		if c.handleConnectionError(err) {
+			// Try again once if it was a connection error that was fixed
+			return c.MoveEmail(folder, emailID, destination)
 		}
+		return "", err
+	}
+	defer c.mutex.Unlock()
+
+	// The Message-ID is used to find the message again in the destination folder
+	msg, err := c.fetchMessage(uid, []imap.FetchItem{imap.FetchEnvelope})
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch envelope: %w", err)
 	}
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+
+	// go-imap falls back to COPY, STORE and EXPUNGE when MOVE isn't supported
+	if err := c.client.UidMove(seqSet, destination); err != nil {
+		return "", fmt.Errorf("failed to move email to %s: %w", destination, err)
+	}
+
+	if msg == nil || msg.Envelope == nil || msg.Envelope.MessageId == "" {
+		return "", nil
+	}
+
+	newUID, err := c.findMessage(destination, msg.Envelope.MessageId)
+	if err != nil || newUID == 0 {
+		// The move itself succeeded; the caller keeps the old ID
+		return "", nil
+	}
+
+	return fmt.Sprintf("%s-%d", c.config.ID, newUID), nil
 }
 
-// supportsIMAP4rev1Extension checks if the server supports a specific IMAP4rev1 extension
-func (c *IMAPClientImpl) supportsIMAP4rev1Extension(extension string) bool {
+// AppendEmail adds a MIME message to a folder with IMAP APPEND, byte for byte, with
+// the flags given and the message's own date as its internal date. It returns the email
+// ID of the appended message, which is located by its Message-ID since the UID the
+// server assigns isn't returned, or "" if it could not be located.
+func (c *IMAPClientImpl) AppendEmail(folder string, raw RawMessage, flags []string) (string, error) {
+	entity, err := message.Read(newMessageLiteral(raw))
+	if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+		return "", fmt.Errorf("failed to parse message: %w", err)
+	}
+	header := mail.Header{Header: entity.Header}
+	date, err := header.Date()
+	if err != nil || date.IsZero() {
+		date = time.Now()
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
 	if !c.connected || c.client == nil {
-		return false
+		return "", fmt.Errorf("not connected to IMAP server")
 	}
 
-	// Check if the client has capability information
-	for _, cap := range c.client.Caps {
-		if cap == extension {
-			return true
-		}
+	// Unlike the other operations this isn't retried after a reconnection, as the
+	// server may have stored the message before the connection was lost
+	if err := c.client.Append(folder, flags, date, newMessageLiteral(raw)); err != nil {
+		return "", fmt.Errorf("failed to append message to %s: %w", folder, err)
+	}
+
+	messageID := header.Get("Message-Id")
+	if messageID == "" {
+		return "", nil
+	}
+
+	uid, err := c.findMessage(folder, messageID)
+	if err != nil || uid == 0 {
+		// The append itself succeeded
+		return "", nil
 	}
 
-	// If not, request capabilities
-	caps, err := c.client.Capability()
+	return fmt.Sprintf("%s-%d", c.config.ID, uid), nil
+}
+
+// DeleteEmail deletes an email in a folder. The message is moved to the trash folder
+// when the server has one and the email isn't already in it. Otherwise it is expunged
+// with ExpungeEmail, which needs UIDPLUS.
+func (c *IMAPClientImpl) DeleteEmail(folder string, emailID string) error {
+	if _, err := EmailUID(emailID); err != nil {
+		return err
+	}
+
+	trash, err := c.trashFolder()
 	if err != nil {
-		return false
+		return err
 	}
 
-	// Check if the extension is supported
-	for _, cap := range caps {
-		if cap == extension {
-			return true
-		}
+	if trash != "" && trash != folder {
+		_, err := c.MoveEmail(folder, emailID, trash)
+		return err
 	}
 
-	return false
+	return c.ExpungeEmail(folder, emailID)
 }
 
-// StopMonitoring stops monitoring for new emails
-func (c *IMAPClientImpl) StopMonitoring() error {
+// capUIDPlus lets a single email be expunged by UID (RFC 4315)
+const capUIDPlus = "UIDPLUS"
+
+// ExpungeEmail deletes an email in a folder for good, without moving it to the trash
+// folder. It is flagged \Deleted and expunged with UID EXPUNGE. Servers without UIDPLUS
+// can only expunge every message flagged \Deleted in the folder, so the email isn't
+// deleted there.
+func (c *IMAPClientImpl) ExpungeEmail(folder string, emailID string) error {
+	uid, err := EmailUID(emailID)
+	if err != nil {
+		return err
+	}
+
 	c.mutex.Lock()
+	if !c.connected || c.client == nil {
+		c.mutex.Unlock()
+		return fmt.Errorf("not connected to IMAP server")
+	}
+
+	if err := c.selectMessage(folder, uid); err != nil {
+		c.mutex.Unlock()
+		// Handle connection error
+		if c.handleConnectionError(err) {
+			// Try again once if it was a connection error that was fixed
+			return c.ExpungeEmail(folder, emailID)
+		}
+		return err
+	}
 	defer c.mutex.Unlock()
 
-	if !c.monitoring {
-		return nil
+	if ok, err := c.client.Support(capUIDPlus); err != nil || !ok {
+		return fmt.Errorf("server doesn't support UIDPLUS, so email %s can't be expunged without the other deleted messages of folder %s", emailID, folder)
+	}
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	if err := c.client.UidStore(seqSet, item, []interface{}{imap.DeletedFlag}, nil); err != nil {
+		return fmt.Errorf("failed to flag email as deleted: %w", err)
+	}
+
+	status, err := c.client.Execute(uidExpungeCommand(seqSet), nil)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to expunge email %s: %w", emailID, err)
 	}
 
-	close(c.stopChan)
-	c.stopChan = make(chan struct{})
-	c.monitoring = false
 	return nil
 }
 
-// MarkAsRead marks an email as read
-func (c *IMAPClientImpl) MarkAsRead(emailID string) error {
-	// Will be implemented in a future task
-	return fmt.Errorf("not implemented")
+// uidExpungeCommand builds a UID EXPUNGE command, which only expunges the messages in
+// a UID set
+func uidExpungeCommand(seqSet *imap.SeqSet) imap.Commander {
+	return &commands.Uid{Cmd: &imap.Command{
+		Name:      "EXPUNGE",
+		Arguments: []interface{}{seqSet},
+	}}
 }
 
-// MarkAsUnread marks an email as unread
-func (c *IMAPClientImpl) MarkAsUnread(emailID string) error {
-	// Will be implemented in a future task
-	return fmt.Errorf("not implemented")
+// trashFolder returns the name of the server's trash folder, or "" if it has none
+func (c *IMAPClientImpl) trashFolder() (string, error) {
+	folders, err := c.GetFoldersDetailed()
+	if err != nil && folders == nil {
+		return "", err
+	}
+
+	for _, folder := range folders {
+		if folder.IsTrash && folder.CanSelect {
+			return folder.Name, nil
+		}
+	}
+
+	return "", nil
 }
 
-// MoveEmail moves an email to a different folder
-func (c *IMAPClientImpl) MoveEmail(emailID string, folder string) error {
-	// Will be implemented in a future task
-	return fmt.Errorf("not implemented")
+// selectMessage selects a folder for writing and checks that it holds a message with the UID.
+// The caller must hold the client mutex.
+func (c *IMAPClientImpl) selectMessage(folder string, uid uint32) error {
+	if _, err := c.client.Select(folder, false); err != nil {
+		return fmt.Errorf("failed to select folder %s: %w", folder, err)
+	}
+
+	msg, err := c.fetchMessage(uid, []imap.FetchItem{imap.FetchUid})
+	if err != nil {
+		return fmt.Errorf("failed to fetch message: %w", err)
+	}
+	if msg == nil {
+		return fmt.Errorf("message with UID %d not found in folder %s", uid, folder)
+	}
+
+	return nil
 }
 
-// DeleteEmail deletes an email
-func (c *IMAPClientImpl) DeleteEmail(emailID string) error {
-	// Will be implemented in a future task
-	return fmt.Errorf("not implemented")
+// findMessage selects a folder and returns the highest UID of the messages with a Message-ID,
+// or 0 if there are none. The caller must hold the client mutex.
+func (c *IMAPClientImpl) findMessage(folder string, messageID string) (uint32, error) {
+	if _, err := c.client.Select(folder, true); err != nil {
+		return 0, err
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Header.Set("Message-Id", messageID)
+
+	uids, err := c.client.UidSearch(criteria)
+	if err != nil {
+		return 0, err
+	}
+
+	var newest uint32
+	for _, uid := range uids {
+		if uid > newest {
+			newest = uid
+		}
+	}
+
+	return newest, nil
 }
 
-// GetAttachment downloads an attachment
-func (c *IMAPClientImpl) GetAttachment(emailID string, attachmentID string) (models.Attachment, error) {
-	// Will be implemented in a future task
-	return models.Attachment{}, fmt.Errorf("not implemented")
+// GetAttachment downloads the decoded content of an attachment of an email in a folder.
+// The message is located by the UID encoded in the email ID and the MIME part by its body section.
+// Attachments stored before sections were recorded are located by their position instead.
+func (c *IMAPClientImpl) GetAttachment(folder string, attachment models.Attachment) (io.ReadCloser, error) {
+	uid, err := EmailUID(attachment.EmailID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	if !c.connected || c.client == nil {
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("not connected to IMAP server")
+	}
+
+	// Select the mailbox in read-only mode
+	if _, err := c.client.Select(folder, true); err != nil {
+		c.mutex.Unlock()
+		// Handle connection error
+		if c.handleConnectionError(err) {
+			// Try again once if it was a connection error that was fixed
+			return c.GetAttachment(folder, attachment)
+		}
+		return nil, fmt.Errorf("failed to select folder %s: %w", folder, err)
+	}
+
+	// Rebuild the body section from the body structure if it was never recorded
+	sectionName := attachment.Section
+	if sectionName == "" {
+		msg, err := c.fetchMessage(uid, []imap.FetchItem{imap.FetchBodyStructure})
+		if err != nil {
+			c.mutex.Unlock()
+			if c.handleConnectionError(err) {
+				return c.GetAttachment(folder, attachment)
+			}
+			return nil, fmt.Errorf("failed to fetch body structure: %w", err)
+		}
+		if msg == nil {
+			c.mutex.Unlock()
+			return nil, fmt.Errorf("message with UID %d not found in folder %s", uid, folder)
+		}
+
+		sectionName, err = attachmentSection(msg.BodyStructure, attachment)
+		if err != nil {
+			c.mutex.Unlock()
+			return nil, err
+		}
+	}
+
+	path, err := parseSectionPath(sectionName)
+	if err != nil {
+		c.mutex.Unlock()
+		return nil, err
+	}
+
+	// Fetch the body structure for the transfer encoding and the raw part content
+	section := &imap.BodySectionName{
+		BodyPartName: imap.BodyPartName{Path: path},
+		Peek:         true,
+	}
+
+	msg, err := c.fetchMessage(uid, []imap.FetchItem{imap.FetchBodyStructure, section.FetchItem()})
+	c.mutex.Unlock()
+	if err != nil {
+		// Handle connection error
+		if c.handleConnectionError(err) {
+			// Try again once if it was a connection error that was fixed
+			return c.GetAttachment(folder, attachment)
+		}
+		return nil, fmt.Errorf("failed to fetch attachment: %w", err)
+	}
+
+	if msg == nil {
+		return nil, fmt.Errorf("message with UID %d not found in folder %s", uid, folder)
+	}
+
+	body := msg.GetBody(section)
+	if body == nil {
+		return nil, fmt.Errorf("body section %s not found", sectionName)
+	}
+
+	// Decode the part using the transfer encoding from the body structure
+	var header message.Header
+	if part := findBodyPart(msg.BodyStructure, path); part != nil && part.Encoding != "" {
+		header.Set("Content-Transfer-Encoding", part.Encoding)
+	}
+
+	entity, err := message.New(header, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode attachment: %w", err)
+	}
+
+	return ioutil.NopCloser(entity.Body), nil
+}
+
+// fetchMessage fetches a single message of the selected mailbox by UID.
+// The caller must hold the client mutex. It returns nil if no message has the UID.
+func (c *IMAPClientImpl) fetchMessage(uid uint32, items []imap.FetchItem) (*imap.Message, error) {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.client.UidFetch(seqSet, items, messages)
+	}()
+
+	var msg *imap.Message
+	for m := range messages {
+		msg = m
+	}
+
+	if err := <-done; err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// attachmentSection returns the body section of an attachment that has none recorded.
+// Attachment IDs are "<emailID>-<n>", where n is the 1-based position of the part
+// among the parts the mail reader treats as attachments.
+func attachmentSection(bs *imap.BodyStructure, attachment models.Attachment) (string, error) {
+	prefix := attachment.EmailID + "-"
+	if !strings.HasPrefix(attachment.ID, prefix) {
+		return "", fmt.Errorf("attachment %s has no body section", attachment.ID)
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(attachment.ID, prefix))
+	if err != nil || n <= 0 {
+		return "", fmt.Errorf("attachment %s has no body section", attachment.ID)
+	}
+
+	sections := attachmentSections(bs)
+	if n > len(sections) {
+		return "", fmt.Errorf("attachment %s not found in message structure", attachment.ID)
+	}
+
+	return sections[n-1], nil
+}
+
+// EmailUID extracts the IMAP UID from an email ID of the form "<account>-<uid>"
+func EmailUID(emailID string) (uint32, error) {
+	i := strings.LastIndex(emailID, "-")
+	if i < 0 || i == len(emailID)-1 {
+		return 0, fmt.Errorf("email ID %s does not contain a UID", emailID)
+	}
+
+	uid, err := strconv.ParseUint(emailID[i+1:], 10, 32)
+	if err != nil || uid == 0 {
+		return 0, fmt.Errorf("email ID %s does not contain a UID", emailID)
+	}
+
+	return uint32(uid), nil
+}
+
+// parseSectionPath parses a body section such as "1.2" into an IMAP part path
+func parseSectionPath(section string) ([]int, error) {
+	var path []int
+	for _, node := range strings.Split(section, ".") {
+		n, err := strconv.Atoi(node)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid body section %s", section)
+		}
+		path = append(path, n)
+	}
+	return path, nil
+}
+
+// formatSectionPath formats an IMAP part path as a body section such as "1.2"
+func formatSectionPath(path []int) string {
+	nodes := make([]string, len(path))
+	for i, n := range path {
+		nodes[i] = strconv.Itoa(n)
+	}
+	return strings.Join(nodes, ".")
+}
+
+// findBodyPart returns the part of a body structure at the given part path
+func findBodyPart(bs *imap.BodyStructure, path []int) *imap.BodyStructure {
+	if bs == nil {
+		return nil
+	}
+
+	var found *imap.BodyStructure
+	target := formatSectionPath(path)
+	bs.Walk(func(partPath []int, part *imap.BodyStructure) bool {
+		if found == nil && formatSectionPath(partPath) == target {
+			found = part
+		}
+		return found == nil
+	})
+
+	return found
+}
+
+// attachmentSections returns the body sections of the parts that the mail reader
+// treats as attachments, in the order in which it returns them
+func attachmentSections(bs *imap.BodyStructure) []string {
+	if bs == nil {
+		return nil
+	}
+
+	var sections []string
+	bs.Walk(func(path []int, part *imap.BodyStructure) bool {
+		if len(part.Parts) > 0 {
+			// Multipart container, only its children are returned by the reader
+			return true
+		}
+
+		disposition := strings.ToLower(part.Disposition)
+		isText := strings.EqualFold(part.MIMEType, "text")
+		if disposition == "inline" || (disposition != "attachment" && isText) {
+			return true
+		}
+
+		sections = append(sections, formatSectionPath(path))
+		return true
+	})
+
+	return sections
 }
 
 // parseMessage converts an IMAP message to an Email model
 func (c *IMAPClientImpl) parseMessage(msg *imap.Message, folder string) (models.Email, error) {
+	return c.parseMessageWithAttachments(msg, folder, nil)
+}
+
+// parseMessageWithAttachments converts a fetched message to an email, writing the
+// content of its attachments to an attachment store if one is given
+func (c *IMAPClientImpl) parseMessageWithAttachments(msg *imap.Message, folder string, attachments *AttachmentStore) (models.Email, error) {
 	if msg == nil {
 		return models.Email{}, fmt.Errorf("nil message")
 	}
@@ -712,7 +1086,7 @@ func (c *IMAPClientImpl) parseMessage(msg *imap.Message, folder string) (models.
 	email.HasAttachments = c.hasAttachments(msg)
 
 	// Parse the message body and attachments
-	if err := c.parseMessageBody(msg, &email); err != nil {
+	if err := c.parseMessageBody(msg, &email, attachments); err != nil {
 		return email, fmt.Errorf("failed to parse message body: %w", err)
 	}
 
@@ -759,8 +1133,10 @@ func (c *IMAPClientImpl) checkPartForAttachment(part *imap.BodyStructure) bool {
 	return false
 }
 
-// parseMessageBody extracts the text and HTML content from the message
-func (c *IMAPClientImpl) parseMessageBody(msg *imap.Message, email *models.Email) error {
+// parseMessageBody extracts the text and HTML content from the message. The content of
+// attachments is written to the attachment store if one is given, and otherwise only
+// measured.
+func (c *IMAPClientImpl) parseMessageBody(msg *imap.Message, email *models.Email, attachments *AttachmentStore) error {
 	// Import required packages
 	// Note: In a real implementation, you would need to import these packages at the top of the file
 	// "github.com/emersion/go-message"
@@ -783,21 +1159,22 @@ func (c *IMAPClientImpl) parseMessageBody(msg *imap.Message, email *models.Email
 
 	// Extract headers
 	header := mr.Header
-	if header != nil {
-		// Extract common headers
-		if date, err := header.Date(); err == nil {
-			email.Date = date
-		}
-		if subject, err := header.Subject(); err == nil {
-			email.Subject = subject
-		}
+	if date, err := header.Date(); err == nil {
+		email.Date = date
+	}
+	if subject, err := header.Subject(); err == nil {
+		email.Subject = subject
+	}
 
-		// Extract all headers
-		for field := range header.Fields() {
-			email.Headers[field.Key] = field.Value
-		}
+	// Extract all headers
+	fields := header.Fields()
+	for fields.Next() {
+		email.Headers[fields.Key()] = fields.Value()
 	}
 
+	// Body sections of the attachment parts, in reader order
+	sections := attachmentSections(msg.BodyStructure)
+
 	// Process each part of the message
 	for {
 		p, err := mr.NextPart()
@@ -840,9 +1217,23 @@ func (c *IMAPClientImpl) parseMessageBody(msg *imap.Message, email *models.Email
 				ContentType: contentType,
 			}
 
-			// Get the size of the attachment
-			if data, err := ioutil.ReadAll(p.Body); err == nil {
-				attachment.Size = int64(len(data))
+			// Remember where the part lives so it can be fetched on demand
+			if n := len(email.Attachments); n < len(sections) {
+				attachment.Section = sections[n]
+			}
+
+			if attachments != nil {
+				// Keep the content so it can be served without the server
+				path, hash, size, err := attachments.Save(p.Body)
+				if err != nil {
+					return fmt.Errorf("failed to save attachment %s: %w", attachment.ID, err)
+				}
+				attachment.Path = path
+				attachment.Hash = hash
+				attachment.Size = size
+			} else if size, err := io.Copy(io.Discard, p.Body); err == nil {
+				// Get the size of the attachment
+				attachment.Size = size
 			}
 
 			// Add to attachments list
@@ -0,0 +1,306 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-message/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+)
+
+// attachmentTestMessage is a message with body text, an inline image and three attachments:
+// a PDF, a CSV marked as attachment and a JPEG without a Content-Disposition
+const attachmentTestMessage = "From: sender@example.com\r\n" +
+	"To: recipient@example.com\r\n" +
+	"Subject: Attachments\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Hello\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>Hello</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=report.pdf\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"aGVsbG8=\r\n" +
+	"--outer\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-Disposition: inline; filename=logo.png\r\n" +
+	"\r\n" +
+	"png\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/csv\r\n" +
+	"Content-Disposition: attachment; filename=data.csv\r\n" +
+	"\r\n" +
+	"a,b\r\n" +
+	"--outer\r\n" +
+	"Content-Type: image/jpeg; name=photo.jpg\r\n" +
+	"\r\n" +
+	"jpeg\r\n" +
+	"--outer--\r\n"
+
+// attachmentTestStructure is the body structure a server reports for attachmentTestMessage
+func attachmentTestStructure() *imap.BodyStructure {
+	return &imap.BodyStructure{
+		MIMEType:    "multipart",
+		MIMESubType: "mixed",
+		Parts: []*imap.BodyStructure{
+			{
+				MIMEType:    "multipart",
+				MIMESubType: "alternative",
+				Parts: []*imap.BodyStructure{
+					{MIMEType: "text", MIMESubType: "plain"},
+					{MIMEType: "text", MIMESubType: "html"},
+				},
+			},
+			{
+				MIMEType:          "application",
+				MIMESubType:       "pdf",
+				Encoding:          "base64",
+				Disposition:       "attachment",
+				DispositionParams: map[string]string{"filename": "report.pdf"},
+			},
+			{
+				MIMEType:          "image",
+				MIMESubType:       "png",
+				Disposition:       "inline",
+				DispositionParams: map[string]string{"filename": "logo.png"},
+			},
+			{
+				MIMEType:          "text",
+				MIMESubType:       "csv",
+				Disposition:       "attachment",
+				DispositionParams: map[string]string{"filename": "data.csv"},
+			},
+			{
+				MIMEType:    "image",
+				MIMESubType: "jpeg",
+				Params:      map[string]string{"name": "photo.jpg"},
+			},
+		},
+	}
+}
+
+func TestEmailUID(t *testing.T) {
+	tests := []struct {
+		emailID string
+		want    uint32
+		wantErr bool
+	}{
+		{emailID: "account-42", want: 42},
+		{emailID: "my-work-account-7", want: 7},
+		{emailID: "account-4294967295", want: 4294967295},
+		{emailID: "account-", wantErr: true},
+		{emailID: "account", wantErr: true},
+		{emailID: "account-0", wantErr: true},
+		{emailID: "account-abc", wantErr: true},
+		{emailID: "account-4294967296", wantErr: true},
+		{emailID: "email_1700000000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.emailID, func(t *testing.T) {
+			uid, err := EmailUID(tt.emailID)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, uid)
+		})
+	}
+}
+
+func TestParseSectionPath(t *testing.T) {
+	tests := []struct {
+		section string
+		want    []int
+		wantErr bool
+	}{
+		{section: "1", want: []int{1}},
+		{section: "2.1", want: []int{2, 1}},
+		{section: "3.2.10", want: []int{3, 2, 10}},
+		{section: "", wantErr: true},
+		{section: "0", wantErr: true},
+		{section: "1..2", wantErr: true},
+		{section: "1.x", wantErr: true},
+		{section: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.section, func(t *testing.T) {
+			path, err := parseSectionPath(tt.section)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, path)
+			assert.Equal(t, tt.section, formatSectionPath(path))
+		})
+	}
+}
+
+func TestAttachmentSections(t *testing.T) {
+	tests := []struct {
+		name string
+		bs   *imap.BodyStructure
+		want []string
+	}{
+		{
+			name: "nil structure",
+			bs:   nil,
+			want: nil,
+		},
+		{
+			name: "single text part",
+			bs:   &imap.BodyStructure{MIMEType: "text", MIMESubType: "plain"},
+			want: nil,
+		},
+		{
+			name: "single attachment part",
+			bs:   &imap.BodyStructure{MIMEType: "application", MIMESubType: "pdf", Disposition: "attachment"},
+			want: []string{"1"},
+		},
+		{
+			name: "mixed message",
+			bs:   attachmentTestStructure(),
+			want: []string{"2", "4", "5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, attachmentSections(tt.bs))
+		})
+	}
+}
+
+// TestAttachmentSectionsMatchReaderOrder checks that the nth section belongs to the
+// nth part that mail.Reader returns as an attachment
+func TestAttachmentSectionsMatchReaderOrder(t *testing.T) {
+	mr, err := mail.CreateReader(strings.NewReader(attachmentTestMessage))
+	if err != nil {
+		t.Fatalf("Failed to create mail reader: %v", err)
+	}
+
+	var readerContentTypes []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read part: %v", err)
+		}
+		if h, ok := p.Header.(*mail.AttachmentHeader); ok {
+			contentType, _, _ := h.ContentType()
+			readerContentTypes = append(readerContentTypes, contentType)
+		}
+	}
+
+	bs := attachmentTestStructure()
+	sections := attachmentSections(bs)
+	if len(sections) != len(readerContentTypes) {
+		t.Fatalf("Expected %d sections, got %d (%v)", len(readerContentTypes), len(sections), sections)
+	}
+
+	for i, section := range sections {
+		path, err := parseSectionPath(section)
+		assert.NoError(t, err)
+
+		part := findBodyPart(bs, path)
+		if assert.NotNil(t, part, "section %s", section) {
+			assert.Equal(t, readerContentTypes[i], strings.ToLower(part.MIMEType+"/"+part.MIMESubType), "attachment %d", i+1)
+		}
+	}
+}
+
+func TestAttachmentSection(t *testing.T) {
+	bs := attachmentTestStructure()
+
+	tests := []struct {
+		name         string
+		attachmentID string
+		want         string
+		wantErr      bool
+	}{
+		{name: "first attachment", attachmentID: "account-7-1", want: "2"},
+		{name: "third attachment", attachmentID: "account-7-3", want: "5"},
+		{name: "out of range", attachmentID: "account-7-4", wantErr: true},
+		{name: "zero index", attachmentID: "account-7-0", wantErr: true},
+		{name: "other email", attachmentID: "account-8-1", wantErr: true},
+		{name: "generated ID", attachmentID: "att_1700000000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			section, err := attachmentSection(bs, models.Attachment{ID: tt.attachmentID, EmailID: "account-7"})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, section)
+		})
+	}
+}
+
+// TestGetAttachmentWithoutSection tests that an attachment stored without a body section
+// is located through the body structure of its message
+func TestGetAttachmentWithoutSection(t *testing.T) {
+	conn := new(MockIMAPConn)
+
+	structureOnly := mock.MatchedBy(func(items []imap.FetchItem) bool { return len(items) == 1 })
+	withContent := mock.MatchedBy(func(items []imap.FetchItem) bool { return len(items) == 2 })
+
+	section := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Path: []int{2}}}
+
+	conn.On("Select", "INBOX", true).Return(&imap.MailboxStatus{Name: "INBOX"}, nil)
+	conn.On("UidFetch", mock.Anything, structureOnly, mock.Anything).Return([]*imap.Message{
+		{Uid: 7, BodyStructure: attachmentTestStructure()},
+	}, nil).Once()
+	conn.On("UidFetch", mock.Anything, withContent, mock.Anything).Return([]*imap.Message{
+		{
+			Uid:           7,
+			BodyStructure: attachmentTestStructure(),
+			Body:          map[*imap.BodySectionName]imap.Literal{section: bytes.NewBufferString("aGVsbG8=")},
+		},
+	}, nil).Once()
+
+	client := &IMAPClientImpl{
+		config:    config.AccountConfig{ID: "account"},
+		client:    conn,
+		connected: true,
+		mutex:     sync.Mutex{},
+	}
+
+	content, err := client.GetAttachment("INBOX", models.Attachment{ID: "account-7-1", EmailID: "account-7"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer content.Close()
+
+	data, err := io.ReadAll(content)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	conn.AssertExpectations(t)
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/email-bridge/internal/config"
+)
+
+// newFlagsTestClient returns a connected client for the account "account" using conn
+func newFlagsTestClient(conn imapConn) *IMAPClientImpl {
+	return &IMAPClientImpl{
+		config:    config.AccountConfig{ID: "account"},
+		client:    conn,
+		connected: true,
+		mutex:     sync.Mutex{},
+	}
+}
+
+// uidSet matches a sequence set holding exactly one UID
+func uidSet(uid uint32) interface{} {
+	return mock.MatchedBy(func(seqSet *imap.SeqSet) bool {
+		return seqSet.String() == (&imap.SeqSet{Set: []imap.Seq{{Start: uid, Stop: uid}}}).String()
+	})
+}
+
+func TestMarkAsReadAndUnread(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(c *IMAPClientImpl) error
+		item imap.StoreItem
+	}{
+		{"read", func(c *IMAPClientImpl) error { return c.MarkAsRead("INBOX", "account-7") }, "+FLAGS.SILENT"},
+		{"unread", func(c *IMAPClientImpl) error { return c.MarkAsUnread("INBOX", "account-7") }, "-FLAGS.SILENT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := new(MockIMAPConn)
+			conn.On("Select", "INBOX", false).Return(&imap.MailboxStatus{Name: "INBOX"}, nil)
+			conn.On("UidFetch", uidSet(7), mock.Anything, mock.Anything).Return([]*imap.Message{{Uid: 7}}, nil)
+			conn.On("UidStore", uidSet(7), tt.item, []interface{}{imap.SeenFlag}, mock.Anything).Return(nil)
+
+			assert.NoError(t, tt.call(newFlagsTestClient(conn)))
+			conn.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAddFlag(t *testing.T) {
+	conn := new(MockIMAPConn)
+	conn.On("Select", "INBOX", false).Return(&imap.MailboxStatus{Name: "INBOX"}, nil)
+	conn.On("UidFetch", uidSet(7), mock.Anything, mock.Anything).Return([]*imap.Message{{Uid: 7}}, nil)
+	conn.On("UidStore", uidSet(7), imap.StoreItem("+FLAGS.SILENT"), []interface{}{"invoices"}, mock.Anything).Return(nil)
+
+	assert.NoError(t, newFlagsTestClient(conn).AddFlag("INBOX", "account-7", "invoices"))
+	conn.AssertExpectations(t)
+}
+
+func TestMarkAsReadMissingMessage(t *testing.T) {
+	conn := new(MockIMAPConn)
+	conn.On("Select", "INBOX", false).Return(&imap.MailboxStatus{Name: "INBOX"}, nil)
+	conn.On("UidFetch", uidSet(7), mock.Anything, mock.Anything).Return([]*imap.Message{}, nil)
+
+	err := newFlagsTestClient(conn).MarkAsRead("INBOX", "account-7")
+	assert.ErrorContains(t, err, "not found")
+	conn.AssertNotCalled(t, "UidStore", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMoveEmail(t *testing.T) {
+	conn := new(MockIMAPConn)
+	conn.On("Select", "INBOX", false).Return(&imap.MailboxStatus{Name: "INBOX"}, nil)
+	conn.On("UidFetch", uidSet(7), mock.Anything, mock.Anything).Return([]*imap.Message{
+		{Uid: 7, Envelope: &imap.Envelope{MessageId: "<7@example.com>"}},
+	}, nil)
+	conn.On("UidMove", uidSet(7), "Archive").Return(nil)
+	conn.On("Select", "Archive", true).Return(&imap.MailboxStatus{Name: "Archive"}, nil)
+	conn.On("UidSearch", mock.MatchedBy(func(criteria *imap.SearchCriteria) bool {
+		return criteria.Header.Get("Message-Id") == "<7@example.com>"
+	})).Return([]uint32{12, 31}, nil)
+
+	newID, err := newFlagsTestClient(conn).MoveEmail("INBOX", "account-7", "Archive")
+	assert.NoError(t, err)
+	assert.Equal(t, "account-31", newID)
+	conn.AssertExpectations(t)
+}
+
+func TestMoveEmailWithoutMessageID(t *testing.T) {
+	conn := new(MockIMAPConn)
+	conn.On("Select", "INBOX", false).Return(&imap.MailboxStatus{Name: "INBOX"}, nil)
+	conn.On("UidFetch", uidSet(7), mock.Anything, mock.Anything).Return([]*imap.Message{
+		{Uid: 7, Envelope: &imap.Envelope{}},
+	}, nil)
+	conn.On("UidMove", uidSet(7), "Archive").Return(nil)
+
+	newID, err := newFlagsTestClient(conn).MoveEmail("INBOX", "account-7", "Archive")
+	assert.NoError(t, err)
+	assert.Equal(t, "", newID)
+	conn.AssertNotCalled(t, "UidSearch", mock.Anything)
+}
+
+func TestDeleteEmail(t *testing.T) {
+	folders := []imap.MailboxInfo{
+		{Name: "INBOX"},
+		{Name: "Bin", Attributes: []string{imap.TrashAttr}},
+	}
+
+	t.Run("moves to trash", func(t *testing.T) {
+		conn := new(MockIMAPConn)
+		conn.On("List", "", "*", mock.Anything).Return(folders, nil)
+		conn.On("Lsub", "", "*", mock.Anything).Return(folders, nil)
+		conn.On("Select", "INBOX", false).Return(&imap.MailboxStatus{Name: "INBOX"}, nil)
+		conn.On("UidFetch", uidSet(7), mock.Anything, mock.Anything).Return([]*imap.Message{{Uid: 7}}, nil)
+		conn.On("UidMove", uidSet(7), "Bin").Return(nil)
+
+		assert.NoError(t, newFlagsTestClient(conn).DeleteEmail("INBOX", "account-7"))
+		conn.AssertExpectations(t)
+		conn.AssertNotCalled(t, "Expunge", mock.Anything)
+	})
+
+	t.Run("expunges from trash", func(t *testing.T) {
+		conn := new(MockIMAPConn)
+		conn.On("List", "", "*", mock.Anything).Return(folders, nil)
+		conn.On("Lsub", "", "*", mock.Anything).Return(folders, nil)
+		conn.On("Select", "Bin", false).Return(&imap.MailboxStatus{Name: "Bin"}, nil)
+		conn.On("UidFetch", uidSet(7), mock.Anything, mock.Anything).Return([]*imap.Message{{Uid: 7}}, nil)
+		conn.On("Support", "UIDPLUS").Return(true, nil)
+		conn.On("UidStore", uidSet(7), imap.StoreItem("+FLAGS.SILENT"), []interface{}{imap.DeletedFlag}, mock.Anything).Return(nil)
+		conn.On("Execute", command("UID EXPUNGE 7"), mock.Anything).Return(&imap.StatusResp{Type: imap.StatusRespOk}, nil)
+
+		assert.NoError(t, newFlagsTestClient(conn).DeleteEmail("Bin", "account-7"))
+		conn.AssertExpectations(t)
+		conn.AssertNotCalled(t, "UidMove", mock.Anything, mock.Anything)
+		conn.AssertNotCalled(t, "Expunge", mock.Anything)
+	})
+
+	t.Run("refuses without UIDPLUS", func(t *testing.T) {
+		conn := new(MockIMAPConn)
+		conn.On("List", "", "*", mock.Anything).Return(folders, nil)
+		conn.On("Lsub", "", "*", mock.Anything).Return(folders, nil)
+		conn.On("Select", "Bin", false).Return(&imap.MailboxStatus{Name: "Bin"}, nil)
+		conn.On("UidFetch", uidSet(7), mock.Anything, mock.Anything).Return([]*imap.Message{{Uid: 7}}, nil)
+		conn.On("Support", "UIDPLUS").Return(false, nil)
+
+		assert.Error(t, newFlagsTestClient(conn).DeleteEmail("Bin", "account-7"))
+		conn.AssertNotCalled(t, "UidStore", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		conn.AssertNotCalled(t, "Execute", mock.Anything, mock.Anything)
+		conn.AssertNotCalled(t, "Expunge", mock.Anything)
+	})
+}
+
+// command matches a command that is written as text, leaving out its tag
+func command(text string) interface{} {
+	return mock.MatchedBy(func(cmdr imap.Commander) bool {
+		var buf bytes.Buffer
+		if err := cmdr.Command().WriteTo(imap.NewWriter(&buf)); err != nil {
+			return false
+		}
+		return strings.HasSuffix(strings.TrimSpace(buf.String()), text)
+	})
+}
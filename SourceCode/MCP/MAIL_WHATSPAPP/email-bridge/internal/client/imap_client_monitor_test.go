@@ -84,8 +84,13 @@ func TestIMAPClientMonitoring(t *testing.T) {
 
 // TestIMAPClientMonitoringIntegration tests the integration between IMAP client monitoring and the email event handler
 func TestIMAPClientMonitoringIntegration(t *testing.T) {
+	// Reset the global event handler so handlers from other tests don't fire
+	eventHandlerMutex.Lock()
+	globalEventHandler = nil
+	eventHandlerMutex.Unlock()
+
 	// Create a mock store
-	mockStore := NewMockStore()
+	mockStore := newMemoryStore()
 
 	// Create an email event handler
 	eventHandler := GetEmailEventHandler(mockStore)
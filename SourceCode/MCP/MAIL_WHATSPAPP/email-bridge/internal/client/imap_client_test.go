@@ -52,11 +52,13 @@ func TestIMAPClientReconnect(t *testing.T) {
 	client := NewIMAPClientImpl(cfg)
 
 	// Test the reconnect logic without actually connecting
-	// This just ensures the method doesn't panic
+	// A client that was never connected has nothing to restore, so this is a no-op
 	err := client.reconnect()
-	if err == nil {
-		// We expect an error since we're not actually connecting to a server
-		t.Error("Expected error when reconnecting to non-existent server")
+	if err != nil {
+		t.Errorf("Expected no error when reconnecting a client that was never connected, got %v", err)
+	}
+	if client.IsConnected() {
+		t.Error("Client should not be connected after reconnecting from a disconnected state")
 	}
 }
 
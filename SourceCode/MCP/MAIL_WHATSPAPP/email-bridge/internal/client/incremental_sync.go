@@ -21,8 +21,12 @@ type IncrementalSyncOptions struct {
 	MaxEmails int
 	// SyncAttachments determines whether to download attachments
 	SyncAttachments bool
+	// AttachmentDir is the directory downloaded attachments are stored in
+	AttachmentDir string
 	// OnProgress is a callback function for progress updates
 	OnProgress func(folder string, current, total int)
+	// OnNewEmail is called with each email that was not stored before the sync
+	OnNewEmail func(email models.Email)
 	// CheckStatusChanges determines whether to check for status changes in existing emails
 	CheckStatusChanges bool
 }
@@ -34,6 +38,7 @@ func DefaultIncrementalSyncOptions(accountID string) IncrementalSyncOptions {
 		BatchSize:          100,
 		MaxEmails:          0, // No limit
 		SyncAttachments:    false,
+		AttachmentDir:      "attachments",
 		OnProgress:         nil,
 		CheckStatusChanges: true,
 	}
@@ -71,6 +76,9 @@ func (c *IMAPClientImpl) IncrementalSync(s store.Store, options IncrementalSyncO
 		}
 	}
 
+	// Before any folder is selected, let the server report expunged emails
+	c.enableQResync()
+
 	// Synchronize each folder incrementally
 	for _, folder := range folders {
 		if err := c.incrementalSyncFolder(s, folder, options); err != nil {
@@ -78,6 +86,11 @@ func (c *IMAPClientImpl) IncrementalSync(s store.Store, options IncrementalSyncO
 		}
 	}
 
+	// Emails the sync deleted may have left attachment files behind
+	if options.SyncAttachments {
+		pruneAttachments(s, options.AttachmentDir)
+	}
+
 	return nil
 }
 
@@ -89,6 +102,10 @@ func (c *IMAPClientImpl) incrementalSyncFolder(s store.Store, folder string, opt
 		return fmt.Errorf("not connected to IMAP server")
 	}
 
+	// Read the folder's mod-sequence before selecting it, so that the changes made while
+	// it is synced are fetched by the next sync
+	highestModSeq := c.folderModSeq(folder)
+
 	// Select the mailbox
 	mbox, err := c.client.Select(folder, false) // Read-only mode
 	if err != nil {
@@ -126,14 +143,17 @@ func (c *IMAPClientImpl) incrementalSyncFolder(s store.Store, folder string, opt
 			BatchSize:       options.BatchSize,
 			MaxEmails:       options.MaxEmails,
 			SyncAttachments: options.SyncAttachments,
+			AttachmentDir:   options.AttachmentDir,
 			OnProgress:      options.OnProgress,
+			OnNewEmail:      options.OnNewEmail,
 		}
 		return c.syncFolder(s, folder, syncOptions)
 	}
 
 	// Check if the mailbox has changed structurally (UID validity changed)
-	if syncStatus.UIDValidity != mbox.UidValidity {
-		// UID validity has changed, need to do a full sync
+	if syncStatus.UIDValidity != formatUIDValidity(mbox.UidValidity) {
+		// UID validity has changed, so the stored emails need re-mapping before a full
+		// sync, which syncFolder does
 		c.mutex.Unlock()
 		syncOptions := EmailSyncOptions{
 			AccountID:       options.AccountID,
@@ -141,7 +161,9 @@ func (c *IMAPClientImpl) incrementalSyncFolder(s store.Store, folder string, opt
 			BatchSize:       options.BatchSize,
 			MaxEmails:       options.MaxEmails,
 			SyncAttachments: options.SyncAttachments,
+			AttachmentDir:   options.AttachmentDir,
 			OnProgress:      options.OnProgress,
+			OnNewEmail:      options.OnNewEmail,
 		}
 		return c.syncFolder(s, folder, syncOptions)
 	}
@@ -195,6 +217,8 @@ func (c *IMAPClientImpl) incrementalSyncFolder(s store.Store, folder string, opt
 				AccountID:       options.AccountID,
 				BatchSize:       options.BatchSize,
 				SyncAttachments: options.SyncAttachments,
+				AttachmentDir:   options.AttachmentDir,
+				OnNewEmail:      options.OnNewEmail,
 			}); err != nil {
 				return fmt.Errorf("failed to sync new email batch: %w", err)
 			}
@@ -225,16 +249,13 @@ func (c *IMAPClientImpl) incrementalSyncFolder(s store.Store, folder string, opt
 		options.OnProgress(folder, 0, 0)
 	}
 
-	// Check for status changes in existing emails (read/unread, flags, moved)
+	// Check for status changes in existing emails (read/unread, flags, moved), only
+	// fetching those changed since the last check when the server supports CONDSTORE
 	if options.CheckStatusChanges {
-		if err := c.syncEmailStatusChanges(s, folder, options.AccountID); err != nil {
-			return fmt.Errorf("failed to sync email status changes: %w", err)
-		}
-
-		// Check for emails that have been moved between folders
-		if err := c.syncMovedEmails(s, options.AccountID, folder); err != nil {
-			return fmt.Errorf("failed to sync moved emails: %w", err)
+		if err := c.syncChanges(s, folder, options.AccountID, syncStatus, highestModSeq); err != nil {
+			return err
 		}
+		syncStatus.HighestModSeq = highestModSeq
 	}
 
 	// Update sync status
@@ -269,8 +290,8 @@ func (c *IMAPClientImpl) syncMovedEmails(s store.Store, accountID string, folder
 	uids := make([]uint32, 0, len(emails))
 
 	for _, email := range emails {
-		// Extract UID from the email ID or metadata
-		uid, err := extractUID(email)
+		// Extract UID from the email ID
+		uid, err := EmailUID(email.ID)
 		if err != nil {
 			// Skip emails where we can't extract the UID
 			continue
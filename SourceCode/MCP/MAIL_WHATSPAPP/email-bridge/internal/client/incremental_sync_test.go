@@ -1,9 +1,12 @@
 package client
 
 import (
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/user/email-bridge/internal/config"
 	"github.com/user/email-bridge/internal/models"
 	"github.com/user/email-bridge/internal/store"
 )
@@ -11,9 +14,9 @@ import (
 // TestIncrementalSync tests the incremental sync functionality
 func TestIncrementalSync(t *testing.T) {
 	// Create a mock IMAP client
-	mockClient := &mockIMAPClient{
+	mockClient := &fakeIMAPConn{
 		folders: []string{"INBOX", "Sent"},
-		emails: map[string][]mockEmail{
+		emails: map[string][]fakeMessage{
 			"INBOX": {
 				{uid: 1, subject: "Old Email 1", date: time.Now().Add(-48 * time.Hour), isRead: true},
 				{uid: 2, subject: "Old Email 2", date: time.Now().Add(-24 * time.Hour), isRead: false},
@@ -24,7 +27,7 @@ func TestIncrementalSync(t *testing.T) {
 	}
 
 	// Create a mock store
-	mockStore := &mockStore{
+	mockStore := &memoryStore{
 		emails: make(map[string]models.Email),
 		syncStatus: map[string]store.SyncStatus{
 			"INBOX": {
@@ -48,6 +51,8 @@ func TestIncrementalSync(t *testing.T) {
 		AccountID: "test-account",
 		Folder:    "INBOX",
 		BatchSize: 100,
+		// Status changes and moved emails are checked in this test too
+		CheckStatusChanges: true,
 	}
 
 	// Perform the sync
@@ -76,19 +81,21 @@ func TestIncrementalSync(t *testing.T) {
 	mockClient.emails["INBOX"][1].isRead = true // Mark email with UID 2 as read
 
 	// Create a new mock store with the email already in it
-	mockStore2 := &mockStore{
+	mockStore2 := &memoryStore{
 		emails: map[string]models.Email{
-			"email-1": {
-				ID:      "email-1",
-				Subject: "Old Email 1",
-				IsRead:  true,
-				Headers: map[string]string{"X-IMAP-UID": "1"},
+			"test-account-1": {
+				ID:        "test-account-1",
+				AccountID: "test-account",
+				Folder:    "INBOX",
+				Subject:   "Old Email 1",
+				IsRead:    true,
 			},
-			"email-2": {
-				ID:      "email-2",
-				Subject: "Old Email 2",
-				IsRead:  false, // This should be updated to true
-				Headers: map[string]string{"X-IMAP-UID": "2"},
+			"test-account-2": {
+				ID:        "test-account-2",
+				AccountID: "test-account",
+				Folder:    "INBOX",
+				Subject:   "Old Email 2",
+				IsRead:    false, // This should be updated to true
 			},
 		},
 		syncStatus: map[string]store.SyncStatus{
@@ -109,9 +116,9 @@ func TestIncrementalSync(t *testing.T) {
 	}
 
 	// Verify that the read status was updated
-	email2, ok := mockStore2.emails["email-2"]
+	email2, ok := mockStore2.emails["test-account-2"]
 	if !ok {
-		t.Fatalf("Email with ID email-2 not found")
+		t.Fatalf("Email with ID test-account-2 not found")
 	}
 
 	if !email2.IsRead {
@@ -120,9 +127,9 @@ func TestIncrementalSync(t *testing.T) {
 
 	// Test moved emails
 	// Create a mock client with an email moved to a different folder
-	mockClient3 := &mockIMAPClient{
+	mockClient3 := &fakeIMAPConn{
 		folders: []string{"INBOX", "Archive"},
-		emails: map[string][]mockEmail{
+		emails: map[string][]fakeMessage{
 			"INBOX": {
 				{uid: 1, subject: "Old Email 1", date: time.Now().Add(-48 * time.Hour), isRead: true},
 				// Email with UID 2 is no longer in INBOX
@@ -135,21 +142,21 @@ func TestIncrementalSync(t *testing.T) {
 	}
 
 	// Create a mock store with both emails in INBOX
-	mockStore3 := &mockStore{
+	mockStore3 := &memoryStore{
 		emails: map[string]models.Email{
-			"email-1": {
-				ID:      "email-1",
-				Subject: "Old Email 1",
-				Folder:  "INBOX",
-				IsRead:  true,
-				Headers: map[string]string{"X-IMAP-UID": "1"},
+			"test-account-1": {
+				ID:        "test-account-1",
+				AccountID: "test-account",
+				Subject:   "Old Email 1",
+				Folder:    "INBOX",
+				IsRead:    true,
 			},
-			"email-2": {
-				ID:      "email-2",
-				Subject: "Old Email 2",
-				Folder:  "INBOX", // This email should be detected as moved/deleted
-				IsRead:  true,
-				Headers: map[string]string{"X-IMAP-UID": "2"},
+			"test-account-2": {
+				ID:        "test-account-2",
+				AccountID: "test-account",
+				Subject:   "Old Email 2",
+				Folder:    "INBOX", // This email should be detected as moved/deleted
+				IsRead:    true,
 			},
 		},
 		syncStatus: map[string]store.SyncStatus{
@@ -176,7 +183,7 @@ func TestIncrementalSync(t *testing.T) {
 	}
 
 	// Verify that the moved email was deleted from the store
-	_, ok = mockStore3.emails["email-2"]
+	_, ok = mockStore3.emails["test-account-2"]
 	if ok {
 		t.Errorf("Expected email with UID 2 to be deleted from the store")
 	}
@@ -185,9 +192,9 @@ func TestIncrementalSync(t *testing.T) {
 // TestIncrementalSyncFirstRun tests that incremental sync falls back to full sync on first run
 func TestIncrementalSyncFirstRun(t *testing.T) {
 	// Create a mock IMAP client
-	mockClient := &mockIMAPClient{
+	mockClient := &fakeIMAPConn{
 		folders: []string{"INBOX"},
-		emails: map[string][]mockEmail{
+		emails: map[string][]fakeMessage{
 			"INBOX": {
 				{uid: 1, subject: "Email 1", date: time.Now().Add(-48 * time.Hour), isRead: true},
 				{uid: 2, subject: "Email 2", date: time.Now().Add(-24 * time.Hour), isRead: false},
@@ -197,7 +204,7 @@ func TestIncrementalSyncFirstRun(t *testing.T) {
 	}
 
 	// Create a mock store with no sync status (first run)
-	mockStore := &mockStore{
+	mockStore := &memoryStore{
 		emails:     make(map[string]models.Email),
 		syncStatus: make(map[string]store.SyncStatus),
 	}
@@ -241,12 +248,73 @@ func TestIncrementalSyncFirstRun(t *testing.T) {
 	}
 }
 
+// TestIncrementalSyncReportsNewEmails tests that only emails the store didn't have are
+// passed to OnNewEmail
+func TestIncrementalSyncReportsNewEmails(t *testing.T) {
+	mockClient := &fakeIMAPConn{
+		folders: []string{"INBOX"},
+		emails: map[string][]fakeMessage{
+			"INBOX": {
+				{uid: 1, subject: "Email 1", date: time.Now().Add(-48 * time.Hour), isRead: true},
+				{uid: 2, subject: "Email 2", date: time.Now().Add(-24 * time.Hour), isRead: false},
+				{uid: 3, subject: "Email 3", date: time.Now().Add(-1 * time.Hour), isRead: false},
+			},
+		},
+		uidValidity: "12345",
+	}
+
+	// The first email was stored by the monitor, so the sync isn't its arrival
+	mockStore := &memoryStore{
+		emails: map[string]models.Email{
+			"test-account-1": {ID: "test-account-1", AccountID: "test-account", Folder: "INBOX"},
+		},
+		syncStatus: make(map[string]store.SyncStatus),
+	}
+
+	imapClient := &IMAPClientImpl{
+		config:    config.AccountConfig{ID: "test-account"},
+		client:    mockClient,
+		connected: true,
+	}
+
+	var mutex sync.Mutex
+	var arrived []string
+	options := IncrementalSyncOptions{
+		AccountID: "test-account",
+		Folder:    "INBOX",
+		BatchSize: 2,
+		OnNewEmail: func(email models.Email) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			arrived = append(arrived, email.ID)
+		},
+	}
+
+	if err := imapClient.IncrementalSync(mockStore, options); err != nil {
+		t.Fatalf("Error during incremental sync: %v", err)
+	}
+
+	sort.Strings(arrived)
+	if len(arrived) != 2 || arrived[0] != "test-account-2" || arrived[1] != "test-account-3" {
+		t.Errorf("Expected the two new emails to be reported, got %v", arrived)
+	}
+
+	// Nothing is new on the next sync
+	arrived = nil
+	if err := imapClient.IncrementalSync(mockStore, options); err != nil {
+		t.Fatalf("Error during incremental sync: %v", err)
+	}
+	if len(arrived) != 0 {
+		t.Errorf("Expected no new emails, got %v", arrived)
+	}
+}
+
 // TestIncrementalSyncUIDValidityChanged tests that incremental sync falls back to full sync when UID validity changes
 func TestIncrementalSyncUIDValidityChanged(t *testing.T) {
 	// Create a mock IMAP client with a different UID validity
-	mockClient := &mockIMAPClient{
+	mockClient := &fakeIMAPConn{
 		folders: []string{"INBOX"},
-		emails: map[string][]mockEmail{
+		emails: map[string][]fakeMessage{
 			"INBOX": {
 				{uid: 1, subject: "Email 1", date: time.Now().Add(-48 * time.Hour), isRead: true},
 				{uid: 2, subject: "Email 2", date: time.Now().Add(-24 * time.Hour), isRead: false},
@@ -256,7 +324,7 @@ func TestIncrementalSyncUIDValidityChanged(t *testing.T) {
 	}
 
 	// Create a mock store with existing sync status
-	mockStore := &mockStore{
+	mockStore := &memoryStore{
 		emails: make(map[string]models.Email),
 		syncStatus: map[string]store.SyncStatus{
 			"INBOX": {
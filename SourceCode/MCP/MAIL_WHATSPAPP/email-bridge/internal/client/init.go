@@ -3,19 +3,23 @@ package client
 import (
 	"fmt"
 	"path/filepath"
+	"time"
 
 	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
 	"github.com/user/email-bridge/internal/store"
 )
 
 // InitializeEmailClients initializes all email clients and connection management
 func InitializeEmailClients(cfg config.Config, keyPath string, emailStore store.Store) error {
 	// Initialize credential manager
-	cm, err := GetCredentialManager(filepath.Join(keyPath, "master.key"))
-	if err != nil {
+	if _, err := GetCredentialManager(filepath.Join(keyPath, "master.key")); err != nil {
 		return fmt.Errorf("failed to initialize credential manager: %w", err)
 	}
 
+	// Initialize token manager so refreshed OAuth tokens are persisted
+	GetTokenManager(emailStore)
+
 	// Initialize connection manager
 	connManager := GetConnectionManager()
 	connManager.Start()
@@ -33,48 +37,169 @@ func InitializeEmailClients(cfg config.Config, keyPath string, emailStore store.
 	folderWatcher.Start()
 
 	// Initialize clients for each account
+	configured := make(map[string]bool, len(cfg.Accounts))
 	for _, account := range cfg.Accounts {
-		// Create a copy of the account to avoid issues with loop variable capture
-		accountCopy := account
+		configured[account.ID] = true
+		if err := registerAccount(account, keyPath, connManager, emailMonitor, folderWatcher); err != nil {
+			fmt.Printf("Warning: Failed to register account %s: %v\n", account.ID, err)
+		}
+	}
 
-		// Initialize IMAP client
-		imapClient := NewIMAPClientImpl(accountCopy)
+	// Initialize clients for accounts created through the API
+	if emailStore != nil {
+		accounts, err := emailStore.GetAccounts()
+		if err != nil {
+			fmt.Printf("Warning: Failed to load stored accounts: %v\n", err)
+		}
+		for _, account := range accounts {
+			if configured[account.ID] {
+				continue
+			}
+
+			// GetAccounts leaves out credentials, so load the full account
+			stored, err := emailStore.GetAccount(account.ID)
+			if err != nil {
+				fmt.Printf("Warning: Failed to load stored account %s: %v\n", account.ID, err)
+				continue
+			}
+			if err := RegisterStoredAccount(stored, keyPath); err != nil {
+				fmt.Printf("Warning: Failed to register stored account %s: %v\n", account.ID, err)
+			}
+		}
+	}
 
-		// Register with connection manager
-		imapClientID := fmt.Sprintf("imap-%s", accountCopy.ID)
-		connManager.RegisterClient(imapClientID, imapClient)
+	// Start sending queued emails once the accounts' SMTP clients are registered
+	GetOutboxSender(emailStore).Start()
 
-		// Try to connect
-		if err := imapClient.Connect(); err != nil {
-			fmt.Printf("Warning: Failed to connect to IMAP server for account %s: %v\n", accountCopy.ID, err)
-			// Continue with other accounts
-			continue
-		}
+	return nil
+}
+
+// RegisterAccount creates the IMAP and SMTP clients of an account and registers them with
+// the connection manager, email monitor and folder watcher. Credentials must be encrypted
+// the same way as in config.json, with the master key in the keyPath directory.
+func RegisterAccount(account config.AccountConfig, keyPath string) error {
+	return registerAccount(account, keyPath, GetConnectionManager(), GetEmailMonitor(nil), GetFolderWatcher(nil))
+}
+
+// RegisterStoredAccount registers the clients of an account loaded from the store,
+// encrypting its plaintext credentials for the clients first with the master key in the
+// keyPath directory
+func RegisterStoredAccount(account models.Account, keyPath string) error {
+	cm, err := GetCredentialManager(filepath.Join(keyPath, "master.key"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize credential manager: %w", err)
+	}
+
+	accountConfig := AccountConfigFromModel(account)
+	if err := cm.EncryptCredentials(&accountConfig); err != nil {
+		return err
+	}
+
+	return RegisterAccount(accountConfig, keyPath)
+}
 
-		// Register with email monitor for mailbox monitoring
-		emailMonitor.RegisterClient(imapClientID, imapClient)
-		fmt.Printf("Started email monitoring for account %s\n", accountCopy.ID)
+// UnregisterAccount stops monitoring and folder synchronization for an account,
+// disconnects its clients and removes them from the connection manager
+func UnregisterAccount(accountID string) {
+	imapClientID := fmt.Sprintf("imap-%s", accountID)
+	smtpClientID := fmt.Sprintf("smtp-%s", accountID)
 
-		// Register with folder watcher for folder synchronization
-		folderWatcher.RegisterClient(accountCopy.ID, imapClient)
-		fmt.Printf("Started folder synchronization for account %s\n", accountCopy.ID)
+	GetEmailMonitor(nil).UnregisterClient(imapClientID)
+	GetFolderWatcher(nil).UnregisterClient(accountID)
+	GetTokenManager(nil).RemoveAccount(accountID)
 
-		// Initialize SMTP client
-		smtpClient := NewSMTPClientImpl(accountCopy)
+	connManager := GetConnectionManager()
+	for _, id := range []string{imapClientID, smtpClientID} {
+		if c, ok := connManager.GetClient(id); ok {
+			if err := c.Disconnect(); err != nil {
+				fmt.Printf("Warning: Failed to disconnect client %s: %v\n", id, err)
+			}
+			connManager.UnregisterClient(id)
+		}
+	}
+}
 
-		// Register with connection manager
-		smtpClientID := fmt.Sprintf("smtp-%s", accountCopy.ID)
-		connManager.RegisterClient(smtpClientID, smtpClient)
+// AccountConfigFromModel converts a stored account into the configuration used by the clients
+func AccountConfigFromModel(account models.Account) config.AccountConfig {
+	accountConfig := config.AccountConfig{
+		ID:    account.ID,
+		Name:  account.Name,
+		Email: account.Email,
+		IMAPConfig: config.IMAPConfig{
+			Server:   account.IMAPConfig.Server,
+			Port:     account.IMAPConfig.Port,
+			Username: account.IMAPConfig.Username,
+			Password: account.IMAPConfig.Password,
+			UseTLS:   account.IMAPConfig.UseTLS,
+		},
+		SMTPConfig: config.SMTPConfig{
+			Server:   account.SMTPConfig.Server,
+			Port:     account.SMTPConfig.Port,
+			Username: account.SMTPConfig.Username,
+			Password: account.SMTPConfig.Password,
+			UseTLS:   account.SMTPConfig.UseTLS,
+		},
+		AuthType: account.AuthType,
+	}
 
-		// Try to connect
-		if err := smtpClient.Connect(); err != nil {
-			fmt.Printf("Warning: Failed to connect to SMTP server for account %s: %v\n", accountCopy.ID, err)
-			// Continue with other clients
-		} else {
-			fmt.Printf("Successfully connected to SMTP server for account %s\n", accountCopy.ID)
+	if account.OAuthConfig != nil {
+		accountConfig.OAuthConfig = &config.OAuthConfig{
+			ClientID:     account.OAuthConfig.ClientID,
+			ClientSecret: account.OAuthConfig.ClientSecret,
+			RefreshToken: account.OAuthConfig.RefreshToken,
+			AccessToken:  account.OAuthConfig.AccessToken,
+			TokenURL:     account.OAuthConfig.TokenURL,
+		}
+		if !account.OAuthConfig.Expiry.IsZero() {
+			accountConfig.OAuthConfig.Expiry = account.OAuthConfig.Expiry.Format(time.RFC3339)
 		}
 	}
 
+	return accountConfig
+}
+
+// registerAccount creates and registers the clients of an account. The clients decrypt
+// their credentials with the master key in the keyPath directory.
+func registerAccount(account config.AccountConfig, keyPath string, connManager *ConnectionManager, emailMonitor *EmailMonitor, folderWatcher *FolderWatcher) error {
+	if _, err := GetCredentialManager(filepath.Join(keyPath, "master.key")); err != nil {
+		return fmt.Errorf("failed to initialize credential manager: %w", err)
+	}
+
+	// Initialize IMAP client
+	imapClient := NewIMAPClientImpl(account)
+
+	// Register with connection manager
+	imapClientID := fmt.Sprintf("imap-%s", account.ID)
+	connManager.RegisterClient(imapClientID, imapClient)
+
+	// Try to connect. The client is registered for monitoring and folder
+	// synchronization either way: both retry while the connection watcher reconnects.
+	if err := imapClient.Connect(); err != nil {
+		fmt.Printf("Warning: Failed to connect to IMAP server for account %s: %v\n", account.ID, err)
+	}
+
+	// Register with email monitor for mailbox monitoring
+	emailMonitor.RegisterClient(imapClientID, imapClient)
+	fmt.Printf("Started email monitoring for account %s\n", account.ID)
+
+	// Register with folder watcher for folder synchronization
+	folderWatcher.RegisterClient(account.ID, imapClient)
+	fmt.Printf("Started folder synchronization for account %s\n", account.ID)
+
+	// Initialize SMTP client
+	smtpClient := NewSMTPClientImpl(account)
+
+	// Register with connection manager
+	smtpClientID := fmt.Sprintf("smtp-%s", account.ID)
+	connManager.RegisterClient(smtpClientID, smtpClient)
+
+	// Try to connect
+	if err := smtpClient.Connect(); err != nil {
+		fmt.Printf("Warning: Failed to connect to SMTP server for account %s: %v\n", account.ID, err)
+	} else {
+		fmt.Printf("Successfully connected to SMTP server for account %s\n", account.ID)
+	}
+
 	return nil
 }
 
@@ -88,6 +213,9 @@ func ShutdownEmailClients() {
 	folderWatcher := GetFolderWatcher(nil)
 	folderWatcher.Stop()
 
+	// Stop the outbox sender so no email is sent while clients disconnect
+	GetOutboxSender(nil).Stop()
+
 	// Stop connection watcher
 	connWatcher := GetConnectionWatcher()
 	connWatcher.Stop()
@@ -1,7 +1,9 @@
 package client
 
 import (
+	"net"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -66,8 +68,12 @@ func TestInitializeEmailClients(t *testing.T) {
 	globalEmailMonitor = nil
 	emailMonitorMutex.Unlock()
 
+	folderWatcherMutex.Lock()
+	globalFolderWatcher = nil
+	folderWatcherMutex.Unlock()
+
 	// Create a mock store for testing
-	mockStore := NewMockStore()
+	mockStore := newMemoryStore()
 
 	// Initialize email clients
 	err = InitializeEmailClients(cfg, tempDir, mockStore)
@@ -116,9 +122,10 @@ func TestInitializeEmailClients(t *testing.T) {
 		t.Error("Expected email monitor to be running")
 	}
 
-	// The client count might be 0 in tests since the actual connection would fail
-	// but we can at least verify the monitor was initialized
-	t.Logf("Email monitor has %d clients registered", clientMonitorCount)
+	// The client is monitored even though the connection fails in tests
+	if clientMonitorCount != 1 {
+		t.Errorf("Expected 1 client to be monitored, got %d", clientMonitorCount)
+	}
 
 	// Wait a moment to ensure all goroutines have started
 	time.Sleep(100 * time.Millisecond)
@@ -144,3 +151,50 @@ func TestInitializeEmailClients(t *testing.T) {
 		t.Error("Expected email monitor to be stopped")
 	}
 }
+
+// TestRegisterAccountWithoutConnection tests that an account whose IMAP server can't
+// be reached is still registered for monitoring and folder synchronization, so that
+// both start once the connection watcher reconnects
+func TestRegisterAccountWithoutConnection(t *testing.T) {
+	// A port nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	account := config.AccountConfig{
+		ID:         "offline",
+		Email:      "offline@example.com",
+		IMAPConfig: config.IMAPConfig{Server: "127.0.0.1", Port: port},
+		SMTPConfig: config.SMTPConfig{Server: "127.0.0.1", Port: port},
+		AuthType:   "password",
+	}
+
+	connManager := &ConnectionManager{clients: make(map[string]EmailClient)}
+	emailMonitor := &EmailMonitor{clients: make(map[string]IMAPClient), stopChan: make(chan struct{})}
+	folderWatcher := &FolderWatcher{
+		clients:      make(map[string]IMAPClient),
+		syncInterval: time.Minute,
+		mutex:        sync.RWMutex{},
+		stopChans:    make(map[string]chan struct{}),
+	}
+
+	if err := registerAccount(account, t.TempDir(), connManager, emailMonitor, folderWatcher); err != nil {
+		t.Fatalf("Failed to register account: %v", err)
+	}
+
+	if _, ok := connManager.GetClient("imap-offline"); !ok {
+		t.Errorf("Expected the IMAP client to be registered with the connection manager")
+	}
+	if _, ok := connManager.GetClient("smtp-offline"); !ok {
+		t.Errorf("Expected the SMTP client to be registered with the connection manager")
+	}
+	if _, ok := emailMonitor.clients["imap-offline"]; !ok {
+		t.Errorf("Expected the IMAP client to be registered with the email monitor")
+	}
+	if _, ok := folderWatcher.clients["offline"]; !ok {
+		t.Errorf("Expected the IMAP client to be registered with the folder watcher")
+	}
+}
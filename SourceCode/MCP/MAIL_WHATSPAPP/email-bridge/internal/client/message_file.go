@@ -0,0 +1,101 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// RawMessage is a MIME message that can be read more than once without holding it in
+// memory, such as a MessageFile. A *bytes.Reader is one too.
+type RawMessage interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// MessageFile is a MIME message kept in a temporary file, so that a sent message can
+// be appended to the Sent folder without building it in memory. Close removes the
+// file.
+type MessageFile struct {
+	file *os.File
+	size int64
+}
+
+// NewMessageFile writes a MIME message to a temporary file with write
+func NewMessageFile(write func(w io.Writer) error) (*MessageFile, error) {
+	m, err := newMessageFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.write(write); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// newMessageFile creates an empty message file
+func newMessageFile() (*MessageFile, error) {
+	file, err := os.CreateTemp("", "email-bridge-*.eml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message file: %w", err)
+	}
+	return &MessageFile{file: file}, nil
+}
+
+// write replaces the contents of the file with the message written by write
+func (m *MessageFile) write(write func(w io.Writer) error) error {
+	if err := m.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to reset message file: %w", err)
+	}
+	if _, err := m.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to reset message file: %w", err)
+	}
+
+	if err := write(m.file); err != nil {
+		return err
+	}
+
+	size, err := m.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to get the size of the message file: %w", err)
+	}
+	m.size = size
+	return nil
+}
+
+// ReadAt implements io.ReaderAt
+func (m *MessageFile) ReadAt(p []byte, off int64) (int, error) {
+	return m.file.ReadAt(p, off)
+}
+
+// Size returns the size of the message in bytes
+func (m *MessageFile) Size() int64 {
+	return m.size
+}
+
+// Close closes and removes the file
+func (m *MessageFile) Close() error {
+	err := m.file.Close()
+	if removeErr := os.Remove(m.file.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// messageLiteral is an IMAP literal reading a whole raw message
+type messageLiteral struct {
+	*io.SectionReader
+}
+
+// newMessageLiteral returns a literal reading raw from its start
+func newMessageLiteral(raw RawMessage) messageLiteral {
+	return messageLiteral{io.NewSectionReader(raw, 0, raw.Size())}
+}
+
+// Len implements imap.Literal
+func (l messageLiteral) Len() int {
+	return int(l.Size())
+}
@@ -0,0 +1,260 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+// entityCreator creates a MIME entity with a header, either a part of a multipart
+// entity or the message itself, and returns the writer for its body
+type entityCreator func(header message.Header) (*message.Writer, error)
+
+// writeMessage writes an email as a MIME message. Text is quoted-printable and
+// attachments are base64 encoded, streamed from their files. Attachments with a
+// content ID are sent inline with the HTML in a multipart/related entity, so it can
+// refer to them as cid: URLs.
+//
+// The structure of the message is
+//
+//	multipart/mixed          if there are attachments
+//	  multipart/related      if there are inline attachments
+//	    multipart/alternative if there are both text and HTML
+//	      text/plain
+//	      text/html
+//	    inline attachments
+//	  attachments
+func writeMessage(w io.Writer, email models.Email, hostname string) error {
+	header, err := messageHeader(email, hostname)
+	if err != nil {
+		return err
+	}
+
+	// The header of the outermost entity is merged into the message header
+	create := func(entity message.Header) (*message.Writer, error) {
+		for fields := entity.Fields(); fields.Next(); {
+			header.Set(fields.Key(), fields.Value())
+		}
+		return message.CreateWriter(w, header.Header)
+	}
+
+	inline, attachments := splitAttachments(email)
+	if len(attachments) == 0 {
+		return writeBody(create, email, inline)
+	}
+
+	mw, err := create(multipartHeader("multipart/mixed", nil))
+	if err != nil {
+		return err
+	}
+	if err := writeBody(mw.CreatePart, email, inline); err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		if err := writeAttachment(mw.CreatePart, attachment, "attachment"); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// messageHeader returns the header of an email. Display names and the subject are
+// encoded as RFC 2047 encoded words when they aren't ASCII.
+func messageHeader(email models.Email, hostname string) (mail.Header, error) {
+	var header mail.Header
+
+	header.SetAddressList("From", mailAddresses([]models.Address{email.From}))
+	header.SetAddressList("To", mailAddresses(email.To))
+	header.SetAddressList("Cc", mailAddresses(email.Cc))
+	header.SetSubject(email.Subject)
+
+	date := email.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	header.SetDate(date)
+
+	if email.MessageID != "" {
+		header.Set("Message-ID", email.MessageID)
+	} else {
+		if hostname == "" {
+			hostname = "localhost"
+		}
+		if err := header.GenerateMessageIDWithHostname(hostname); err != nil {
+			return header, fmt.Errorf("failed to generate Message-ID: %w", err)
+		}
+	}
+
+	// Add extra headers such as In-Reply-To and References
+	for _, key := range extraHeaderKeys(email.Headers) {
+		header.SetText(key, sanitizeHeaderValue(email.Headers[key]))
+	}
+
+	return header, nil
+}
+
+// mailAddresses converts addresses for a mail header, skipping empty ones
+func mailAddresses(addresses []models.Address) []*mail.Address {
+	var list []*mail.Address
+	for _, address := range addresses {
+		if address.Email == "" {
+			continue
+		}
+		list = append(list, &mail.Address{Name: address.Name, Address: address.Email})
+	}
+	return list
+}
+
+// splitAttachments separates the inline attachments the HTML refers to by content ID
+// from the other attachments
+func splitAttachments(email models.Email) (inline, attachments []models.Attachment) {
+	for _, attachment := range email.Attachments {
+		if attachment.ContentID != "" && email.HtmlContent != "" {
+			inline = append(inline, attachment)
+		} else {
+			attachments = append(attachments, attachment)
+		}
+	}
+	return inline, attachments
+}
+
+// writeBody writes the text of an email with its inline attachments
+func writeBody(create entityCreator, email models.Email, inline []models.Attachment) error {
+	if len(inline) == 0 {
+		return writeText(create, email)
+	}
+
+	// RFC 2387 requires the type of the root part
+	rootType := "text/html"
+	if email.TextContent != "" {
+		rootType = "multipart/alternative"
+	}
+	mw, err := create(multipartHeader("multipart/related", map[string]string{"type": rootType}))
+	if err != nil {
+		return err
+	}
+	if err := writeText(mw.CreatePart, email); err != nil {
+		return err
+	}
+	for _, attachment := range inline {
+		if err := writeAttachment(mw.CreatePart, attachment, "inline"); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// writeText writes the text and HTML content of an email, as alternatives if it has both
+func writeText(create entityCreator, email models.Email) error {
+	switch {
+	case email.TextContent != "" && email.HtmlContent != "":
+		mw, err := create(multipartHeader("multipart/alternative", nil))
+		if err != nil {
+			return err
+		}
+		if err := writeTextPart(mw.CreatePart, "text/plain", email.TextContent); err != nil {
+			return err
+		}
+		if err := writeTextPart(mw.CreatePart, "text/html", email.HtmlContent); err != nil {
+			return err
+		}
+		return mw.Close()
+	case email.HtmlContent != "":
+		return writeTextPart(create, "text/html", email.HtmlContent)
+	default:
+		return writeTextPart(create, "text/plain", email.TextContent)
+	}
+}
+
+// writeTextPart writes UTF-8 text as quoted-printable, which keeps lines within the
+// length limit whatever the content
+func writeTextPart(create entityCreator, mediaType string, content string) error {
+	var header message.Header
+	header.SetContentType(mediaType, map[string]string{"charset": "utf-8"})
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	pw, err := create(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(pw, content); err != nil {
+		return err
+	}
+	return pw.Close()
+}
+
+// writeAttachment streams an attachment file as a base64 part. Non-ASCII filenames
+// are encoded as RFC 2231 parameters.
+func writeAttachment(create entityCreator, attachment models.Attachment, disposition string) error {
+	if attachment.Path == "" {
+		return fmt.Errorf("attachment %s has no local file", attachment.Filename)
+	}
+	file, err := os.Open(attachment.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read attachment file %s: %w", attachment.Path, err)
+	}
+	defer file.Close()
+
+	// The header's own setters would write the filename as RFC 2047 encoded words,
+	// which aren't allowed in parameters
+	var header message.Header
+	header.Set("Content-Type", mime.FormatMediaType(attachmentType(attachment), map[string]string{"name": attachment.Filename}))
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	header.Set("Content-Transfer-Encoding", "base64")
+	if attachment.ContentID != "" {
+		header.Set("Content-ID", "<"+strings.Trim(attachment.ContentID, "<>")+">")
+	}
+
+	pw, err := create(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(pw, file); err != nil {
+		return fmt.Errorf("failed to read attachment file %s: %w", attachment.Path, err)
+	}
+	return pw.Close()
+}
+
+// attachmentType returns the media type of an attachment without parameters, guessing
+// it from the filename if it isn't set
+func attachmentType(attachment models.Attachment) string {
+	if mediaType, _, err := mime.ParseMediaType(attachment.ContentType); err == nil {
+		return mediaType
+	}
+	if mediaType, _, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(attachment.Filename))); err == nil {
+		return mediaType
+	}
+	return "application/octet-stream"
+}
+
+// multipartHeader returns the header of a multipart entity. The writer adds the boundary.
+func multipartHeader(mediaType string, params map[string]string) message.Header {
+	var header message.Header
+	header.SetContentType(mediaType, params)
+	return header
+}
+
+// checkAttachments reports an error if an attachment file can't be read, so that a
+// message isn't abandoned halfway through sending
+func checkAttachments(email models.Email) error {
+	for _, attachment := range email.Attachments {
+		if attachment.Path == "" {
+			return fmt.Errorf("attachment %s has no local file", attachment.Filename)
+		}
+		file, err := os.Open(attachment.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read attachment file %s: %w", attachment.Path, err)
+		}
+		file.Close()
+	}
+	return nil
+}
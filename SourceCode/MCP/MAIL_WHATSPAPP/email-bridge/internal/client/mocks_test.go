@@ -0,0 +1,1228 @@
+package client
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/responses"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// errEmailNotFound is returned by memoryStore for unknown email IDs. Like the SQLite
+// store's error, it is sql.ErrNoRows.
+var errEmailNotFound = fmt.Errorf("email not found: %w", sql.ErrNoRows)
+
+// MockIMAPClient is a mock implementation of the IMAPClient interface for testing.
+// Connection and monitoring state is tracked directly, folder operations use testify expectations.
+type MockIMAPClient struct {
+	mock.Mock
+	connected      bool
+	monitoring     bool
+	monitoringFunc func(models.Email)
+	mutex          sync.Mutex
+}
+
+func (m *MockIMAPClient) Connect() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.connected = true
+	return nil
+}
+
+func (m *MockIMAPClient) Disconnect() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.connected = false
+	m.monitoring = false
+	return nil
+}
+
+func (m *MockIMAPClient) IsConnected() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.connected
+}
+
+func (m *MockIMAPClient) FetchEmails(criteria models.SearchCriteria) ([]models.Email, error) {
+	return []models.Email{}, nil
+}
+
+func (m *MockIMAPClient) GetFolders() ([]string, error) {
+	return []string{"INBOX"}, nil
+}
+
+func (m *MockIMAPClient) GetFoldersDetailed() ([]models.Folder, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Folder), args.Error(1)
+}
+
+func (m *MockIMAPClient) SyncFolders(s store.Store, options models.FolderSyncOptions) error {
+	args := m.Called(s, options)
+	return args.Error(0)
+}
+
+func (m *MockIMAPClient) SyncEmails(s store.Store, options EmailSyncOptions) error {
+	return nil
+}
+
+func (m *MockIMAPClient) SyncEmailsWithProgress(s store.Store, accountID string, progressCallback func(folder string, current, total int)) error {
+	return nil
+}
+
+func (m *MockIMAPClient) SyncEmailsForFolder(s store.Store, accountID string, folder string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) SyncRecentEmails(s store.Store, accountID string, since time.Time) error {
+	return nil
+}
+
+func (m *MockIMAPClient) SyncEmailsWithLimit(s store.Store, accountID string, maxEmails int) error {
+	return nil
+}
+
+func (m *MockIMAPClient) IncrementalSync(s store.Store, options IncrementalSyncOptions) error {
+	return nil
+}
+
+func (m *MockIMAPClient) SyncNewEmails(s store.Store, accountID string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) SyncEmailsIncrementally(s store.Store, accountID string, progressCallback func(folder string, current, total int)) error {
+	return nil
+}
+
+func (m *MockIMAPClient) SyncFolderIncrementally(s store.Store, accountID string, folder string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) CreateFolder(name string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) RenameFolder(oldName string, newName string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) DeleteFolder(name string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) SubscribeFolder(name string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) UnsubscribeFolder(name string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) MonitorMailbox(callback func(models.Email)) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.monitoring = true
+	m.monitoringFunc = callback
+	return nil
+}
+
+func (m *MockIMAPClient) StopMonitoring() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.monitoring = false
+	return nil
+}
+
+func (m *MockIMAPClient) MarkAsRead(folder string, emailID string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) MarkAsUnread(folder string, emailID string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) AddFlag(folder string, emailID string, flag string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) MoveEmail(folder string, emailID string, destination string) (string, error) {
+	return "", nil
+}
+
+func (m *MockIMAPClient) DeleteEmail(folder string, emailID string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) ExpungeEmail(folder string, emailID string) error {
+	return nil
+}
+
+func (m *MockIMAPClient) AppendEmail(folder string, raw RawMessage, flags []string) (string, error) {
+	return "", nil
+}
+
+func (m *MockIMAPClient) GetAttachment(folder string, attachment models.Attachment) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+// MockIMAPConn is a mock implementation of the go-imap connection used by IMAPClientImpl
+type MockIMAPConn struct {
+	mock.Mock
+}
+
+func (m *MockIMAPConn) Select(name string, readOnly bool) (*imap.MailboxStatus, error) {
+	args := m.Called(name, readOnly)
+	status, _ := args.Get(0).(*imap.MailboxStatus)
+	return status, args.Error(1)
+}
+
+func (m *MockIMAPConn) List(ref, pattern string, ch chan *imap.MailboxInfo) error {
+	args := m.Called(ref, pattern, ch)
+
+	// Send mock data to the channel
+	folders := args.Get(0).([]imap.MailboxInfo)
+	for i := range folders {
+		ch <- &folders[i]
+	}
+	close(ch)
+
+	return args.Error(1)
+}
+
+func (m *MockIMAPConn) Lsub(ref, pattern string, ch chan *imap.MailboxInfo) error {
+	args := m.Called(ref, pattern, ch)
+
+	// Send mock data to the channel
+	folders := args.Get(0).([]imap.MailboxInfo)
+	for i := range folders {
+		ch <- &folders[i]
+	}
+	close(ch)
+
+	return args.Error(1)
+}
+
+func (m *MockIMAPConn) Create(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+func (m *MockIMAPConn) Delete(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+func (m *MockIMAPConn) Rename(oldName, newName string) error {
+	args := m.Called(oldName, newName)
+	return args.Error(0)
+}
+
+func (m *MockIMAPConn) Subscribe(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+func (m *MockIMAPConn) Unsubscribe(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+func (m *MockIMAPConn) UidSearch(criteria *imap.SearchCriteria) ([]uint32, error) {
+	args := m.Called(criteria)
+	uids, _ := args.Get(0).([]uint32)
+	return uids, args.Error(1)
+}
+
+func (m *MockIMAPConn) UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	args := m.Called(seqset, items, ch)
+
+	// Send mock data to the channel
+	if messages, ok := args.Get(0).([]*imap.Message); ok {
+		for _, msg := range messages {
+			ch <- msg
+		}
+	}
+	close(ch)
+
+	return args.Error(1)
+}
+
+func (m *MockIMAPConn) UidStore(seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error {
+	args := m.Called(seqset, item, value, ch)
+	if ch != nil {
+		close(ch)
+	}
+	return args.Error(0)
+}
+
+func (m *MockIMAPConn) UidMove(seqset *imap.SeqSet, dest string) error {
+	args := m.Called(seqset, dest)
+	return args.Error(0)
+}
+
+func (m *MockIMAPConn) Append(mbox string, flags []string, date time.Time, msg imap.Literal) error {
+	args := m.Called(mbox, flags, date, msg)
+	return args.Error(0)
+}
+
+func (m *MockIMAPConn) Expunge(ch chan uint32) error {
+	args := m.Called(ch)
+	if ch != nil {
+		close(ch)
+	}
+	return args.Error(0)
+}
+
+func (m *MockIMAPConn) Idle(stop <-chan struct{}, opts *client.IdleOptions) error {
+	args := m.Called(stop, opts)
+	return args.Error(0)
+}
+
+func (m *MockIMAPConn) Support(cap string) (bool, error) {
+	args := m.Called(cap)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockIMAPConn) Status(name string, items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	args := m.Called(name, items)
+	status, _ := args.Get(0).(*imap.MailboxStatus)
+	return status, args.Error(1)
+}
+
+func (m *MockIMAPConn) Enable(caps []string) ([]string, error) {
+	args := m.Called(caps)
+	enabled, _ := args.Get(0).([]string)
+	return enabled, args.Error(1)
+}
+
+func (m *MockIMAPConn) Execute(cmdr imap.Commander, h responses.Handler) (*imap.StatusResp, error) {
+	args := m.Called(cmdr, h)
+	status, _ := args.Get(0).(*imap.StatusResp)
+	return status, args.Error(1)
+}
+
+func (m *MockIMAPConn) Logout() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// MockStore is a mock implementation of the store.Store interface
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) Initialize() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockStore) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockStore) StoreEmail(email models.Email) error {
+	args := m.Called(email)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetEmail(id string) (models.Email, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Email), args.Error(1)
+}
+
+func (m *MockStore) SearchEmails(criteria models.SearchCriteria) ([]models.Email, error) {
+	args := m.Called(criteria)
+	return args.Get(0).([]models.Email), args.Error(1)
+}
+
+func (m *MockStore) CountEmails(criteria models.SearchCriteria) (int, error) {
+	args := m.Called(criteria)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStore) UpdateEmailStatus(id string, status models.EmailStatus) error {
+	args := m.Called(id, status)
+	return args.Error(0)
+}
+
+func (m *MockStore) MoveEmail(id string, folder string) error {
+	args := m.Called(id, folder)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteEmail(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockStore) RemapEmails(deleted []string, emails []models.Email) error {
+	args := m.Called(deleted, emails)
+	return args.Error(0)
+}
+
+func (m *MockStore) StoreAttachment(attachment models.Attachment) error {
+	args := m.Called(attachment)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetAttachment(id string) (models.Attachment, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Attachment), args.Error(1)
+}
+
+func (m *MockStore) GetFolders(accountID string) ([]string, error) {
+	args := m.Called(accountID)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStore) CreateFolder(accountID string, name string) error {
+	args := m.Called(accountID, name)
+	return args.Error(0)
+}
+
+func (m *MockStore) RenameFolder(accountID string, oldName string, newName string) error {
+	args := m.Called(accountID, oldName, newName)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteFolder(accountID string, name string) error {
+	args := m.Called(accountID, name)
+	return args.Error(0)
+}
+
+func (m *MockStore) StoreAccount(account models.Account) error {
+	args := m.Called(account)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetAccount(id string) (models.Account, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Account), args.Error(1)
+}
+
+func (m *MockStore) GetAccounts() ([]models.Account, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Account), args.Error(1)
+}
+
+func (m *MockStore) DeleteAccount(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetOAuthToken(accountID string) (models.OAuthToken, error) {
+	args := m.Called(accountID)
+	return args.Get(0).(models.OAuthToken), args.Error(1)
+}
+
+func (m *MockStore) StoreOAuthToken(token models.OAuthToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockStore) QueueOutboxMessage(message models.OutboxMessage) error {
+	args := m.Called(message)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetOutboxMessage(id string) (models.OutboxMessage, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.OutboxMessage), args.Error(1)
+}
+
+func (m *MockStore) EditPendingOutboxMessage(id string, email models.Email, entry models.OutboxAuditEntry) error {
+	args := m.Called(id, email, entry)
+	return args.Error(0)
+}
+
+func (m *MockStore) ReviewOutboxMessage(id string, status string, nextAttempt time.Time, entry models.OutboxAuditEntry) error {
+	args := m.Called(id, status, nextAttempt, entry)
+	return args.Error(0)
+}
+
+func (m *MockStore) AddOutboxAuditEntry(entry models.OutboxAuditEntry) error {
+	args := m.Called(entry)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetOutboxAuditEntries(outboxID string) ([]models.OutboxAuditEntry, error) {
+	args := m.Called(outboxID)
+	return args.Get(0).([]models.OutboxAuditEntry), args.Error(1)
+}
+
+func (m *MockStore) AttachmentHashReferenced(hash string) (bool, error) {
+	args := m.Called(hash)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) StoreReconJob(job models.ReconJob) error {
+	args := m.Called(job)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetReconJob(id string) (models.ReconJob, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.ReconJob), args.Error(1)
+}
+
+func (m *MockStore) GetReconJobs(status string) ([]models.ReconJob, error) {
+	args := m.Called(status)
+	return args.Get(0).([]models.ReconJob), args.Error(1)
+}
+
+func (m *MockStore) GetReconJobByAttachment(attachmentID string) (models.ReconJob, error) {
+	args := m.Called(attachmentID)
+	return args.Get(0).(models.ReconJob), args.Error(1)
+}
+
+func (m *MockStore) StoreMailRule(rule models.MailRule) error {
+	args := m.Called(rule)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetMailRule(id string) (models.MailRule, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.MailRule), args.Error(1)
+}
+
+func (m *MockStore) GetMailRules() ([]models.MailRule, error) {
+	args := m.Called()
+	return args.Get(0).([]models.MailRule), args.Error(1)
+}
+
+func (m *MockStore) DeleteMailRule(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockStore) AppendEvent(event models.Event) (int64, error) {
+	args := m.Called(event)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStore) GetEventsAfter(afterID int64, accountID, folder string, limit int) ([]models.Event, error) {
+	args := m.Called(afterID, accountID, folder, limit)
+	return args.Get(0).([]models.Event), args.Error(1)
+}
+
+func (m *MockStore) DeleteEventsBefore(before time.Time) (int64, error) {
+	args := m.Called(before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStore) StoreWebhook(webhook models.Webhook) error {
+	args := m.Called(webhook)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetWebhook(id string) (models.Webhook, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Webhook), args.Error(1)
+}
+
+func (m *MockStore) GetWebhooks() ([]models.Webhook, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Webhook), args.Error(1)
+}
+
+func (m *MockStore) DeleteWebhook(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockStore) StoreWebhookDelivery(delivery models.WebhookDelivery) error {
+	args := m.Called(delivery)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetWebhookDelivery(id string) (models.WebhookDelivery, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockStore) GetWebhookDeliveries(webhookID, status string, limit int) ([]models.WebhookDelivery, error) {
+	args := m.Called(webhookID, status, limit)
+	return args.Get(0).([]models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockStore) ClaimWebhookDelivery(now time.Time, lease time.Duration) (models.WebhookDelivery, error) {
+	args := m.Called(now, lease)
+	return args.Get(0).(models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockStore) DeleteWebhookDeliveriesBefore(before time.Time) (int64, error) {
+	args := m.Called(before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStore) StoreDraft(draft models.Draft) error {
+	args := m.Called(draft)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetDraft(id string) (models.Draft, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Draft), args.Error(1)
+}
+
+func (m *MockStore) GetDrafts(accountID string) ([]models.Draft, error) {
+	args := m.Called(accountID)
+	return args.Get(0).([]models.Draft), args.Error(1)
+}
+
+func (m *MockStore) DeleteDraft(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockStore) ClaimOutboxMessage(now time.Time, lease time.Duration) (models.OutboxMessage, error) {
+	args := m.Called(now, lease)
+	return args.Get(0).(models.OutboxMessage), args.Error(1)
+}
+
+func (m *MockStore) PendingOutboxMessages(accountID string) ([]models.OutboxMessage, error) {
+	args := m.Called(accountID)
+	return args.Get(0).([]models.OutboxMessage), args.Error(1)
+}
+
+func (m *MockStore) CancelOutboxMessage(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockStore) UpdateOutboxMessage(message models.OutboxMessage) error {
+	args := m.Called(message)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetSyncStatus(accountID, folderID string) (store.SyncStatus, error) {
+	args := m.Called(accountID, folderID)
+	return args.Get(0).(store.SyncStatus), args.Error(1)
+}
+
+func (m *MockStore) UpdateSyncStatus(status store.SyncStatus) error {
+	args := m.Called(status)
+	return args.Error(0)
+}
+
+func (m *MockStore) GetAllSyncStatus(accountID string) ([]store.SyncStatus, error) {
+	args := m.Called(accountID)
+	return args.Get(0).([]store.SyncStatus), args.Error(1)
+}
+
+func (m *MockStore) DeleteSyncStatus(accountID, folderID string) error {
+	args := m.Called(accountID, folderID)
+	return args.Error(0)
+}
+
+// memoryStore is an in-memory implementation of the store.Store interface for testing
+type memoryStore struct {
+	emails     map[string]models.Email
+	folders    map[string][]string
+	syncStatus map[string]store.SyncStatus // Keyed by folder ID
+	tokens     map[string]models.OAuthToken
+	outbox     map[string]models.OutboxMessage
+	mutex      sync.RWMutex
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		emails:     make(map[string]models.Email),
+		syncStatus: make(map[string]store.SyncStatus),
+		tokens:     make(map[string]models.OAuthToken),
+		outbox:     make(map[string]models.OutboxMessage),
+	}
+}
+
+func (s *memoryStore) Initialize() error {
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+func (s *memoryStore) StoreEmail(email models.Email) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.emails[email.ID] = email
+	return nil
+}
+
+func (s *memoryStore) GetEmail(id string) (models.Email, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	email, ok := s.emails[id]
+	if !ok {
+		return models.Email{}, errEmailNotFound
+	}
+	return email, nil
+}
+
+func (s *memoryStore) SearchEmails(criteria models.SearchCriteria) ([]models.Email, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var emails []models.Email
+	for _, email := range s.emails {
+		if criteria.AccountID != "" && email.AccountID != criteria.AccountID {
+			continue
+		}
+		if criteria.Folder != "" && email.Folder != criteria.Folder {
+			continue
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+func (s *memoryStore) CountEmails(criteria models.SearchCriteria) (int, error) {
+	emails, err := s.SearchEmails(criteria)
+	return len(emails), err
+}
+
+func (s *memoryStore) UpdateEmailStatus(id string, status models.EmailStatus) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	email, ok := s.emails[id]
+	if !ok {
+		return errEmailNotFound
+	}
+	email.IsRead = status.IsRead
+	s.emails[id] = email
+	return nil
+}
+
+func (s *memoryStore) MoveEmail(id string, folder string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	email, ok := s.emails[id]
+	if !ok {
+		return errEmailNotFound
+	}
+	email.Folder = folder
+	s.emails[id] = email
+	return nil
+}
+
+func (s *memoryStore) DeleteEmail(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.emails[id]; !ok {
+		return errEmailNotFound
+	}
+	delete(s.emails, id)
+	return nil
+}
+
+func (s *memoryStore) RemapEmails(deleted []string, emails []models.Email) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	isDeleted := make(map[string]bool, len(deleted))
+	for _, id := range deleted {
+		if _, ok := s.emails[id]; !ok {
+			return errEmailNotFound
+		}
+		isDeleted[id] = true
+	}
+	for _, email := range emails {
+		if existing, ok := s.emails[email.ID]; ok && !isDeleted[email.ID] {
+			return fmt.Errorf("email ID %s is already used by an email in folder %s", email.ID, existing.Folder)
+		}
+	}
+	for _, id := range deleted {
+		delete(s.emails, id)
+	}
+	for _, email := range emails {
+		s.emails[email.ID] = email
+	}
+	return nil
+}
+
+func (s *memoryStore) StoreAttachment(attachment models.Attachment) error {
+	return nil
+}
+
+func (s *memoryStore) GetAttachment(id string) (models.Attachment, error) {
+	return models.Attachment{}, nil
+}
+
+func (s *memoryStore) GetFolders(accountID string) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.folders[accountID], nil
+}
+
+func (s *memoryStore) CreateFolder(accountID string, name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.folders == nil {
+		s.folders = make(map[string][]string)
+	}
+	for _, folder := range s.folders[accountID] {
+		if folder == name {
+			return nil
+		}
+	}
+	s.folders[accountID] = append(s.folders[accountID], name)
+	return nil
+}
+
+func (s *memoryStore) RenameFolder(accountID string, oldName string, newName string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, folder := range s.folders[accountID] {
+		if folder == oldName {
+			s.folders[accountID][i] = newName
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteFolder(accountID string, name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	folders := s.folders[accountID][:0]
+	for _, folder := range s.folders[accountID] {
+		if folder != name {
+			folders = append(folders, folder)
+		}
+	}
+	s.folders[accountID] = folders
+	return nil
+}
+
+func (s *memoryStore) StoreAccount(account models.Account) error {
+	return nil
+}
+
+func (s *memoryStore) GetAccount(id string) (models.Account, error) {
+	return models.Account{}, fmt.Errorf("account %s not found", id)
+}
+
+func (s *memoryStore) GetAccounts() ([]models.Account, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) DeleteAccount(id string) error {
+	return nil
+}
+
+func (s *memoryStore) GetSyncStatus(accountID, folderID string) (store.SyncStatus, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	status, ok := s.syncStatus[folderID]
+	if !ok {
+		return store.SyncStatus{AccountID: accountID, FolderID: folderID}, nil
+	}
+	return status, nil
+}
+
+func (s *memoryStore) UpdateSyncStatus(status store.SyncStatus) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.syncStatus[status.FolderID] = status
+	return nil
+}
+
+func (s *memoryStore) GetAllSyncStatus(accountID string) ([]store.SyncStatus, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var statuses []store.SyncStatus
+	for _, status := range s.syncStatus {
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (s *memoryStore) DeleteSyncStatus(accountID, folderID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.syncStatus, folderID)
+	return nil
+}
+
+func (s *memoryStore) GetOAuthToken(accountID string) (models.OAuthToken, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	token, ok := s.tokens[accountID]
+	if !ok {
+		return token, sql.ErrNoRows
+	}
+	return token, nil
+}
+
+func (s *memoryStore) StoreOAuthToken(token models.OAuthToken) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens[token.AccountID] = token
+	return nil
+}
+
+func (s *memoryStore) QueueOutboxMessage(message models.OutboxMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.outbox[message.ID] = message
+	return nil
+}
+
+func (s *memoryStore) GetOutboxMessage(id string) (models.OutboxMessage, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	message, ok := s.outbox[id]
+	if !ok {
+		return message, sql.ErrNoRows
+	}
+	return message, nil
+}
+
+func (s *memoryStore) EditPendingOutboxMessage(id string, email models.Email, entry models.OutboxAuditEntry) error {
+	return sql.ErrNoRows
+}
+
+func (s *memoryStore) ReviewOutboxMessage(id string, status string, nextAttempt time.Time, entry models.OutboxAuditEntry) error {
+	return sql.ErrNoRows
+}
+
+func (s *memoryStore) AddOutboxAuditEntry(entry models.OutboxAuditEntry) error {
+	return nil
+}
+
+func (s *memoryStore) GetOutboxAuditEntries(outboxID string) ([]models.OutboxAuditEntry, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) AttachmentHashReferenced(hash string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, email := range s.emails {
+		for _, attachment := range email.Attachments {
+			if attachment.Hash == hash {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryStore) StoreReconJob(job models.ReconJob) error {
+	return nil
+}
+
+func (s *memoryStore) GetReconJob(id string) (models.ReconJob, error) {
+	return models.ReconJob{}, sql.ErrNoRows
+}
+
+func (s *memoryStore) GetReconJobs(status string) ([]models.ReconJob, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) GetReconJobByAttachment(attachmentID string) (models.ReconJob, error) {
+	return models.ReconJob{}, sql.ErrNoRows
+}
+
+func (s *memoryStore) StoreMailRule(rule models.MailRule) error {
+	return nil
+}
+
+func (s *memoryStore) GetMailRule(id string) (models.MailRule, error) {
+	return models.MailRule{}, sql.ErrNoRows
+}
+
+func (s *memoryStore) GetMailRules() ([]models.MailRule, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) DeleteMailRule(id string) error {
+	return sql.ErrNoRows
+}
+
+func (s *memoryStore) AppendEvent(event models.Event) (int64, error) {
+	return 0, nil
+}
+
+func (s *memoryStore) GetEventsAfter(afterID int64, accountID, folder string, limit int) ([]models.Event, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) DeleteEventsBefore(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *memoryStore) StoreWebhook(webhook models.Webhook) error {
+	return nil
+}
+
+func (s *memoryStore) GetWebhook(id string) (models.Webhook, error) {
+	return models.Webhook{}, sql.ErrNoRows
+}
+
+func (s *memoryStore) GetWebhooks() ([]models.Webhook, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) DeleteWebhook(id string) error {
+	return sql.ErrNoRows
+}
+
+func (s *memoryStore) StoreWebhookDelivery(delivery models.WebhookDelivery) error {
+	return nil
+}
+
+func (s *memoryStore) GetWebhookDelivery(id string) (models.WebhookDelivery, error) {
+	return models.WebhookDelivery{}, sql.ErrNoRows
+}
+
+func (s *memoryStore) GetWebhookDeliveries(webhookID, status string, limit int) ([]models.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) ClaimWebhookDelivery(now time.Time, lease time.Duration) (models.WebhookDelivery, error) {
+	return models.WebhookDelivery{}, sql.ErrNoRows
+}
+
+func (s *memoryStore) DeleteWebhookDeliveriesBefore(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *memoryStore) StoreDraft(draft models.Draft) error {
+	return nil
+}
+
+func (s *memoryStore) GetDraft(id string) (models.Draft, error) {
+	return models.Draft{}, sql.ErrNoRows
+}
+
+func (s *memoryStore) GetDrafts(accountID string) ([]models.Draft, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) DeleteDraft(id string) error {
+	return sql.ErrNoRows
+}
+
+func (s *memoryStore) ClaimOutboxMessage(now time.Time, lease time.Duration) (models.OutboxMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, message := range s.outbox {
+		pending := message.Status == models.OutboxQueued || message.Status == models.OutboxSending
+		if pending && !message.NextAttempt.After(now) {
+			message.Status = models.OutboxSending
+			message.NextAttempt = now.Add(lease)
+			s.outbox[id] = message
+			return message, nil
+		}
+	}
+	return models.OutboxMessage{}, sql.ErrNoRows
+}
+
+func (s *memoryStore) PendingOutboxMessages(accountID string) ([]models.OutboxMessage, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var messages []models.OutboxMessage
+	for _, message := range s.outbox {
+		if message.Status == models.OutboxQueued || message.Status == models.OutboxSending {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func (s *memoryStore) CancelOutboxMessage(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	message, ok := s.outbox[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if message.Status != models.OutboxQueued && message.Status != models.OutboxPendingApproval {
+		return store.ErrOutboxNotQueued
+	}
+	message.Status = models.OutboxCancelled
+	s.outbox[id] = message
+	return nil
+}
+
+func (s *memoryStore) UpdateOutboxMessage(message models.OutboxMessage) error {
+	return s.QueueOutboxMessage(message)
+}
+
+// fakeMessage is a message held by fakeIMAPConn
+type fakeMessage struct {
+	uid     uint32
+	subject string
+	date    time.Time
+	isRead  bool
+	// messageID defaults to one made from the UID
+	messageID string
+}
+
+// fakeIMAPConn is an in-memory IMAP connection serving fixed folders and messages
+type fakeIMAPConn struct {
+	folders     []string
+	emails      map[string][]fakeMessage
+	uidValidity string
+	selected    string
+}
+
+func (f *fakeIMAPConn) Select(name string, readOnly bool) (*imap.MailboxStatus, error) {
+	uidValidity, err := strconv.ParseUint(f.uidValidity, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	f.selected = name
+	status := imap.NewMailboxStatus(name, nil)
+	status.Messages = uint32(len(f.emails[name]))
+	status.UidValidity = uint32(uidValidity)
+	return status, nil
+}
+
+func (f *fakeIMAPConn) List(ref, name string, ch chan *imap.MailboxInfo) error {
+	for _, folder := range f.folders {
+		ch <- &imap.MailboxInfo{Name: folder}
+	}
+	close(ch)
+	return nil
+}
+
+func (f *fakeIMAPConn) Lsub(ref, name string, ch chan *imap.MailboxInfo) error {
+	return f.List(ref, name, ch)
+}
+
+func (f *fakeIMAPConn) Create(name string) error {
+	return nil
+}
+
+func (f *fakeIMAPConn) Delete(name string) error {
+	return nil
+}
+
+func (f *fakeIMAPConn) Rename(existingName, newName string) error {
+	return nil
+}
+
+func (f *fakeIMAPConn) Subscribe(name string) error {
+	return nil
+}
+
+func (f *fakeIMAPConn) Unsubscribe(name string) error {
+	return nil
+}
+
+func (f *fakeIMAPConn) UidSearch(criteria *imap.SearchCriteria) ([]uint32, error) {
+	var uids []uint32
+	for _, msg := range f.emails[f.selected] {
+		if criteria.Uid != nil && !criteria.Uid.Contains(msg.uid) {
+			continue
+		}
+		uids = append(uids, msg.uid)
+	}
+	return uids, nil
+}
+
+func (f *fakeIMAPConn) UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	defer close(ch)
+
+	for _, m := range f.emails[f.selected] {
+		if !seqset.Contains(m.uid) {
+			continue
+		}
+
+		msg := imap.NewMessage(m.uid, items)
+		msg.Uid = m.uid
+		if m.isRead {
+			msg.Flags = []string{imap.SeenFlag}
+		}
+		messageID := m.messageID
+		if messageID == "" {
+			messageID = fmt.Sprintf("<%d@example.com>", m.uid)
+		}
+		msg.Envelope = &imap.Envelope{
+			Date:      m.date,
+			Subject:   m.subject,
+			MessageId: messageID,
+		}
+		msg.BodyStructure = &imap.BodyStructure{MIMEType: "text", MIMESubType: "plain"}
+
+		raw := fmt.Sprintf("Subject: %s\r\nDate: %s\r\nContent-Type: text/plain\r\n\r\nBody of %s\r\n",
+			m.subject, m.date.Format(time.RFC1123Z), m.subject)
+		msg.Body = map[*imap.BodySectionName]imap.Literal{
+			{}: bytes.NewBufferString(raw),
+		}
+
+		ch <- msg
+	}
+
+	return nil
+}
+
+func (f *fakeIMAPConn) UidStore(seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error {
+	if ch != nil {
+		close(ch)
+	}
+	return nil
+}
+
+func (f *fakeIMAPConn) UidMove(seqset *imap.SeqSet, dest string) error {
+	return nil
+}
+
+func (f *fakeIMAPConn) Append(mbox string, flags []string, date time.Time, msg imap.Literal) error {
+	return nil
+}
+
+func (f *fakeIMAPConn) Expunge(ch chan uint32) error {
+	if ch != nil {
+		close(ch)
+	}
+	return nil
+}
+
+func (f *fakeIMAPConn) Idle(stop <-chan struct{}, opts *client.IdleOptions) error {
+	<-stop
+	return nil
+}
+
+func (f *fakeIMAPConn) Support(cap string) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeIMAPConn) Status(name string, items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	status := imap.NewMailboxStatus(name, items)
+	status.UidNext = 1
+	for _, m := range f.emails[name] {
+		if m.uid >= status.UidNext {
+			status.UidNext = m.uid + 1
+		}
+	}
+	if uidValidity, err := strconv.ParseUint(f.uidValidity, 10, 32); err == nil {
+		status.UidValidity = uint32(uidValidity)
+	}
+	return status, nil
+}
+
+func (f *fakeIMAPConn) Enable(caps []string) ([]string, error) {
+	return nil, client.ErrExtensionUnsupported
+}
+
+func (f *fakeIMAPConn) Execute(cmdr imap.Commander, h responses.Handler) (*imap.StatusResp, error) {
+	return nil, client.ErrExtensionUnsupported
+}
+
+func (f *fakeIMAPConn) Logout() error {
+	return nil
+}
@@ -0,0 +1,364 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+	"golang.org/x/oauth2"
+)
+
+// SASL mechanisms used to log in with an OAuth2 access token
+const (
+	mechanismXOAuth2     = "XOAUTH2"
+	mechanismOAuthBearer = "OAUTHBEARER"
+)
+
+// Token endpoints used when an account's OAuth configuration has no token URL
+const (
+	googleTokenURL    = "https://oauth2.googleapis.com/token"
+	microsoftTokenURL = "https://login.microsoftonline.com/common/oauth2/v2.0/token"
+)
+
+// TokenManager provides OAuth2 access tokens for accounts. Expired tokens are refreshed
+// from the refresh token and the refreshed tokens are persisted, encrypted, in the store.
+type TokenManager struct {
+	store   store.Store
+	sources map[string]*accountTokenSource
+	mutex   sync.Mutex
+}
+
+// accountTokenSource holds the current token of one account
+type accountTokenSource struct {
+	accountID string
+	config    *oauth2.Config
+	token     *oauth2.Token
+	mutex     sync.Mutex
+}
+
+var (
+	// Global token manager instance
+	globalTokenManager *TokenManager
+	tokenManagerMutex  sync.Mutex
+)
+
+// GetTokenManager returns the global token manager instance
+func GetTokenManager(store store.Store) *TokenManager {
+	tokenManagerMutex.Lock()
+	defer tokenManagerMutex.Unlock()
+
+	if globalTokenManager == nil {
+		globalTokenManager = &TokenManager{
+			store:   store,
+			sources: make(map[string]*accountTokenSource),
+			mutex:   sync.Mutex{},
+		}
+	}
+
+	// Update the store if provided
+	if store != nil {
+		globalTokenManager.store = store
+	}
+
+	return globalTokenManager
+}
+
+// AccessToken returns a valid access token for an account with decrypted credentials,
+// refreshing it first if it has expired
+func (tm *TokenManager) AccessToken(account config.AccountConfig) (string, error) {
+	if account.OAuthConfig == nil {
+		return "", fmt.Errorf("account %s has no OAuth configuration", account.ID)
+	}
+
+	tm.mutex.Lock()
+	source, ok := tm.sources[account.ID]
+	if !ok {
+		var err error
+		source, err = tm.newTokenSource(account)
+		if err != nil {
+			tm.mutex.Unlock()
+			return "", err
+		}
+		tm.sources[account.ID] = source
+	}
+	s := tm.store
+	tm.mutex.Unlock()
+
+	return source.accessToken(s)
+}
+
+// Expire discards the current access token of an account so the next call to
+// AccessToken refreshes it. It is used when a server rejects a token before its expiry.
+func (tm *TokenManager) Expire(accountID string) {
+	tm.mutex.Lock()
+	source, ok := tm.sources[accountID]
+	tm.mutex.Unlock()
+
+	if ok {
+		source.mutex.Lock()
+		source.token.AccessToken = ""
+		source.mutex.Unlock()
+	}
+}
+
+// RemoveAccount forgets the token of an account, so the next call to AccessToken
+// starts again from the account configuration and the stored token
+func (tm *TokenManager) RemoveAccount(accountID string) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	delete(tm.sources, accountID)
+}
+
+// newTokenSource creates the token source of an account from its configuration.
+// A token refreshed in an earlier run is used instead when it expires later.
+func (tm *TokenManager) newTokenSource(account config.AccountConfig) (*accountTokenSource, error) {
+	oauthConfig := account.OAuthConfig
+
+	token := &oauth2.Token{
+		AccessToken:  oauthConfig.AccessToken,
+		RefreshToken: oauthConfig.RefreshToken,
+	}
+	if oauthConfig.Expiry != "" {
+		expiry, err := time.Parse(time.RFC3339, oauthConfig.Expiry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OAuth token expiry %q: %w", oauthConfig.Expiry, err)
+		}
+		token.Expiry = expiry
+	}
+
+	if tm.store != nil {
+		stored, err := tm.store.GetOAuthToken(account.ID)
+		if err == nil {
+			if stored.Expiry.After(token.Expiry) {
+				token = &oauth2.Token{
+					AccessToken:  stored.AccessToken,
+					RefreshToken: stored.RefreshToken,
+					Expiry:       stored.Expiry,
+				}
+			}
+		} else if err != sql.ErrNoRows {
+			fmt.Printf("Warning: Failed to load OAuth token for account %s: %v\n", account.ID, err)
+		}
+	}
+
+	tokenURL := oauthConfig.TokenURL
+	if tokenURL == "" {
+		tokenURL = defaultTokenURL(account.IMAPConfig.Server)
+	}
+
+	return &accountTokenSource{
+		accountID: account.ID,
+		config: &oauth2.Config{
+			ClientID:     oauthConfig.ClientID,
+			ClientSecret: oauthConfig.ClientSecret,
+			Endpoint:     oauth2.Endpoint{TokenURL: tokenURL},
+		},
+		token: token,
+		mutex: sync.Mutex{},
+	}, nil
+}
+
+// accessToken returns the current access token, refreshing and persisting it if it has expired
+func (s *accountTokenSource) accessToken(tokenStore store.Store) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token.Valid() {
+		return s.token.AccessToken, nil
+	}
+
+	if s.token.RefreshToken == "" {
+		return "", fmt.Errorf("OAuth access token for account %s has expired and no refresh token is configured", s.accountID)
+	}
+	if s.config.Endpoint.TokenURL == "" {
+		return "", fmt.Errorf("no OAuth token URL is configured for account %s", s.accountID)
+	}
+
+	// The token source keeps the old refresh token if the provider doesn't rotate it
+	token, err := s.config.TokenSource(context.Background(), s.token).Token()
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh OAuth access token: %w", err)
+	}
+	s.token = token
+
+	if tokenStore != nil {
+		err := tokenStore.StoreOAuthToken(models.OAuthToken{
+			AccountID:    s.accountID,
+			AccessToken:  token.AccessToken,
+			RefreshToken: token.RefreshToken,
+			Expiry:       token.Expiry,
+		})
+		if err != nil {
+			// The token is still usable until the next restart
+			fmt.Printf("Warning: Failed to store refreshed OAuth token for account %s: %v\n", s.accountID, err)
+		}
+	}
+
+	return token.AccessToken, nil
+}
+
+// defaultTokenURL returns the token endpoint of the provider hosting an IMAP server, or ""
+func defaultTokenURL(server string) string {
+	server = strings.ToLower(server)
+
+	switch {
+	case strings.HasSuffix(server, "gmail.com") || strings.HasSuffix(server, "googlemail.com"):
+		return googleTokenURL
+	case strings.HasSuffix(server, "office365.com") || strings.HasSuffix(server, "outlook.com"):
+		return microsoftTokenURL
+	default:
+		return ""
+	}
+}
+
+// oauthSASL is a SASL client for the XOAUTH2 and OAUTHBEARER (RFC 7628) mechanisms
+type oauthSASL struct {
+	mechanism string
+	username  string
+	token     string
+	host      string
+	port      int
+}
+
+// Start implements sasl.Client
+func (a *oauthSASL) Start() (string, []byte, error) {
+	return a.mechanism, a.initialResponse(), nil
+}
+
+// Next implements sasl.Client. A challenge is only sent after a failed login and
+// carries the error details; answering it lets the server finish the exchange.
+func (a *oauthSASL) Next(challenge []byte) ([]byte, error) {
+	if a.mechanism == mechanismOAuthBearer {
+		return []byte{0x01}, nil
+	}
+	return []byte{}, nil
+}
+
+// initialResponse returns the client response carrying the access token
+func (a *oauthSASL) initialResponse() []byte {
+	if a.mechanism == mechanismOAuthBearer {
+		// The authorization identity is a GS2 saslname, where ',' and '=' are escaped
+		authzid := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(a.username)
+		return []byte(fmt.Sprintf("n,a=%s,\x01host=%s\x01port=%d\x01auth=Bearer %s\x01\x01", authzid, a.host, a.port, a.token))
+	}
+	return []byte("user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01")
+}
+
+// smtpOAuthAuth implements smtp.Auth with oauthSASL, choosing the mechanism from
+// the ones the server advertises
+type smtpOAuthAuth struct {
+	sasl *oauthSASL
+}
+
+// Start implements smtp.Auth
+func (a *smtpOAuthAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Like smtp.PlainAuth, refuse to send the token over an unencrypted connection
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, fmt.Errorf("unencrypted connection")
+	}
+
+	a.sasl.mechanism = mechanismXOAuth2
+	for _, mechanism := range server.Auth {
+		if strings.EqualFold(mechanism, mechanismOAuthBearer) {
+			a.sasl.mechanism = mechanismOAuthBearer
+			break
+		}
+	}
+
+	return a.sasl.Start()
+}
+
+// Next implements smtp.Auth
+func (a *smtpOAuthAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	return a.sasl.Next(fromServer)
+}
+
+// isLocalhost reports whether a server name refers to the local machine
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+// imapAuthenticator is the part of the go-imap client used for SASL authentication
+type imapAuthenticator interface {
+	SupportAuth(mech string) (bool, error)
+	Authenticate(auth sasl.Client) error
+}
+
+// smtpAuthenticator is the part of the net/smtp client used for authentication
+type smtpAuthenticator interface {
+	Auth(a smtp.Auth) error
+}
+
+// authenticateIMAPOAuth logs in to an IMAP server with the account's access token,
+// preferring OAUTHBEARER when the server supports it
+func authenticateIMAPOAuth(conn imapAuthenticator, account config.AccountConfig) error {
+	tm := GetTokenManager(nil)
+
+	token, err := tm.AccessToken(account)
+	if err != nil {
+		return fmt.Errorf("failed to get OAuth access token: %w", err)
+	}
+
+	mechanism := mechanismXOAuth2
+	if ok, _ := conn.SupportAuth(mechanismOAuthBearer); ok {
+		mechanism = mechanismOAuthBearer
+	}
+
+	auth := &oauthSASL{
+		mechanism: mechanism,
+		username:  loginName(account.IMAPConfig.Username, account.Email),
+		token:     token,
+		host:      account.IMAPConfig.Server,
+		port:      account.IMAPConfig.Port,
+	}
+	if err := conn.Authenticate(auth); err != nil {
+		// The token may have been revoked before it expired, so refresh it on the next attempt
+		tm.Expire(account.ID)
+		return fmt.Errorf("failed to authenticate with IMAP server: %w", err)
+	}
+
+	return nil
+}
+
+// authenticateSMTPOAuth logs in to an SMTP server with the account's access token
+func authenticateSMTPOAuth(conn smtpAuthenticator, account config.AccountConfig) error {
+	tm := GetTokenManager(nil)
+
+	token, err := tm.AccessToken(account)
+	if err != nil {
+		return fmt.Errorf("failed to get OAuth access token: %w", err)
+	}
+
+	auth := &smtpOAuthAuth{sasl: &oauthSASL{
+		username: loginName(account.SMTPConfig.Username, account.Email),
+		token:    token,
+		host:     account.SMTPConfig.Server,
+		port:     account.SMTPConfig.Port,
+	}}
+	if err := conn.Auth(auth); err != nil {
+		// The token may have been revoked before it expired, so refresh it on the next attempt
+		tm.Expire(account.ID)
+		return fmt.Errorf("failed to authenticate with SMTP server: %w", err)
+	}
+
+	return nil
+}
+
+// loginName returns the configured username, or the account's email address if it is empty
+func loginName(username string, email string) string {
+	if username != "" {
+		return username
+	}
+	return email
+}
@@ -0,0 +1,258 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/stretchr/testify/assert"
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// resetTokenManager replaces the global token manager with one backed by s
+func resetTokenManager(t *testing.T, s store.Store) *TokenManager {
+	t.Helper()
+
+	tokenManagerMutex.Lock()
+	globalTokenManager = nil
+	tokenManagerMutex.Unlock()
+	t.Cleanup(func() {
+		tokenManagerMutex.Lock()
+		globalTokenManager = nil
+		tokenManagerMutex.Unlock()
+	})
+
+	return GetTokenManager(s)
+}
+
+// newTokenServer returns a token endpoint that issues access-1, access-2, ... and
+// records the refresh tokens it receives
+func newTokenServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var mutex sync.Mutex
+	var refreshTokens []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "refresh_token" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		mutex.Lock()
+		refreshTokens = append(refreshTokens, r.PostForm.Get("refresh_token"))
+		n := len(refreshTokens)
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"access-%d","token_type":"Bearer","expires_in":3600,"refresh_token":"refresh-%d"}`, n, n)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &refreshTokens
+}
+
+// oauthTestAccount returns a decrypted OAuth account whose access token has expired
+func oauthTestAccount(tokenURL string) config.AccountConfig {
+	return config.AccountConfig{
+		ID:       "oauth-account",
+		Email:    "me@example.com",
+		AuthType: "oauth",
+		IMAPConfig: config.IMAPConfig{
+			Server: "imap.example.com",
+			Port:   993,
+		},
+		SMTPConfig: config.SMTPConfig{
+			Server: "smtp.example.com",
+			Port:   587,
+		},
+		OAuthConfig: &config.OAuthConfig{
+			ClientID:     "client",
+			ClientSecret: "secret",
+			RefreshToken: "refresh-0",
+			AccessToken:  "access-0",
+			Expiry:       time.Now().Add(-time.Hour).Format(time.RFC3339),
+			TokenURL:     tokenURL,
+		},
+	}
+}
+
+func TestTokenManagerRefreshesAndPersists(t *testing.T) {
+	server, refreshTokens := newTokenServer(t)
+	s := newMemoryStore()
+	tm := resetTokenManager(t, s)
+	account := oauthTestAccount(server.URL)
+
+	token, err := tm.AccessToken(account)
+	assert.NoError(t, err)
+	assert.Equal(t, "access-1", token)
+
+	stored, err := s.GetOAuthToken(account.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "access-1", stored.AccessToken)
+	assert.Equal(t, "refresh-1", stored.RefreshToken)
+	assert.True(t, stored.Expiry.After(time.Now()))
+
+	// A valid token is reused
+	token, err = tm.AccessToken(account)
+	assert.NoError(t, err)
+	assert.Equal(t, "access-1", token)
+
+	// An expired token is refreshed with the rotated refresh token
+	tm.Expire(account.ID)
+	token, err = tm.AccessToken(account)
+	assert.NoError(t, err)
+	assert.Equal(t, "access-2", token)
+
+	assert.Equal(t, []string{"refresh-0", "refresh-1"}, *refreshTokens)
+}
+
+func TestTokenManagerUsesStoredToken(t *testing.T) {
+	server, refreshTokens := newTokenServer(t)
+	s := newMemoryStore()
+	s.tokens["oauth-account"] = models.OAuthToken{
+		AccountID:    "oauth-account",
+		AccessToken:  "stored-access",
+		RefreshToken: "stored-refresh",
+		Expiry:       time.Now().Add(time.Hour),
+	}
+	tm := resetTokenManager(t, s)
+
+	token, err := tm.AccessToken(oauthTestAccount(server.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, "stored-access", token)
+	assert.Empty(t, *refreshTokens)
+}
+
+func TestTokenManagerErrors(t *testing.T) {
+	tm := resetTokenManager(t, nil)
+
+	noRefreshToken := oauthTestAccount("http://127.0.0.1:1/token")
+	noRefreshToken.ID = "no-refresh-token"
+	noRefreshToken.OAuthConfig.RefreshToken = ""
+	_, err := tm.AccessToken(noRefreshToken)
+	assert.Error(t, err)
+
+	noTokenURL := oauthTestAccount("")
+	noTokenURL.ID = "no-token-url"
+	_, err = tm.AccessToken(noTokenURL)
+	assert.Error(t, err)
+
+	noOAuthConfig := oauthTestAccount("")
+	noOAuthConfig.ID = "no-oauth-config"
+	noOAuthConfig.OAuthConfig = nil
+	_, err = tm.AccessToken(noOAuthConfig)
+	assert.Error(t, err)
+}
+
+func TestDefaultTokenURL(t *testing.T) {
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{"imap.gmail.com", googleTokenURL},
+		{"smtp.gmail.com", googleTokenURL},
+		{"outlook.office365.com", microsoftTokenURL},
+		{"imap-mail.outlook.com", microsoftTokenURL},
+		{"imap.example.com", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			assert.Equal(t, tt.want, defaultTokenURL(tt.server))
+		})
+	}
+}
+
+func TestOAuthSASLInitialResponse(t *testing.T) {
+	xoauth2 := &oauthSASL{mechanism: mechanismXOAuth2, username: "me@example.com", token: "tok"}
+	mech, ir, err := xoauth2.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, "XOAUTH2", mech)
+	assert.Equal(t, "user=me@example.com\x01auth=Bearer tok\x01\x01", string(ir))
+
+	bearer := &oauthSASL{mechanism: mechanismOAuthBearer, username: "a,b=c", token: "tok", host: "imap.example.com", port: 993}
+	mech, ir, err = bearer.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, "OAUTHBEARER", mech)
+	assert.Equal(t, "n,a=a=2Cb=3Dc,\x01host=imap.example.com\x01port=993\x01auth=Bearer tok\x01\x01", string(ir))
+
+	// The error challenge is acknowledged so the server can fail the command
+	resp, err := bearer.Next([]byte(`{"status":"invalid_token"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, resp)
+}
+
+func TestSMTPOAuthAuthStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   smtp.ServerInfo
+		wantMech string
+		wantErr  bool
+	}{
+		{"oauthbearer", smtp.ServerInfo{Name: "smtp.example.com", TLS: true, Auth: []string{"PLAIN", "OAUTHBEARER", "XOAUTH2"}}, "OAUTHBEARER", false},
+		{"xoauth2", smtp.ServerInfo{Name: "smtp.example.com", TLS: true, Auth: []string{"PLAIN", "XOAUTH2"}}, "XOAUTH2", false},
+		{"localhost without tls", smtp.ServerInfo{Name: "localhost", Auth: []string{"XOAUTH2"}}, "XOAUTH2", false},
+		{"remote without tls", smtp.ServerInfo{Name: "smtp.example.com", Auth: []string{"XOAUTH2"}}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &smtpOAuthAuth{sasl: &oauthSASL{username: "me@example.com", token: "tok"}}
+			mech, _, err := auth.Start(&tt.server)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMech, mech)
+		})
+	}
+}
+
+// fakeIMAPAuthenticator records the SASL client it is given
+type fakeIMAPAuthenticator struct {
+	oauthBearer bool
+	err         error
+	mech        string
+	ir          []byte
+}
+
+func (f *fakeIMAPAuthenticator) SupportAuth(mech string) (bool, error) {
+	return mech == mechanismOAuthBearer && f.oauthBearer, nil
+}
+
+func (f *fakeIMAPAuthenticator) Authenticate(auth sasl.Client) error {
+	f.mech, f.ir, _ = auth.Start()
+	return f.err
+}
+
+func TestAuthenticateIMAPOAuth(t *testing.T) {
+	server, refreshTokens := newTokenServer(t)
+	resetTokenManager(t, newMemoryStore())
+	account := oauthTestAccount(server.URL)
+
+	conn := &fakeIMAPAuthenticator{oauthBearer: true}
+	assert.NoError(t, authenticateIMAPOAuth(conn, account))
+	assert.Equal(t, "OAUTHBEARER", conn.mech)
+	assert.Contains(t, string(conn.ir), "a=me@example.com,")
+	assert.Contains(t, string(conn.ir), "auth=Bearer access-1")
+
+	// A rejected token is refreshed on the next attempt
+	conn = &fakeIMAPAuthenticator{err: errors.New("AUTHENTICATIONFAILED")}
+	assert.Error(t, authenticateIMAPOAuth(conn, account))
+	assert.Equal(t, "XOAUTH2", conn.mech)
+
+	conn = &fakeIMAPAuthenticator{}
+	assert.NoError(t, authenticateIMAPOAuth(conn, account))
+	assert.Contains(t, string(conn.ir), "auth=Bearer access-2")
+	assert.Len(t, *refreshTokens, 2)
+}
@@ -0,0 +1,323 @@
+package client
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+const (
+	// maxOutboxAttempts is how many times a message is tried before it is marked failed
+	maxOutboxAttempts = 10
+	// outboxRetryDelay is the delay before the first retry, doubled after each attempt
+	outboxRetryDelay = 30 * time.Second
+	// maxOutboxRetryDelay caps the delay between retries
+	maxOutboxRetryDelay = time.Hour
+	// outboxSendingLease is how long a message being sent stays claimed. A message whose
+	// sending was interrupted by a crash is sent again after it.
+	outboxSendingLease = 15 * time.Minute
+)
+
+// OutboxSender sends the messages queued in the store's outbox once they are due, which
+// for scheduled messages is their send time. Messages that fail with a temporary error
+// are retried with exponential backoff; messages the server rejects permanently are
+// marked bounced. Sent messages are appended to the Sent folder on the account's IMAP
+// server.
+type OutboxSender struct {
+	store             store.Store
+	defaultClient     SMTPClient
+	defaultIMAPClient IMAPClient
+	pollInterval      time.Duration
+	mutex             sync.Mutex
+	wake              chan struct{}
+	stopChan          chan struct{}
+	done              chan struct{}
+	running           bool
+}
+
+var (
+	// Global outbox sender instance
+	globalOutboxSender *OutboxSender
+	outboxSenderMutex  sync.Mutex
+)
+
+// GetOutboxSender returns the global outbox sender instance
+func GetOutboxSender(store store.Store) *OutboxSender {
+	outboxSenderMutex.Lock()
+	defer outboxSenderMutex.Unlock()
+
+	if globalOutboxSender == nil {
+		globalOutboxSender = &OutboxSender{
+			store:        store,
+			pollInterval: 10 * time.Second,
+			wake:         make(chan struct{}, 1),
+		}
+	}
+
+	// Update the store if provided
+	if store != nil {
+		globalOutboxSender.store = store
+	}
+
+	return globalOutboxSender
+}
+
+// SetDefaultClients sets the clients for messages queued without an account
+func (s *OutboxSender) SetDefaultClients(imapClient IMAPClient, smtpClient SMTPClient) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.defaultIMAPClient = imapClient
+	s.defaultClient = smtpClient
+}
+
+// SetPollInterval sets how often the outbox is checked for due retries
+func (s *OutboxSender) SetPollInterval(interval time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pollInterval = interval
+}
+
+// Start starts sending queued messages in the background
+func (s *OutboxSender) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.running {
+		return
+	}
+
+	s.running = true
+	s.stopChan = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run(s.stopChan, s.done, s.pollInterval)
+}
+
+// Stop stops the sender, waiting for a message being sent to finish
+func (s *OutboxSender) Stop() {
+	s.mutex.Lock()
+	if !s.running {
+		s.mutex.Unlock()
+		return
+	}
+	s.running = false
+	close(s.stopChan)
+	done := s.done
+	s.mutex.Unlock()
+
+	<-done
+}
+
+// Notify wakes the sender to send newly queued messages without waiting for the next poll
+func (s *OutboxSender) Notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+		// A wake-up is already pending
+	}
+}
+
+// run sends due messages until stopChan is closed
+func (s *OutboxSender) run(stopChan <-chan struct{}, done chan<- struct{}, pollInterval time.Duration) {
+	defer close(done)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.sendDue()
+
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// sendDue sends the queued messages whose next attempt is due, claiming each one so it
+// can't be cancelled while it is being sent
+func (s *OutboxSender) sendDue() {
+	if s.store == nil {
+		return
+	}
+
+	for {
+		message, err := s.store.ClaimOutboxMessage(time.Now(), outboxSendingLease)
+		if err == sql.ErrNoRows {
+			return
+		}
+		if err != nil {
+			fmt.Printf("Warning: Failed to load outbox: %v\n", err)
+			return
+		}
+		s.send(message)
+	}
+}
+
+// send makes one attempt to send a message and records the outcome
+func (s *OutboxSender) send(message models.OutboxMessage) {
+	raw, err := s.deliver(message)
+	now := time.Now()
+	message.Attempts++
+
+	switch {
+	case err == nil:
+		defer raw.Close()
+
+		message.Status = models.OutboxSent
+		message.LastError = ""
+		message.SentAt = &now
+
+		// Keep a copy of the sent email in the local Sent folder
+		if err := s.store.StoreEmail(message.Email); err != nil {
+			fmt.Printf("Warning: Failed to store sent email %s: %v\n", message.Email.ID, err)
+		} else {
+			s.appendToSent(message.Email, raw)
+		}
+	case isPermanentSMTPError(err):
+		message.Status = models.OutboxBounced
+		message.LastError = err.Error()
+	case message.Attempts >= maxOutboxAttempts:
+		message.Status = models.OutboxFailed
+		message.LastError = err.Error()
+	default:
+		message.Status = models.OutboxQueued
+		message.LastError = err.Error()
+		message.NextAttempt = now.Add(outboxBackoff(message.Attempts))
+	}
+
+	if err := s.store.UpdateOutboxMessage(message); err != nil {
+		fmt.Printf("Warning: Failed to update outbox message %s: %v\n", message.ID, err)
+	}
+}
+
+// deliver sends a message with the SMTP client of its account, connecting it if needed,
+// and returns the MIME message that was sent
+func (s *OutboxSender) deliver(message models.OutboxMessage) (*MessageFile, error) {
+	smtpClient, err := s.clientFor(message.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !smtpClient.IsConnected() {
+		if err := smtpClient.Connect(); err != nil {
+			return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+		}
+	}
+
+	return smtpClient.SendEmailMessage(message.Email)
+}
+
+// appendToSent appends a sent message to the Sent folder on the IMAP server of its
+// account, if it has an IMAP client
+func (s *OutboxSender) appendToSent(email models.Email, raw RawMessage) {
+	imapClient := s.imapClientFor(email.AccountID)
+	if imapClient == nil {
+		return
+	}
+
+	if _, err := AppendSentEmail(s.store, imapClient, email, raw); err != nil {
+		fmt.Printf("Warning: Failed to store sent email %s on the server: %v\n", email.ID, err)
+	}
+}
+
+// AppendSentEmail appends a sent message to the \Sent folder on the IMAP server, so
+// that other mail clients show it, and re-keys the stored email to the UID of the
+// server's copy. It returns the ID of the stored email, which is unchanged when the
+// server has no Sent folder or the copy could not be located.
+func AppendSentEmail(s store.Store, imapClient IMAPClient, email models.Email, raw RawMessage) (string, error) {
+	if !imapClient.IsConnected() {
+		if err := imapClient.Connect(); err != nil {
+			return email.ID, fmt.Errorf("failed to connect to IMAP server: %w", err)
+		}
+	}
+
+	folder, err := specialFolder(imapClient, func(folder models.Folder) bool { return folder.IsSent })
+	if err != nil {
+		return email.ID, fmt.Errorf("failed to find the Sent folder: %w", err)
+	}
+	if folder == "" {
+		return email.ID, nil
+	}
+
+	newEmailID, err := imapClient.AppendEmail(folder, raw, []string{imap.SeenFlag})
+	if err != nil {
+		return email.ID, err
+	}
+	if newEmailID == "" {
+		return email.ID, nil
+	}
+
+	if err := GetEmailEventHandler(s).HandleEmailAppended(email.ID, newEmailID, folder); err != nil {
+		return email.ID, fmt.Errorf("failed to update the stored email: %w", err)
+	}
+
+	return newEmailID, nil
+}
+
+// clientFor returns the SMTP client of an account, or the default client for messages
+// queued without one
+func (s *OutboxSender) clientFor(accountID string) (SMTPClient, error) {
+	if accountID == "" {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.defaultClient == nil {
+			return nil, fmt.Errorf("SMTP client not configured")
+		}
+		return s.defaultClient, nil
+	}
+
+	c, ok := GetConnectionManager().GetClient(fmt.Sprintf("smtp-%s", accountID))
+	if !ok {
+		return nil, fmt.Errorf("no SMTP client registered for account %s", accountID)
+	}
+	smtpClient, ok := c.(SMTPClient)
+	if !ok {
+		return nil, fmt.Errorf("client smtp-%s is not an SMTP client", accountID)
+	}
+	return smtpClient, nil
+}
+
+// imapClientFor returns the IMAP client of an account, or the default client for
+// messages queued without one. It returns nil if there is none.
+func (s *OutboxSender) imapClientFor(accountID string) IMAPClient {
+	if accountID == "" {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return s.defaultIMAPClient
+	}
+
+	c, ok := GetConnectionManager().GetClient(fmt.Sprintf("imap-%s", accountID))
+	if !ok {
+		return nil
+	}
+	imapClient, _ := c.(IMAPClient)
+	return imapClient
+}
+
+// isPermanentSMTPError reports whether the SMTP server rejected a message with a 5xx
+// reply, which retrying won't change
+func isPermanentSMTPError(err error) bool {
+	var protocolErr *textproto.Error
+	return errors.As(err, &protocolErr) && protocolErr.Code >= 500 && protocolErr.Code < 600
+}
+
+// outboxBackoff returns the delay before retrying a message after a number of attempts
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxRetryDelay
+	for i := 1; i < attempts && delay < maxOutboxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxOutboxRetryDelay {
+		delay = maxOutboxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/mock"
+	"github.com/user/email-bridge/internal/models"
+)
+
+// outboxSMTPClient fails sends with its errors in turn, then succeeds
+type outboxSMTPClient struct {
+	errs []error
+	sent []models.Email
+}
+
+func (c *outboxSMTPClient) Connect() error    { return nil }
+func (c *outboxSMTPClient) Disconnect() error { return nil }
+func (c *outboxSMTPClient) IsConnected() bool { return true }
+
+func (c *outboxSMTPClient) SendEmail(email models.Email) error {
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return err
+	}
+	c.sent = append(c.sent, email)
+	return nil
+}
+
+func (c *outboxSMTPClient) SendEmailMessage(email models.Email) (*MessageFile, error) {
+	if err := c.SendEmail(email); err != nil {
+		return nil, err
+	}
+	return NewMessageFile(func(w io.Writer) error {
+		_, err := io.WriteString(w, sentMessage)
+		return err
+	})
+}
+
+// sentMessage is the message outboxSMTPClient reports it sent
+const sentMessage = "Message-Id: <email-1@example.com>\r\n" +
+	"Date: Fri, 01 Mar 2024 09:00:00 +0530\r\n" +
+	"Subject: Report\r\n" +
+	"\r\n" +
+	"Sent\r\n"
+
+func TestOutboxSender(t *testing.T) {
+	temporary := fmt.Errorf("failed to add recipient: %w", &textproto.Error{Code: 451, Msg: "try again later"})
+	permanent := fmt.Errorf("failed to add recipient: %w", &textproto.Error{Code: 550, Msg: "no such user"})
+
+	tests := []struct {
+		name         string
+		errs         []error
+		attempts     int
+		wantStatus   string
+		wantAttempts int
+		wantRetry    bool
+	}{
+		{"sent", nil, 0, models.OutboxSent, 1, false},
+		{"temporary failure is retried", []error{temporary}, 0, models.OutboxQueued, 1, true},
+		{"connection failure is retried", []error{errors.New("connection reset")}, 0, models.OutboxQueued, 1, true},
+		{"permanent failure bounces", []error{permanent}, 0, models.OutboxBounced, 1, false},
+		{"last attempt fails", []error{temporary}, maxOutboxAttempts - 1, models.OutboxFailed, maxOutboxAttempts, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memStore := newMemoryStore()
+			smtpClient := &outboxSMTPClient{errs: tt.errs}
+			sender := &OutboxSender{store: memStore, defaultClient: smtpClient, wake: make(chan struct{}, 1)}
+
+			queued := models.OutboxMessage{
+				ID:          "outbox-1",
+				Email:       models.Email{ID: "email-1", Folder: "Sent", Subject: "Report"},
+				Status:      models.OutboxQueued,
+				Attempts:    tt.attempts,
+				NextAttempt: time.Now().Add(-time.Second),
+			}
+			memStore.QueueOutboxMessage(queued)
+
+			before := time.Now()
+			sender.sendDue()
+
+			message, _ := memStore.GetOutboxMessage("outbox-1")
+			if message.Status != tt.wantStatus || message.Attempts != tt.wantAttempts {
+				t.Fatalf("Expected %s after %d attempts, got %s after %d (%s)",
+					tt.wantStatus, tt.wantAttempts, message.Status, message.Attempts, message.LastError)
+			}
+			retried := message.Status == models.OutboxQueued && message.NextAttempt.After(before)
+			if retried != tt.wantRetry {
+				t.Errorf("Expected retry %v, next attempt is %v", tt.wantRetry, message.NextAttempt)
+			}
+
+			// Sent emails are kept in the local store
+			sent := tt.wantStatus == models.OutboxSent
+			_, stored := memStore.emails["email-1"]
+			if stored != sent || (len(smtpClient.sent) == 1) != sent {
+				t.Errorf("Expected the email to be sent and stored: %v, got sent %d, stored %v", sent, len(smtpClient.sent), stored)
+			}
+			if tt.wantStatus == models.OutboxSent && message.SentAt == nil {
+				t.Error("Expected the sent time to be set")
+			}
+			if tt.wantStatus != models.OutboxSent && message.LastError == "" {
+				t.Error("Expected the error to be recorded")
+			}
+
+			// A message waiting for a retry is not sent again before it is due
+			sender.sendDue()
+			if tt.wantRetry && len(smtpClient.sent) != 0 {
+				t.Error("Expected the retry to wait for its backoff")
+			}
+		})
+	}
+}
+
+func TestOutboxAppendsToSent(t *testing.T) {
+	conn := new(MockIMAPConn)
+	folders := []imap.MailboxInfo{
+		{Name: "INBOX"},
+		{Name: "Sent Items", Attributes: []string{imap.SentAttr}},
+	}
+	conn.On("List", "", "*", mock.Anything).Return(folders, nil)
+	conn.On("Lsub", "", "*", mock.Anything).Return(folders, nil)
+	date := time.Date(2024, 3, 1, 9, 0, 0, 0, time.FixedZone("", 5*3600+1800))
+	conn.On("Append", "Sent Items", []string{imap.SeenFlag}, mock.MatchedBy(date.Equal), mock.MatchedBy(func(literal imap.Literal) bool {
+		raw, _ := io.ReadAll(literal)
+		return string(raw) == sentMessage
+	})).Return(nil)
+	conn.On("Select", "Sent Items", true).Return(&imap.MailboxStatus{Name: "Sent Items"}, nil)
+	conn.On("UidSearch", mock.MatchedBy(func(criteria *imap.SearchCriteria) bool {
+		return criteria.Header.Get("Message-Id") == "<email-1@example.com>"
+	})).Return([]uint32{55}, nil)
+
+	memStore := newMemoryStore()
+	sender := &OutboxSender{
+		store:             memStore,
+		defaultClient:     &outboxSMTPClient{},
+		defaultIMAPClient: newFlagsTestClient(conn),
+		wake:              make(chan struct{}, 1),
+	}
+	memStore.QueueOutboxMessage(models.OutboxMessage{
+		ID:          "outbox-1",
+		Email:       models.Email{ID: "email-1", Folder: "Sent", Subject: "Report"},
+		Status:      models.OutboxQueued,
+		NextAttempt: time.Now().Add(-time.Second),
+	})
+
+	sender.sendDue()
+	conn.AssertExpectations(t)
+
+	// The stored email is re-keyed to the server's copy of the exact message sent
+	if _, ok := memStore.emails["email-1"]; ok {
+		t.Error("Expected the email not to be stored under its local ID")
+	}
+	email, ok := memStore.emails["account-55"]
+	if !ok || email.Folder != "Sent Items" {
+		t.Errorf("Expected the email to be stored as account-55 in Sent Items, got %+v", email)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{9, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempts); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -2,10 +2,10 @@ package client
 
 import (
 	"crypto/tls"
-	"encoding/base64"
 	"fmt"
+	"io"
 	"net/smtp"
-	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -92,8 +92,11 @@ func (c *SMTPClientImpl) Connect() error {
 
 	// Authenticate
 	if decryptedConfig.AuthType == "oauth" && decryptedConfig.OAuthConfig != nil {
-		// TODO: Implement OAuth authentication
-		return fmt.Errorf("OAuth authentication not implemented yet")
+		// Login with an OAuth2 access token
+		if err := authenticateSMTPOAuth(smtpClient, decryptedConfig); err != nil {
+			smtpClient.Quit()
+			return err
+		}
 	} else {
 		// Login with username and password
 		auth := smtp.PlainAuth("", decryptedConfig.SMTPConfig.Username, decryptedConfig.SMTPConfig.Password, decryptedConfig.SMTPConfig.Server)
@@ -138,6 +141,10 @@ func (c *SMTPClientImpl) IsConnected() bool {
 func (c *SMTPClientImpl) reconnect() error {
 	c.mutex.Lock()
 	wasConnected := c.connected
+	if c.client != nil {
+		// Release the broken connection
+		c.client.Close()
+	}
 	c.connected = false
 	c.client = nil
 	c.mutex.Unlock()
@@ -183,10 +190,9 @@ func (c *SMTPClientImpl) reconnect() error {
 	return fmt.Errorf("connection lost, reconnection scheduled")
 }
 
-// handleConnectionError handles SMTP connection errors and attempts to reconnect
-// Returns true if the connection was restored and the operation should be retried
-func (c *SMTPClientImpl) handleConnectionError(err error) bool {
-	// Check if it's a connection error
+// isSMTPConnectionError reports whether an error means the connection to the SMTP
+// server was lost
+func isSMTPConnectionError(err error) bool {
 	if err == nil {
 		return false
 	}
@@ -201,26 +207,24 @@ func (c *SMTPClientImpl) handleConnectionError(err error) bool {
 		"use of closed network connection",
 	}
 
-	isConnectionError := false
-	errStr := err.Error()
+	errStr := strings.ToLower(err.Error())
 	for _, connErr := range connectionErrors {
-		if strings.Contains(strings.ToLower(errStr), strings.ToLower(connErr)) {
-			isConnectionError = true
-			break
+		if strings.Contains(errStr, strings.ToLower(connErr)) {
+			return true
 		}
 	}
+	return false
+}
 
-	if !isConnectionError {
+// handleConnectionError handles SMTP connection errors and attempts to reconnect
+// Returns true if the connection was restored and the operation should be retried
+func (c *SMTPClientImpl) handleConnectionError(err error) bool {
+	// Check if it's a connection error
+	if !isSMTPConnectionError(err) {
 		return false
 	}
 
 	// It's a connection error, try to reconnect
-	c.mutex.Lock()
-	c.connected = false
-	c.client = nil
-	c.mutex.Unlock()
-
-	// Try to reconnect
 	reconnectErr := c.reconnect()
 	if reconnectErr != nil {
 		// Reconnection failed
@@ -231,8 +235,50 @@ func (c *SMTPClientImpl) handleConnectionError(err error) bool {
 	return true
 }
 
-// SendEmail sends an email
+// SendEmail sends an email, streaming the message to the server
 func (c *SMTPClientImpl) SendEmail(email models.Email) error {
+	return c.send(email, func(w io.Writer) error {
+		return writeMessage(w, email, c.config.SMTPConfig.Server)
+	})
+}
+
+// SendEmailMessage sends an email and returns the message that was sent, so that the
+// same bytes can be stored in the Sent folder. The message is streamed to the server
+// and to a temporary file at the same time; the caller must close it.
+func (c *SMTPClientImpl) SendEmailMessage(email models.Email) (*MessageFile, error) {
+	msg, err := newMessageFile()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.send(email, func(w io.Writer) error {
+		// A retry writes the message again from the start
+		return msg.write(func(file io.Writer) error {
+			return writeMessage(io.MultiWriter(w, file), email, c.config.SMTPConfig.Server)
+		})
+	})
+	if err != nil {
+		msg.Close()
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// send sends an email to its recipients, with write writing the message. The email is
+// sent again once if the connection was lost and could be restored.
+func (c *SMTPClientImpl) send(email models.Email, write func(w io.Writer) error) error {
+	err := c.sendOnce(email, write)
+	if err != nil && c.handleConnectionError(err) {
+		// Try again once if it was a connection error that was fixed. The lock must be
+		// released first, as reconnecting takes it.
+		err = c.sendOnce(email, write)
+	}
+	return err
+}
+
+// sendOnce runs a single mail transaction for an email on the current connection
+func (c *SMTPClientImpl) sendOnce(email models.Email, write func(w io.Writer) error) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -249,290 +295,126 @@ func (c *SMTPClientImpl) SendEmail(email models.Email) error {
 		return fmt.Errorf("email must have a sender")
 	}
 
-	// Create message
-	msg, err := c.createMessage(email)
-	if err != nil {
+	// Check the attachments before starting the transaction, as the message is
+	// streamed to the server
+	if err := checkAttachments(email); err != nil {
 		return fmt.Errorf("failed to create email message: %w", err)
 	}
 
 	// Set sender
 	if err := c.client.Mail(email.From.Email); err != nil {
-		// Handle connection error
-		if c.handleConnectionError(err) {
-			// Try again once if it was a connection error that was fixed
-			return c.SendEmail(email)
-		}
+		c.resetTransaction()
 		return fmt.Errorf("failed to set sender: %w", err)
 	}
 
 	// Add recipients
 	recipients := make(map[string]bool)
-
-	// Add To recipients
-	for _, to := range email.To {
-		if to.Email != "" && !recipients[to.Email] {
-			if err := c.client.Rcpt(to.Email); err != nil {
-				// Handle connection error
-				if c.handleConnectionError(err) {
-					// Try again once if it was a connection error that was fixed
-					return c.SendEmail(email)
-				}
-				return fmt.Errorf("failed to add recipient %s: %w", to.Email, err)
+	addRecipients := func(kind string, addresses []models.Address) error {
+		for _, address := range addresses {
+			if address.Email == "" || recipients[address.Email] {
+				continue
 			}
-			recipients[to.Email] = true
-		}
-	}
-
-	// Add Cc recipients
-	for _, cc := range email.Cc {
-		if cc.Email != "" && !recipients[cc.Email] {
-			if err := c.client.Rcpt(cc.Email); err != nil {
-				// Handle connection error
-				if c.handleConnectionError(err) {
-					// Try again once if it was a connection error that was fixed
-					return c.SendEmail(email)
-				}
-				return fmt.Errorf("failed to add CC recipient %s: %w", cc.Email, err)
+			if err := c.client.Rcpt(address.Email); err != nil {
+				return fmt.Errorf("failed to add %s %s: %w", kind, address.Email, err)
 			}
-			recipients[cc.Email] = true
+			recipients[address.Email] = true
 		}
+		return nil
 	}
-
-	// Add Bcc recipients
-	for _, bcc := range email.Bcc {
-		if bcc.Email != "" && !recipients[bcc.Email] {
-			if err := c.client.Rcpt(bcc.Email); err != nil {
-				// Handle connection error
-				if c.handleConnectionError(err) {
-					// Try again once if it was a connection error that was fixed
-					return c.SendEmail(email)
-				}
-				return fmt.Errorf("failed to add BCC recipient %s: %w", bcc.Email, err)
-			}
-			recipients[bcc.Email] = true
+	for _, group := range []struct {
+		kind      string
+		addresses []models.Address
+	}{
+		{"recipient", email.To},
+		{"CC recipient", email.Cc},
+		{"BCC recipient", email.Bcc},
+	} {
+		if err := addRecipients(group.kind, group.addresses); err != nil {
+			c.resetTransaction()
+			return err
 		}
 	}
 
 	// Get data writer
 	w, err := c.client.Data()
 	if err != nil {
-		// Handle connection error
-		if c.handleConnectionError(err) {
-			// Try again once if it was a connection error that was fixed
-			return c.SendEmail(email)
-		}
+		c.resetTransaction()
 		return fmt.Errorf("failed to get data writer: %w", err)
 	}
 
 	// Write message
-	if _, err := w.Write([]byte(msg)); err != nil {
-		// Handle connection error
-		if c.handleConnectionError(err) {
-			// Try again once if it was a connection error that was fixed
-			return c.SendEmail(email)
+	if err := write(w); err != nil {
+		if isSMTPConnectionError(err) {
+			// send reconnects
+			return fmt.Errorf("failed to write message: %w", err)
 		}
+		// Drop the connection without ending the data, so the server discards
+		// the partial message
+		c.client.Close()
+		c.client = nil
+		c.connected = false
 		return fmt.Errorf("failed to write message: %w", err)
 	}
 
 	// Close data writer
 	if err := w.Close(); err != nil {
-		// Handle connection error
-		if c.handleConnectionError(err) {
-			// Try again once if it was a connection error that was fixed
-			return c.SendEmail(email)
-		}
+		c.resetTransaction()
 		return fmt.Errorf("failed to close data writer: %w", err)
 	}
 
 	return nil
 }
 
-// createMessage creates an email message in RFC 822 format
+// resetTransaction aborts the current mail transaction with RSET, so that the next
+// email isn't refused as a nested MAIL command. The caller must hold the lock.
+func (c *SMTPClientImpl) resetTransaction() {
+	// A lost connection fails here too and is handled by the caller
+	c.client.Reset()
+}
+
+// createMessage creates an email message in memory. SendEmail and SendEmailMessage
+// stream the message with writeMessage instead.
 func (c *SMTPClientImpl) createMessage(email models.Email) (string, error) {
-	// Create a buffer for the message
 	var msg strings.Builder
-
-	// Add headers
-	msg.WriteString(fmt.Sprintf("From: %s\r\n", formatAddress(email.From)))
-
-	// Add To header
-	if len(email.To) > 0 {
-		msg.WriteString("To: ")
-		for i, to := range email.To {
-			if i > 0 {
-				msg.WriteString(", ")
-			}
-			msg.WriteString(formatAddress(to))
-		}
-		msg.WriteString("\r\n")
+	if err := writeMessage(&msg, email, c.config.SMTPConfig.Server); err != nil {
+		return "", err
 	}
+	return msg.String(), nil
+}
 
-	// Add Cc header
-	if len(email.Cc) > 0 {
-		msg.WriteString("Cc: ")
-		for i, cc := range email.Cc {
-			if i > 0 {
-				msg.WriteString(", ")
-			}
-			msg.WriteString(formatAddress(cc))
-		}
-		msg.WriteString("\r\n")
-	}
-
-	// Add Subject header
-	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", email.Subject))
-
-	// Add Date header
-	msg.WriteString(fmt.Sprintf("Date: %s\r\n", email.Date.Format(time.RFC1123Z)))
-
-	// Add Message-ID header if provided
-	if email.MessageID != "" {
-		msg.WriteString(fmt.Sprintf("Message-ID: %s\r\n", email.MessageID))
-	} else {
-		// Generate a Message-ID if not provided
-		msgID := fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), email.From.Email, c.config.SMTPConfig.Server)
-		msg.WriteString(fmt.Sprintf("Message-ID: %s\r\n", msgID))
-	}
-
-	// Add MIME headers
-	boundary := generateBoundary()
-	msg.WriteString("MIME-Version: 1.0\r\n")
-
-	// Determine content type based on email content and attachments
-	if len(email.Attachments) > 0 {
-		// Multipart message with attachments
-		msg.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", boundary))
-		msg.WriteString("\r\n")
-
-		// Add message body
-		msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-
-		// If we have both text and HTML content, use multipart/alternative
-		if email.TextContent != "" && email.HtmlContent != "" {
-			altBoundary := generateBoundary()
-			msg.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", altBoundary))
-			msg.WriteString("\r\n")
-
-			// Add text part
-			msg.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
-			msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-			msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-			msg.WriteString("\r\n")
-			msg.WriteString(email.TextContent)
-			msg.WriteString("\r\n\r\n")
-
-			// Add HTML part
-			msg.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
-			msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-			msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-			msg.WriteString("\r\n")
-			msg.WriteString(email.HtmlContent)
-			msg.WriteString("\r\n\r\n")
-
-			// Close alternative part
-			msg.WriteString(fmt.Sprintf("--%s--\r\n", altBoundary))
-		} else if email.HtmlContent != "" {
-			// HTML only
-			msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-			msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-			msg.WriteString("\r\n")
-			msg.WriteString(email.HtmlContent)
-			msg.WriteString("\r\n\r\n")
-		} else {
-			// Text only
-			msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-			msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-			msg.WriteString("\r\n")
-			msg.WriteString(email.TextContent)
-			msg.WriteString("\r\n\r\n")
-		}
+// generatedHeaders are the headers createMessage writes itself
+var generatedHeaders = map[string]bool{
+	"from":                      true,
+	"to":                        true,
+	"cc":                        true,
+	"bcc":                       true,
+	"subject":                   true,
+	"date":                      true,
+	"message-id":                true,
+	"mime-version":              true,
+	"content-type":              true,
+	"content-transfer-encoding": true,
+}
 
-		// Add attachments
-		for _, attachment := range email.Attachments {
-			msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-			msg.WriteString(fmt.Sprintf("Content-Type: %s; name=\"%s\"\r\n", attachment.ContentType, attachment.Filename))
-			msg.WriteString("Content-Transfer-Encoding: base64\r\n")
-			msg.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n", attachment.Filename))
-			if attachment.ContentID != "" {
-				msg.WriteString(fmt.Sprintf("Content-ID: <%s>\r\n", attachment.ContentID))
-			}
-			msg.WriteString("\r\n")
-
-			// If the attachment has a path, read the file and encode it as base64
-			if attachment.Path != "" {
-				data, err := os.ReadFile(attachment.Path)
-				if err != nil {
-					return "", fmt.Errorf("failed to read attachment file %s: %w", attachment.Path, err)
-				}
-
-				// Encode the data as base64
-				encoded := base64.StdEncoding.EncodeToString(data)
-
-				// Write the encoded data in lines of 76 characters
-				for i := 0; i < len(encoded); i += 76 {
-					end := i + 76
-					if end > len(encoded) {
-						end = len(encoded)
-					}
-					msg.WriteString(encoded[i:end] + "\r\n")
-				}
-			} else {
-				// No path provided, just add a placeholder
-				msg.WriteString("[Attachment data not available]\r\n\r\n")
-			}
+// extraHeaderKeys returns the sorted keys of the headers that createMessage doesn't generate
+func extraHeaderKeys(headers map[string]string) []string {
+	var keys []string
+	for key := range headers {
+		if key == "" || generatedHeaders[strings.ToLower(key)] || strings.ContainsAny(key, ": \r\n") {
+			continue
 		}
-
-		// Close multipart message
-		msg.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
-	} else if email.HtmlContent != "" && email.TextContent != "" {
-		// Multipart alternative with both HTML and text
-		msg.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", boundary))
-		msg.WriteString("\r\n")
-
-		// Add text part
-		msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-		msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-		msg.WriteString("\r\n")
-		msg.WriteString(email.TextContent)
-		msg.WriteString("\r\n\r\n")
-
-		// Add HTML part
-		msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-		msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-		msg.WriteString("\r\n")
-		msg.WriteString(email.HtmlContent)
-		msg.WriteString("\r\n\r\n")
-
-		// Close multipart message
-		msg.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
-	} else if email.HtmlContent != "" {
-		// HTML only
-		msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-		msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-		msg.WriteString("\r\n")
-		msg.WriteString(email.HtmlContent)
-	} else {
-		// Text only
-		msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-		msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-		msg.WriteString("\r\n")
-		msg.WriteString(email.TextContent)
+		keys = append(keys, key)
 	}
-
-	return msg.String(), nil
+	sort.Strings(keys)
+	return keys
 }
 
-// formatAddress formats an email address with optional name
-func formatAddress(addr models.Address) string {
-	if addr.Name != "" {
-		return fmt.Sprintf("\"%s\" <%s>", addr.Name, addr.Email)
-	}
-	return addr.Email
+// sanitizeHeaderValue replaces line breaks so a value can't start a new header
+func sanitizeHeaderValue(value string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(value)
 }
 
-// generateBoundary generates a unique boundary string for multipart messages
-func generateBoundary() string {
-	return fmt.Sprintf("boundary_%d", time.Now().UnixNano())
+// Sender returns the address of the account the client sends for
+func (c *SMTPClientImpl) Sender() models.Address {
+	return models.Address{Email: c.config.Email}
 }
@@ -1,13 +1,14 @@
 package client
 
 import (
-	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/emersion/go-message/mail"
 	"github.com/user/email-bridge/internal/config"
 	"github.com/user/email-bridge/internal/models"
 )
@@ -85,7 +86,7 @@ func TestAttachmentHandling(t *testing.T) {
 	if !strings.Contains(msg, "Content-Type: multipart/mixed") {
 		t.Errorf("Message missing multipart/mixed Content-Type header")
 	}
-	if !strings.Contains(msg, fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"", "test-attachment.txt")) {
+	if !strings.Contains(msg, "Content-Disposition: attachment; filename=test-attachment.txt") {
 		t.Errorf("Message missing attachment Content-Disposition header")
 	}
 
@@ -106,3 +107,103 @@ func TestAttachmentHandling(t *testing.T) {
 		t.Errorf("Expected 'failed to read attachment file' error, got: %v", err)
 	}
 }
+
+// TestCreateMessageMIME parses a message back to check its encodings and structure
+func TestCreateMessageMIME(t *testing.T) {
+	client := NewSMTPClientImpl(config.AccountConfig{Email: "test@example.com"})
+
+	dir := t.TempDir()
+	spreadsheet := make([]byte, 3<<20)
+	for i := range spreadsheet {
+		spreadsheet[i] = byte(i % 251)
+	}
+	files := map[string][]byte{"logo.png": []byte("\x89PNG image"), "report.xlsx": spreadsheet}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	longLine := strings.Repeat("पुनर्मिलान रिपोर्ट ", 40)
+	msg, err := client.createMessage(models.Email{
+		From:        models.Address{Name: "राजेश कुमार", Email: "rajesh@example.com"},
+		To:          []models.Address{{Name: "Priya", Email: "priya@example.com"}},
+		Subject:     "मासिक चालान – March",
+		TextContent: longLine,
+		HtmlContent: `<p>See <img src="cid:logo@example.com"></p>`,
+		Attachments: []models.Attachment{
+			{Filename: "logo.png", ContentType: "image/png", ContentID: "logo@example.com", Path: filepath.Join(dir, "logo.png")},
+			{Filename: "रिपोर्ट.xlsx", Path: filepath.Join(dir, "report.xlsx")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create message: %v", err)
+	}
+
+	// Every line is ASCII and within the SMTP line length limit
+	for i, line := range strings.Split(msg, "\r\n") {
+		if len(line) > 998 {
+			t.Fatalf("Line %d is %d characters long", i+1, len(line))
+		}
+		for _, r := range line {
+			if r > 127 {
+				t.Fatalf("Line %d is not ASCII: %q", i+1, line)
+			}
+		}
+	}
+
+	mr, err := mail.CreateReader(strings.NewReader(msg))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	if subject, _ := mr.Header.Subject(); subject != "मासिक चालान – March" {
+		t.Errorf("Unexpected subject %q", subject)
+	}
+	if from, _ := mr.Header.AddressList("From"); len(from) != 1 || from[0].Name != "राजेश कुमार" {
+		t.Errorf("Unexpected From %v", from)
+	}
+
+	// The parts are flattened by the reader, in order
+	var parts []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read part: %v", err)
+		}
+		body, err := io.ReadAll(part.Body)
+		if err != nil {
+			t.Fatalf("Failed to read part body: %v", err)
+		}
+
+		switch h := part.Header.(type) {
+		case *mail.InlineHeader:
+			mediaType, _, _ := h.ContentType()
+			parts = append(parts, mediaType)
+			if mediaType == "text/plain" && string(body) != longLine {
+				t.Errorf("Text was not decoded intact")
+			}
+			if mediaType == "image/png" {
+				if h.Get("Content-Id") != "<logo@example.com>" || string(body) != string(files["logo.png"]) {
+					t.Errorf("Unexpected inline image %v", h.Header)
+				}
+			}
+		case *mail.AttachmentHeader:
+			filename, _ := h.Filename()
+			parts = append(parts, filename)
+			if string(body) != string(spreadsheet) {
+				t.Errorf("Attachment %s was not decoded intact", filename)
+			}
+		}
+	}
+
+	want := "text/plain,text/html,image/png,रिपोर्ट.xlsx"
+	if strings.Join(parts, ",") != want {
+		t.Errorf("Expected parts %s, got %s", want, strings.Join(parts, ","))
+	}
+	if !strings.Contains(msg, "Content-Type: multipart/related") {
+		t.Error("Expected the inline image to be related to the HTML")
+	}
+}
@@ -1,8 +1,14 @@
 package client
 
 import (
+	"io"
+	"net"
 	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -221,6 +227,10 @@ func TestCreateMessage(t *testing.T) {
 	}
 
 	// Test with attachments
+	attachmentPath := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(attachmentPath, []byte("attachment"), 0644); err != nil {
+		t.Fatalf("Failed to create attachment file: %v", err)
+	}
 	attachmentEmail := models.Email{
 		From: models.Address{
 			Name:  "Test Sender",
@@ -243,6 +253,7 @@ func TestCreateMessage(t *testing.T) {
 				Filename:    "test.txt",
 				ContentType: "text/plain",
 				Size:        123,
+				Path:        attachmentPath,
 			},
 		},
 	}
@@ -256,7 +267,7 @@ func TestCreateMessage(t *testing.T) {
 	if !containsString(msg, "Content-Type: multipart/mixed") {
 		t.Errorf("Message missing multipart/mixed Content-Type header")
 	}
-	if !containsString(msg, "Content-Disposition: attachment; filename=\"test.txt\"") {
+	if !containsString(msg, "Content-Disposition: attachment; filename=test.txt") {
 		t.Errorf("Message missing attachment Content-Disposition header")
 	}
 }
@@ -265,3 +276,268 @@ func TestCreateMessage(t *testing.T) {
 func containsString(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
+
+// TestCreateMessageExtraHeaders tests that extra headers are written once and can't inject new headers
+func TestCreateMessageExtraHeaders(t *testing.T) {
+	client := NewSMTPClientImpl(config.AccountConfig{Email: "test@example.com"})
+
+	msg, err := client.createMessage(models.Email{
+		From:        models.Address{Email: "sender@example.com"},
+		To:          []models.Address{{Email: "recipient@example.com"}},
+		Subject:     "Re: Threads",
+		TextContent: "Reply",
+		Date:        time.Now(),
+		MessageID:   "<reply@example.com>",
+		Headers: map[string]string{
+			"In-Reply-To": "<original@example.com>",
+			"References":  "<root@example.com> <original@example.com>",
+			"Subject":     "Duplicate",
+			"X-Note":      "one\r\nBcc: attacker@example.com",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create message: %v", err)
+	}
+
+	for _, want := range []string{
+		"In-Reply-To: <original@example.com>\r\n",
+		"References: <root@example.com> <original@example.com>\r\n",
+		"X-Note: one Bcc: attacker@example.com\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected message to contain %q", want)
+		}
+	}
+	if strings.Contains(msg, "Duplicate") {
+		t.Error("Expected generated headers not to be overridden")
+	}
+}
+
+// fakeSMTPServer is a minimal SMTP server that accepts any login. It drops the
+// connection on the first MAIL command when dropMail is set, refuses recipients at
+// reject.example.com, and refuses a MAIL command sent during a transaction.
+type fakeSMTPServer struct {
+	listener net.Listener
+	dropMail bool
+
+	mutex       sync.Mutex
+	connections int
+	messages    []string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &fakeSMTPServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	s.mutex.Lock()
+	s.connections++
+	s.mutex.Unlock()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+	inTransaction := false
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			text.PrintfLine("250-localhost")
+			text.PrintfLine("250 AUTH PLAIN")
+		case strings.HasPrefix(command, "AUTH"):
+			text.PrintfLine("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(command, "MAIL"):
+			s.mutex.Lock()
+			drop := s.dropMail
+			s.dropMail = false
+			s.mutex.Unlock()
+			if drop {
+				return
+			}
+			if inTransaction {
+				text.PrintfLine("503 5.5.1 Error: nested MAIL command")
+				continue
+			}
+			inTransaction = true
+			text.PrintfLine("250 2.1.0 Ok")
+		case strings.HasPrefix(command, "RCPT"):
+			if strings.Contains(command, "@REJECT.EXAMPLE.COM") {
+				text.PrintfLine("550 5.1.1 No such user")
+				continue
+			}
+			text.PrintfLine("250 2.1.5 Ok")
+		case command == "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mutex.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mutex.Unlock()
+			inTransaction = false
+			text.PrintfLine("250 2.0.0 Ok: queued")
+		case command == "RSET":
+			inTransaction = false
+			text.PrintfLine("250 2.0.0 Ok")
+		case command == "QUIT":
+			text.PrintfLine("221 2.0.0 Bye")
+			return
+		default:
+			text.PrintfLine("250 2.0.0 Ok")
+		}
+	}
+}
+
+// connectFakeSMTPServer returns an SMTP client connected to server
+func connectFakeSMTPServer(t *testing.T, server *fakeSMTPServer) *SMTPClientImpl {
+	cm, err := GetCredentialManager(filepath.Join(t.TempDir(), "master.key"))
+	if err != nil {
+		t.Fatalf("Failed to initialize credential manager: %v", err)
+	}
+
+	account := config.AccountConfig{
+		ID:    "test-account",
+		Email: "test@example.com",
+		SMTPConfig: config.SMTPConfig{
+			Server:   "127.0.0.1",
+			Port:     server.port(),
+			Username: "test@example.com",
+			Password: "password",
+		},
+		AuthType: "password",
+	}
+	if err := cm.EncryptCredentials(&account); err != nil {
+		t.Fatalf("Failed to encrypt credentials: %v", err)
+	}
+
+	client := NewSMTPClientImpl(account)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	return client
+}
+
+// TestSendEmailRecovers tests that a send reconnects when the connection is dropped
+// mid-send instead of deadlocking, and that a refused transaction is reset so the
+// next email is delivered
+func TestSendEmailRecovers(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	client := connectFakeSMTPServer(t, server)
+
+	send := func(to string) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- client.SendEmail(models.Email{
+				From:        models.Address{Email: "test@example.com"},
+				To:          []models.Address{{Email: to}},
+				Subject:     "Report for " + to,
+				TextContent: "Report",
+				Date:        time.Now(),
+			})
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Sending to %s hung", to)
+			return nil
+		}
+	}
+
+	// The connection is dropped on MAIL, and the email is sent again on a new one
+	server.mutex.Lock()
+	server.dropMail = true
+	server.mutex.Unlock()
+	if err := send("first@example.com"); err != nil {
+		t.Fatalf("Expected the email to be sent after reconnecting, got %v", err)
+	}
+
+	// A refused recipient fails the email permanently
+	if err := send("nobody@reject.example.com"); err == nil || !isPermanentSMTPError(err) {
+		t.Errorf("Expected a permanent error, got %v", err)
+	}
+
+	// The next email isn't refused as a nested MAIL command
+	if err := send("second@example.com"); err != nil {
+		t.Fatalf("Expected the next email to be sent, got %v", err)
+	}
+	client.Disconnect()
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.connections != 2 {
+		t.Errorf("Expected 2 connections, got %d", server.connections)
+	}
+	if len(server.messages) != 2 ||
+		!strings.Contains(server.messages[0], "Report for first@example.com") ||
+		!strings.Contains(server.messages[1], "Report for second@example.com") {
+		t.Errorf("Expected the first and second emails to be delivered, got %q", server.messages)
+	}
+}
+
+// TestSendEmailMessage tests that the message kept for the Sent folder is the one the
+// server received, also when it was sent again after reconnecting
+func TestSendEmailMessage(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	client := connectFakeSMTPServer(t, server)
+
+	server.mutex.Lock()
+	server.dropMail = true
+	server.mutex.Unlock()
+	msg, err := client.SendEmailMessage(models.Email{
+		From:        models.Address{Email: "test@example.com"},
+		To:          []models.Address{{Email: "first@example.com"}},
+		Subject:     "Report",
+		TextContent: "Report",
+		Date:        time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+	client.Disconnect()
+
+	raw, err := io.ReadAll(io.NewSectionReader(msg, 0, msg.Size()))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	server.mutex.Lock()
+	received := server.messages
+	server.mutex.Unlock()
+	// The server reads the message with LF line endings, ended by a line break
+	if len(received) != 1 || strings.ReplaceAll(string(raw), "\r\n", "\n") != strings.TrimSuffix(received[0], "\n") {
+		t.Errorf("Expected the message sent, got %q and %q", raw, received)
+	}
+
+	name := msg.file.Name()
+	if err := msg.Close(); err != nil {
+		t.Errorf("Failed to close message: %v", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Expected the message file to be removed, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"io"
 	"testing"
 
 	"github.com/user/email-bridge/internal/config"
@@ -87,6 +88,13 @@ func (m *mockSMTPClient) SendEmail(email models.Email) error {
 	return nil
 }
 
+func (m *mockSMTPClient) SendEmailMessage(email models.Email) (*MessageFile, error) {
+	if m.sendEmailErr != nil {
+		return nil, m.sendEmailErr
+	}
+	return NewMessageFile(func(w io.Writer) error { return nil })
+}
+
 // TestConnectionManagerWithSMTP tests the interaction between the connection manager and SMTP client
 func TestConnectionManagerWithSMTP(t *testing.T) {
 	// Create a connection manager
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// resyncFolder handles a folder whose UIDVALIDITY changed since it was last synced.
+// Email IDs are built from UIDs, so after the change the IDs of the folder's stored
+// emails may be those of other emails on the server. The stored emails are matched
+// with the folder's emails by Message-ID and re-keyed to their new UIDs; the ones that
+// can't be matched are removed. The folder's sync status is then deleted, so that the
+// next sync of the folder rebuilds it with a full sync.
+func (c *IMAPClientImpl) resyncFolder(s store.Store, folder string, accountID string, oldUIDValidity string, uidValidity uint32) error {
+	// Get all emails in this folder from the database
+	emails, err := s.SearchEmails(models.SearchCriteria{
+		AccountID: accountID,
+		Folder:    folder,
+		Limit:     0, // No limit
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get emails from database: %w", err)
+	}
+
+	var uids map[string][]uint32
+	if len(emails) > 0 {
+		if uids, err = c.fetchMessageUIDs(folder); err != nil {
+			return err
+		}
+	}
+
+	resync := remapEmails(accountID, emails, uids)
+	resync.OldUIDValidity = oldUIDValidity
+	resync.NewUIDValidity = formatUIDValidity(uidValidity)
+
+	fmt.Printf("Warning: UIDVALIDITY of folder %s changed from %s to %s, %d emails re-mapped and %d removed\n",
+		folder, resync.OldUIDValidity, resync.NewUIDValidity, len(resync.Remapped), len(resync.Removed))
+
+	if err := GetEmailEventHandler(s).HandleUIDValidityChanged(accountID, folder, resync); err != nil {
+		return fmt.Errorf("failed to re-map emails: %w", err)
+	}
+
+	// The sync status is deleted last, so that a resync whose re-map failed, which
+	// leaves the stored emails as they were, is tried again by the next sync
+	if err := s.DeleteSyncStatus(accountID, folder); err != nil {
+		return fmt.Errorf("failed to reset sync status: %w", err)
+	}
+
+	return nil
+}
+
+// fetchMessageUIDs selects a folder and returns the UIDs of its emails by Message-ID,
+// in increasing order. Emails without a Message-ID are left out.
+func (c *IMAPClientImpl) fetchMessageUIDs(folder string) (map[string][]uint32, error) {
+	c.mutex.Lock()
+	if !c.connected || c.client == nil {
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("not connected to IMAP server")
+	}
+
+	mbox, err := c.client.Select(folder, false)
+	if err != nil {
+		c.mutex.Unlock()
+		// Handle connection error
+		if c.handleConnectionError(err) {
+			// Try again once if it was a connection error that was fixed
+			return c.fetchMessageUIDs(folder)
+		}
+		return nil, fmt.Errorf("failed to select folder %s: %w", folder, err)
+	}
+
+	uids := make(map[string][]uint32)
+	if mbox.Messages == 0 {
+		c.mutex.Unlock()
+		return uids, nil
+	}
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddRange(1, 0)
+
+	// Define items to fetch (the envelope holds the Message-ID)
+	items := []imap.FetchItem{
+		imap.FetchUid,
+		imap.FetchEnvelope,
+	}
+
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.client.UidFetch(seqSet, items, messages)
+	}()
+	c.mutex.Unlock()
+
+	for msg := range messages {
+		if msg.Envelope == nil {
+			continue
+		}
+		messageID := strings.TrimSpace(msg.Envelope.MessageId)
+		if messageID == "" {
+			continue
+		}
+		uids[messageID] = append(uids[messageID], msg.Uid)
+	}
+
+	// Check for fetch error
+	if err := <-done; err != nil {
+		// Handle connection error
+		if c.handleConnectionError(err) {
+			// Try again once if it was a connection error that was fixed
+			return c.fetchMessageUIDs(folder)
+		}
+		return nil, fmt.Errorf("failed to fetch email Message-IDs: %w", err)
+	}
+
+	for _, messageUIDs := range uids {
+		sort.Slice(messageUIDs, func(i, j int) bool { return messageUIDs[i] < messageUIDs[j] })
+	}
+
+	return uids, nil
+}
+
+// remapEmails matches the stored emails of a folder with its emails on the server by
+// Message-ID, given the server's UIDs by Message-ID. When several emails share a
+// Message-ID, they are matched in the order of their old and new UIDs. Stored emails
+// whose ID isn't built from a UID of the account are left alone.
+func remapEmails(accountID string, emails []models.Email, uids map[string][]uint32) models.FolderResync {
+	resync := models.FolderResync{Remapped: make(map[string]string)}
+
+	// Sort the emails by old UID, so duplicates are matched in order
+	type storedEmail struct {
+		id        string
+		uid       uint32
+		messageID string
+	}
+	stored := make([]storedEmail, 0, len(emails))
+	for _, email := range emails {
+		uid, err := EmailUID(email.ID)
+		if err != nil || email.ID != fmt.Sprintf("%s-%d", accountID, uid) {
+			continue
+		}
+		stored = append(stored, storedEmail{id: email.ID, uid: uid, messageID: strings.TrimSpace(email.MessageID)})
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].uid < stored[j].uid })
+
+	matched := make(map[string]int)
+	for _, email := range stored {
+		candidates := uids[email.messageID]
+		if email.messageID == "" || matched[email.messageID] >= len(candidates) {
+			resync.Removed = append(resync.Removed, email.id)
+			continue
+		}
+
+		uid := candidates[matched[email.messageID]]
+		matched[email.messageID]++
+		resync.Remapped[email.id] = fmt.Sprintf("%s-%d", accountID, uid)
+	}
+
+	return resync
+}
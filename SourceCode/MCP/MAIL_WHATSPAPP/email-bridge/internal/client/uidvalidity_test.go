@@ -0,0 +1,172 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// TestIncrementalSyncUIDValidityRemap tests that when the server changes a folder's
+// UIDVALIDITY, the stored emails are re-keyed to their new UIDs by Message-ID, the ones
+// that are gone are removed, and the change is reported in a single event
+func TestIncrementalSyncUIDValidityRemap(t *testing.T) {
+	globalEventHandler = nil
+	defer func() { globalEventHandler = nil }()
+
+	date := time.Now().Add(-time.Hour)
+	s := &memoryStore{
+		emails: map[string]models.Email{
+			"acct-1": {ID: "acct-1", AccountID: "acct", Folder: "INBOX", MessageID: "<a@example.com>", IsRead: true},
+			"acct-2": {ID: "acct-2", AccountID: "acct", Folder: "INBOX", MessageID: "<b@example.com>"},
+			"acct-3": {ID: "acct-3", AccountID: "acct", Folder: "INBOX", MessageID: "<gone@example.com>"},
+			"acct-4": {ID: "acct-4", AccountID: "acct", Folder: "INBOX"},
+			"acct-9": {ID: "acct-9", AccountID: "acct", Folder: "Archive", MessageID: "<a@example.com>"},
+		},
+		syncStatus: map[string]store.SyncStatus{
+			"INBOX": {
+				AccountID: "acct", FolderID: "INBOX", LastSync: date,
+				UIDValidity: "12345", LastUID: 4, HighestModSeq: 10,
+			},
+		},
+	}
+	conn := &fakeIMAPConn{
+		folders: []string{"INBOX"},
+		emails: map[string][]fakeMessage{
+			// The UIDs of a and b were swapped, and c is a new email
+			"INBOX": {
+				{uid: 1, subject: "B", date: date, messageID: "<b@example.com>"},
+				{uid: 2, subject: "A", date: date, messageID: "<a@example.com>", isRead: true},
+				{uid: 3, subject: "C", date: date, messageID: "<c@example.com>"},
+			},
+		},
+		uidValidity: "67890",
+	}
+
+	var logged []EmailEvent
+	GetEmailEventHandler(s).SetEventLog(func(event EmailEvent) {
+		logged = append(logged, event)
+	})
+
+	var arrived []string
+	imapClient := &IMAPClientImpl{config: config.AccountConfig{ID: "acct"}, client: conn, connected: true}
+	err := imapClient.IncrementalSync(s, IncrementalSyncOptions{
+		AccountID: "acct",
+		Folder:    "INBOX",
+		BatchSize: 100,
+		OnNewEmail: func(email models.Email) {
+			arrived = append(arrived, email.ID)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error during incremental sync: %v", err)
+	}
+
+	expected := map[string]string{
+		"acct-1": "<b@example.com>",
+		"acct-2": "<a@example.com>",
+		"acct-3": "<c@example.com>",
+	}
+	for id, messageID := range expected {
+		if email, ok := s.emails[id]; !ok || email.MessageID != messageID {
+			t.Errorf("Expected %s to be %s, got %+v", id, messageID, email)
+		}
+	}
+	if !s.emails["acct-2"].IsRead || s.emails["acct-1"].IsRead {
+		t.Errorf("Expected the re-keyed emails to keep their state, got %+v", s.emails)
+	}
+	if _, ok := s.emails["acct-4"]; ok {
+		t.Errorf("Expected the email without a Message-ID to be removed")
+	}
+	if _, ok := s.emails["acct-9"]; !ok {
+		t.Errorf("Expected the email of another folder to be left alone")
+	}
+
+	// Only the email that wasn't stored before is new
+	if len(arrived) != 1 || arrived[0] != "acct-3" {
+		t.Errorf("Expected acct-3 to be reported new, got %v", arrived)
+	}
+
+	if len(logged) != 1 || logged[0].Type != FolderEventUIDValidityChanged || logged[0].Resync == nil {
+		t.Fatalf("Expected a single UIDVALIDITY change event, got %+v", logged)
+	}
+	resync := logged[0].Resync
+	if logged[0].AccountID != "acct" || logged[0].NewValue != "INBOX" ||
+		resync.OldUIDValidity != "12345" || resync.NewUIDValidity != "67890" {
+		t.Errorf("Unexpected event %+v", logged[0])
+	}
+	if len(resync.Remapped) != 2 || resync.Remapped["acct-1"] != "acct-2" || resync.Remapped["acct-2"] != "acct-1" {
+		t.Errorf("Unexpected re-mapped emails %v", resync.Remapped)
+	}
+	if len(resync.Removed) != 2 || resync.Removed[0] != "acct-3" || resync.Removed[1] != "acct-4" {
+		t.Errorf("Unexpected removed emails %v", resync.Removed)
+	}
+
+	status := s.syncStatus["INBOX"]
+	if status.UIDValidity != "67890" || status.LastUID != 3 || status.HighestModSeq != 0 {
+		t.Errorf("Expected the sync status to be rebuilt, got %+v", status)
+	}
+}
+
+// TestRemapEmails tests that emails sharing a Message-ID are matched in UID order
+func TestRemapEmails(t *testing.T) {
+	emails := []models.Email{
+		{ID: "acct-8", MessageID: "<dup@example.com>"},
+		{ID: "acct-5", MessageID: "<dup@example.com>"},
+		{ID: "acct-6", MessageID: "<dup@example.com>"},
+		{ID: "sent-1", MessageID: "<dup@example.com>"},
+	}
+	uids := map[string][]uint32{"<dup@example.com>": {2, 3}}
+
+	resync := remapEmails("acct", emails, uids)
+	if len(resync.Remapped) != 2 || resync.Remapped["acct-5"] != "acct-2" || resync.Remapped["acct-6"] != "acct-3" {
+		t.Errorf("Unexpected re-mapped emails %v", resync.Remapped)
+	}
+	if len(resync.Removed) != 1 || resync.Removed[0] != "acct-8" {
+		t.Errorf("Unexpected removed emails %v", resync.Removed)
+	}
+}
+
+// TestIncrementalSyncUIDValidityCollision tests that a re-map whose new ID is used by an
+// email of another folder fails without removing any stored email, and is tried again
+// by the next sync
+func TestIncrementalSyncUIDValidityCollision(t *testing.T) {
+	globalEventHandler = nil
+	defer func() { globalEventHandler = nil }()
+
+	date := time.Now().Add(-time.Hour)
+	s := &memoryStore{
+		emails: map[string]models.Email{
+			"acct-1": {ID: "acct-1", AccountID: "acct", Folder: "INBOX", MessageID: "<a@example.com>"},
+			"acct-3": {ID: "acct-3", AccountID: "acct", Folder: "INBOX", MessageID: "<gone@example.com>"},
+			"acct-2": {ID: "acct-2", AccountID: "acct", Folder: "Archive", MessageID: "<b@example.com>"},
+		},
+		syncStatus: map[string]store.SyncStatus{
+			"INBOX": {AccountID: "acct", FolderID: "INBOX", LastSync: date, UIDValidity: "12345", LastUID: 3},
+		},
+	}
+	conn := &fakeIMAPConn{
+		folders: []string{"INBOX"},
+		emails: map[string][]fakeMessage{
+			"INBOX": {{uid: 2, subject: "A", date: date, messageID: "<a@example.com>"}},
+		},
+		uidValidity: "67890",
+	}
+
+	imapClient := &IMAPClientImpl{config: config.AccountConfig{ID: "acct"}, client: conn, connected: true}
+	err := imapClient.IncrementalSync(s, IncrementalSyncOptions{AccountID: "acct", Folder: "INBOX", BatchSize: 100})
+	if err == nil {
+		t.Fatalf("Expected the collision with acct-2 to fail the sync")
+	}
+
+	for id, folder := range map[string]string{"acct-1": "INBOX", "acct-2": "Archive", "acct-3": "INBOX"} {
+		if email, ok := s.emails[id]; !ok || email.Folder != folder {
+			t.Errorf("Expected %s to be left in %s, got %+v", id, folder, email)
+		}
+	}
+	if status := s.syncStatus["INBOX"]; status.UIDValidity != "12345" {
+		t.Errorf("Expected the sync status to be kept for the next sync, got %+v", status)
+	}
+}
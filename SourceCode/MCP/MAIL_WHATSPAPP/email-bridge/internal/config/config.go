@@ -11,13 +11,27 @@ import (
 type Config struct {
 	Server   ServerConfig    `json:"server"`
 	Database DatabaseConfig  `json:"database"`
+	Storage  StorageConfig   `json:"storage"`
 	Accounts []AccountConfig `json:"accounts"`
+	Approval ApprovalConfig  `json:"approval"`
+	Recon    ReconConfig     `json:"recon"`
+	Events   EventsConfig    `json:"events"`
 }
 
 // ServerConfig represents the server configuration
 type ServerConfig struct {
 	Host string `json:"host"`
 	Port int    `json:"port"`
+	// Clients are the API clients and the bearer tokens they authenticate with. When
+	// any are set, every request but health checks needs one of the tokens.
+	Clients []APIClientConfig `json:"clients,omitempty"`
+}
+
+// APIClientConfig represents an API client, identified by the token it sends in the
+// Authorization header
+type APIClientConfig struct {
+	ID    string `json:"id"`
+	Token string `json:"token"`
 }
 
 // DatabaseConfig represents the database configuration
@@ -25,6 +39,57 @@ type DatabaseConfig struct {
 	Path string `json:"path"`
 }
 
+// StorageConfig represents the local file storage configuration
+type StorageConfig struct {
+	AttachmentsPath string `json:"attachments_path"`
+}
+
+// ApprovalConfig represents the policy for emails that need a person's approval before
+// they are sent
+type ApprovalConfig struct {
+	// Clients are the IDs of the API clients whose emails are held for approval. They
+	// must be among the server's clients, so that they can't avoid approval by leaving
+	// out or changing their identity.
+	Clients []string `json:"clients"`
+}
+
+// EventsConfig represents the log of email and folder events streamed to API clients
+type EventsConfig struct {
+	// RetentionDays is how long events are kept for clients to resume from. Defaults
+	// to 7.
+	RetentionDays int `json:"retention_days,omitempty"`
+}
+
+// ReconConfig represents the ingestion of reconciliation spreadsheets received as
+// email attachments
+type ReconConfig struct {
+	Backend ReconBackendConfig `json:"backend"`
+	Rules   []ReconRuleConfig  `json:"rules"`
+}
+
+// ReconBackendConfig represents the endpoint parsed spreadsheets are submitted to
+type ReconBackendConfig struct {
+	URL string `json:"url"`
+	// Headers are added to every request, for example an Authorization header
+	Headers map[string]string `json:"headers,omitempty"`
+	// TimeoutSeconds limits how long a submission may take. Defaults to 300.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// ReconRuleConfig represents a rule selecting the attachments to ingest. The patterns
+// are case-insensitive regular expressions, and an empty pattern matches anything.
+// Only .xlsx, .xlsb and .csv attachments are ingested.
+type ReconRuleConfig struct {
+	Name   string `json:"name"`
+	Source string `json:"source"` // passed to the backend, for example benow or brand
+	// Sender is matched against the sender's address and name
+	Sender   string `json:"sender,omitempty"`
+	Subject  string `json:"subject,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	// Sheet is the sheet to read. Defaults to the first sheet.
+	Sheet string `json:"sheet,omitempty"`
+}
+
 // AccountConfig represents an email account configuration
 type AccountConfig struct {
 	ID          string       `json:"id"`
@@ -34,6 +99,25 @@ type AccountConfig struct {
 	SMTPConfig  SMTPConfig   `json:"smtp_config"`
 	AuthType    string       `json:"auth_type"` // password, oauth
 	OAuthConfig *OAuthConfig `json:"oauth_config,omitempty"`
+	// Monitoring selects the folders watched for new emails. Only INBOX is watched
+	// when it is nil.
+	Monitoring *MonitoringConfig `json:"monitoring,omitempty"`
+}
+
+// MonitoringConfig represents how an account's folders are watched for new emails.
+// Servers supporting NOTIFY report new emails in all the folders on one connection.
+// Otherwise up to IdleConnections folders are watched with IDLE, one connection each,
+// and the other folders are polled with STATUS.
+type MonitoringConfig struct {
+	// Folders are the folders watched for new emails. Defaults to INBOX.
+	Folders []string `json:"folders,omitempty"`
+	// IdleConnections is how many folders may be watched with IDLE. Defaults to 2. A
+	// negative value opens no connection for watching and polls every folder, even
+	// when the server supports NOTIFY.
+	IdleConnections int `json:"idle_connections,omitempty"`
+	// PollIntervalSeconds is how often the folders that aren't watched are polled.
+	// Defaults to 60.
+	PollIntervalSeconds int `json:"poll_interval_seconds,omitempty"`
 }
 
 // IMAPConfig represents IMAP server configuration
@@ -61,6 +145,8 @@ type OAuthConfig struct {
 	RefreshToken string `json:"refresh_token"`
 	AccessToken  string `json:"access_token"`
 	Expiry       string `json:"expiry"`
+	// TokenURL is the provider's token endpoint. Gmail and Microsoft 365 servers are detected when empty.
+	TokenURL string `json:"token_url,omitempty"`
 }
 
 // DefaultConfig returns the default configuration
@@ -73,6 +159,9 @@ func DefaultConfig() Config {
 		Database: DatabaseConfig{
 			Path: "email_bridge.db",
 		},
+		Storage: StorageConfig{
+			AttachmentsPath: "attachments",
+		},
 		Accounts: []AccountConfig{},
 	}
 }
@@ -107,9 +196,38 @@ func LoadConfig(path string) (Config, error) {
 		return config, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid config file: %w", err)
+	}
+
 	return config, nil
 }
 
+// Validate checks that the API clients have IDs and distinct tokens, and that the
+// clients whose emails need approval are among them
+func (c Config) Validate() error {
+	clients := make(map[string]bool, len(c.Server.Clients))
+	tokens := make(map[string]bool, len(c.Server.Clients))
+	for _, client := range c.Server.Clients {
+		if client.ID == "" || client.Token == "" {
+			return fmt.Errorf("API clients need an id and a token")
+		}
+		if tokens[client.Token] {
+			return fmt.Errorf("API client %s shares its token with another client", client.ID)
+		}
+		clients[client.ID] = true
+		tokens[client.Token] = true
+	}
+
+	for _, clientID := range c.Approval.Clients {
+		if !clients[clientID] {
+			return fmt.Errorf("approval client %s is not one of the server's clients", clientID)
+		}
+	}
+
+	return nil
+}
+
 // SaveConfig saves the configuration to the specified file
 func SaveConfig(path string, config Config) error {
 	data, err := json.MarshalIndent(config, "", "  ")
@@ -0,0 +1,243 @@
+// Package events keeps a log of the email and folder events of the EmailEventHandler
+// and streams them to API clients. Every event is stored before it is sent, so a
+// client that reconnects can resume after the last event it received.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+const (
+	// DefaultRetention is how long events are kept in the log when no retention is
+	// configured
+	DefaultRetention = 7 * 24 * time.Hour
+
+	// subscriberBuffer is how many events a subscriber may fall behind before it is
+	// dropped
+	subscriberBuffer = 256
+	// replayPageSize is how many logged events are read at a time when a client resumes
+	replayPageSize = 500
+	// pruneInterval is how often events older than the retention are removed
+	pruneInterval = time.Hour
+)
+
+// ErrDropped is returned by Stream when the client fell too far behind the live
+// events. It can resume from the last event it received.
+var ErrDropped = errors.New("event stream fell behind")
+
+// Filter selects the events of an account or concerning a folder. Empty fields match
+// any event.
+type Filter struct {
+	AccountID string
+	Folder    string
+}
+
+// Matches reports whether an event passes the filter. An event concerns the folder of
+// its email and, for moves and renames, the folder it left.
+func (f Filter) Matches(event models.Event) bool {
+	if f.AccountID != "" && event.AccountID != f.AccountID {
+		return false
+	}
+	return f.Folder == "" || event.Folder == f.Folder || event.OldFolder == f.Folder
+}
+
+// subscriber receives the live events that match its filter
+type subscriber struct {
+	filter Filter
+	events chan models.Event
+}
+
+// Hub logs events and sends them to the clients streaming them
+type Hub struct {
+	store     store.Store
+	retention time.Duration
+
+	// heartbeatInterval is how long a stream may be idle before a heartbeat is sent
+	heartbeatInterval time.Duration
+
+	mutex       sync.Mutex
+	subscribers map[*subscriber]struct{}
+	lastPrune   time.Time
+}
+
+// NewHub creates a hub that logs events in the store and keeps them for the retention
+// period, or DefaultRetention if it isn't positive
+func NewHub(s store.Store, retention time.Duration) *Hub {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
+	return &Hub{
+		store:             s,
+		retention:         retention,
+		heartbeatInterval: 15 * time.Second,
+		subscribers:       make(map[*subscriber]struct{}),
+	}
+}
+
+// Record logs an event and sends it to the streams whose filter it matches. It is set
+// as the EmailEventHandler's event log, so events are recorded in the order they
+// happen. A stream that can't keep up is dropped rather than holding up the event.
+func (h *Hub) Record(emailEvent client.EmailEvent) {
+	event := NewEvent(emailEvent, time.Now())
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	id, err := h.store.AppendEvent(event)
+	if err != nil {
+		fmt.Printf("Warning: Failed to log %s event: %v\n", event.Type, err)
+		return
+	}
+	event.ID = id
+
+	for sub := range h.subscribers {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.events)
+		}
+	}
+
+	if event.CreatedAt.Sub(h.lastPrune) >= pruneInterval {
+		h.lastPrune = event.CreatedAt
+		if _, err := h.store.DeleteEventsBefore(event.CreatedAt.Add(-h.retention)); err != nil {
+			fmt.Printf("Warning: Failed to remove old events: %v\n", err)
+		}
+	}
+}
+
+// NewEvent converts an event of the EmailEventHandler to the form it is logged and sent
+// to clients in. The email's body is left out to keep events small; clients can get it
+// from the API.
+func NewEvent(emailEvent client.EmailEvent, now time.Time) models.Event {
+	event := models.Event{
+		Type:      string(emailEvent.Type),
+		AccountID: emailEvent.AccountID,
+		CreatedAt: now,
+	}
+
+	switch emailEvent.Type {
+	case client.FolderEventCreated:
+		event.Folder = emailEvent.NewValue
+	case client.FolderEventRenamed:
+		event.Folder = emailEvent.NewValue
+		event.OldFolder = emailEvent.OldValue
+	case client.FolderEventDeleted:
+		event.Folder = emailEvent.OldValue
+	case client.FolderEventSynced:
+		event.Folders = emailEvent.Folders
+	case client.FolderEventUIDValidityChanged:
+		event.Folder = emailEvent.NewValue
+		event.Resync = emailEvent.Resync
+	default:
+		email := emailEvent.Email
+		email.TextContent = ""
+		email.HtmlContent = ""
+		if emailEvent.Type == client.EmailEventMoved {
+			email.Folder = emailEvent.NewValue
+			event.OldFolder = emailEvent.OldValue
+		}
+		if event.AccountID == "" {
+			event.AccountID = email.AccountID
+		}
+		event.Folder = email.Folder
+		event.EmailID = email.ID
+		event.Email = &email
+	}
+
+	return event
+}
+
+// subscribe adds a subscriber for the live events matching a filter
+func (h *Hub) subscribe(filter Filter) *subscriber {
+	sub := &subscriber{
+		filter: filter,
+		events: make(chan models.Event, subscriberBuffer),
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe removes a subscriber, unless it was dropped already
+func (h *Hub) unsubscribe(sub *subscriber) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Stream sends the logged events matching a filter that come after the event with the
+// given ID, then the live ones, until the context is done. A negative ID only streams
+// live events. heartbeat is called when the stream has been idle for a while, so that
+// connections aren't closed by proxies and dead clients are noticed.
+//
+// Stream returns the context's error, the error of send or heartbeat, or ErrDropped.
+func (h *Hub) Stream(ctx context.Context, filter Filter, afterID int64, send func(models.Event) error, heartbeat func() error) error {
+	// Subscribe before reading the log, so no event falls between the two
+	sub := h.subscribe(filter)
+	defer h.unsubscribe(sub)
+
+	lastID := afterID
+	if afterID >= 0 {
+		for {
+			events, err := h.store.GetEventsAfter(lastID, filter.AccountID, filter.Folder, replayPageSize)
+			if err != nil {
+				return fmt.Errorf("failed to read event log: %w", err)
+			}
+			for _, event := range events {
+				if err := send(event); err != nil {
+					return err
+				}
+				lastID = event.ID
+			}
+			if len(events) < replayPageSize {
+				break
+			}
+		}
+	}
+
+	ticker := time.NewTicker(h.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-sub.events:
+			if !ok {
+				return ErrDropped
+			}
+			// Skip the events the replay already sent
+			if event.ID <= lastID {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+			lastID = event.ID
+			ticker.Reset(h.heartbeatInterval)
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+}
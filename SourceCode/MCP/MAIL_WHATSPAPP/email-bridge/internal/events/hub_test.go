@@ -0,0 +1,193 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// eventStore keeps the event log in memory
+type eventStore struct {
+	store.Store
+	mutex  sync.Mutex
+	events []models.Event
+	pruned []time.Time
+}
+
+func (s *eventStore) AppendEvent(event models.Event) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	event.ID = int64(len(s.events) + 1)
+	s.events = append(s.events, event)
+	return event.ID, nil
+}
+
+func (s *eventStore) GetEventsAfter(afterID int64, accountID, folder string, limit int) ([]models.Event, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	filter := Filter{AccountID: accountID, Folder: folder}
+	var events []models.Event
+	for _, event := range s.events {
+		if event.ID > afterID && filter.Matches(event) && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *eventStore) DeleteEventsBefore(before time.Time) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pruned = append(s.pruned, before)
+	return 0, nil
+}
+
+// stream streams the events of a hub in the background, returning the channel it
+// sends them to and a function that stops it and returns its error
+func stream(hub *Hub, filter Filter, afterID int64) (<-chan models.Event, func() error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan models.Event, 100)
+	done := make(chan error, 1)
+	go func() {
+		done <- hub.Stream(ctx, filter, afterID, func(event models.Event) error {
+			received <- event
+			return nil
+		}, func() error { return nil })
+	}()
+	return received, func() error {
+		cancel()
+		return <-done
+	}
+}
+
+// expectEvents waits for events with the given IDs
+func expectEvents(t *testing.T, received <-chan models.Event, ids ...int64) {
+	t.Helper()
+	for _, id := range ids {
+		select {
+		case event := <-received:
+			if event.ID != id {
+				t.Fatalf("Expected event %d, got %+v", id, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %d", id)
+		}
+	}
+}
+
+// waitForSubscribers waits until a hub has a number of subscribers
+func waitForSubscribers(t *testing.T, hub *Hub, count int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		hub.mutex.Lock()
+		n := len(hub.subscribers)
+		hub.mutex.Unlock()
+		if n == count {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d subscribers, got %d", count, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHub(t *testing.T) {
+	s := &eventStore{}
+	hub := NewHub(s, 0)
+
+	inbox := models.Email{ID: "acct-1", AccountID: "acct", Folder: "INBOX", Subject: "Settlement", TextContent: "body"}
+	hub.Record(client.EmailEvent{Type: client.EmailEventNew, Email: inbox})
+	hub.Record(client.EmailEvent{Type: client.EmailEventNew, Email: models.Email{ID: "other-1", AccountID: "other", Folder: "INBOX"}})
+
+	logged, _ := s.GetEventsAfter(0, "", "", 10)
+	if len(logged) != 2 || logged[0].Email == nil || logged[0].Email.Subject != "Settlement" || logged[0].Email.TextContent != "" ||
+		logged[0].AccountID != "acct" || logged[0].Folder != "INBOX" || logged[0].EmailID != "acct-1" {
+		t.Fatalf("Unexpected event log %+v", logged)
+	}
+	if len(s.pruned) != 1 {
+		t.Errorf("Expected old events to be pruned once, got %v", s.pruned)
+	}
+
+	// A client resuming from the start of the log gets the logged events of its account,
+	// then the live ones
+	received, stop := stream(hub, Filter{AccountID: "acct"}, 0)
+	expectEvents(t, received, 1)
+	waitForSubscribers(t, hub, 1)
+
+	hub.Record(client.EmailEvent{Type: client.EmailEventMoved, Email: inbox, OldValue: "INBOX", NewValue: "Archive"})
+	hub.Record(client.EmailEvent{Type: client.FolderEventCreated, AccountID: "other", NewValue: "Archive"})
+	hub.Record(client.EmailEvent{Type: client.FolderEventRenamed, AccountID: "acct", OldValue: "Archive", NewValue: "Old"})
+	expectEvents(t, received, 3, 5)
+	if err := stop(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the stream to end with the context, got %v", err)
+	}
+
+	moved, _ := s.GetEventsAfter(2, "", "", 1)
+	if moved[0].Folder != "Archive" || moved[0].OldFolder != "INBOX" || moved[0].Email.Folder != "Archive" {
+		t.Errorf("Unexpected moved event %+v", moved[0])
+	}
+
+	// A folder filter matches the folder an email or folder left
+	received, stop = stream(hub, Filter{Folder: "INBOX"}, 1)
+	expectEvents(t, received, 2, 3)
+	stop()
+
+	// Without an ID only live events are sent
+	received, stop = stream(hub, Filter{}, -1)
+	waitForSubscribers(t, hub, 1)
+	hub.Record(client.EmailEvent{Type: client.EmailEventDeleted, Email: inbox})
+	expectEvents(t, received, 6)
+	stop()
+	waitForSubscribers(t, hub, 0)
+}
+
+func TestHubDropsSlowStreams(t *testing.T) {
+	hub := NewHub(&eventStore{}, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	blocked := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- hub.Stream(ctx, Filter{}, -1, func(event models.Event) error {
+			<-blocked
+			return nil
+		}, func() error { return nil })
+	}()
+	waitForSubscribers(t, hub, 1)
+
+	// Recording never waits for the stream, which is dropped once its buffer is full
+	for i := 0; i < subscriberBuffer+2; i++ {
+		hub.Record(client.EmailEvent{Type: client.FolderEventCreated, AccountID: "acct", NewValue: "Folder"})
+	}
+	waitForSubscribers(t, hub, 0)
+	close(blocked)
+
+	select {
+	case err := <-done:
+		if err != ErrDropped {
+			t.Errorf("Expected ErrDropped, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the stream to end")
+	}
+}
+
+func TestHubHeartbeat(t *testing.T) {
+	hub := NewHub(&eventStore{}, 0)
+	hub.heartbeatInterval = 10 * time.Millisecond
+
+	failed := errors.New("client went away")
+	err := hub.Stream(context.Background(), Filter{}, -1, func(models.Event) error { return nil }, func() error { return failed })
+	if err != failed {
+		t.Errorf("Expected the heartbeat's error, got %v", err)
+	}
+}
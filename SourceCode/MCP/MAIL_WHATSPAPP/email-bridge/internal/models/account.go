@@ -36,8 +36,19 @@ type SMTPConfig struct {
 // OAuthConfig represents OAuth configuration
 type OAuthConfig struct {
 	ClientID     string    `json:"client_id"`
-	ClientSecret string    `json:"client_secret"`
-	RefreshToken string    `json:"refresh_token"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	AccessToken  string    `json:"access_token,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+	// TokenURL is the provider's token endpoint. Gmail and Microsoft 365 servers are detected when empty.
+	TokenURL string `json:"token_url,omitempty"`
+}
+
+// OAuthToken is the latest OAuth token obtained for an account.
+// Refreshed tokens are kept so they survive restarts.
+type OAuthToken struct {
+	AccountID    string    `json:"account_id"`
 	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
 	Expiry       time.Time `json:"expiry"`
 }
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Draft is an email composed through the API and saved for sending later. Each edit
+// saves a new revision, which replaces the previous one in the server's Drafts folder.
+type Draft struct {
+	ID        string `json:"id"`
+	AccountID string `json:"account_id"`
+	Email     Email  `json:"email"`
+	Revision  int    `json:"revision"`
+	// Folder and EmailID locate the latest revision on the server. They are empty
+	// when it is only stored locally, and EmailID is empty when its UID is unknown.
+	Folder    string    `json:"folder,omitempty"`
+	EmailID   string    `json:"email_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
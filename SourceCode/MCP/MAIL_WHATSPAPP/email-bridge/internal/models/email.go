@@ -22,6 +22,15 @@ type Email struct {
 	HasAttachments bool              `json:"has_attachments"`
 	Attachments    []Attachment      `json:"attachments,omitempty"`
 	Headers        map[string]string `json:"headers,omitempty"`
+
+	// Rank and Snippet are set on full-text search results. Lower ranks are better matches
+	// and the snippet highlights the matched words with <mark> tags.
+	Rank    float64 `json:"rank,omitempty"`
+	Snippet string  `json:"snippet,omitempty"`
+
+	// Cursor is set on search results. Passing it as SearchCriteria.Cursor continues
+	// the search after this email.
+	Cursor string `json:"-"`
 }
 
 // Address represents an email address with optional name
@@ -39,6 +48,8 @@ type Attachment struct {
 	Size        int64  `json:"size"`
 	ContentID   string `json:"content_id,omitempty"` // For inline attachments
 	Path        string `json:"path,omitempty"`       // Local storage path
+	Hash        string `json:"hash,omitempty"`       // SHA-256 of the content, hex encoded, once stored locally
+	Section     string `json:"section,omitempty"`    // IMAP body section of the MIME part
 }
 
 // SearchCriteria represents parameters for searching emails
@@ -55,6 +66,45 @@ type SearchCriteria struct {
 	IsRead         *bool     `json:"is_read"`
 	Limit          int       `json:"limit"`
 	Offset         int       `json:"offset"`
+	// SortBy is date, subject, from or relevance, and SortOrder asc or desc.
+	// Both default to relevance for full-text queries and newest first otherwise.
+	SortBy    string `json:"sort_by,omitempty"`
+	SortOrder string `json:"sort_order,omitempty"`
+	// Cursor continues a search after the email it was taken from
+	Cursor string `json:"cursor,omitempty"`
+	// Expression holds the parts of a parsed query that the fields above can't express,
+	// such as OR and NOT. Emails must match it as well as the fields.
+	Expression *SearchExpression `json:"expression,omitempty"`
+}
+
+// Search expression operators. A SearchExpression without an operator is a single term.
+const (
+	SearchAnd = "and"
+	SearchOr  = "or"
+	SearchNot = "not"
+)
+
+// Search term fields
+const (
+	SearchText     = "text"     // subject, bodies, addresses and attachment filenames
+	SearchFrom     = "from"     // sender name or address
+	SearchTo       = "to"       // To recipient name or address
+	SearchCc       = "cc"       // Cc recipient name or address
+	SearchSubject  = "subject"  // subject
+	SearchFolder   = "in"       // folder name
+	SearchHas      = "has"      // "attachment"
+	SearchIs       = "is"       // "read" or "unread"
+	SearchAfter    = "after"    // date, inclusive
+	SearchBefore   = "before"   // date, exclusive
+	SearchFilename = "filename" // attachment filename
+)
+
+// SearchExpression is a boolean combination of search terms
+type SearchExpression struct {
+	Op       string             `json:"op,omitempty"`
+	Children []SearchExpression `json:"children,omitempty"`
+	Field    string             `json:"field,omitempty"`
+	Value    string             `json:"value,omitempty"`
 }
 
 // EmailStatus represents the status of an email
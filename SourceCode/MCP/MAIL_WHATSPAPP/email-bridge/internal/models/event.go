@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Event is an email or folder event in the event log, as streamed to API clients. IDs
+// increase in the order events happened, so a client can resume after the last ID it
+// received. Events that aren't from the log, such as those posted to webhooks, have no
+// ID.
+type Event struct {
+	ID        int64  `json:"id,omitempty"`
+	Type      string `json:"type"`
+	AccountID string `json:"account_id,omitempty"`
+	// Folder is the email's folder, the folder it was moved to, or the folder that was
+	// created, renamed to or deleted
+	Folder string `json:"folder,omitempty"`
+	// OldFolder is the folder an email was moved from or a folder was renamed from
+	OldFolder string `json:"old_folder,omitempty"`
+	EmailID   string `json:"email_id,omitempty"`
+	// Email is the email the event is about, without its body
+	Email *Email `json:"email,omitempty"`
+	// Folders are the account's folders after a folder sync
+	Folders []Folder `json:"folders,omitempty"`
+	// Resync is how the folder's stored emails were re-mapped after its UIDVALIDITY
+	// changed
+	Resync    *FolderResync `json:"resync,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// FolderResync describes a folder resynced because the server changed its UIDVALIDITY,
+// which invalidates the UIDs the IDs of its stored emails are built from. The stored
+// emails found again on the server by their Message-ID are re-keyed to their new UIDs;
+// the others are removed and stored again by the sync as new emails.
+type FolderResync struct {
+	OldUIDValidity string `json:"old_uid_validity"`
+	NewUIDValidity string `json:"new_uid_validity"`
+	// Remapped maps the old IDs of the re-keyed emails to their new IDs
+	Remapped map[string]string `json:"remapped,omitempty"`
+	// Removed are the IDs of the emails that weren't found again
+	Removed []string `json:"removed,omitempty"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Outbox statuses
+const (
+	// OutboxPendingApproval messages are held until a person approves or rejects them
+	OutboxPendingApproval = "pending_approval"
+	// OutboxRejected messages were rejected by the person reviewing them
+	OutboxRejected = "rejected"
+	// OutboxQueued messages are waiting to be sent, or to be retried after a
+	// temporary failure
+	OutboxQueued = "queued"
+	// OutboxSending messages are being sent
+	OutboxSending = "sending"
+	// OutboxSent messages were accepted by the SMTP server
+	OutboxSent = "sent"
+	// OutboxBounced messages were permanently rejected by the SMTP server
+	OutboxBounced = "bounced"
+	// OutboxFailed messages kept failing temporarily until they ran out of attempts
+	OutboxFailed = "failed"
+	// OutboxCancelled messages were cancelled before they were sent
+	OutboxCancelled = "cancelled"
+)
+
+// OutboxMessage is an email queued for sending
+type OutboxMessage struct {
+	ID          string     `json:"id"`
+	AccountID   string     `json:"account_id"`
+	Email       Email      `json:"email"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	SendAt      *time.Time `json:"send_at,omitempty"` // set on scheduled messages
+	NextAttempt time.Time  `json:"next_attempt"`
+	CreatedAt   time.Time  `json:"created_at"`
+	SentAt      *time.Time `json:"sent_at,omitempty"`
+}
+
+// Outbox audit actions
+const (
+	// AuditSubmitted records a message submitted for approval
+	AuditSubmitted = "submitted"
+	// AuditEdited records a reviewer's edit of a message pending approval
+	AuditEdited = "edited"
+	// AuditApproved records the approval of a message, with the email that was approved
+	AuditApproved = "approved"
+	// AuditRejected records the rejection of a message
+	AuditRejected = "rejected"
+	// AuditCancelled records the withdrawal of a message pending approval
+	AuditCancelled = "cancelled"
+)
+
+// OutboxAuditEntry records an action on an outbox message held for approval
+type OutboxAuditEntry struct {
+	ID       int64  `json:"id"`
+	OutboxID string `json:"outbox_id"`
+	Action   string `json:"action"`
+	// Actor is the API client that took the action
+	Actor string `json:"actor"`
+	Note  string `json:"note,omitempty"`
+	// Email is the email as it was after the action, if the action concerned its content
+	Email     *Email    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Recon job statuses
+const (
+	// ReconQueued jobs are waiting to be processed, or to be retried
+	ReconQueued = "queued"
+	// ReconProcessing jobs are being parsed and submitted
+	ReconProcessing = "processing"
+	// ReconSubmitted jobs were accepted by the recon backend
+	ReconSubmitted = "submitted"
+	// ReconFailed jobs could not be downloaded, parsed or submitted
+	ReconFailed = "failed"
+)
+
+// ReconJob tracks the ingestion of a reconciliation spreadsheet received as an email
+// attachment: it is saved, parsed into rows and submitted to the recon backend
+type ReconJob struct {
+	ID           string `json:"id"`
+	AccountID    string `json:"account_id"`
+	EmailID      string `json:"email_id"`
+	AttachmentID string `json:"attachment_id"`
+	// Rule is the name of the ingestion rule that matched the attachment, and Source
+	// the source it assigns the file to, such as benow or brand
+	Rule     string `json:"rule"`
+	Source   string `json:"source,omitempty"`
+	Filename string `json:"filename"`
+	// Path and Hash locate the saved file once it has been downloaded
+	Path string `json:"path,omitempty"`
+	Hash string `json:"hash,omitempty"`
+	// Sheet is the sheet that was read; the rule's sheet or the first one
+	Sheet       string     `json:"sheet,omitempty"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	Rows        int        `json:"rows"` // records submitted, not counting the header row
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+}
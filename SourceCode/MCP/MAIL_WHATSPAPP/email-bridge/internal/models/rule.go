@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Mail rule action types
+const (
+	// RuleActionMove moves the email to Folder. It runs after the other actions, since
+	// the email gets a new ID in the destination folder.
+	RuleActionMove = "move"
+	// RuleActionMarkRead marks the email as read
+	RuleActionMarkRead = "mark_read"
+	// RuleActionFlag sets the \Flagged flag
+	RuleActionFlag = "flag"
+	// RuleActionForward forwards the email to To through the outbox
+	RuleActionForward = "forward"
+	// RuleActionTag sets Tag as an IMAP keyword
+	RuleActionTag = "tag"
+	// RuleActionWebhook posts the email as JSON to URL
+	RuleActionWebhook = "webhook"
+	// RuleActionExtractAttachments downloads the attachments into the attachment store
+	RuleActionExtractAttachments = "extract_attachments"
+)
+
+// MailRule is a server-side filter: the actions of an enabled rule run on each new
+// email that meets all of its conditions
+type MailRule struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// AccountID limits the rule to the emails of an account; empty applies it to all
+	AccountID string `json:"account_id,omitempty"`
+	Enabled   bool   `json:"enabled"`
+	// Rules are evaluated by ascending priority. A matching rule with StopProcessing
+	// set keeps the rules after it from being evaluated.
+	Priority       int            `json:"priority"`
+	StopProcessing bool           `json:"stop_processing"`
+	Conditions     RuleConditions `json:"conditions"`
+	Actions        []RuleAction   `json:"actions"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+// RuleConditions are the case-insensitive regular expressions an email must match.
+// Empty conditions match any email.
+type RuleConditions struct {
+	From    string `json:"from,omitempty"`    // sender name or address
+	To      string `json:"to,omitempty"`      // name or address of a To or Cc recipient
+	Subject string `json:"subject,omitempty"` // subject
+	Body    string `json:"body,omitempty"`    // text or HTML content
+	// Headers maps header names to the pattern their value must match. A header the
+	// email doesn't have doesn't match.
+	Headers map[string]string `json:"headers,omitempty"`
+	// With any of the attachment conditions set, the email must have an attachment
+	// that meets all of them. AttachmentType matches the content type or filename and
+	// the sizes are in bytes.
+	AttachmentType    string `json:"attachment_type,omitempty"`
+	MinAttachmentSize int64  `json:"min_attachment_size,omitempty"`
+	MaxAttachmentSize int64  `json:"max_attachment_size,omitempty"`
+}
+
+// RuleAction is an action of a mail rule. Only the fields of its type are used.
+type RuleAction struct {
+	Type   string    `json:"type"`
+	Folder string    `json:"folder,omitempty"` // move
+	To     []Address `json:"to,omitempty"`     // forward
+	Tag    string    `json:"tag,omitempty"`    // tag
+	URL    string    `json:"url,omitempty"`    // webhook
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	// WebhookDeliveryQueued deliveries are waiting to be sent, or to be retried after
+	// a failure
+	WebhookDeliveryQueued = "queued"
+	// WebhookDeliverySending deliveries are being sent
+	WebhookDeliverySending = "sending"
+	// WebhookDeliveryDelivered deliveries got a 2xx response
+	WebhookDeliveryDelivered = "delivered"
+	// WebhookDeliveryDead deliveries ran out of attempts, or their webhook was disabled.
+	// They stay in the dead-letter list until they are replayed.
+	WebhookDeliveryDead = "dead"
+)
+
+// Webhook is a subscription of an HTTP endpoint to email and folder events. Each event
+// it subscribes to is posted to URL as JSON, signed with Secret.
+type Webhook struct {
+	ID string `json:"id"`
+	// AccountID limits the webhook to the events of an account; empty subscribes to all
+	AccountID string `json:"account_id,omitempty"`
+	// EventTypes are the event types posted, such as new or moved; empty posts all
+	EventTypes []string `json:"event_types,omitempty"`
+	URL        string   `json:"url"`
+	// Secret is the HMAC-SHA256 key of the signatures. The API only returns it when a
+	// webhook is created.
+	Secret    string    `json:"secret,omitempty"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is the delivery of an event to a webhook
+type WebhookDelivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	AccountID string `json:"account_id,omitempty"`
+	EventType string `json:"event_type"`
+	// Payload is the JSON body posted to the webhook
+	Payload  json.RawMessage `json:"payload"`
+	Status   string          `json:"status"`
+	Attempts int             `json:"attempts"`
+	// LastError is the error of the last attempt if it failed
+	LastError string `json:"last_error,omitempty"`
+	// ResponseStatus is the HTTP status of the last response
+	ResponseStatus int        `json:"response_status,omitempty"`
+	NextAttempt    time.Time  `json:"next_attempt"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,153 @@
+package recon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/spreadsheet"
+)
+
+// defaultBackendTimeout limits a submission when the backend configures no timeout
+const defaultBackendTimeout = 5 * time.Minute
+
+// submission is the description of a file sent to the recon backend ahead of its rows
+type submission struct {
+	JobID     string   `json:"job_id"`
+	Rule      string   `json:"rule"`
+	Source    string   `json:"source,omitempty"`
+	AccountID string   `json:"account_id"`
+	EmailID   string   `json:"email_id"`
+	Sender    string   `json:"sender"`
+	Subject   string   `json:"subject"`
+	Filename  string   `json:"filename"`
+	Hash      string   `json:"hash,omitempty"`
+	Sheet     string   `json:"sheet"`
+	Headers   []string `json:"headers"`
+}
+
+// backend submits parsed spreadsheets to the recon backend
+type backend struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// newBackend creates a backend from its configuration
+func newBackend(cfg config.ReconBackendConfig) *backend {
+	timeout := defaultBackendTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	return &backend{url: cfg.URL, headers: cfg.Headers, client: &http.Client{Timeout: timeout}}
+}
+
+// submit posts the records of a table as JSON and returns how many were sent. The body
+// is the submission with a "rows" array added, each row holding one value per header.
+// Rows are streamed as they are read, so large files are never held in memory.
+func (b *backend) submit(job models.ReconJob, email models.Email, table *spreadsheet.Table) (int, error) {
+	head, err := json.Marshal(submission{
+		JobID:     job.ID,
+		Rule:      job.Rule,
+		Source:    job.Source,
+		AccountID: job.AccountID,
+		EmailID:   job.EmailID,
+		Sender:    email.From.Email,
+		Subject:   email.Subject,
+		Filename:  job.Filename,
+		Hash:      job.Hash,
+		Sheet:     job.Sheet,
+		Headers:   nonNil(table.Headers()),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode submission: %w", err)
+	}
+
+	body, pw := io.Pipe()
+	written := make(chan int, 1)
+	go func() {
+		rows, err := writeRows(pw, head, table)
+		written <- rows
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, b.url, body)
+	if err != nil {
+		body.Close()
+		<-written
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range b.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := b.client.Do(req)
+	// Stop the writer if the request ended before the body was read
+	body.Close()
+	rows := <-written
+	if err != nil {
+		return 0, fmt.Errorf("failed to submit to recon backend: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("recon backend returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if err := table.Err(); err != nil {
+		return 0, err
+	}
+
+	return rows, nil
+}
+
+// writeRows writes the submission with the records of a table added as "rows"
+func writeRows(w io.Writer, head []byte, table *spreadsheet.Table) (int, error) {
+	// Replace the closing brace of the submission with the rows
+	var buf bytes.Buffer
+	buf.Write(head[:len(head)-1])
+	buf.WriteString(`,"rows":[`)
+
+	rows := 0
+	for table.Next() {
+		if rows > 0 {
+			buf.WriteByte(',')
+		}
+		record, err := json.Marshal(table.Record())
+		if err != nil {
+			return rows, fmt.Errorf("failed to encode row %d: %w", table.Number(), err)
+		}
+		buf.Write(record)
+		rows++
+
+		// Write in chunks rather than one row at a time
+		if buf.Len() >= 64*1024 {
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return rows, err
+			}
+			buf.Reset()
+		}
+	}
+	if err := table.Err(); err != nil {
+		return rows, err
+	}
+
+	buf.WriteString("]}")
+	_, err := w.Write(buf.Bytes())
+	return rows, err
+}
+
+// nonNil returns an empty slice for a nil one, so it is encoded as [] rather than null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,347 @@
+// Package recon ingests the reconciliation spreadsheets, such as Benow and brand
+// settlement files, that arrive as email attachments. Configured rules select the
+// attachments of new emails by sender, subject and filename; each selected file gets a
+// job that saves it, parses it into rows and submits them to the recon backend.
+package recon
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/spreadsheet"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// ErrJobNotFailed is returned when retrying a job that has not failed
+var ErrJobNotFailed = errors.New("recon job has not failed")
+
+// Ingester queues a job for each attachment of a new email that matches a rule and
+// processes the jobs one at a time in the background. Failed jobs stay failed until
+// they are retried.
+type Ingester struct {
+	store       store.Store
+	rules       []rule
+	backend     *backend
+	attachments *client.AttachmentStore
+
+	// imapClient returns the IMAP client of an account, for attachments that have not
+	// been downloaded yet
+	imapClient func(accountID string) (client.IMAPClient, bool)
+
+	mutex    sync.Mutex
+	queueMu  sync.Mutex
+	wake     chan struct{}
+	stopChan chan struct{}
+	done     chan struct{}
+	running  bool
+}
+
+// NewIngester creates an ingester for the configured rules, saving attachments in the
+// attachment directory
+func NewIngester(s store.Store, cfg config.ReconConfig, attachmentDir string) (*Ingester, error) {
+	if attachmentDir == "" {
+		attachmentDir = "attachments"
+	}
+	if cfg.Backend.URL == "" {
+		return nil, fmt.Errorf("recon backend URL not configured")
+	}
+	rules, err := compileRules(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ingester{
+		store:       s,
+		rules:       rules,
+		backend:     newBackend(cfg.Backend),
+		attachments: client.NewAttachmentStore(attachmentDir),
+		imapClient:  accountIMAPClient,
+		wake:        make(chan struct{}, 1),
+	}, nil
+}
+
+// accountIMAPClient returns the IMAP client registered for an account
+func accountIMAPClient(accountID string) (client.IMAPClient, bool) {
+	c, ok := client.GetConnectionManager().GetClient(fmt.Sprintf("imap-%s", accountID))
+	if !ok {
+		return nil, false
+	}
+	imapClient, ok := c.(client.IMAPClient)
+	return imapClient, ok
+}
+
+// HandleEvent queues a job for each attachment of a new email that matches a rule. The
+// first matching rule applies, and an attachment that already has a job is skipped.
+func (in *Ingester) HandleEvent(event client.EmailEvent) {
+	if event.Type != client.EmailEventNew {
+		return
+	}
+
+	queued := false
+	for _, attachment := range event.Email.Attachments {
+		for _, r := range in.rules {
+			if !r.matches(event.Email, attachment) {
+				continue
+			}
+			if in.queue(event.Email, attachment, r) {
+				queued = true
+			}
+			break
+		}
+	}
+
+	if queued {
+		in.Notify()
+	}
+}
+
+// queue creates the job of an attachment unless it has one, reporting whether it did
+func (in *Ingester) queue(email models.Email, attachment models.Attachment, r rule) bool {
+	in.queueMu.Lock()
+	defer in.queueMu.Unlock()
+
+	_, err := in.store.GetReconJobByAttachment(attachment.ID)
+	if err == nil {
+		return false
+	}
+	if err != sql.ErrNoRows {
+		fmt.Printf("Warning: Failed to look up recon job of attachment %s: %v\n", attachment.ID, err)
+		return false
+	}
+
+	now := time.Now()
+	job := models.ReconJob{
+		ID:           fmt.Sprintf("recon_%d", now.UnixNano()),
+		AccountID:    email.AccountID,
+		EmailID:      email.ID,
+		AttachmentID: attachment.ID,
+		Rule:         r.name,
+		Source:       r.source,
+		Filename:     attachment.Filename,
+		Sheet:        r.sheet,
+		Status:       models.ReconQueued,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := in.store.StoreReconJob(job); err != nil {
+		fmt.Printf("Warning: Failed to queue recon job for %s: %v\n", attachment.Filename, err)
+		return false
+	}
+	return true
+}
+
+// Start starts processing queued jobs in the background, resuming any job whose
+// processing was interrupted
+func (in *Ingester) Start() {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+
+	if in.running {
+		return
+	}
+
+	in.running = true
+	in.stopChan = make(chan struct{})
+	in.done = make(chan struct{})
+	go in.run(in.stopChan, in.done)
+}
+
+// Stop stops the ingester, waiting for a job being processed to finish
+func (in *Ingester) Stop() {
+	in.mutex.Lock()
+	if !in.running {
+		in.mutex.Unlock()
+		return
+	}
+	in.running = false
+	close(in.stopChan)
+	done := in.done
+	in.mutex.Unlock()
+
+	<-done
+}
+
+// Notify wakes the ingester to process newly queued jobs
+func (in *Ingester) Notify() {
+	select {
+	case in.wake <- struct{}{}:
+	default:
+		// A wake-up is already pending
+	}
+}
+
+// run processes queued jobs until stopChan is closed
+func (in *Ingester) run(stopChan <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	in.processJobs(stopChan, models.ReconProcessing)
+	for {
+		in.processJobs(stopChan, models.ReconQueued)
+
+		select {
+		case <-stopChan:
+			return
+		case <-in.wake:
+		}
+	}
+}
+
+// processJobs processes the jobs with a status in the order they were queued
+func (in *Ingester) processJobs(stopChan <-chan struct{}, status string) {
+	jobs, err := in.store.GetReconJobs(status)
+	if err != nil {
+		fmt.Printf("Warning: Failed to load recon jobs: %v\n", err)
+		return
+	}
+
+	for _, job := range jobs {
+		select {
+		case <-stopChan:
+			return
+		default:
+		}
+		in.process(job)
+	}
+}
+
+// process makes one attempt to ingest a job's file and records the outcome
+func (in *Ingester) process(job models.ReconJob) {
+	job.Status = models.ReconProcessing
+	job.Attempts++
+	job.UpdatedAt = time.Now()
+	if err := in.store.StoreReconJob(job); err != nil {
+		fmt.Printf("Warning: Failed to update recon job %s: %v\n", job.ID, err)
+		return
+	}
+
+	rows, err := in.ingest(&job)
+	now := time.Now()
+	job.UpdatedAt = now
+	if err != nil {
+		job.Status = models.ReconFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = models.ReconSubmitted
+		job.Error = ""
+		job.Rows = rows
+		job.SubmittedAt = &now
+	}
+
+	if err := in.store.StoreReconJob(job); err != nil {
+		fmt.Printf("Warning: Failed to update recon job %s: %v\n", job.ID, err)
+	}
+}
+
+// ingest saves a job's file, parses the sheet and submits its rows, returning how many
+// were submitted
+func (in *Ingester) ingest(job *models.ReconJob) (int, error) {
+	email, err := in.store.GetEmail(job.EmailID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get email %s: %w", job.EmailID, err)
+	}
+	if err := in.download(job, email); err != nil {
+		return 0, err
+	}
+
+	// Saved files are named by their hash, so the format comes from the filename
+	format, ok := spreadsheet.FormatOf(job.Filename)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", spreadsheet.ErrUnsupportedFormat, job.Filename)
+	}
+	workbook, err := spreadsheet.OpenFormat(job.Path, format)
+	if err != nil {
+		return 0, err
+	}
+	defer workbook.Close()
+
+	sheet, err := workbook.Sheet(job.Sheet)
+	if err != nil {
+		return 0, err
+	}
+	job.Sheet = sheet
+
+	rows, err := workbook.Rows(sheet)
+	if err != nil {
+		return 0, err
+	}
+	table, err := spreadsheet.NewTable(rows)
+	if err != nil {
+		rows.Close()
+		return 0, err
+	}
+	defer table.Close()
+
+	return in.backend.submit(*job, email, table)
+}
+
+// download saves the attachment of a job, fetching it from the IMAP server unless it
+// has already been downloaded, and records where it was saved
+func (in *Ingester) download(job *models.ReconJob, email models.Email) error {
+	attachment, err := in.store.GetAttachment(job.AttachmentID)
+	if err != nil {
+		return fmt.Errorf("failed to get attachment %s: %w", job.AttachmentID, err)
+	}
+
+	if !fileExists(attachment.Path) {
+		if attachment, err = in.fetch(email, attachment); err != nil {
+			return err
+		}
+	}
+
+	job.Path = attachment.Path
+	job.Hash = attachment.Hash
+	return nil
+}
+
+// fetch downloads an attachment from the IMAP server into the attachment store and
+// records its path and hash
+func (in *Ingester) fetch(email models.Email, attachment models.Attachment) (models.Attachment, error) {
+	imapClient, ok := in.imapClient(email.AccountID)
+	if !ok || imapClient == nil {
+		return attachment, fmt.Errorf("no IMAP client for account %s", email.AccountID)
+	}
+	return in.attachments.Download(in.store, imapClient, email, attachment)
+}
+
+// fileExists reports whether a regular file exists at the given path
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Retry queues a failed job again. It returns sql.ErrNoRows if there is no such job
+// and ErrJobNotFailed if it is queued, being processed or was submitted.
+func (in *Ingester) Retry(id string) (models.ReconJob, error) {
+	in.queueMu.Lock()
+	job, err := in.store.GetReconJob(id)
+	if err != nil {
+		in.queueMu.Unlock()
+		return job, err
+	}
+	if job.Status != models.ReconFailed {
+		in.queueMu.Unlock()
+		return job, ErrJobNotFailed
+	}
+
+	job.Status = models.ReconQueued
+	job.Error = ""
+	job.UpdatedAt = time.Now()
+	err = in.store.StoreReconJob(job)
+	in.queueMu.Unlock()
+	if err != nil {
+		return job, err
+	}
+
+	in.Notify()
+	return job, nil
+}
@@ -0,0 +1,416 @@
+package recon
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// reconStore keeps emails, attachments and recon jobs in memory
+type reconStore struct {
+	store.Store
+	mutex       sync.Mutex
+	emails      map[string]models.Email
+	attachments map[string]models.Attachment
+	jobs        map[string]models.ReconJob
+}
+
+func newReconStore() *reconStore {
+	return &reconStore{
+		emails:      make(map[string]models.Email),
+		attachments: make(map[string]models.Attachment),
+		jobs:        make(map[string]models.ReconJob),
+	}
+}
+
+// addEmail stores an email and its attachments
+func (s *reconStore) addEmail(email models.Email) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.emails[email.ID] = email
+	for _, attachment := range email.Attachments {
+		s.attachments[attachment.ID] = attachment
+	}
+}
+
+func (s *reconStore) GetEmail(id string) (models.Email, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	email, ok := s.emails[id]
+	if !ok {
+		return email, sql.ErrNoRows
+	}
+	return email, nil
+}
+
+func (s *reconStore) StoreAttachment(attachment models.Attachment) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attachments[attachment.ID] = attachment
+	return nil
+}
+
+func (s *reconStore) GetAttachment(id string) (models.Attachment, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	attachment, ok := s.attachments[id]
+	if !ok {
+		return attachment, sql.ErrNoRows
+	}
+	return attachment, nil
+}
+
+func (s *reconStore) StoreReconJob(job models.ReconJob) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *reconStore) GetReconJob(id string) (models.ReconJob, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return job, sql.ErrNoRows
+	}
+	return job, nil
+}
+
+func (s *reconStore) GetReconJobs(status string) ([]models.ReconJob, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var jobs []models.ReconJob
+	for _, job := range s.jobs {
+		if status == "" || job.Status == status {
+			jobs = append(jobs, job)
+		}
+	}
+	// In the order they were queued, like the SQLite store
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+func (s *reconStore) GetReconJobByAttachment(attachmentID string) (models.ReconJob, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, job := range s.jobs {
+		if job.AttachmentID == attachmentID {
+			return job, nil
+		}
+	}
+	return models.ReconJob{}, sql.ErrNoRows
+}
+
+// attachmentIMAPClient serves attachment content from memory
+type attachmentIMAPClient struct {
+	client.IMAPClient
+	content map[string]string
+}
+
+func (c *attachmentIMAPClient) IsConnected() bool { return true }
+
+func (c *attachmentIMAPClient) GetAttachment(folder string, attachment models.Attachment) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(c.content[attachment.ID])), nil
+}
+
+// reconBackend records the submissions it receives, failing while fail is set
+type reconBackend struct {
+	mutex       sync.Mutex
+	submissions []map[string]interface{}
+	fail        bool
+}
+
+func (b *reconBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer recon-token" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if b.fail {
+		http.Error(w, "recon database unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	var submission map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b.submissions = append(b.submissions, submission)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// waitForJob waits until a job reaches a status
+func waitForJob(t *testing.T, s *reconStore, id string, status string) models.ReconJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := s.GetReconJob(id)
+		if err == nil && job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job %s did not become %s: %+v (%v)", id, status, job, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+const settlementCSV = "txn_ref_number,Paid Amount,BANKDATETIME\n" +
+	"TXXER00000002438,11618,2025-04-22\n" +
+	"\n" +
+	"TXXER00000002439,12018,2025-04-22\n"
+
+func TestIngester(t *testing.T) {
+	dir := t.TempDir()
+	savedPath := filepath.Join(dir, "saved.csv")
+	if err := os.WriteFile(savedPath, []byte(settlementCSV), 0600); err != nil {
+		t.Fatalf("Failed to write attachment: %v", err)
+	}
+
+	backend := &reconBackend{}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	s := newReconStore()
+	ingester, err := NewIngester(s, config.ReconConfig{
+		Backend: config.ReconBackendConfig{
+			URL:     server.URL,
+			Headers: map[string]string{"Authorization": "Bearer recon-token"},
+		},
+		Rules: []config.ReconRuleConfig{
+			{Name: "benow", Source: "benow", Sender: `@benow\.in$`, Filename: `^benow`},
+			{Name: "brand", Source: "brand", Subject: "settlement"},
+		},
+	}, filepath.Join(dir, "attachments"))
+	if err != nil {
+		t.Fatalf("NewIngester failed: %v", err)
+	}
+	imapClient := &attachmentIMAPClient{content: map[string]string{"brand-1-1": settlementCSV}}
+	ingester.imapClient = func(accountID string) (client.IMAPClient, bool) {
+		return imapClient, accountID == "acct"
+	}
+
+	benow := models.Email{
+		ID:        "benow-1",
+		AccountID: "acct",
+		Folder:    "INBOX",
+		From:      models.Address{Email: "recon@benow.in"},
+		Subject:   "Daily file",
+		Attachments: []models.Attachment{
+			{ID: "benow-1-1", EmailID: "benow-1", Filename: "Benow File 1.csv", Path: savedPath, Hash: "saved"},
+			{ID: "benow-1-2", EmailID: "benow-1", Filename: "Benow summary.pdf"},
+		},
+	}
+	brand := models.Email{
+		ID:        "brand-1",
+		AccountID: "acct",
+		Folder:    "INBOX",
+		From:      models.Address{Name: "Brand Finance", Email: "finance@brand.example"},
+		Subject:   "Weekly Settlement",
+		Attachments: []models.Attachment{
+			{ID: "brand-1-1", EmailID: "brand-1", Filename: "settlement.csv"},
+		},
+	}
+	other := models.Email{
+		ID:          "other-1",
+		AccountID:   "acct",
+		From:        models.Address{Email: "someone@example.com"},
+		Subject:     "Photos",
+		Attachments: []models.Attachment{{ID: "other-1-1", EmailID: "other-1", Filename: "list.csv"}},
+	}
+	for _, email := range []models.Email{benow, brand, other} {
+		s.addEmail(email)
+		ingester.HandleEvent(client.EmailEvent{Type: client.EmailEventNew, Email: email})
+	}
+	// Events for an email seen again don't queue another job
+	ingester.HandleEvent(client.EmailEvent{Type: client.EmailEventNew, Email: benow})
+	ingester.HandleEvent(client.EmailEvent{Type: client.EmailEventDeleted, Email: brand})
+
+	jobs, _ := s.GetReconJobs("")
+	if len(jobs) != 2 {
+		t.Fatalf("Expected a job for the Benow and brand files, got %+v", jobs)
+	}
+	jobIDs := make(map[string]string)
+	for _, job := range jobs {
+		if job.Status != models.ReconQueued {
+			t.Errorf("Expected job %s to be queued, got %s", job.ID, job.Status)
+		}
+		jobIDs[job.Rule] = job.ID
+	}
+	if jobIDs["benow"] == "" || jobIDs["brand"] == "" {
+		t.Fatalf("Expected jobs for both rules, got %+v", jobs)
+	}
+
+	ingester.Start()
+	defer ingester.Stop()
+
+	job := waitForJob(t, s, jobIDs["benow"], models.ReconSubmitted)
+	if job.Rows != 2 || job.Sheet != "saved" || job.Path != savedPath || job.Attempts != 1 || job.SubmittedAt == nil {
+		t.Errorf("Unexpected Benow job %+v", job)
+	}
+
+	// The brand file is fetched from the server and saved by its hash
+	job = waitForJob(t, s, jobIDs["brand"], models.ReconSubmitted)
+	attachment, _ := s.GetAttachment("brand-1-1")
+	if job.Hash == "" || attachment.Hash != job.Hash || attachment.Path != job.Path ||
+		!strings.HasPrefix(job.Path, filepath.Join(dir, "attachments")) {
+		t.Errorf("Expected the brand file to be saved, got job %+v and attachment %+v", job, attachment)
+	}
+
+	backend.mutex.Lock()
+	submissions := backend.submissions
+	backend.mutex.Unlock()
+	if len(submissions) != 2 {
+		t.Fatalf("Expected 2 submissions, got %d", len(submissions))
+	}
+	for _, submission := range submissions {
+		if submission["source"] != submission["rule"] || submission["account_id"] != "acct" {
+			t.Errorf("Unexpected submission %v", submission)
+		}
+		headers, _ := json.Marshal(submission["headers"])
+		rows, _ := json.Marshal(submission["rows"])
+		if string(headers) != `["txn_ref_number","Paid Amount","BANKDATETIME"]` ||
+			string(rows) != `[["TXXER00000002438","11618","2025-04-22"],["TXXER00000002439","12018","2025-04-22"]]` {
+			t.Errorf("Unexpected rows %s %s", headers, rows)
+		}
+	}
+	if submissions[0]["filename"] != "Benow File 1.csv" || submissions[0]["sender"] != "recon@benow.in" {
+		t.Errorf("Unexpected Benow submission %v", submissions[0])
+	}
+}
+
+func TestIngesterRetry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "brand.csv")
+	if err := os.WriteFile(path, []byte(settlementCSV), 0600); err != nil {
+		t.Fatalf("Failed to write attachment: %v", err)
+	}
+
+	backend := &reconBackend{fail: true}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	s := newReconStore()
+	ingester, err := NewIngester(s, config.ReconConfig{
+		Backend: config.ReconBackendConfig{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer recon-token"}},
+		Rules:   []config.ReconRuleConfig{{Name: "brand", Filename: `\.csv$`, Sheet: "missing"}},
+	}, dir)
+	if err != nil {
+		t.Fatalf("NewIngester failed: %v", err)
+	}
+
+	email := models.Email{
+		ID:          "brand-1",
+		AccountID:   "acct",
+		Attachments: []models.Attachment{{ID: "brand-1-1", EmailID: "brand-1", Filename: "brand.csv", Path: path}},
+	}
+	s.addEmail(email)
+	ingester.HandleEvent(client.EmailEvent{Type: client.EmailEventNew, Email: email})
+	jobs, _ := s.GetReconJobs("")
+	if len(jobs) != 1 {
+		t.Fatalf("Expected one job, got %+v", jobs)
+	}
+	jobID := jobs[0].ID
+
+	if _, err := ingester.Retry(jobID); err != ErrJobNotFailed {
+		t.Errorf("Expected ErrJobNotFailed for a queued job, got %v", err)
+	}
+
+	ingester.Start()
+	defer ingester.Stop()
+
+	// The configured sheet doesn't exist
+	job := waitForJob(t, s, jobID, models.ReconFailed)
+	if !strings.Contains(job.Error, "sheet not found") {
+		t.Errorf("Expected a missing sheet error, got %q", job.Error)
+	}
+
+	// Once the sheet is found, the backend's error is recorded
+	job.Sheet = ""
+	s.StoreReconJob(job)
+	if _, err := ingester.Retry(jobID); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	job = waitForJob(t, s, jobID, models.ReconFailed)
+	if job.Attempts != 2 || !strings.Contains(job.Error, "recon database unavailable") {
+		t.Errorf("Expected the backend error, got %+v", job)
+	}
+
+	backend.mutex.Lock()
+	backend.fail = false
+	backend.mutex.Unlock()
+	if _, err := ingester.Retry(jobID); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	job = waitForJob(t, s, jobID, models.ReconSubmitted)
+	if job.Error != "" || job.Rows != 2 || job.Attempts != 3 {
+		t.Errorf("Unexpected job after retry %+v", job)
+	}
+
+	if _, err := ingester.Retry("missing"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a missing job, got %v", err)
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	rules, err := compileRules([]config.ReconRuleConfig{{Sender: "Benow", Subject: `recon|settlement`, Filename: `\.xlsb$`}})
+	if err != nil {
+		t.Fatalf("compileRules failed: %v", err)
+	}
+	r := rules[0]
+	if r.name != "rule 1" {
+		t.Errorf("Expected an unnamed rule to be named by its position, got %q", r.name)
+	}
+
+	email := models.Email{From: models.Address{Name: "Benow Payments", Email: "noreply@payments.example"}, Subject: "Daily RECON file"}
+	tests := []struct {
+		filename string
+		subject  string
+		want     bool
+	}{
+		{"Benow File 1.xlsb", "Daily RECON file", true},
+		{"Benow File 1.XLSB", "Settlement", true},
+		{"Benow File 1.xlsx", "Daily RECON file", false},
+		{"Benow File 1.xlsb", "Invoice", false},
+	}
+	for _, test := range tests {
+		email.Subject = test.subject
+		if got := r.matches(email, models.Attachment{Filename: test.filename}); got != test.want {
+			t.Errorf("matches(%q, %q) = %v, want %v", test.filename, test.subject, got, test.want)
+		}
+	}
+
+	if _, err := compileRules([]config.ReconRuleConfig{{Name: "bad", Subject: "("}}); err == nil {
+		t.Error("Expected an invalid pattern to be rejected")
+	}
+	if _, err := NewIngester(newReconStore(), config.ReconConfig{}, ""); err == nil {
+		t.Error("Expected an ingester without a backend URL to be rejected")
+	}
+	if !reflect.DeepEqual(nonNil(nil), []string{}) {
+		t.Error("Expected nonNil to return an empty slice")
+	}
+}
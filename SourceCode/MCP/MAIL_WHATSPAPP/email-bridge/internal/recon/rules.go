@@ -0,0 +1,66 @@
+package recon
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/spreadsheet"
+)
+
+// rule is an ingestion rule with its patterns compiled. A nil pattern matches anything.
+type rule struct {
+	name     string
+	source   string
+	sheet    string
+	sender   *regexp.Regexp
+	subject  *regexp.Regexp
+	filename *regexp.Regexp
+}
+
+// compileRules compiles the patterns of the configured rules
+func compileRules(configs []config.ReconRuleConfig) ([]rule, error) {
+	rules := make([]rule, 0, len(configs))
+	for i, cfg := range configs {
+		r := rule{name: cfg.Name, source: cfg.Source, sheet: cfg.Sheet}
+		if r.name == "" {
+			r.name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		var err error
+		if r.sender, err = compilePattern(cfg.Sender); err != nil {
+			return nil, fmt.Errorf("invalid sender pattern of %s: %w", r.name, err)
+		}
+		if r.subject, err = compilePattern(cfg.Subject); err != nil {
+			return nil, fmt.Errorf("invalid subject pattern of %s: %w", r.name, err)
+		}
+		if r.filename, err = compilePattern(cfg.Filename); err != nil {
+			return nil, fmt.Errorf("invalid filename pattern of %s: %w", r.name, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// compilePattern compiles a case-insensitive pattern, returning nil for an empty one
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// matches reports whether an attachment of an email is a spreadsheet the rule selects
+func (r rule) matches(email models.Email, attachment models.Attachment) bool {
+	if _, ok := spreadsheet.FormatOf(attachment.Filename); !ok {
+		return false
+	}
+	if r.sender != nil && !r.sender.MatchString(email.From.Email) && !r.sender.MatchString(email.From.Name) {
+		return false
+	}
+	if r.subject != nil && !r.subject.MatchString(email.Subject) {
+		return false
+	}
+	return r.filename == nil || r.filename.MatchString(attachment.Filename)
+}
@@ -0,0 +1,208 @@
+// Package rules applies the mail rules stored in the database to new emails. A rule
+// whose conditions an email meets runs its actions on it: moving, marking as read,
+// flagging, tagging or forwarding it, posting it to a webhook or saving its
+// attachments.
+package rules
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+// keywordPattern matches the IMAP keywords tags are stored as: atoms that aren't
+// system flags
+var keywordPattern = regexp.MustCompile(`^[^\\\s(){%*"\]]+$`)
+
+// matcher holds the compiled conditions of a rule. A nil pattern matches anything.
+type matcher struct {
+	from           *regexp.Regexp
+	to             *regexp.Regexp
+	subject        *regexp.Regexp
+	body           *regexp.Regexp
+	headers        map[string]*regexp.Regexp
+	attachmentType *regexp.Regexp
+	minSize        int64
+	maxSize        int64
+}
+
+// Validate checks that the conditions of a rule compile and that its actions have
+// the fields their type needs
+func Validate(rule models.MailRule) error {
+	if _, err := compileConditions(rule.Conditions); err != nil {
+		return err
+	}
+
+	if len(rule.Actions) == 0 {
+		return fmt.Errorf("rule must have at least one action")
+	}
+
+	moves := 0
+	for i, action := range rule.Actions {
+		if err := validateAction(action); err != nil {
+			return fmt.Errorf("action %d: %w", i+1, err)
+		}
+		if action.Type == models.RuleActionMove {
+			moves++
+		}
+	}
+	if moves > 1 {
+		return fmt.Errorf("rule can move an email to one folder only")
+	}
+
+	return nil
+}
+
+// validateAction checks that an action has the fields its type needs
+func validateAction(action models.RuleAction) error {
+	switch action.Type {
+	case models.RuleActionMove:
+		if action.Folder == "" {
+			return fmt.Errorf("move needs a folder")
+		}
+	case models.RuleActionForward:
+		if len(action.To) == 0 {
+			return fmt.Errorf("forward needs at least one recipient")
+		}
+		for _, addr := range action.To {
+			if !strings.Contains(addr.Email, "@") {
+				return fmt.Errorf("invalid forward recipient %q", addr.Email)
+			}
+		}
+	case models.RuleActionTag:
+		if !keywordPattern.MatchString(action.Tag) {
+			return fmt.Errorf("invalid tag %q: tags are IMAP keywords, without spaces or special characters", action.Tag)
+		}
+	case models.RuleActionWebhook:
+		u, err := url.Parse(action.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook needs an http or https URL")
+		}
+	case models.RuleActionMarkRead, models.RuleActionFlag, models.RuleActionExtractAttachments:
+	default:
+		return fmt.Errorf("unknown action type %q", action.Type)
+	}
+	return nil
+}
+
+// compileConditions compiles the patterns of a rule's conditions
+func compileConditions(c models.RuleConditions) (matcher, error) {
+	m := matcher{minSize: c.MinAttachmentSize, maxSize: c.MaxAttachmentSize}
+	if m.minSize < 0 || m.maxSize < 0 || (m.maxSize > 0 && m.minSize > m.maxSize) {
+		return m, fmt.Errorf("invalid attachment size range")
+	}
+
+	var err error
+	if m.from, err = compilePattern(c.From); err != nil {
+		return m, fmt.Errorf("invalid from pattern: %w", err)
+	}
+	if m.to, err = compilePattern(c.To); err != nil {
+		return m, fmt.Errorf("invalid to pattern: %w", err)
+	}
+	if m.subject, err = compilePattern(c.Subject); err != nil {
+		return m, fmt.Errorf("invalid subject pattern: %w", err)
+	}
+	if m.body, err = compilePattern(c.Body); err != nil {
+		return m, fmt.Errorf("invalid body pattern: %w", err)
+	}
+	if m.attachmentType, err = compilePattern(c.AttachmentType); err != nil {
+		return m, fmt.Errorf("invalid attachment type pattern: %w", err)
+	}
+
+	for name, pattern := range c.Headers {
+		if name == "" {
+			return m, fmt.Errorf("header condition needs a header name")
+		}
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return m, fmt.Errorf("invalid pattern of header %s: %w", name, err)
+		}
+		if m.headers == nil {
+			m.headers = make(map[string]*regexp.Regexp)
+		}
+		m.headers[name] = re
+	}
+
+	return m, nil
+}
+
+// compilePattern compiles a case-insensitive pattern, returning nil for an empty one
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// matches reports whether an email meets all the conditions
+func (m matcher) matches(email models.Email) bool {
+	if m.from != nil && !matchAddress(m.from, email.From) {
+		return false
+	}
+	if m.to != nil && !matchAnyAddress(m.to, email.To) && !matchAnyAddress(m.to, email.Cc) {
+		return false
+	}
+	if m.subject != nil && !m.subject.MatchString(email.Subject) {
+		return false
+	}
+	if m.body != nil && !m.body.MatchString(email.TextContent) && !m.body.MatchString(email.HtmlContent) {
+		return false
+	}
+
+	for name, re := range m.headers {
+		value, ok := headerValue(email.Headers, name)
+		if !ok || !re.MatchString(value) {
+			return false
+		}
+	}
+
+	if m.attachmentType == nil && m.minSize == 0 && m.maxSize == 0 {
+		return true
+	}
+	for _, attachment := range email.Attachments {
+		if m.matchesAttachment(attachment) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAttachment reports whether an attachment meets the attachment conditions
+func (m matcher) matchesAttachment(attachment models.Attachment) bool {
+	if m.attachmentType != nil && !m.attachmentType.MatchString(attachment.ContentType) &&
+		!m.attachmentType.MatchString(attachment.Filename) {
+		return false
+	}
+	if m.minSize > 0 && attachment.Size < m.minSize {
+		return false
+	}
+	return m.maxSize == 0 || attachment.Size <= m.maxSize
+}
+
+// matchAddress reports whether a pattern matches the name or address of an address
+func matchAddress(re *regexp.Regexp, addr models.Address) bool {
+	return re.MatchString(addr.Email) || (addr.Name != "" && re.MatchString(addr.Name))
+}
+
+// matchAnyAddress reports whether a pattern matches any of the addresses
+func matchAnyAddress(re *regexp.Regexp, addresses []models.Address) bool {
+	for _, addr := range addresses {
+		if matchAddress(re, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerValue returns the value of a stored header, whose key may have any case
+func headerValue(headers map[string]string, key string) (string, bool) {
+	for k, v := range headers {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
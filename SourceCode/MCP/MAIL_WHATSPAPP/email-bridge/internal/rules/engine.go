@@ -0,0 +1,346 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// webhookTimeout bounds a webhook call, so a slow endpoint doesn't hold up the actions
+// after it
+const webhookTimeout = 10 * time.Second
+
+// Engine evaluates the enabled mail rules against new emails. Rules are read from the
+// store for each email, so changes made over the API apply to the next email.
+type Engine struct {
+	store       store.Store
+	accounts    []config.AccountConfig
+	attachments *client.AttachmentStore
+	httpClient  *http.Client
+
+	// imapClient returns the IMAP client of an account
+	imapClient func(accountID string) (client.IMAPClient, bool)
+	// notifyOutbox wakes the outbox sender after a forward is queued
+	notifyOutbox func()
+}
+
+// NewEngine creates an engine for the rules in the store. Forwards are sent from the
+// address of the email's account in accounts, or in the store, and extracted
+// attachments are saved in the attachment directory.
+func NewEngine(s store.Store, accounts []config.AccountConfig, attachmentDir string) *Engine {
+	if attachmentDir == "" {
+		attachmentDir = "attachments"
+	}
+
+	return &Engine{
+		store:        s,
+		accounts:     accounts,
+		attachments:  client.NewAttachmentStore(attachmentDir),
+		httpClient:   &http.Client{Timeout: webhookTimeout},
+		imapClient:   accountIMAPClient,
+		notifyOutbox: client.GetOutboxSender(nil).Notify,
+	}
+}
+
+// accountIMAPClient returns the IMAP client registered for an account
+func accountIMAPClient(accountID string) (client.IMAPClient, bool) {
+	c, ok := client.GetConnectionManager().GetClient(fmt.Sprintf("imap-%s", accountID))
+	if !ok {
+		return nil, false
+	}
+	imapClient, ok := c.(client.IMAPClient)
+	return imapClient, ok
+}
+
+// HandleEvent applies the rules to the email of a new email event
+func (e *Engine) HandleEvent(event client.EmailEvent) {
+	if event.Type != client.EmailEventNew {
+		return
+	}
+	e.Apply(event.Email)
+}
+
+// Apply runs the actions of the enabled rules that an email matches, by ascending
+// priority, until a matching rule stops processing. A move runs after all the other
+// actions, since the email gets a new ID in its new folder. Failed actions are logged
+// and don't keep the others from running.
+func (e *Engine) Apply(email models.Email) {
+	rules, err := e.store.GetMailRules()
+	if err != nil {
+		fmt.Printf("Warning: Failed to load mail rules: %v\n", err)
+		return
+	}
+
+	type ruleAction struct {
+		rule   models.MailRule
+		action models.RuleAction
+	}
+	var actions []ruleAction
+	var move *ruleAction
+
+	for _, rule := range rules {
+		if !rule.Enabled || (rule.AccountID != "" && rule.AccountID != email.AccountID) {
+			continue
+		}
+
+		m, err := compileConditions(rule.Conditions)
+		if err != nil {
+			fmt.Printf("Warning: Skipping mail rule %s: %v\n", rule.ID, err)
+			continue
+		}
+		if !m.matches(email) {
+			continue
+		}
+
+		for _, action := range rule.Actions {
+			if action.Type == models.RuleActionMove {
+				// A later rule's move wins
+				move = &ruleAction{rule, action}
+				continue
+			}
+			actions = append(actions, ruleAction{rule, action})
+		}
+		if rule.StopProcessing {
+			break
+		}
+	}
+
+	if move != nil {
+		actions = append(actions, *move)
+	}
+	for _, a := range actions {
+		if err := e.run(a.action, email); err != nil {
+			fmt.Printf("Warning: Mail rule %s failed to %s email %s: %v\n", a.rule.ID, a.action.Type, email.ID, err)
+		}
+	}
+}
+
+// run runs an action on an email
+func (e *Engine) run(action models.RuleAction, email models.Email) error {
+	switch action.Type {
+	case models.RuleActionMarkRead:
+		return e.markRead(email)
+	case models.RuleActionFlag:
+		return e.addFlag(email, imap.FlaggedFlag)
+	case models.RuleActionTag:
+		return e.addFlag(email, action.Tag)
+	case models.RuleActionForward:
+		return e.forward(email, action.To)
+	case models.RuleActionWebhook:
+		return e.callWebhook(action.URL, email)
+	case models.RuleActionExtractAttachments:
+		return e.extractAttachments(email)
+	case models.RuleActionMove:
+		return e.move(email, action.Folder)
+	default:
+		return fmt.Errorf("unknown action type %q", action.Type)
+	}
+}
+
+// connectedIMAPClient returns the IMAP client of an account, connecting it if needed
+func (e *Engine) connectedIMAPClient(accountID string) (client.IMAPClient, error) {
+	imapClient, ok := e.imapClient(accountID)
+	if !ok || imapClient == nil {
+		return nil, fmt.Errorf("no IMAP client for account %s", accountID)
+	}
+	if !imapClient.IsConnected() {
+		if err := imapClient.Connect(); err != nil {
+			return nil, fmt.Errorf("failed to connect to IMAP server: %w", err)
+		}
+	}
+	return imapClient, nil
+}
+
+// markRead marks an email as read on the server and in the store
+func (e *Engine) markRead(email models.Email) error {
+	if email.IsRead {
+		return nil
+	}
+
+	imapClient, err := e.connectedIMAPClient(email.AccountID)
+	if err != nil {
+		return err
+	}
+	if err := imapClient.MarkAsRead(email.Folder, email.ID); err != nil {
+		return err
+	}
+
+	return client.GetEmailEventHandler(e.store).HandleStatusChange(email.ID, models.EmailStatus{IsRead: true})
+}
+
+// addFlag sets a flag or keyword on an email on the server. Flags aren't stored locally.
+func (e *Engine) addFlag(email models.Email, flag string) error {
+	imapClient, err := e.connectedIMAPClient(email.AccountID)
+	if err != nil {
+		return err
+	}
+	return imapClient.AddFlag(email.Folder, email.ID, flag)
+}
+
+// move moves an email to a folder on the server and re-keys it in the store
+func (e *Engine) move(email models.Email, folder string) error {
+	if folder == email.Folder {
+		return nil
+	}
+
+	imapClient, err := e.connectedIMAPClient(email.AccountID)
+	if err != nil {
+		return err
+	}
+	newEmailID, err := imapClient.MoveEmail(email.Folder, email.ID, folder)
+	if err != nil {
+		return err
+	}
+
+	return client.GetEmailEventHandler(e.store).HandleEmailMoved(email.ID, newEmailID, email.Folder, folder)
+}
+
+// forward queues a forward of an email, with its attachments, in the outbox. Emails
+// that were sent automatically are not forwarded, so that two forwarding rules can't
+// loop (RFC 3834).
+func (e *Engine) forward(email models.Email, to []models.Address) error {
+	if autoSubmitted, ok := headerValue(email.Headers, "Auto-Submitted"); ok && !strings.EqualFold(strings.TrimSpace(autoSubmitted), "no") {
+		return nil
+	}
+
+	from := e.sender(email.AccountID)
+	if from.Email == "" {
+		return fmt.Errorf("no sender address for account %s", email.AccountID)
+	}
+
+	now := time.Now()
+	forward := models.Email{
+		ID:          fmt.Sprintf("email_%d", now.UnixNano()),
+		AccountID:   email.AccountID,
+		MessageID:   messageID(from.Email, now),
+		From:        from,
+		To:          to,
+		Subject:     client.PrefixSubject("Fwd:", email.Subject),
+		TextContent: client.ForwardedText("", email),
+		Date:        now,
+		Folder:      "Sent", // Default folder for sent emails
+		Headers:     map[string]string{"Auto-Submitted": "auto-forwarded"},
+	}
+	if email.HtmlContent != "" {
+		forward.HtmlContent = client.ForwardedHTML("", email)
+	}
+
+	// Forward the attachments, downloading any that aren't on disk yet
+	for _, attachment := range email.Attachments {
+		attachment, err := e.localAttachment(email, attachment)
+		if err != nil {
+			return err
+		}
+		attachment.ID = fmt.Sprintf("%s-%d", forward.ID, len(forward.Attachments)+1)
+		attachment.EmailID = forward.ID
+		attachment.Section = ""
+		forward.Attachments = append(forward.Attachments, attachment)
+	}
+	forward.HasAttachments = len(forward.Attachments) > 0
+
+	message := models.OutboxMessage{
+		ID:          fmt.Sprintf("outbox_%d", now.UnixNano()),
+		AccountID:   email.AccountID,
+		Email:       forward,
+		Status:      models.OutboxQueued,
+		NextAttempt: now,
+		CreatedAt:   now,
+	}
+	if err := e.store.QueueOutboxMessage(message); err != nil {
+		return fmt.Errorf("failed to queue forward: %w", err)
+	}
+
+	e.notifyOutbox()
+	return nil
+}
+
+// sender returns the address of an account, from the configuration or the store
+func (e *Engine) sender(accountID string) models.Address {
+	for _, account := range e.accounts {
+		if account.ID == accountID && account.Email != "" {
+			return models.Address{Email: account.Email}
+		}
+	}
+	if account, err := e.store.GetAccount(accountID); err == nil {
+		return models.Address{Email: account.Email}
+	}
+	return models.Address{}
+}
+
+// messageID generates a Message-ID for an email sent from an address
+func messageID(fromEmail string, now time.Time) string {
+	local, host, ok := strings.Cut(fromEmail, "@")
+	if !ok {
+		host = "localhost"
+	}
+	return fmt.Sprintf("<%d.%s@%s>", now.UnixNano(), local, host)
+}
+
+// callWebhook posts an email as JSON to a URL
+func (e *Engine) callWebhook(url string, email models.Email) error {
+	body, err := json.Marshal(struct {
+		Event string       `json:"event"`
+		Email models.Email `json:"email"`
+	}{
+		Event: string(client.EmailEventNew),
+		Email: email,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	resp, err := e.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// extractAttachments saves the attachments of an email that aren't on disk yet in the
+// attachment store
+func (e *Engine) extractAttachments(email models.Email) error {
+	for _, attachment := range email.Attachments {
+		if _, err := e.localAttachment(email, attachment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localAttachment returns an attachment with the path of its content on disk,
+// downloading it into the attachment store if needed
+func (e *Engine) localAttachment(email models.Email, attachment models.Attachment) (models.Attachment, error) {
+	if fileExists(attachment.Path) {
+		return attachment, nil
+	}
+
+	imapClient, ok := e.imapClient(email.AccountID)
+	if !ok || imapClient == nil {
+		return attachment, fmt.Errorf("no IMAP client for account %s", email.AccountID)
+	}
+	return e.attachments.Download(e.store, imapClient, email, attachment)
+}
+
+// fileExists reports whether a regular file exists at the given path
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
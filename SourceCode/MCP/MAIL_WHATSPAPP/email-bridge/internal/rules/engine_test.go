@@ -0,0 +1,310 @@
+package rules
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/config"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// rulesStore keeps emails, rules and the outbox in memory
+type rulesStore struct {
+	store.Store
+	mutex       sync.Mutex
+	emails      map[string]models.Email
+	attachments map[string]models.Attachment
+	rules       []models.MailRule
+	outbox      []models.OutboxMessage
+}
+
+func (s *rulesStore) GetMailRules() ([]models.MailRule, error) {
+	return s.rules, nil
+}
+
+func (s *rulesStore) GetEmail(id string) (models.Email, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	email, ok := s.emails[id]
+	if !ok {
+		return email, sql.ErrNoRows
+	}
+	return email, nil
+}
+
+func (s *rulesStore) UpdateEmailStatus(id string, status models.EmailStatus) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	email := s.emails[id]
+	email.IsRead = status.IsRead
+	s.emails[id] = email
+	return nil
+}
+
+func (s *rulesStore) MoveEmail(id string, folder string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	email := s.emails[id]
+	email.Folder = folder
+	s.emails[id] = email
+	return nil
+}
+
+func (s *rulesStore) StoreAttachment(attachment models.Attachment) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attachments[attachment.ID] = attachment
+	return nil
+}
+
+func (s *rulesStore) GetAccount(id string) (models.Account, error) {
+	return models.Account{}, sql.ErrNoRows
+}
+
+func (s *rulesStore) QueueOutboxMessage(message models.OutboxMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.outbox = append(s.outbox, message)
+	return nil
+}
+
+// rulesIMAPClient records the operations of the actions as "operation folder/emailID"
+type rulesIMAPClient struct {
+	client.IMAPClient
+	operations []string
+	content    map[string]string
+}
+
+func (c *rulesIMAPClient) IsConnected() bool { return true }
+
+func (c *rulesIMAPClient) MarkAsRead(folder string, emailID string) error {
+	c.operations = append(c.operations, "read "+folder+"/"+emailID)
+	return nil
+}
+
+func (c *rulesIMAPClient) AddFlag(folder string, emailID string, flag string) error {
+	c.operations = append(c.operations, "flag "+flag+" "+folder+"/"+emailID)
+	return nil
+}
+
+func (c *rulesIMAPClient) MoveEmail(folder string, emailID string, destination string) (string, error) {
+	c.operations = append(c.operations, "move "+folder+"/"+emailID+" to "+destination)
+	return "", nil
+}
+
+func (c *rulesIMAPClient) GetAttachment(folder string, attachment models.Attachment) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(c.content[attachment.ID])), nil
+}
+
+func TestEngine(t *testing.T) {
+	var webhookMu sync.Mutex
+	var posted []models.Email
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Event string       `json:"event"`
+			Email models.Email `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Event != "new" {
+			t.Errorf("Unexpected webhook payload %+v (%v)", payload, err)
+		}
+		webhookMu.Lock()
+		posted = append(posted, payload.Email)
+		webhookMu.Unlock()
+	}))
+	defer webhook.Close()
+
+	email := models.Email{
+		ID:        "acct-7",
+		AccountID: "acct",
+		Folder:    "INBOX",
+		From:      models.Address{Name: "Benow Settlements", Email: "settlements@benow.in"},
+		To:        []models.Address{{Email: "ops@example.com"}},
+		Subject:   "Settlement file 22/04",
+		Headers:   map[string]string{"X-Mailer": "benow-batch"},
+		Attachments: []models.Attachment{
+			{ID: "acct-7-1", EmailID: "acct-7", Filename: "Benow File 1.xlsb", ContentType: "application/vnd.ms-excel.sheet.binary.macroEnabled.12", Size: 48213},
+		},
+		HasAttachments: true,
+	}
+	s := &rulesStore{
+		emails:      map[string]models.Email{email.ID: email},
+		attachments: make(map[string]models.Attachment),
+		rules: []models.MailRule{
+			{
+				ID: "settlements", Enabled: true, Priority: 1,
+				Conditions: models.RuleConditions{From: "@benow\\.in$", AttachmentType: "\\.xlsb$"},
+				Actions: []models.RuleAction{
+					{Type: models.RuleActionMove, Folder: "Settlements"},
+					{Type: models.RuleActionMarkRead},
+					{Type: models.RuleActionTag, Tag: "recon"},
+					{Type: models.RuleActionForward, To: []models.Address{{Email: "recon@example.com"}}},
+					{Type: models.RuleActionWebhook, URL: webhook.URL},
+				},
+			},
+			{
+				ID: "flag-all", Enabled: true, Priority: 2, StopProcessing: true,
+				Actions: []models.RuleAction{{Type: models.RuleActionFlag}},
+			},
+			{
+				ID: "after-stop", Enabled: true, Priority: 3,
+				Actions: []models.RuleAction{{Type: models.RuleActionTag, Tag: "late"}},
+			},
+			{
+				ID: "disabled", Enabled: false,
+				Actions: []models.RuleAction{{Type: models.RuleActionTag, Tag: "disabled"}},
+			},
+			{
+				ID: "other-account", Enabled: true, AccountID: "other",
+				Actions: []models.RuleAction{{Type: models.RuleActionTag, Tag: "other"}},
+			},
+		},
+	}
+	imapClient := &rulesIMAPClient{content: map[string]string{"acct-7-1": "xlsb content"}}
+
+	notified := 0
+	engine := NewEngine(s, []config.AccountConfig{{ID: "acct", Email: "ops@example.com"}}, t.TempDir())
+	engine.imapClient = func(accountID string) (client.IMAPClient, bool) { return imapClient, accountID == "acct" }
+	engine.notifyOutbox = func() { notified++ }
+
+	engine.HandleEvent(client.EmailEvent{Type: client.EmailEventNew, Email: email})
+
+	// Actions run in order, with the move last
+	want := []string{
+		"read INBOX/acct-7",
+		"flag recon INBOX/acct-7",
+		"flag " + imap.FlaggedFlag + " INBOX/acct-7",
+		"move INBOX/acct-7 to Settlements",
+	}
+	if !reflect.DeepEqual(imapClient.operations, want) {
+		t.Errorf("Expected operations %v, got %v", want, imapClient.operations)
+	}
+
+	stored, _ := s.GetEmail("acct-7")
+	if !stored.IsRead || stored.Folder != "Settlements" {
+		t.Errorf("Store was not updated: %+v", stored)
+	}
+
+	if len(s.outbox) != 1 || notified != 1 {
+		t.Fatalf("Expected one queued forward, got %d (notified %d)", len(s.outbox), notified)
+	}
+	forward := s.outbox[0].Email
+	if forward.From.Email != "ops@example.com" || forward.To[0].Email != "recon@example.com" ||
+		forward.Subject != "Fwd: Settlement file 22/04" || forward.Headers["Auto-Submitted"] != "auto-forwarded" {
+		t.Errorf("Unexpected forward %+v", forward)
+	}
+	if len(forward.Attachments) != 1 || forward.Attachments[0].Path == "" || forward.Attachments[0].Section != "" {
+		t.Errorf("Expected the downloaded attachment to be forwarded, got %+v", forward.Attachments)
+	}
+	if saved := s.attachments["acct-7-1"]; saved.Path != forward.Attachments[0].Path || saved.Hash == "" {
+		t.Errorf("Downloaded attachment was not stored: %+v", saved)
+	}
+
+	if len(posted) != 1 || posted[0].ID != "acct-7" {
+		t.Errorf("Expected the email to be posted to the webhook, got %+v", posted)
+	}
+
+	// Forwards are not forwarded again
+	imapClient.operations = nil
+	forward.ID = "acct-8"
+	forward.AccountID = "acct"
+	forward.From = email.From
+	engine.Apply(forward)
+	if len(s.outbox) != 1 {
+		t.Errorf("Expected an auto-forwarded email not to be forwarded, got %d queued", len(s.outbox))
+	}
+}
+
+func TestMatches(t *testing.T) {
+	email := models.Email{
+		From:        models.Address{Name: "Brand Payouts", Email: "payouts@brand.com"},
+		To:          []models.Address{{Email: "ops@example.com"}},
+		Cc:          []models.Address{{Name: "Finance", Email: "finance@example.com"}},
+		Subject:     "Weekly payout report",
+		TextContent: "Total paid: 11,612.45 INR",
+		Headers:     map[string]string{"List-Id": "<payouts.brand.com>"},
+		Attachments: []models.Attachment{
+			{Filename: "payouts.csv", ContentType: "text/csv", Size: 2048},
+			{Filename: "logo.png", ContentType: "image/png", Size: 90000},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		conditions models.RuleConditions
+		want       bool
+	}{
+		{"no conditions", models.RuleConditions{}, true},
+		{"sender name", models.RuleConditions{From: "^brand payouts$"}, true},
+		{"sender address", models.RuleConditions{From: "@brand\\.com$"}, true},
+		{"other sender", models.RuleConditions{From: "@benow\\.in$"}, false},
+		{"cc recipient", models.RuleConditions{To: "finance"}, true},
+		{"subject and body", models.RuleConditions{Subject: "payout", Body: "total paid: [0-9,.]+"}, true},
+		{"body mismatch", models.RuleConditions{Body: "refund"}, false},
+		{"header any case", models.RuleConditions{Headers: map[string]string{"list-id": "brand"}}, true},
+		{"missing header", models.RuleConditions{Headers: map[string]string{"X-Spam-Flag": ".*"}}, false},
+		{"attachment type", models.RuleConditions{AttachmentType: "^text/csv$"}, true},
+		{"attachment extension", models.RuleConditions{AttachmentType: "\\.png$"}, true},
+		{"type and size on one attachment", models.RuleConditions{AttachmentType: "csv", MinAttachmentSize: 10000}, false},
+		{"size range", models.RuleConditions{MinAttachmentSize: 50000, MaxAttachmentSize: 100000}, true},
+		{"too small", models.RuleConditions{MaxAttachmentSize: 1000}, false},
+	}
+
+	for _, tt := range tests {
+		m, err := compileConditions(tt.conditions)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := m.matches(email); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// Attachment conditions need an attachment
+	m, _ := compileConditions(models.RuleConditions{MaxAttachmentSize: 1000})
+	if m.matches(models.Email{}) {
+		t.Errorf("Expected an email without attachments not to match")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	markRead := []models.RuleAction{{Type: models.RuleActionMarkRead}}
+	tests := []struct {
+		name  string
+		rule  models.MailRule
+		valid bool
+	}{
+		{"valid", models.MailRule{Conditions: models.RuleConditions{Subject: "invoice"}, Actions: markRead}, true},
+		{"no actions", models.MailRule{}, false},
+		{"bad pattern", models.MailRule{Conditions: models.RuleConditions{From: "("}, Actions: markRead}, false},
+		{"bad header pattern", models.MailRule{Conditions: models.RuleConditions{Headers: map[string]string{"List-Id": "["}}, Actions: markRead}, false},
+		{"size range", models.MailRule{Conditions: models.RuleConditions{MinAttachmentSize: 10, MaxAttachmentSize: 5}, Actions: markRead}, false},
+		{"unknown action", models.MailRule{Actions: []models.RuleAction{{Type: "delete"}}}, false},
+		{"move without folder", models.MailRule{Actions: []models.RuleAction{{Type: models.RuleActionMove}}}, false},
+		{"two moves", models.MailRule{Actions: []models.RuleAction{
+			{Type: models.RuleActionMove, Folder: "A"}, {Type: models.RuleActionMove, Folder: "B"},
+		}}, false},
+		{"forward", models.MailRule{Actions: []models.RuleAction{{Type: models.RuleActionForward, To: []models.Address{{Email: "a@example.com"}}}}}, true},
+		{"forward without recipient", models.MailRule{Actions: []models.RuleAction{{Type: models.RuleActionForward}}}, false},
+		{"tag", models.MailRule{Actions: []models.RuleAction{{Type: models.RuleActionTag, Tag: "recon"}}}, true},
+		{"system flag as tag", models.MailRule{Actions: []models.RuleAction{{Type: models.RuleActionTag, Tag: "\\Deleted"}}}, false},
+		{"tag with space", models.MailRule{Actions: []models.RuleAction{{Type: models.RuleActionTag, Tag: "to do"}}}, false},
+		{"webhook", models.MailRule{Actions: []models.RuleAction{{Type: models.RuleActionWebhook, URL: "https://hooks.example.com/mail"}}}, true},
+		{"webhook without scheme", models.MailRule{Actions: []models.RuleAction{{Type: models.RuleActionWebhook, URL: "hooks.example.com"}}}, false},
+	}
+
+	for _, tt := range tests {
+		if err := Validate(tt.rule); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %v, got error %v", tt.name, tt.valid, err)
+		}
+	}
+}
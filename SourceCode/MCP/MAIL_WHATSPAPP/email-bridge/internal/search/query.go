@@ -0,0 +1,425 @@
+// Package search parses Gmail-style search queries such as
+// `from:alice has:attachment after:2024-01-01 subject:"invoice" -is:read in:INBOX`.
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+// operators maps the operator names accepted in queries to search term fields.
+// Any other word with a colon is searched as text.
+var operators = map[string]string{
+	"from":     models.SearchFrom,
+	"to":       models.SearchTo,
+	"cc":       models.SearchCc,
+	"subject":  models.SearchSubject,
+	"in":       models.SearchFolder,
+	"label":    models.SearchFolder,
+	"has":      models.SearchHas,
+	"is":       models.SearchIs,
+	"after":    models.SearchAfter,
+	"before":   models.SearchBefore,
+	"filename": models.SearchFilename,
+}
+
+// dateLayouts are the accepted formats of after: and before: values
+var dateLayouts = []string{"2006-01-02", "2006/01/02"}
+
+// Parse compiles a query into search criteria. Terms joined only by AND are set on
+// the matching criteria fields where possible; everything else, including OR, NOT and
+// parenthesized groups, is kept in the criteria's Expression.
+func Parse(query string) (models.SearchCriteria, error) {
+	var criteria models.SearchCriteria
+
+	tokens, err := tokenize(query)
+	if err != nil {
+		return criteria, err
+	}
+	if len(tokens) == 0 {
+		return criteria, nil
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return criteria, err
+	}
+	if p.pos < len(p.tokens) {
+		return criteria, fmt.Errorf("unexpected %s in query", p.tokens[p.pos])
+	}
+
+	var rest []models.SearchExpression
+	var text []string
+	for _, term := range conjuncts(expr) {
+		if term.Field == models.SearchText && term.Op == "" {
+			text = append(text, term.Value)
+			continue
+		}
+		if !applyToCriteria(&criteria, term) {
+			rest = append(rest, term)
+		}
+	}
+	criteria.Query = strings.Join(text, " ")
+
+	switch len(rest) {
+	case 0:
+	case 1:
+		criteria.Expression = &rest[0]
+	default:
+		criteria.Expression = &models.SearchExpression{Op: models.SearchAnd, Children: rest}
+	}
+
+	return criteria, nil
+}
+
+// conjuncts returns the terms of an expression joined by AND at its top level
+func conjuncts(expr models.SearchExpression) []models.SearchExpression {
+	if expr.Op != models.SearchAnd {
+		return []models.SearchExpression{expr}
+	}
+
+	var terms []models.SearchExpression
+	for _, child := range expr.Children {
+		terms = append(terms, conjuncts(child)...)
+	}
+	return terms
+}
+
+// applyToCriteria sets the criteria field matching a term, reporting false if the
+// term has no field or the field is already set
+func applyToCriteria(criteria *models.SearchCriteria, term models.SearchExpression) bool {
+	negated := false
+	if term.Op == models.SearchNot && term.Children[0].Op == "" {
+		negated = true
+		term = term.Children[0]
+	} else if term.Op != "" {
+		return false
+	}
+
+	// Flags can be negated by flipping them
+	switch term.Field {
+	case models.SearchHas:
+		if criteria.HasAttachments != nil {
+			return false
+		}
+		value := !negated
+		criteria.HasAttachments = &value
+		return true
+	case models.SearchIs:
+		if criteria.IsRead != nil {
+			return false
+		}
+		value := (term.Value == "read") != negated
+		criteria.IsRead = &value
+		return true
+	}
+
+	if negated {
+		return false
+	}
+
+	var field *string
+	switch term.Field {
+	case models.SearchFrom:
+		field = &criteria.FromAddress
+	case models.SearchTo:
+		field = &criteria.ToAddress
+	case models.SearchSubject:
+		field = &criteria.Subject
+	case models.SearchFolder:
+		field = &criteria.Folder
+	case models.SearchAfter, models.SearchBefore:
+		date, _ := parseDate(term.Value)
+		target := &criteria.AfterDate
+		if term.Field == models.SearchBefore {
+			target = &criteria.BeforeDate
+		}
+		if !target.IsZero() {
+			return false
+		}
+		*target = date
+		return true
+	default:
+		return false
+	}
+
+	if *field != "" {
+		return false
+	}
+	*field = term.Value
+	return true
+}
+
+// parser is a recursive descent parser over query tokens with the grammar
+//
+//	or   = and { "OR" and }
+//	and  = not { ["AND"] not }
+//	not  = ( "NOT" | "-" ) not | "(" or ")" | term
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) parseOr() (models.SearchExpression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return left, err
+	}
+
+	children := []models.SearchExpression{left}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokenOr {
+			break
+		}
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return right, err
+		}
+		children = append(children, right)
+	}
+
+	if len(children) == 1 {
+		return left, nil
+	}
+	return models.SearchExpression{Op: models.SearchOr, Children: children}, nil
+}
+
+func (p *parser) parseAnd() (models.SearchExpression, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return left, err
+	}
+
+	children := []models.SearchExpression{left}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind == tokenOr || tok.kind == tokenRParen {
+			break
+		}
+		if tok.kind == tokenAnd {
+			p.pos++
+		}
+
+		right, err := p.parseNot()
+		if err != nil {
+			return right, err
+		}
+		children = append(children, right)
+	}
+
+	if len(children) == 1 {
+		return left, nil
+	}
+	return models.SearchExpression{Op: models.SearchAnd, Children: children}, nil
+}
+
+func (p *parser) parseNot() (models.SearchExpression, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return models.SearchExpression{}, fmt.Errorf("query ends where a search term was expected")
+	}
+	p.pos++
+
+	switch tok.kind {
+	case tokenNot:
+		child, err := p.parseNot()
+		if err != nil {
+			return child, err
+		}
+		return models.SearchExpression{Op: models.SearchNot, Children: []models.SearchExpression{child}}, nil
+	case tokenLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return expr, err
+		}
+		if tok, ok := p.peek(); !ok || tok.kind != tokenRParen {
+			return expr, fmt.Errorf("missing closing parenthesis in query")
+		}
+		p.pos++
+		return expr, nil
+	case tokenTerm:
+		return tok.term, nil
+	default:
+		return models.SearchExpression{}, fmt.Errorf("unexpected %s in query", tok)
+	}
+}
+
+// tokenKind is the kind of a query token
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+// token is a query token. Terms carry their parsed search term.
+type token struct {
+	kind tokenKind
+	term models.SearchExpression
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenAnd:
+		return "AND"
+	case tokenOr:
+		return "OR"
+	case tokenNot:
+		return "NOT"
+	case tokenLParen:
+		return "'('"
+	case tokenRParen:
+		return "')'"
+	default:
+		return fmt.Sprintf("%q", t.term.Value)
+	}
+}
+
+// tokenize splits a query into tokens
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, token{kind: tokenNot})
+			i++
+		default:
+			word, quoted, next, err := readWord(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			i = next
+
+			if !quoted {
+				switch word {
+				case "AND":
+					tokens = append(tokens, token{kind: tokenAnd})
+					continue
+				case "OR":
+					tokens = append(tokens, token{kind: tokenOr})
+					continue
+				case "NOT":
+					tokens = append(tokens, token{kind: tokenNot})
+					continue
+				}
+			}
+
+			term, err := parseTerm(word, quoted)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenTerm, term: term})
+		}
+	}
+
+	return tokens, nil
+}
+
+// readWord reads a word or quoted phrase starting at runes[i], including an operator
+// prefix such as subject: before a quoted phrase. It returns the word, whether it was
+// a bare quoted phrase and the index after it.
+func readWord(runes []rune, i int) (string, bool, int, error) {
+	var b strings.Builder
+	quoted := runes[i] == '"'
+
+	for i < len(runes) {
+		r := runes[i]
+		if unicode.IsSpace(r) || r == '(' || r == ')' {
+			break
+		}
+		if r == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return "", false, 0, fmt.Errorf("unterminated quote in query")
+			}
+			b.WriteString(string(runes[i+1 : end]))
+			i = end + 1
+			continue
+		}
+		b.WriteRune(r)
+		i++
+	}
+
+	return b.String(), quoted, i, nil
+}
+
+// parseTerm parses a word into a search term, validating operator values
+func parseTerm(word string, quoted bool) (models.SearchExpression, error) {
+	text := models.SearchExpression{Field: models.SearchText, Value: word}
+	if quoted {
+		return text, nil
+	}
+
+	name, value, ok := strings.Cut(word, ":")
+	field, known := operators[strings.ToLower(name)]
+	if !ok || !known {
+		return text, nil
+	}
+	if value == "" {
+		return text, fmt.Errorf("%s: needs a value", name)
+	}
+
+	switch field {
+	case models.SearchHas:
+		if value = strings.ToLower(value); value != "attachment" {
+			return text, fmt.Errorf("unsupported has:%s, only has:attachment is supported", value)
+		}
+	case models.SearchIs:
+		if value = strings.ToLower(value); value != "read" && value != "unread" {
+			return text, fmt.Errorf("unsupported is:%s, use is:read or is:unread", value)
+		}
+	case models.SearchAfter, models.SearchBefore:
+		date, err := parseDate(value)
+		if err != nil {
+			return text, fmt.Errorf("invalid date in %s:%s, use YYYY-MM-DD", name, value)
+		}
+		value = date.Format("2006-01-02")
+	}
+
+	return models.SearchExpression{Field: field, Value: value}, nil
+}
+
+// parseDate parses an after: or before: value as a UTC date
+func parseDate(value string) (time.Time, error) {
+	var err error
+	for _, layout := range dateLayouts {
+		var date time.Time
+		if date, err = time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, err
+}
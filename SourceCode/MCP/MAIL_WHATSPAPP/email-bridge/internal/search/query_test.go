@@ -0,0 +1,136 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func term(field, value string) models.SearchExpression {
+	return models.SearchExpression{Field: field, Value: value}
+}
+
+func not(child models.SearchExpression) models.SearchExpression {
+	return models.SearchExpression{Op: models.SearchNot, Children: []models.SearchExpression{child}}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  models.SearchCriteria
+	}{
+		{
+			name:  "empty",
+			query: "  ",
+			want:  models.SearchCriteria{},
+		},
+		{
+			name:  "operators set criteria fields",
+			query: `from:alice has:attachment after:2024-01-01 subject:"invoice march" -is:read in:INBOX`,
+			want: models.SearchCriteria{
+				FromAddress:    "alice",
+				HasAttachments: boolPtr(true),
+				AfterDate:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				Subject:        "invoice march",
+				IsRead:         boolPtr(false),
+				Folder:         "INBOX",
+			},
+		},
+		{
+			name:  "free text",
+			query: `quarterly "net revenue" report`,
+			want:  models.SearchCriteria{Query: "quarterly net revenue report"},
+		},
+		{
+			name:  "unknown operator is text",
+			query: "re:budget is:unread before:2024/02/01",
+			want: models.SearchCriteria{
+				Query:      "re:budget",
+				IsRead:     boolPtr(false),
+				BeforeDate: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "explicit AND",
+			query: "from:alice AND to:bob",
+			want:  models.SearchCriteria{FromAddress: "alice", ToAddress: "bob"},
+		},
+		{
+			name:  "or",
+			query: "from:alice OR from:bob",
+			want: models.SearchCriteria{Expression: &models.SearchExpression{
+				Op:       models.SearchOr,
+				Children: []models.SearchExpression{term("from", "alice"), term("from", "bob")},
+			}},
+		},
+		{
+			name:  "grouped or with fields",
+			query: "in:INBOX (from:alice OR filename:pdf) -subject:spam",
+			want: models.SearchCriteria{
+				Folder: "INBOX",
+				Expression: &models.SearchExpression{Op: models.SearchAnd, Children: []models.SearchExpression{
+					{Op: models.SearchOr, Children: []models.SearchExpression{term("from", "alice"), term("filename", "pdf")}},
+					not(term("subject", "spam")),
+				}},
+			},
+		},
+		{
+			name:  "repeated field",
+			query: "from:alice from:example.com",
+			want: models.SearchCriteria{
+				FromAddress: "alice",
+				Expression:  &models.SearchExpression{Field: "from", Value: "example.com"},
+			},
+		},
+		{
+			name:  "NOT keyword",
+			query: "NOT invoice",
+			want:  models.SearchCriteria{Expression: &models.SearchExpression{Op: models.SearchNot, Children: []models.SearchExpression{term("text", "invoice")}}},
+		},
+		{
+			name:  "and binds tighter than or",
+			query: "a b OR c",
+			want: models.SearchCriteria{Expression: &models.SearchExpression{Op: models.SearchOr, Children: []models.SearchExpression{
+				{Op: models.SearchAnd, Children: []models.SearchExpression{term("text", "a"), term("text", "b")}},
+				term("text", "c"),
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q)\n got %+v\nwant %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, query := range []string{
+		`subject:"invoice`,
+		"(from:alice OR from:bob",
+		"from:alice)",
+		"from:alice OR",
+		"NOT",
+		"after:yesterday",
+		"has:drive",
+		"is:starred",
+		"from:",
+	} {
+		t.Run(query, func(t *testing.T) {
+			if _, err := Parse(query); err == nil {
+				t.Errorf("Expected an error for %q", query)
+			}
+		})
+	}
+}
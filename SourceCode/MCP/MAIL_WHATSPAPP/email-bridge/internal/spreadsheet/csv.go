@@ -0,0 +1,109 @@
+package spreadsheet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// utf8BOM is the byte order mark some programs write at the start of UTF-8 files
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// openCSV opens a .csv file as a workbook with one sheet named after the file. The
+// separator is detected from the first line: a comma, semicolon or tab.
+func openCSV(filePath string) (*Workbook, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	separator, err := detectSeparator(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	return &Workbook{
+		format: CSV,
+		sheets: []string{name},
+		open: func(int) (Rows, error) {
+			f, err := os.Open(filePath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open file: %w", err)
+			}
+
+			reader := bufio.NewReader(f)
+			if bom, _ := reader.Peek(len(utf8BOM)); bytes.Equal(bom, utf8BOM) {
+				reader.Discard(len(utf8BOM))
+			}
+
+			records := csv.NewReader(reader)
+			records.Comma = separator
+			records.FieldsPerRecord = -1
+			records.LazyQuotes = true
+			records.ReuseRecord = true
+			return &csvRows{file: f, records: records}, nil
+		},
+	}, nil
+}
+
+// detectSeparator returns the separator that occurs most often in the first line
+func detectSeparator(r io.Reader) (rune, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	separator, most := ',', 0
+	for _, candidate := range []rune{',', ';', '\t'} {
+		if n := strings.Count(line, string(candidate)); n > most {
+			separator, most = candidate, n
+		}
+	}
+	return separator, nil
+}
+
+// csvRows streams the records of a .csv file
+type csvRows struct {
+	file    *os.File
+	records *csv.Reader
+	row     []string
+	number  int
+	err     error
+	done    bool
+}
+
+func (r *csvRows) Next() bool {
+	if r.err != nil || r.done {
+		return false
+	}
+
+	record, err := r.records.Read()
+	if err == io.EOF {
+		r.done = true
+		return false
+	}
+	if err != nil {
+		r.err = fmt.Errorf("failed to read row %d: %w", r.number+1, err)
+		return false
+	}
+
+	// Records spanning several lines count as one row
+	r.number++
+	r.row = r.row[:0]
+	for i, value := range record {
+		r.row = setCell(r.row, i, value)
+	}
+	r.row = trimRow(r.row)
+	return true
+}
+
+func (r *csvRows) Row() []string { return r.row }
+func (r *csvRows) Number() int   { return r.number }
+func (r *csvRows) Err() error    { return r.err }
+func (r *csvRows) Close() error  { return r.file.Close() }
@@ -0,0 +1,238 @@
+// Package spreadsheet reads the rows of .xlsx, .xlsb and .csv files, such as the
+// settlement files received as email attachments. Rows are streamed, so files with
+// tens of thousands of rows are read without loading the sheet into memory.
+package spreadsheet
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is the file format of a spreadsheet
+type Format string
+
+const (
+	// XLSX is the Office Open XML workbook format
+	XLSX Format = "xlsx"
+	// XLSB is the Excel binary workbook format
+	XLSB Format = "xlsb"
+	// CSV is comma-separated values, or values separated by semicolons or tabs
+	CSV Format = "csv"
+)
+
+// ErrUnsupportedFormat is returned when opening a file that isn't a supported spreadsheet
+var ErrUnsupportedFormat = errors.New("unsupported spreadsheet format")
+
+// ErrSheetNotFound is returned when reading a sheet the workbook doesn't have
+var ErrSheetNotFound = errors.New("sheet not found")
+
+// FormatOf returns the format of a spreadsheet from its file name. The boolean is
+// false if the file isn't a supported spreadsheet.
+func FormatOf(filename string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx", ".xlsm":
+		return XLSX, true
+	case ".xlsb":
+		return XLSB, true
+	case ".csv", ".tsv":
+		return CSV, true
+	}
+	return "", false
+}
+
+// Rows iterates over the rows of a sheet. Cells are returned as text: numbers in their
+// shortest form and dates formatted as 2006-01-02, or 2006-01-02 15:04:05 when they
+// have a time. Missing cells are empty strings and trailing empty cells are dropped.
+type Rows interface {
+	// Next advances to the next row, returning false at the end of the sheet or on error
+	Next() bool
+	// Row returns the cells of the current row. It is only valid until the next call to Next.
+	Row() []string
+	// Number returns the 1-based row number of the current row in the sheet
+	Number() int
+	// Err returns the error that stopped the iteration, if any
+	Err() error
+	// Close releases the resources of the iteration
+	Close() error
+}
+
+// Workbook is an open spreadsheet file
+type Workbook struct {
+	format Format
+	sheets []string
+	// open returns the rows of a sheet by its index in sheets
+	open  func(index int) (Rows, error)
+	close func() error
+}
+
+// Open opens a spreadsheet file, detecting its format from its name
+func Open(path string) (*Workbook, error) {
+	format, ok := FormatOf(path)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, filepath.Ext(path))
+	}
+	return OpenFormat(path, format)
+}
+
+// OpenFormat opens a spreadsheet file of a known format
+func OpenFormat(path string, format Format) (*Workbook, error) {
+	switch format {
+	case XLSX:
+		return openXLSX(path)
+	case XLSB:
+		return openXLSB(path)
+	case CSV:
+		return openCSV(path)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+// Format returns the format of the workbook
+func (w *Workbook) Format() Format {
+	return w.format
+}
+
+// Sheets returns the names of the sheets in the workbook, in order
+func (w *Workbook) Sheets() []string {
+	return append([]string(nil), w.sheets...)
+}
+
+// Sheet returns the name of a sheet as the workbook spells it; names are matched
+// case-insensitively. An empty name returns the first sheet.
+func (w *Workbook) Sheet(name string) (string, error) {
+	index, err := w.sheetIndex(name)
+	if err != nil {
+		return "", err
+	}
+	return w.sheets[index], nil
+}
+
+// Rows returns an iterator over the rows of a sheet. An empty name reads the first sheet.
+func (w *Workbook) Rows(sheet string) (Rows, error) {
+	index, err := w.sheetIndex(sheet)
+	if err != nil {
+		return nil, err
+	}
+	return w.open(index)
+}
+
+// sheetIndex returns the index of a sheet by name, or of the first sheet for an empty name
+func (w *Workbook) sheetIndex(sheet string) (int, error) {
+	if len(w.sheets) == 0 {
+		return 0, fmt.Errorf("%w: workbook has no sheets", ErrSheetNotFound)
+	}
+	if sheet == "" {
+		return 0, nil
+	}
+	for i, name := range w.sheets {
+		if strings.EqualFold(name, sheet) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrSheetNotFound, sheet)
+}
+
+// Close closes the file
+func (w *Workbook) Close() error {
+	if w.close == nil {
+		return nil
+	}
+	return w.close()
+}
+
+// formatNumber formats a numeric cell in its shortest form
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// formatDate formats an Excel date serial number, the days since the epoch of the
+// workbook's date system
+func formatDate(serial float64, date1904 bool) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 24 * 60 * 60)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+
+	if seconds == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// isDateFormat reports whether a number format displays dates or times. Built-in
+// formats are identified by their ID and custom ones by their format code.
+func isDateFormat(id int, code string) bool {
+	switch {
+	case id >= 14 && id <= 22, id >= 27 && id <= 36, id >= 45 && id <= 47, id >= 50 && id <= 58:
+		return true
+	case code == "":
+		return false
+	}
+
+	// Ignore quoted text, escaped characters and bracketed sections such as colours and
+	// locales, except for elapsed time like [h]
+	inQuotes := false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == '\\' || c == '_' || c == '*':
+			i++
+		case c == '[':
+			end := strings.IndexByte(code[i:], ']')
+			if end < 0 {
+				return false
+			}
+			switch strings.ToLower(code[i+1 : i+end]) {
+			case "h", "hh", "m", "mm", "s", "ss":
+				return true
+			}
+			i += end
+		case c == ';':
+			// Only the format of positive numbers matters
+			return false
+		default:
+			switch c | 0x20 {
+			case 'd', 'm', 'y', 'h', 's':
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trimRow drops the trailing empty cells of a row
+func trimRow(row []string) []string {
+	n := len(row)
+	for n > 0 && row[n-1] == "" {
+		n--
+	}
+	return row[:n]
+}
+
+// setCell sets a cell of a row by its 0-based column, growing the row as needed
+func setCell(row []string, column int, value string) []string {
+	if column < 0 || column > maxColumns {
+		return row
+	}
+	for len(row) <= column {
+		row = append(row, "")
+	}
+	row[column] = strings.TrimSpace(value)
+	return row
+}
+
+// maxColumns is the number of columns in an Excel sheet, which bounds rows read from
+// malformed files
+const maxColumns = 16384
@@ -0,0 +1,323 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// writeZip writes a zip archive of files to a temporary path
+func writeZip(t *testing.T, name string, files map[string][]byte) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for file, content := range files {
+		w, err := zw.Create(file)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", file, err)
+		}
+		w.Write(content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+// readTable reads the headers and records of the first sheet of a workbook
+func readTable(t *testing.T, path string) ([]string, [][]string, []int) {
+	t.Helper()
+
+	workbook, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer workbook.Close()
+
+	rows, err := workbook.Rows("")
+	if err != nil {
+		t.Fatalf("Rows failed: %v", err)
+	}
+	table, err := NewTable(rows)
+	if err != nil {
+		t.Fatalf("NewTable failed: %v", err)
+	}
+	defer table.Close()
+
+	var records [][]string
+	var numbers []int
+	for table.Next() {
+		records = append(records, append([]string(nil), table.Record()...))
+		numbers = append(numbers, table.Number())
+	}
+	if err := table.Err(); err != nil {
+		t.Fatalf("Reading the table failed: %v", err)
+	}
+	return table.Headers(), records, numbers
+}
+
+const workbookRels = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.%[1]s"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.%[1]s"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.%[1]s"/>
+<Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.%[1]s"/>
+</Relationships>`
+
+func rels(ext string) []byte {
+	return []byte(fmt.Sprintf(workbookRels, ext))
+}
+
+func TestXLSX(t *testing.T) {
+	path := writeZip(t, "settlement.xlsx", map[string][]byte{
+		"xl/_rels/workbook.xml.rels": rels("xml"),
+		"xl/workbook.xml": []byte(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Brand" sheetId="1" r:id="rId1"/><sheet name="Notes" sheetId="2" r:id="rId2"/></sheets></workbook>`),
+		"xl/sharedStrings.xml": []byte(`<sst><si><t>Transaction Reference</t></si><si><t xml:space="preserve"> Paid  Amount </t></si>
+<si><r><t>TX</t></r><r><t>001</t></r><rPh><t>ignored</t></rPh></si><si><t>Rate</t></si></sst>`),
+		"xl/styles.xml": []byte(`<styleSheet><numFmts><numFmt numFmtId="164" formatCode="dd/mm/yyyy\ hh:mm"/><numFmt numFmtId="165" formatCode="&quot;Rs&quot;\ #,##0.00"/></numFmts>
+<cellStyleXfs><xf numFmtId="14"/></cellStyleXfs>
+<cellXfs><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/><xf numFmtId="165"/></cellXfs></styleSheet>`),
+		"xl/worksheets/sheet1.xml": []byte(`<worksheet><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1"/><c r="D1" t="s"><v>3</v></c><c r="E1" t="s"><v>3</v></c></row>
+<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2" s="3"><v>12166.14</v></c><c r="C2" s="1"><v>45769</v></c><c r="D2" s="2"><v>45769.5</v></c><c r="E2"><v>4.4999999999999998E-2</v></c></row>
+<row r="4"><c r="A4" t="inlineStr"><is><t>TX002</t></is></c><c r="B4" t="b"><v>1</v></c><c r="E4" t="str"><v>#N/A</v></c><c r="F4"><v>7</v></c></row>
+<row r="5"></row>
+</sheetData></worksheet>`),
+		"xl/worksheets/sheet2.xml": []byte(`<worksheet><sheetData><row><c><v>1</v></c><c><v>2</v></c></row></sheetData></worksheet>`),
+	})
+
+	headers, records, numbers := readTable(t, path)
+	wantHeaders := []string{"Transaction Reference", "Paid Amount", "Column 3", "Rate", "Rate (2)"}
+	if !reflect.DeepEqual(headers, wantHeaders) {
+		t.Errorf("Expected headers %q, got %q", wantHeaders, headers)
+	}
+	wantRecords := [][]string{
+		{"TX001", "12166.14", "2025-04-22", "2025-04-22 12:00:00", "0.045"},
+		{"TX002", "TRUE", "", "", "#N/A"},
+	}
+	if !reflect.DeepEqual(records, wantRecords) {
+		t.Errorf("Expected records %q, got %q", wantRecords, records)
+	}
+	if !reflect.DeepEqual(numbers, []int{2, 4}) {
+		t.Errorf("Expected row numbers 2 and 4, got %v", numbers)
+	}
+
+	workbook, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer workbook.Close()
+	if sheets := workbook.Sheets(); !reflect.DeepEqual(sheets, []string{"Brand", "Notes"}) {
+		t.Errorf("Unexpected sheets %q", sheets)
+	}
+	if sheet, err := workbook.Sheet("notes"); err != nil || sheet != "Notes" {
+		t.Errorf("Expected the Notes sheet, got %q (%v)", sheet, err)
+	}
+	rows, err := workbook.Rows("notes")
+	if err != nil {
+		t.Fatalf("Rows failed: %v", err)
+	}
+	defer rows.Close()
+	if !rows.Next() || rows.Number() != 1 || !reflect.DeepEqual(rows.Row(), []string{"1", "2"}) {
+		t.Errorf("Unexpected row %d %q (%v)", rows.Number(), rows.Row(), rows.Err())
+	}
+	if _, err := workbook.Rows("missing"); !errors.Is(err, ErrSheetNotFound) {
+		t.Errorf("Expected ErrSheetNotFound, got %v", err)
+	}
+}
+
+// record encodes an .xlsb record
+func record(recordType int, data ...[]byte) []byte {
+	var buf []byte
+	for _, value := range []int{recordType, len(bytes.Join(data, nil))} {
+		for {
+			b := byte(value & 0x7f)
+			value >>= 7
+			if value > 0 {
+				buf = append(buf, b|0x80)
+				continue
+			}
+			buf = append(buf, b)
+			break
+		}
+	}
+	return append(buf, bytes.Join(data, nil)...)
+}
+
+func u16(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+func f64(v float64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v))
+}
+
+// wide encodes an XLWideString
+func wide(s string) []byte {
+	chars := utf16.Encode([]rune(s))
+	buf := u32(uint32(len(chars)))
+	for _, c := range chars {
+		buf = append(buf, u16(c)...)
+	}
+	return buf
+}
+
+// cell encodes the column and style every cell record starts with
+func cell(column uint32, style uint32) []byte {
+	return append(u32(column), u32(style)...)
+}
+
+func TestXLSB(t *testing.T) {
+	path := writeZip(t, "Benow File 1.xlsb", map[string][]byte{
+		"xl/_rels/workbook.bin.rels": rels("bin"),
+		"xl/workbook.bin": bytes.Join([][]byte{
+			record(brtWbProp, u32(0)),
+			record(brtBundleSh, u32(0), u32(1), wide("rId1"), wide("Benow")),
+			record(brtBundleSh, u32(0), u32(2), wide("rId2"), wide("Notes")),
+		}, nil),
+		"xl/sharedStrings.bin": bytes.Join([][]byte{
+			record(brtSSTItem, []byte{0}, wide("txn_ref_number")),
+			record(brtSSTItem, []byte{0}, wide("BANKDATETIME")),
+			record(brtSSTItem, []byte{1}, wide("TXXER00000002438"), u32(0)),
+		}, nil),
+		"xl/styles.bin": bytes.Join([][]byte{
+			record(brtFmt, u16(164), wide("yyyy-mm-dd")),
+			record(626), record(brtXF, u16(0xffff), u16(14), make([]byte, 12)), record(627),
+			record(brtBeginCellXFs, u32(2)),
+			record(brtXF, u16(0), u16(0), make([]byte, 12)),
+			record(brtXF, u16(0), u16(164), make([]byte, 12)),
+			record(brtEndCellXFs),
+		}, nil),
+		"xl/worksheets/sheet1.bin": bytes.Join([][]byte{
+			record(145),
+			record(brtRowHdr, u32(0), make([]byte, 13)),
+			record(brtCellIsst, cell(0, 0), u32(0)),
+			record(brtCellIsst, cell(1, 0), u32(1)),
+			record(brtCellSt, cell(2, 0), wide("Amount")),
+			record(brtCellSt, cell(3, 0), wide("Ok")),
+			record(brtRowHdr, u32(1), make([]byte, 13)),
+			record(brtCellIsst, cell(0, 0), u32(2)),
+			record(brtCellRk, cell(1, 1), u32(45769<<2|2)),
+			record(brtCellRk, cell(2, 0), u32(1161800<<2|3)),
+			record(brtFmlaBool, cell(3, 0), []byte{1}, u16(0)),
+			record(brtRowHdr, u32(2), make([]byte, 13)),
+			record(brtCellReal, cell(0, 0), f64(2027.69)),
+			record(brtCellError, cell(2, 0), []byte{0x2a}),
+			record(brtCellBlank, cell(3, 0)),
+			record(brtEndSheetData),
+		}, nil),
+		"xl/worksheets/sheet2.bin": record(145),
+	})
+
+	headers, records, numbers := readTable(t, path)
+	if want := []string{"txn_ref_number", "BANKDATETIME", "Amount", "Ok"}; !reflect.DeepEqual(headers, want) {
+		t.Errorf("Expected headers %q, got %q", want, headers)
+	}
+	wantRecords := [][]string{
+		{"TXXER00000002438", "2025-04-22", "11618", "TRUE"},
+		{"2027.69", "", "#N/A", ""},
+	}
+	if !reflect.DeepEqual(records, wantRecords) {
+		t.Errorf("Expected records %q, got %q", wantRecords, records)
+	}
+	if !reflect.DeepEqual(numbers, []int{2, 3}) {
+		t.Errorf("Expected row numbers 2 and 3, got %v", numbers)
+	}
+
+	workbook, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer workbook.Close()
+	if sheets := workbook.Sheets(); !reflect.DeepEqual(sheets, []string{"Benow", "Notes"}) {
+		t.Errorf("Unexpected sheets %q", sheets)
+	}
+
+	// A sheet without rows is an empty table
+	rows, err := workbook.Rows("Notes")
+	if err != nil {
+		t.Fatalf("Rows failed: %v", err)
+	}
+	table, err := NewTable(rows)
+	if err != nil || table.Headers() != nil || table.Next() {
+		t.Errorf("Expected an empty table, got %q (%v)", table.Headers(), err)
+	}
+	table.Close()
+}
+
+func TestCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "brand.csv")
+	content := "\xef\xbb\xbfTransaction Reference;Paid Amount;Reason\n" +
+		"TX001;11618;\"Eligible; as per\narrangement\"\n" +
+		"\n" +
+		"TX002;12018\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+
+	headers, records, numbers := readTable(t, path)
+	if want := []string{"Transaction Reference", "Paid Amount", "Reason"}; !reflect.DeepEqual(headers, want) {
+		t.Errorf("Expected headers %q, got %q", want, headers)
+	}
+	wantRecords := [][]string{
+		{"TX001", "11618", "Eligible; as per\narrangement"},
+		{"TX002", "12018", ""},
+	}
+	if !reflect.DeepEqual(records, wantRecords) {
+		t.Errorf("Expected records %q, got %q", wantRecords, records)
+	}
+	if !reflect.DeepEqual(numbers, []int{2, 3}) {
+		t.Errorf("Expected row numbers 2 and 3, got %v", numbers)
+	}
+
+	workbook, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer workbook.Close()
+	if sheets := workbook.Sheets(); !reflect.DeepEqual(sheets, []string{"brand"}) {
+		t.Errorf("Unexpected sheets %q", sheets)
+	}
+}
+
+func TestOpenUnsupported(t *testing.T) {
+	if _, err := Open("statement.pdf"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestIsDateFormat(t *testing.T) {
+	tests := []struct {
+		id   int
+		code string
+		want bool
+	}{
+		{0, "General", false},
+		{14, "", true},
+		{164, "dd/mm/yyyy", true},
+		{165, `"Rs" #,##0.00`, false},
+		{166, `[Red]0.00`, false},
+		{167, `[h]:mm`, true},
+		{168, `[$-409]mmm d, yyyy`, true},
+		{169, `0.00\d`, false},
+		{170, `0;[Red]-0;"day"`, false},
+	}
+	for _, test := range tests {
+		if got := isDateFormat(test.id, test.code); got != test.want {
+			t.Errorf("isDateFormat(%d, %q) = %v, want %v", test.id, test.code, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package spreadsheet
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Table reads a sheet as a header row followed by records. The header is the first
+// row that isn't empty. Headers are trimmed, with empty headers named "Column N" and
+// repeated ones numbered, so they can be used as keys. Empty rows are skipped, and
+// every record has one value per header; values in columns without a header are dropped.
+type Table struct {
+	rows    Rows
+	headers []string
+	record  []string
+	number  int
+}
+
+// NewTable reads the header row of a sheet. A sheet without rows has no headers and no
+// records.
+func NewTable(rows Rows) (*Table, error) {
+	t := &Table{rows: rows}
+	for rows.Next() {
+		if row := rows.Row(); len(row) > 0 {
+			t.headers = normalizeHeaders(row)
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Headers returns the normalized headers of the table
+func (t *Table) Headers() []string {
+	return t.headers
+}
+
+// Next advances to the next record, returning false at the end of the sheet or on error
+func (t *Table) Next() bool {
+	if t.headers == nil {
+		return false
+	}
+	for t.rows.Next() {
+		row := t.rows.Row()
+		if len(row) == 0 {
+			continue
+		}
+
+		if cap(t.record) < len(t.headers) {
+			t.record = make([]string, len(t.headers))
+		}
+		t.record = t.record[:len(t.headers)]
+		n := copy(t.record, row)
+		for i := n; i < len(t.record); i++ {
+			t.record[i] = ""
+		}
+		t.number = t.rows.Number()
+		return true
+	}
+	return false
+}
+
+// Record returns the values of the current record, one per header. It is only valid
+// until the next call to Next.
+func (t *Table) Record() []string {
+	return t.record
+}
+
+// Number returns the row number of the current record in the sheet
+func (t *Table) Number() int {
+	return t.number
+}
+
+// Err returns the error that stopped reading the table, if any
+func (t *Table) Err() error {
+	return t.rows.Err()
+}
+
+// Close releases the rows of the table
+func (t *Table) Close() error {
+	return t.rows.Close()
+}
+
+// normalizeHeaders trims headers and collapses their whitespace, names empty ones by
+// their column and numbers repeated ones: Rate, Rate (2)
+func normalizeHeaders(row []string) []string {
+	headers := make([]string, len(row))
+	seen := make(map[string]int, len(row))
+	for i, header := range row {
+		header = strings.Join(strings.Fields(header), " ")
+		if header == "" {
+			header = fmt.Sprintf("Column %d", i+1)
+		}
+
+		key := strings.ToLower(header)
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			header = fmt.Sprintf("%s (%d)", header, n)
+		}
+		headers[i] = header
+	}
+	return headers
+}
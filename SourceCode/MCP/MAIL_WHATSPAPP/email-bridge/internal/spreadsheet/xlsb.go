@@ -0,0 +1,464 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf16"
+)
+
+// Record types of the Excel binary format used here, from [MS-XLSB] section 2.3
+const (
+	brtRowHdr        = 0
+	brtCellBlank     = 1
+	brtCellRk        = 2
+	brtCellError     = 3
+	brtCellBool      = 4
+	brtCellReal      = 5
+	brtCellSt        = 6
+	brtCellIsst      = 7
+	brtFmlaString    = 8
+	brtFmlaNum       = 9
+	brtFmlaBool      = 10
+	brtFmlaError     = 11
+	brtSSTItem       = 19
+	brtFmt           = 44
+	brtXF            = 47
+	brtEndSheetData  = 146
+	brtWbProp        = 153
+	brtBundleSh      = 156
+	brtBeginCellXFs  = 617
+	brtEndCellXFs    = 618
+	maxXLSBRecordLen = 1 << 24
+)
+
+// errShortRecord is returned for a record too short for its type
+var errShortRecord = errors.New("record too short")
+
+// recordReader reads the records of a binary part. Each record is a type and a length,
+// both variable-length integers of 7 bits per byte, followed by its data.
+type recordReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func newRecordReader(r io.Reader) *recordReader {
+	return &recordReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// next returns the type and data of the next record. The data is only valid until the
+// next call.
+func (rr *recordReader) next() (int, []byte, error) {
+	recordType, err := rr.varint(2)
+	if err != nil {
+		return 0, nil, err
+	}
+	length, err := rr.varint(4)
+	if err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	if length > maxXLSBRecordLen {
+		return 0, nil, fmt.Errorf("record of %d bytes is too long", length)
+	}
+
+	if cap(rr.buf) < length {
+		rr.buf = make([]byte, length)
+	}
+	data := rr.buf[:length]
+	if _, err := io.ReadFull(rr.r, data); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	return recordType, data, nil
+}
+
+// varint reads a variable-length integer of up to maxBytes bytes
+func (rr *recordReader) varint(maxBytes int) (int, error) {
+	value := 0
+	for i := 0; i < maxBytes; i++ {
+		b, err := rr.r.ReadByte()
+		if err != nil {
+			if i > 0 {
+				return 0, unexpectedEOF(err)
+			}
+			return 0, err
+		}
+		value |= int(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return value, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readWideString reads an XLWideString, a 32-bit character count followed by UTF-16
+// characters, and returns it with the rest of the data. A count of 0xFFFFFFFF is a
+// null string.
+func readWideString(data []byte) (string, []byte, error) {
+	if len(data) < 4 {
+		return "", nil, errShortRecord
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+	if count == math.MaxUint32 {
+		return "", data, nil
+	}
+	if uint64(len(data)) < uint64(count)*2 {
+		return "", nil, errShortRecord
+	}
+
+	chars := make([]uint16, count)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(chars)), data[2*count:], nil
+}
+
+// xlsbWorkbook holds what is needed to read the sheets of an .xlsb file
+type xlsbWorkbook struct {
+	zip        *zip.ReadCloser
+	sheets     []zipSheet
+	strings    []string
+	dateStyles []bool
+	date1904   bool
+}
+
+// openXLSB opens an .xlsb file, reading its sheet list, shared strings and styles
+func openXLSB(filePath string) (*Workbook, error) {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workbook: %w", err)
+	}
+
+	wb := &xlsbWorkbook{zip: zr}
+	if err := wb.load(); err != nil {
+		zr.Close()
+		return nil, err
+	}
+
+	workbook := &Workbook{format: XLSB, close: zr.Close}
+	for _, sheet := range wb.sheets {
+		workbook.sheets = append(workbook.sheets, sheet.name)
+	}
+	workbook.open = wb.rows
+	return workbook, nil
+}
+
+// load reads the workbook part and the parts it refers to
+func (wb *xlsbWorkbook) load() error {
+	const workbookPart = "xl/workbook.bin"
+
+	rels, err := readRelationships(&wb.zip.Reader, workbookPart)
+	if err != nil {
+		return err
+	}
+	targets := make(map[string]string, len(rels))
+	for _, rel := range rels {
+		targets[rel.ID] = rel.Target
+	}
+
+	err = wb.readPart(workbookPart, func(recordType int, data []byte) error {
+		switch recordType {
+		case brtWbProp:
+			if len(data) < 4 {
+				return errShortRecord
+			}
+			wb.date1904 = binary.LittleEndian.Uint32(data)&1 != 0
+		case brtBundleSh:
+			// hsState and iTabID, then the relationship ID and name of the sheet
+			if len(data) < 8 {
+				return errShortRecord
+			}
+			relID, rest, err := readWideString(data[8:])
+			if err != nil {
+				return err
+			}
+			name, _, err := readWideString(rest)
+			if err != nil {
+				return err
+			}
+			target, ok := targets[relID]
+			if !ok {
+				return fmt.Errorf("sheet %s has no part", name)
+			}
+			wb.sheets = append(wb.sheets, zipSheet{name: name, part: target})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read workbook: %w", err)
+	}
+
+	if part := relationshipOfType(rels, "sharedStrings"); part != "" {
+		err := wb.readPart(part, func(recordType int, data []byte) error {
+			if recordType != brtSSTItem {
+				return nil
+			}
+			// A flags byte, then the text; formatting runs and phonetic text follow
+			if len(data) < 1 {
+				return errShortRecord
+			}
+			text, _, err := readWideString(data[1:])
+			if err != nil {
+				return err
+			}
+			wb.strings = append(wb.strings, text)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read shared strings: %w", err)
+		}
+	}
+
+	if part := relationshipOfType(rels, "styles"); part != "" {
+		formats := make(map[int]string)
+		inCellXfs := false
+		err := wb.readPart(part, func(recordType int, data []byte) error {
+			switch recordType {
+			case brtFmt:
+				if len(data) < 2 {
+					return errShortRecord
+				}
+				code, _, err := readWideString(data[2:])
+				if err != nil {
+					return err
+				}
+				formats[int(binary.LittleEndian.Uint16(data))] = code
+			case brtBeginCellXFs:
+				inCellXfs = true
+			case brtEndCellXFs:
+				inCellXfs = false
+			case brtXF:
+				if !inCellXfs {
+					return nil
+				}
+				// ixfeParent, then the number format
+				if len(data) < 4 {
+					return errShortRecord
+				}
+				id := int(binary.LittleEndian.Uint16(data[2:]))
+				wb.dateStyles = append(wb.dateStyles, isDateFormat(id, formats[id]))
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read styles: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readPart calls handle for each record of a binary part
+func (wb *xlsbWorkbook) readPart(part string, handle func(recordType int, data []byte) error) error {
+	f, err := openZipFile(&wb.zip.Reader, part)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	records := newRecordReader(f)
+	for {
+		recordType, data, err := records.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := handle(recordType, data); err != nil {
+			return err
+		}
+	}
+}
+
+// rows returns an iterator over the rows of a sheet
+func (wb *xlsbWorkbook) rows(index int) (Rows, error) {
+	f, err := openZipFile(&wb.zip.Reader, wb.sheets[index].part)
+	if err != nil {
+		return nil, err
+	}
+	return &xlsbRows{workbook: wb, file: f, records: newRecordReader(f), pending: -1}, nil
+}
+
+// xlsbRows streams the rows of an .xlsb sheet. A row's cells follow its BrtRowHdr
+// record, so a row is complete when the next row header or the end of the sheet data
+// is read.
+type xlsbRows struct {
+	workbook *xlsbWorkbook
+	file     io.ReadCloser
+	records  *recordReader
+	row      []string
+	number   int
+	// pending is the 0-based index of a row whose header has been read, or -1
+	pending int
+	done    bool
+	err     error
+}
+
+func (r *xlsbRows) Next() bool {
+	if r.err != nil || r.done {
+		return false
+	}
+
+	r.row = r.row[:0]
+	for {
+		recordType, data, err := r.records.next()
+		if err == io.EOF || (err == nil && recordType == brtEndSheetData) {
+			r.done = true
+			return r.finishRow()
+		}
+		if err != nil {
+			r.err = fmt.Errorf("failed to read sheet: %w", err)
+			return false
+		}
+
+		switch {
+		case recordType == brtRowHdr:
+			if len(data) < 4 {
+				r.err = fmt.Errorf("failed to read sheet: %w", errShortRecord)
+				return false
+			}
+			index := int(binary.LittleEndian.Uint32(data))
+			if r.finishRow() {
+				r.pending = index
+				return true
+			}
+			r.pending = index
+		case recordType >= brtCellBlank && recordType <= brtFmlaError:
+			if r.pending < 0 {
+				continue
+			}
+			column, value, err := r.cell(recordType, data)
+			if err != nil {
+				r.err = fmt.Errorf("failed to read row %d: %w", r.pending+1, err)
+				return false
+			}
+			r.row = setCell(r.row, column, value)
+		}
+	}
+}
+
+// finishRow completes the pending row and reports whether there was one
+func (r *xlsbRows) finishRow() bool {
+	if r.pending < 0 {
+		return false
+	}
+	r.number = r.pending + 1
+	r.pending = -1
+	r.row = trimRow(r.row)
+	return true
+}
+
+// cell decodes a cell record into its column and formatted value
+func (r *xlsbRows) cell(recordType int, data []byte) (int, string, error) {
+	// Every cell starts with its column and style
+	if len(data) < 8 {
+		return 0, "", errShortRecord
+	}
+	column := int(binary.LittleEndian.Uint32(data))
+	style := int(binary.LittleEndian.Uint32(data[4:]) & 0xffffff)
+	data = data[8:]
+
+	switch recordType {
+	case brtCellBlank:
+		return column, "", nil
+	case brtCellRk:
+		if len(data) < 4 {
+			return 0, "", errShortRecord
+		}
+		return column, r.formatNumber(decodeRK(binary.LittleEndian.Uint32(data)), style), nil
+	case brtCellReal, brtFmlaNum:
+		if len(data) < 8 {
+			return 0, "", errShortRecord
+		}
+		return column, r.formatNumber(math.Float64frombits(binary.LittleEndian.Uint64(data)), style), nil
+	case brtCellSt, brtFmlaString:
+		text, _, err := readWideString(data)
+		return column, text, err
+	case brtCellIsst:
+		if len(data) < 4 {
+			return 0, "", errShortRecord
+		}
+		index := int(binary.LittleEndian.Uint32(data))
+		if index >= len(r.workbook.strings) {
+			return column, "", nil
+		}
+		return column, r.workbook.strings[index], nil
+	case brtCellBool, brtFmlaBool:
+		if len(data) < 1 {
+			return 0, "", errShortRecord
+		}
+		if data[0] != 0 {
+			return column, "TRUE", nil
+		}
+		return column, "FALSE", nil
+	case brtCellError, brtFmlaError:
+		if len(data) < 1 {
+			return 0, "", errShortRecord
+		}
+		return column, errorText(data[0]), nil
+	}
+	return column, "", nil
+}
+
+// formatNumber formats a numeric cell as a date if its style has a date format
+func (r *xlsbRows) formatNumber(value float64, style int) string {
+	if style < len(r.workbook.dateStyles) && r.workbook.dateStyles[style] {
+		return formatDate(value, r.workbook.date1904)
+	}
+	return formatNumber(value)
+}
+
+func (r *xlsbRows) Row() []string { return r.row }
+func (r *xlsbRows) Number() int   { return r.number }
+func (r *xlsbRows) Err() error    { return r.err }
+func (r *xlsbRows) Close() error  { return r.file.Close() }
+
+// decodeRK decodes an RkNumber, a number stored in 30 bits as either an integer or the
+// high bits of a double, optionally multiplied by 100
+func decodeRK(rk uint32) float64 {
+	var value float64
+	if rk&2 != 0 {
+		value = float64(int32(rk) >> 2)
+	} else {
+		value = math.Float64frombits(uint64(rk&0xfffffffc) << 32)
+	}
+	if rk&1 != 0 {
+		value /= 100
+	}
+	return value
+}
+
+// errorText returns the text Excel shows for an error value
+func errorText(code byte) string {
+	switch code {
+	case 0x00:
+		return "#NULL!"
+	case 0x07:
+		return "#DIV/0!"
+	case 0x0f:
+		return "#VALUE!"
+	case 0x17:
+		return "#REF!"
+	case 0x1d:
+		return "#NAME?"
+	case 0x24:
+		return "#NUM!"
+	case 0x2a:
+		return "#N/A"
+	case 0x2b:
+		return "#GETTING_DATA"
+	}
+	return "#ERROR!"
+}
@@ -0,0 +1,453 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// relationship is an entry of a part's relationships, such as a sheet of a workbook
+type relationship struct {
+	ID     string
+	Type   string
+	Target string
+}
+
+// readRelationships reads the relationships of a part, resolving their targets to
+// paths in the package
+func readRelationships(zr *zip.Reader, part string) ([]relationship, error) {
+	relsPath := path.Join(path.Dir(part), "_rels", path.Base(part)+".rels")
+	f, err := openZipFile(zr, relsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rels []relationship
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return rels, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", relsPath, err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Relationship" {
+			continue
+		}
+		rel := relationship{ID: attr(start, "Id"), Type: attr(start, "Type"), Target: attr(start, "Target")}
+		if strings.HasPrefix(rel.Target, "/") {
+			rel.Target = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			rel.Target = path.Join(path.Dir(part), rel.Target)
+		}
+		rels = append(rels, rel)
+	}
+}
+
+// relationshipOfType returns the target of the first relationship of a type, which is
+// matched by the last element of its URI
+func relationshipOfType(rels []relationship, relType string) string {
+	for _, rel := range rels {
+		if strings.HasSuffix(rel.Type, "/"+relType) {
+			return rel.Target
+		}
+	}
+	return ""
+}
+
+// openZipFile opens a file of a zip archive by name
+func openZipFile(zr *zip.Reader, name string) (io.ReadCloser, error) {
+	for _, f := range zr.File {
+		if strings.EqualFold(f.Name, name) {
+			return f.Open()
+		}
+	}
+	return nil, fmt.Errorf("%s not found in workbook", name)
+}
+
+// attr returns the value of an attribute by its local name
+func attr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// zipSheet is a sheet of a zipped workbook
+type zipSheet struct {
+	name string
+	part string
+}
+
+// xlsxWorkbook holds what is needed to read the sheets of an .xlsx file
+type xlsxWorkbook struct {
+	zip        *zip.ReadCloser
+	sheets     []zipSheet
+	strings    []string
+	dateStyles []bool
+	date1904   bool
+}
+
+// openXLSX opens an .xlsx file, reading its sheet list, shared strings and styles
+func openXLSX(filePath string) (*Workbook, error) {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workbook: %w", err)
+	}
+
+	wb := &xlsxWorkbook{zip: zr}
+	if err := wb.load(); err != nil {
+		zr.Close()
+		return nil, err
+	}
+
+	workbook := &Workbook{format: XLSX, close: zr.Close}
+	for _, sheet := range wb.sheets {
+		workbook.sheets = append(workbook.sheets, sheet.name)
+	}
+	workbook.open = wb.rows
+	return workbook, nil
+}
+
+// load reads the workbook part and the parts it refers to
+func (wb *xlsxWorkbook) load() error {
+	const workbookPart = "xl/workbook.xml"
+
+	rels, err := readRelationships(&wb.zip.Reader, workbookPart)
+	if err != nil {
+		return err
+	}
+	targets := make(map[string]string, len(rels))
+	for _, rel := range rels {
+		targets[rel.ID] = rel.Target
+	}
+
+	f, err := openZipFile(&wb.zip.Reader, workbookPart)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read workbook: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "workbookPr":
+			value := attr(start, "date1904")
+			wb.date1904 = value == "1" || value == "true"
+		case "sheet":
+			target, ok := targets[attr(start, "id")]
+			if !ok {
+				return fmt.Errorf("sheet %s has no part", attr(start, "name"))
+			}
+			wb.sheets = append(wb.sheets, zipSheet{name: attr(start, "name"), part: target})
+		}
+	}
+
+	if part := relationshipOfType(rels, "sharedStrings"); part != "" {
+		if wb.strings, err = wb.readSharedStrings(part); err != nil {
+			return err
+		}
+	}
+	if part := relationshipOfType(rels, "styles"); part != "" {
+		if wb.dateStyles, err = wb.readStyles(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSharedStrings reads the strings that text cells refer to by index. Rich text
+// runs are joined, and phonetic guides are left out.
+func (wb *xlsxWorkbook) readSharedStrings(part string) ([]string, error) {
+	f, err := openZipFile(&wb.zip.Reader, part)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var strs []string
+	var text strings.Builder
+	inText, inPhonetic := false, false
+
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return strs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read shared strings: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				text.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				inPhonetic = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				strs = append(strs, text.String())
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			}
+		case xml.CharData:
+			if inText && !inPhonetic {
+				text.Write(t)
+			}
+		}
+	}
+}
+
+// readStyles reads which cell styles have a date format, indexed by style
+func (wb *xlsxWorkbook) readStyles(part string) ([]bool, error) {
+	f, err := openZipFile(&wb.zip.Reader, part)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	formats := make(map[int]string)
+	var dateStyles []bool
+	inCellXfs := false
+
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return dateStyles, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read styles: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "numFmt":
+				id, _ := strconv.Atoi(attr(t, "numFmtId"))
+				formats[id] = attr(t, "formatCode")
+			case "cellXfs":
+				inCellXfs = true
+			case "xf":
+				if inCellXfs {
+					id, _ := strconv.Atoi(attr(t, "numFmtId"))
+					dateStyles = append(dateStyles, isDateFormat(id, formats[id]))
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "cellXfs" {
+				inCellXfs = false
+			}
+		}
+	}
+}
+
+// rows returns an iterator over the rows of a sheet
+func (wb *xlsxWorkbook) rows(index int) (Rows, error) {
+	f, err := openZipFile(&wb.zip.Reader, wb.sheets[index].part)
+	if err != nil {
+		return nil, err
+	}
+	return &xlsxRows{workbook: wb, file: f, decoder: xml.NewDecoder(f)}, nil
+}
+
+// xlsxRows streams the rows of an .xlsx sheet
+type xlsxRows struct {
+	workbook *xlsxWorkbook
+	file     io.ReadCloser
+	decoder  *xml.Decoder
+	row      []string
+	number   int
+	err      error
+}
+
+func (r *xlsxRows) Next() bool {
+	if r.err != nil || r.decoder == nil {
+		return false
+	}
+
+	for {
+		token, err := r.decoder.Token()
+		if err == io.EOF {
+			r.decoder = nil
+			return false
+		}
+		if err != nil {
+			r.err = fmt.Errorf("failed to read sheet: %w", err)
+			return false
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		// Rows without a number follow the previous one
+		r.number++
+		if n, err := strconv.Atoi(attr(start, "r")); err == nil {
+			r.number = n
+		}
+		if err := r.readRow(); err != nil {
+			r.err = err
+			return false
+		}
+		return true
+	}
+}
+
+// readRow reads the cells of the row element the decoder is in
+func (r *xlsxRows) readRow() error {
+	r.row = r.row[:0]
+	column := -1
+
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return fmt.Errorf("failed to read row %d: %w", r.number, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				continue
+			}
+			// Cells without a reference follow the previous one
+			column++
+			if ref := attr(t, "r"); ref != "" {
+				if c, ok := columnIndex(ref); ok {
+					column = c
+				}
+			}
+			value, err := r.readCell(t)
+			if err != nil {
+				return err
+			}
+			r.row = setCell(r.row, column, value)
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				r.row = trimRow(r.row)
+				return nil
+			}
+		}
+	}
+}
+
+// readCell reads the value of a cell element and formats it by its type and style
+func (r *xlsxRows) readCell(start xml.StartElement) (string, error) {
+	var value, inline strings.Builder
+	inValue, inInline := false, false
+
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("failed to read cell: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "v":
+				inValue = true
+			case "t":
+				inInline = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v":
+				inValue = false
+			case "t":
+				inInline = false
+			case "c":
+				return r.formatCell(attr(start, "t"), attr(start, "s"), value.String(), inline.String()), nil
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			} else if inInline {
+				inline.Write(t)
+			}
+		}
+	}
+}
+
+// formatCell formats a cell value by its type and style
+func (r *xlsxRows) formatCell(cellType string, style string, value string, inline string) string {
+	switch cellType {
+	case "s":
+		index, err := strconv.Atoi(value)
+		if err != nil || index < 0 || index >= len(r.workbook.strings) {
+			return ""
+		}
+		return r.workbook.strings[index]
+	case "inlineStr":
+		return inline
+	case "b":
+		if value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "str", "e", "d":
+		return value
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	if index, err := strconv.Atoi(style); err == nil && index >= 0 && index < len(r.workbook.dateStyles) && r.workbook.dateStyles[index] {
+		return formatDate(number, r.workbook.date1904)
+	}
+	return formatNumber(number)
+}
+
+func (r *xlsxRows) Row() []string { return r.row }
+func (r *xlsxRows) Number() int   { return r.number }
+func (r *xlsxRows) Err() error    { return r.err }
+func (r *xlsxRows) Close() error  { return r.file.Close() }
+
+// columnIndex returns the 0-based column of a cell reference such as B12
+func columnIndex(ref string) (int, bool) {
+	column := 0
+	i := 0
+	for ; i < len(ref); i++ {
+		c := ref[i] | 0x20
+		if c < 'a' || c > 'z' {
+			break
+		}
+		column = column*26 + int(c-'a') + 1
+	}
+	if i == 0 || column > maxColumns {
+		return 0, false
+	}
+	return column - 1, true
+}
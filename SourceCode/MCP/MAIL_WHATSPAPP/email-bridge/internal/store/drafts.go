@@ -0,0 +1,106 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+const draftColumns = "id, account_id, email, revision, folder, email_id, created_at, updated_at"
+
+// StoreDraft saves a draft, replacing the stored revision if there is one
+func (s *SQLiteStore) StoreDraft(draft models.Draft) error {
+	email, err := json.Marshal(draft.Email)
+	if err != nil {
+		return fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT OR REPLACE INTO drafts (`+draftColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		draft.ID, draft.AccountID, string(email), draft.Revision, draft.Folder, draft.EmailID,
+		formatTimestamp(draft.CreatedAt), formatTimestamp(draft.UpdatedAt))
+	return err
+}
+
+// GetDraft retrieves a draft. It returns sql.ErrNoRows if there is none.
+func (s *SQLiteStore) GetDraft(id string) (models.Draft, error) {
+	row := s.db.QueryRow("SELECT "+draftColumns+" FROM drafts WHERE id = ?", id)
+	return scanDraft(row)
+}
+
+// GetDrafts returns the drafts of an account, most recently edited first. An empty
+// account ID returns the drafts of all accounts.
+func (s *SQLiteStore) GetDrafts(accountID string) ([]models.Draft, error) {
+	query := "SELECT " + draftColumns + " FROM drafts"
+	var args []interface{}
+	if accountID != "" {
+		query += " WHERE account_id = ?"
+		args = append(args, accountID)
+	}
+	query += " ORDER BY updated_at DESC, id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []models.Draft
+	for rows.Next() {
+		draft, err := scanDraft(rows)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, draft)
+	}
+
+	return drafts, rows.Err()
+}
+
+// DeleteDraft deletes a draft. It returns sql.ErrNoRows if there is none.
+func (s *SQLiteStore) DeleteDraft(id string) error {
+	result, err := s.db.Exec("DELETE FROM drafts WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// scanDraft scans a row of draftColumns
+func scanDraft(row rowScanner) (models.Draft, error) {
+	var draft models.Draft
+	var email, createdAt, updatedAt string
+	var folder, emailID sql.NullString
+
+	err := row.Scan(&draft.ID, &draft.AccountID, &email, &draft.Revision, &folder, &emailID, &createdAt, &updatedAt)
+	if err != nil {
+		return draft, err
+	}
+
+	if err := json.Unmarshal([]byte(email), &draft.Email); err != nil {
+		return draft, fmt.Errorf("failed to decode email of draft %s: %w", draft.ID, err)
+	}
+	draft.Folder = folder.String
+	draft.EmailID = emailID.String
+
+	if draft.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return draft, err
+	}
+	if draft.UpdatedAt, err = parseTimestamp(updatedAt); err != nil {
+		return draft, err
+	}
+
+	return draft, nil
+}
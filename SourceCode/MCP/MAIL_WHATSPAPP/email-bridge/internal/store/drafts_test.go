@@ -0,0 +1,70 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+func TestDrafts(t *testing.T) {
+	s := newTestStore(t)
+	created := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	for i, id := range []string{"draft-1", "draft-2"} {
+		draft := models.Draft{
+			ID:        id,
+			AccountID: "acct",
+			Email:     models.Email{ID: id + "-email", Subject: "Summary", Headers: map[string]string{"In-Reply-To": "<a@example.com>"}},
+			Revision:  1,
+			CreatedAt: created,
+			UpdatedAt: created.Add(time.Duration(i) * time.Minute),
+		}
+		if err := s.StoreDraft(draft); err != nil {
+			t.Fatalf("Failed to store %s: %v", id, err)
+		}
+	}
+
+	// Storing a new revision replaces the draft
+	draft, err := s.GetDraft("draft-1")
+	if err != nil {
+		t.Fatalf("GetDraft failed: %v", err)
+	}
+	draft.Revision = 2
+	draft.Folder = "Drafts"
+	draft.EmailID = "acct-7"
+	draft.Email.TextContent = "Edited"
+	draft.UpdatedAt = created.Add(time.Hour)
+	if err := s.StoreDraft(draft); err != nil {
+		t.Fatalf("StoreDraft failed: %v", err)
+	}
+
+	draft, err = s.GetDraft("draft-1")
+	if err != nil {
+		t.Fatalf("GetDraft failed: %v", err)
+	}
+	if draft.Revision != 2 || draft.EmailID != "acct-7" || draft.Email.TextContent != "Edited" ||
+		draft.Email.Headers["In-Reply-To"] != "<a@example.com>" || !draft.CreatedAt.Equal(created) {
+		t.Errorf("Draft was not stored intact: %+v", draft)
+	}
+
+	// Most recently edited first
+	drafts, err := s.GetDrafts("acct")
+	if err != nil || len(drafts) != 2 || drafts[0].ID != "draft-1" || drafts[1].ID != "draft-2" {
+		t.Errorf("Unexpected drafts %v (%v)", drafts, err)
+	}
+	if drafts, _ := s.GetDrafts("other"); len(drafts) != 0 {
+		t.Errorf("Expected no drafts for another account, got %v", drafts)
+	}
+
+	if err := s.DeleteDraft("draft-1"); err != nil {
+		t.Fatalf("DeleteDraft failed: %v", err)
+	}
+	if _, err := s.GetDraft("draft-1"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows after deleting, got %v", err)
+	}
+	if err := s.DeleteDraft("draft-1"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows deleting a missing draft, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+const eventColumns = "id, type, account_id, folder, old_folder, email_id, data, created_at"
+
+// eventData is the payload of an event, stored as JSON
+type eventData struct {
+	Email   *models.Email        `json:"email,omitempty"`
+	Folders []models.Folder      `json:"folders,omitempty"`
+	Resync  *models.FolderResync `json:"resync,omitempty"`
+}
+
+// AppendEvent adds an event to the event log and returns its ID. The event's ID is
+// ignored; IDs are assigned in increasing order.
+func (s *SQLiteStore) AppendEvent(event models.Event) (int64, error) {
+	data, err := json.Marshal(eventData{Email: event.Email, Folders: event.Folders, Resync: event.Resync})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO events (type, account_id, folder, old_folder, email_id, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		event.Type, event.AccountID, event.Folder, event.OldFolder, event.EmailID, string(data),
+		formatTimestamp(event.CreatedAt))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// GetEventsAfter returns up to limit events logged after the event with the given ID,
+// oldest first. A non-empty account ID or folder only returns the events of that
+// account or concerning that folder; events that concern no folder, such as folder
+// syncs, don't match a folder.
+func (s *SQLiteStore) GetEventsAfter(afterID int64, accountID, folder string, limit int) ([]models.Event, error) {
+	query := "SELECT " + eventColumns + " FROM events WHERE id > ?"
+	args := []interface{}{afterID}
+	if accountID != "" {
+		query += " AND account_id = ?"
+		args = append(args, accountID)
+	}
+	if folder != "" {
+		query += " AND (folder = ? OR old_folder = ?)"
+		args = append(args, folder, folder)
+	}
+	query += " ORDER BY id LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// DeleteEventsBefore removes the events logged before a time and returns how many
+// were removed
+func (s *SQLiteStore) DeleteEventsBefore(before time.Time) (int64, error) {
+	result, err := s.db.Exec("DELETE FROM events WHERE created_at < ?", formatTimestamp(before))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// scanEvent scans a row of eventColumns
+func scanEvent(row rowScanner) (models.Event, error) {
+	var event models.Event
+	var accountID, folder, oldFolder, emailID, data sql.NullString
+	var createdAt string
+
+	err := row.Scan(&event.ID, &event.Type, &accountID, &folder, &oldFolder, &emailID, &data, &createdAt)
+	if err != nil {
+		return event, err
+	}
+	event.AccountID = accountID.String
+	event.Folder = folder.String
+	event.OldFolder = oldFolder.String
+	event.EmailID = emailID.String
+
+	if data.String != "" {
+		var payload eventData
+		if err := json.Unmarshal([]byte(data.String), &payload); err != nil {
+			return event, fmt.Errorf("failed to decode event %d: %w", event.ID, err)
+		}
+		event.Email = payload.Email
+		event.Folders = payload.Folders
+		event.Resync = payload.Resync
+	}
+
+	if event.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return event, err
+	}
+
+	return event, nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+func TestEventLog(t *testing.T) {
+	s := newTestStore(t)
+	logged := time.Date(2025, 5, 2, 9, 0, 0, 0, time.UTC)
+
+	events := []models.Event{
+		{Type: "new", AccountID: "acct", Folder: "INBOX", EmailID: "email-1", Email: &models.Email{ID: "email-1", Subject: "Settlement"}},
+		{Type: "moved", AccountID: "acct", Folder: "Archive", OldFolder: "INBOX", EmailID: "email-2"},
+		{Type: "new", AccountID: "other", Folder: "INBOX", EmailID: "email-3"},
+		{Type: "folder_synced", AccountID: "acct", Folders: []models.Folder{{Name: "INBOX"}, {Name: "Archive"}}},
+	}
+	var ids []int64
+	for i, event := range events {
+		event.CreatedAt = logged.Add(time.Duration(i) * time.Hour)
+		id, err := s.AppendEvent(event)
+		if err != nil {
+			t.Fatalf("AppendEvent failed: %v", err)
+		}
+		if len(ids) > 0 && id <= ids[len(ids)-1] {
+			t.Errorf("Expected increasing IDs, got %d after %d", id, ids[len(ids)-1])
+		}
+		ids = append(ids, id)
+	}
+
+	all, err := s.GetEventsAfter(0, "", "", 100)
+	if err != nil || len(all) != 4 {
+		t.Fatalf("Expected 4 events, got %d (%v)", len(all), err)
+	}
+	if all[0].Email == nil || all[0].Email.Subject != "Settlement" || all[0].ID != ids[0] || !all[0].CreatedAt.Equal(logged) {
+		t.Errorf("Event was not stored intact: %+v", all[0])
+	}
+	if len(all[3].Folders) != 2 || all[3].Folders[1].Name != "Archive" {
+		t.Errorf("Folders were not stored intact: %+v", all[3])
+	}
+
+	tests := []struct {
+		name      string
+		afterID   int64
+		accountID string
+		folder    string
+		limit     int
+		expected  []int64
+	}{
+		{"after an ID", ids[1], "", "", 100, ids[2:]},
+		{"account", 0, "acct", "", 100, []int64{ids[0], ids[1], ids[3]}},
+		{"folder moved from", 0, "acct", "INBOX", 100, ids[:2]},
+		{"folder moved to", 0, "", "Archive", 100, ids[1:2]},
+		{"limit", 0, "", "", 2, ids[:2]},
+	}
+	for _, test := range tests {
+		events, err := s.GetEventsAfter(test.afterID, test.accountID, test.folder, test.limit)
+		if err != nil {
+			t.Fatalf("%s: GetEventsAfter failed: %v", test.name, err)
+		}
+		if len(events) != len(test.expected) {
+			t.Errorf("%s: expected %d events, got %+v", test.name, len(test.expected), events)
+			continue
+		}
+		for i, event := range events {
+			if event.ID != test.expected[i] {
+				t.Errorf("%s: expected event %d, got %d", test.name, test.expected[i], event.ID)
+			}
+		}
+	}
+
+	deleted, err := s.DeleteEventsBefore(logged.Add(2 * time.Hour))
+	if err != nil || deleted != 2 {
+		t.Errorf("Expected 2 events to be deleted, got %d (%v)", deleted, err)
+	}
+	if rest, _ := s.GetEventsAfter(0, "", "", 100); len(rest) != 2 || rest[0].ID != ids[2] {
+		t.Errorf("Unexpected events after pruning: %+v", rest)
+	}
+
+	resync := models.Event{
+		Type: "folder_uidvalidity_changed", AccountID: "acct", Folder: "INBOX", CreatedAt: logged,
+		Resync: &models.FolderResync{
+			OldUIDValidity: "1", NewUIDValidity: "2",
+			Remapped: map[string]string{"acct-1": "acct-7"}, Removed: []string{"acct-2"},
+		},
+	}
+	id, err := s.AppendEvent(resync)
+	if err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+	if rest, _ := s.GetEventsAfter(id-1, "", "INBOX", 100); len(rest) != 1 || rest[0].Resync == nil ||
+		rest[0].Resync.Remapped["acct-1"] != "acct-7" || rest[0].Resync.Removed[0] != "acct-2" {
+		t.Errorf("Resync was not stored intact: %+v", rest)
+	}
+}
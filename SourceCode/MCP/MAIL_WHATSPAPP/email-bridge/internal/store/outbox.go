@@ -0,0 +1,355 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+var (
+	// ErrOutboxNotQueued is returned when cancelling an outbox message that is no longer queued
+	ErrOutboxNotQueued = errors.New("outbox message is no longer queued")
+	// ErrOutboxNotPendingApproval is returned when reviewing an outbox message that isn't
+	// pending approval
+	ErrOutboxNotPendingApproval = errors.New("outbox message is not pending approval")
+)
+
+// timestampLayout formats the times of outbox messages and drafts in UTC with a fixed
+// width, so they compare correctly as text
+const timestampLayout = "2006-01-02T15:04:05.000000000Z"
+
+const outboxColumns = "id, account_id, email, status, attempts, last_error, send_at, next_attempt, created_at, sent_at"
+
+// QueueOutboxMessage adds a message to the outbox
+func (s *SQLiteStore) QueueOutboxMessage(message models.OutboxMessage) error {
+	email, err := json.Marshal(message.Email)
+	if err != nil {
+		return fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO outbox (`+outboxColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		message.ID, message.AccountID, string(email), message.Status, message.Attempts, message.LastError,
+		formatTimestampPtr(message.SendAt), formatTimestamp(message.NextAttempt), formatTimestamp(message.CreatedAt), formatTimestampPtr(message.SentAt))
+	return err
+}
+
+// GetOutboxMessage retrieves an outbox message. It returns sql.ErrNoRows if there is none.
+func (s *SQLiteStore) GetOutboxMessage(id string) (models.OutboxMessage, error) {
+	row := s.db.QueryRow("SELECT "+outboxColumns+" FROM outbox WHERE id = ?", id)
+	return scanOutboxMessage(row)
+}
+
+// ClaimOutboxMessage marks the queued message whose next attempt is due first as
+// sending and returns it. It returns sql.ErrNoRows if no message is due. A message
+// whose sending was interrupted, for example by a restart, is due again once its
+// claim lease expires.
+func (s *SQLiteStore) ClaimOutboxMessage(now time.Time, lease time.Duration) (models.OutboxMessage, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.OutboxMessage{}, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var message models.OutboxMessage
+	message, err = scanOutboxMessage(tx.QueryRow(`
+		SELECT `+outboxColumns+`
+		FROM outbox
+		WHERE status IN (?, ?) AND next_attempt <= ?
+		ORDER BY next_attempt, created_at
+		LIMIT 1`,
+		models.OutboxQueued, models.OutboxSending, formatTimestamp(now)))
+	if err != nil {
+		return message, err
+	}
+
+	message.Status = models.OutboxSending
+	message.NextAttempt = now.Add(lease)
+	if _, err = tx.Exec("UPDATE outbox SET status = ?, next_attempt = ? WHERE id = ?",
+		message.Status, formatTimestamp(message.NextAttempt), message.ID); err != nil {
+		return message, err
+	}
+
+	err = tx.Commit()
+	return message, err
+}
+
+// PendingOutboxMessages returns the messages waiting to be sent, including those
+// pending approval, in the order they are due. An empty account ID returns the
+// messages of all accounts.
+func (s *SQLiteStore) PendingOutboxMessages(accountID string) ([]models.OutboxMessage, error) {
+	query := "SELECT " + outboxColumns + " FROM outbox WHERE status IN (?, ?, ?)"
+	args := []interface{}{models.OutboxPendingApproval, models.OutboxQueued, models.OutboxSending}
+	if accountID != "" {
+		query += " AND account_id = ?"
+		args = append(args, accountID)
+	}
+	query += " ORDER BY next_attempt, created_at"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.OutboxMessage
+	for rows.Next() {
+		message, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+// CancelOutboxMessage cancels a message that is queued or pending approval. It returns
+// sql.ErrNoRows if there is no such message and ErrOutboxNotQueued if it is being sent
+// or was already sent, bounced, failed, cancelled or rejected.
+func (s *SQLiteStore) CancelOutboxMessage(id string) error {
+	result, err := s.db.Exec("UPDATE outbox SET status = ? WHERE id = ? AND status IN (?, ?)",
+		models.OutboxCancelled, id, models.OutboxQueued, models.OutboxPendingApproval)
+	if err != nil {
+		return err
+	}
+
+	cancelled, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if cancelled > 0 {
+		return nil
+	}
+
+	if _, err := s.GetOutboxMessage(id); err != nil {
+		return err
+	}
+	return ErrOutboxNotQueued
+}
+
+// UpdateOutboxMessage stores the delivery state of an outbox message
+func (s *SQLiteStore) UpdateOutboxMessage(message models.OutboxMessage) error {
+	result, err := s.db.Exec(`
+		UPDATE outbox
+		SET status = ?, attempts = ?, last_error = ?, next_attempt = ?, sent_at = ?
+		WHERE id = ?`,
+		message.Status, message.Attempts, message.LastError,
+		formatTimestamp(message.NextAttempt), formatTimestampPtr(message.SentAt), message.ID)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// EditPendingOutboxMessage replaces the email of a message pending approval and records
+// the edit. It returns sql.ErrNoRows if there is no such message and
+// ErrOutboxNotPendingApproval if it isn't pending approval.
+func (s *SQLiteStore) EditPendingOutboxMessage(id string, email models.Email, entry models.OutboxAuditEntry) error {
+	encoded, err := json.Marshal(email)
+	if err != nil {
+		return fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	return s.reviewOutboxMessage(id, entry, "UPDATE outbox SET email = ? WHERE id = ?", string(encoded), id)
+}
+
+// ReviewOutboxMessage approves or rejects a message pending approval and records the
+// decision in the same transaction, so that nothing is sent without a record of it.
+// An approved message is queued to be sent at nextAttempt; status is
+// models.OutboxQueued or models.OutboxRejected. It returns sql.ErrNoRows if there is
+// no such message and ErrOutboxNotPendingApproval if it isn't pending approval.
+func (s *SQLiteStore) ReviewOutboxMessage(id string, status string, nextAttempt time.Time, entry models.OutboxAuditEntry) error {
+	if status != models.OutboxQueued && status != models.OutboxRejected {
+		return fmt.Errorf("invalid review status %q", status)
+	}
+
+	return s.reviewOutboxMessage(id, entry, "UPDATE outbox SET status = ?, next_attempt = ? WHERE id = ?",
+		status, formatTimestamp(nextAttempt), id)
+}
+
+// reviewOutboxMessage runs an update of a message pending approval and adds an audit
+// entry in a transaction. The entry of an approval holds the email that was approved.
+func (s *SQLiteStore) reviewOutboxMessage(id string, entry models.OutboxAuditEntry, update string, args ...interface{}) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var message models.OutboxMessage
+	message, err = scanOutboxMessage(tx.QueryRow("SELECT "+outboxColumns+" FROM outbox WHERE id = ?", id))
+	if err != nil {
+		return err
+	}
+	if message.Status != models.OutboxPendingApproval {
+		err = ErrOutboxNotPendingApproval
+		return err
+	}
+
+	if _, err = tx.Exec(update, args...); err != nil {
+		return err
+	}
+
+	entry.OutboxID = id
+	if entry.Action == models.AuditApproved {
+		entry.Email = &message.Email
+	}
+	if err = addOutboxAuditEntry(tx, entry); err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// AddOutboxAuditEntry records an action on an outbox message
+func (s *SQLiteStore) AddOutboxAuditEntry(entry models.OutboxAuditEntry) error {
+	return addOutboxAuditEntry(s.db, entry)
+}
+
+func addOutboxAuditEntry(db execer, entry models.OutboxAuditEntry) error {
+	var email interface{}
+	if entry.Email != nil {
+		encoded, err := json.Marshal(entry.Email)
+		if err != nil {
+			return fmt.Errorf("failed to encode email: %w", err)
+		}
+		email = string(encoded)
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO outbox_audit (outbox_id, action, actor, note, email, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.OutboxID, entry.Action, entry.Actor, entry.Note, email, formatTimestamp(entry.CreatedAt))
+	return err
+}
+
+// GetOutboxAuditEntries returns the audit trail of an outbox message, oldest first
+func (s *SQLiteStore) GetOutboxAuditEntries(outboxID string) ([]models.OutboxAuditEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT id, outbox_id, action, actor, note, email, created_at
+		FROM outbox_audit
+		WHERE outbox_id = ?
+		ORDER BY id`, outboxID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.OutboxAuditEntry
+	for rows.Next() {
+		var entry models.OutboxAuditEntry
+		var actor, note, email sql.NullString
+		var createdAt string
+		if err := rows.Scan(&entry.ID, &entry.OutboxID, &entry.Action, &actor, &note, &email, &createdAt); err != nil {
+			return nil, err
+		}
+		entry.Actor = actor.String
+		entry.Note = note.String
+
+		if email.String != "" {
+			entry.Email = &models.Email{}
+			if err := json.Unmarshal([]byte(email.String), entry.Email); err != nil {
+				return nil, fmt.Errorf("failed to decode email of audit entry %d: %w", entry.ID, err)
+			}
+		}
+		if entry.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOutboxMessage scans a row of outboxColumns
+func scanOutboxMessage(row rowScanner) (models.OutboxMessage, error) {
+	var message models.OutboxMessage
+	var email, nextAttempt, createdAt string
+	var lastError, sendAt, sentAt sql.NullString
+
+	err := row.Scan(&message.ID, &message.AccountID, &email, &message.Status, &message.Attempts,
+		&lastError, &sendAt, &nextAttempt, &createdAt, &sentAt)
+	if err != nil {
+		return message, err
+	}
+
+	if err := json.Unmarshal([]byte(email), &message.Email); err != nil {
+		return message, fmt.Errorf("failed to decode email of outbox message %s: %w", message.ID, err)
+	}
+	message.LastError = lastError.String
+
+	if message.NextAttempt, err = parseTimestamp(nextAttempt); err != nil {
+		return message, err
+	}
+	if message.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return message, err
+	}
+	if message.SendAt, err = parseTimestampPtr(sendAt); err != nil {
+		return message, err
+	}
+	if message.SentAt, err = parseTimestampPtr(sentAt); err != nil {
+		return message, err
+	}
+
+	return message, nil
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+func formatTimestampPtr(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return formatTimestamp(*t)
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	t, err := time.Parse(timestampLayout, value)
+	if err != nil {
+		return t, fmt.Errorf("failed to parse time %q: %w", value, err)
+	}
+	return t, nil
+}
+
+func parseTimestampPtr(value sql.NullString) (*time.Time, error) {
+	if value.String == "" {
+		return nil, nil
+	}
+	t, err := parseTimestamp(value.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
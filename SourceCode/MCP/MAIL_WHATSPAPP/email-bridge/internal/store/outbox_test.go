@@ -0,0 +1,184 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+func TestOutbox(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.FixedZone("IST", 5*3600+1800))
+
+	for i, id := range []string{"outbox-1", "outbox-2"} {
+		message := models.OutboxMessage{
+			ID:        id,
+			AccountID: "acct",
+			Email: models.Email{
+				ID: id + "-email", Subject: "Report",
+				To:          []models.Address{{Email: "finance@example.com"}},
+				Attachments: []models.Attachment{{Filename: "report.xlsx", Path: "/tmp/report.xlsx"}},
+			},
+			Status:      models.OutboxQueued,
+			NextAttempt: now.Add(time.Duration(i) * time.Hour),
+			CreatedAt:   now,
+		}
+		if err := s.QueueOutboxMessage(message); err != nil {
+			t.Fatalf("Failed to queue %s: %v", id, err)
+		}
+	}
+
+	// Due times are compared in UTC whatever the zone they were given in
+	claimed, err := s.ClaimOutboxMessage(now.UTC().Add(30*time.Minute), time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimOutboxMessage failed: %v", err)
+	}
+	if claimed.ID != "outbox-1" || claimed.Status != models.OutboxSending {
+		t.Fatalf("Expected outbox-1 to be claimed, got %+v", claimed)
+	}
+	if claimed.Email.Attachments[0].Path != "/tmp/report.xlsx" {
+		t.Errorf("Message was not stored intact: %+v", claimed)
+	}
+	if _, err := s.ClaimOutboxMessage(now.Add(30*time.Minute), time.Minute); err != sql.ErrNoRows {
+		t.Errorf("Expected a claimed message not to be claimed again, got %v", err)
+	}
+
+	// A message being sent can't be cancelled
+	if err := s.CancelOutboxMessage("outbox-1"); err != ErrOutboxNotQueued {
+		t.Errorf("Expected ErrOutboxNotQueued cancelling a message being sent, got %v", err)
+	}
+
+	// A claim whose sender was interrupted expires, and the message is sent again
+	again, err := s.ClaimOutboxMessage(now.Add(32*time.Minute), time.Minute)
+	if err != nil || again.ID != "outbox-1" {
+		t.Fatalf("Expected the expired claim on outbox-1 to be claimed again, got %+v (%v)", again, err)
+	}
+
+	sentAt := now.Add(time.Minute)
+	message := again
+	message.Status = models.OutboxSent
+	message.Attempts = 1
+	message.SentAt = &sentAt
+	if err := s.UpdateOutboxMessage(message); err != nil {
+		t.Fatalf("UpdateOutboxMessage failed: %v", err)
+	}
+
+	message, err = s.GetOutboxMessage("outbox-1")
+	if err != nil {
+		t.Fatalf("GetOutboxMessage failed: %v", err)
+	}
+	if message.Status != models.OutboxSent || message.SentAt == nil || !message.SentAt.Equal(sentAt) {
+		t.Errorf("Unexpected message after update: %+v", message)
+	}
+
+	pending, err := s.PendingOutboxMessages("acct")
+	if err != nil || len(pending) != 1 || pending[0].ID != "outbox-2" {
+		t.Errorf("Expected only outbox-2 to be pending, got %v (%v)", pending, err)
+	}
+	if pending, _ := s.PendingOutboxMessages("other"); len(pending) != 0 {
+		t.Errorf("Expected no pending messages for another account, got %v", pending)
+	}
+
+	// A scheduled message that is cancelled is never sent
+	if err := s.CancelOutboxMessage("outbox-2"); err != nil {
+		t.Fatalf("CancelOutboxMessage failed: %v", err)
+	}
+	if _, err := s.ClaimOutboxMessage(now.Add(2*time.Hour), time.Minute); err != sql.ErrNoRows {
+		t.Errorf("Expected nothing to be due after cancelling, got %v", err)
+	}
+	if err := s.CancelOutboxMessage("outbox-2"); err != ErrOutboxNotQueued {
+		t.Errorf("Expected ErrOutboxNotQueued cancelling twice, got %v", err)
+	}
+	if err := s.CancelOutboxMessage("missing"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows cancelling a missing message, got %v", err)
+	}
+
+	if _, err := s.GetOutboxMessage("missing"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+	if err := s.UpdateOutboxMessage(models.OutboxMessage{ID: "missing"}); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows updating a missing message, got %v", err)
+	}
+}
+
+func TestOutboxApproval(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	for _, id := range []string{"held-1", "held-2", "held-3"} {
+		message := models.OutboxMessage{
+			ID:          id,
+			AccountID:   "acct",
+			Email:       models.Email{ID: id + "-email", Subject: "Draft reply"},
+			Status:      models.OutboxPendingApproval,
+			NextAttempt: now,
+			CreatedAt:   now,
+		}
+		if err := s.QueueOutboxMessage(message); err != nil {
+			t.Fatalf("Failed to queue %s: %v", id, err)
+		}
+	}
+
+	// Messages pending approval are listed but never claimed for sending
+	if pending, _ := s.PendingOutboxMessages("acct"); len(pending) != 3 {
+		t.Errorf("Expected 3 pending messages, got %v", pending)
+	}
+	if _, err := s.ClaimOutboxMessage(now.Add(time.Hour), time.Minute); err != sql.ErrNoRows {
+		t.Fatalf("Expected nothing to be due before approval, got %v", err)
+	}
+
+	edited := models.Email{ID: "held-1-email", Subject: "Reply"}
+	entry := models.OutboxAuditEntry{Action: models.AuditEdited, Actor: "alice", Email: &edited, CreatedAt: now}
+	if err := s.EditPendingOutboxMessage("held-1", edited, entry); err != nil {
+		t.Fatalf("EditPendingOutboxMessage failed: %v", err)
+	}
+
+	entry = models.OutboxAuditEntry{Action: models.AuditApproved, Actor: "alice", Note: "ok", CreatedAt: now}
+	if err := s.ReviewOutboxMessage("held-1", models.OutboxQueued, now, entry); err != nil {
+		t.Fatalf("ReviewOutboxMessage failed: %v", err)
+	}
+	claimed, err := s.ClaimOutboxMessage(now.Add(time.Minute), time.Minute)
+	if err != nil || claimed.ID != "held-1" || claimed.Email.Subject != "Reply" {
+		t.Fatalf("Expected the edited held-1 to be claimed, got %+v (%v)", claimed, err)
+	}
+
+	entry = models.OutboxAuditEntry{Action: models.AuditRejected, Actor: "bob", CreatedAt: now}
+	if err := s.ReviewOutboxMessage("held-2", models.OutboxRejected, now, entry); err != nil {
+		t.Fatalf("ReviewOutboxMessage failed: %v", err)
+	}
+	if err := s.ReviewOutboxMessage("held-2", models.OutboxQueued, now, entry); err != ErrOutboxNotPendingApproval {
+		t.Errorf("Expected ErrOutboxNotPendingApproval approving a rejected message, got %v", err)
+	}
+	if err := s.EditPendingOutboxMessage("held-2", edited, entry); err != ErrOutboxNotPendingApproval {
+		t.Errorf("Expected ErrOutboxNotPendingApproval editing a rejected message, got %v", err)
+	}
+	if err := s.CancelOutboxMessage("held-2"); err != ErrOutboxNotQueued {
+		t.Errorf("Expected ErrOutboxNotQueued cancelling a rejected message, got %v", err)
+	}
+
+	// A message pending approval can be withdrawn
+	if err := s.CancelOutboxMessage("held-3"); err != nil {
+		t.Errorf("CancelOutboxMessage failed: %v", err)
+	}
+	if message, _ := s.GetOutboxMessage("held-3"); message.Status != models.OutboxCancelled {
+		t.Errorf("Expected held-3 to be cancelled, got %s", message.Status)
+	}
+	if err := s.ReviewOutboxMessage("missing", models.OutboxQueued, now, entry); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows reviewing a missing message, got %v", err)
+	}
+
+	// The approval records the email that was approved
+	audit, err := s.GetOutboxAuditEntries("held-1")
+	if err != nil || len(audit) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %v (%v)", audit, err)
+	}
+	if audit[1].Action != models.AuditApproved || audit[1].Actor != "alice" || audit[1].Note != "ok" ||
+		audit[1].Email == nil || audit[1].Email.Subject != "Reply" || !audit[1].CreatedAt.Equal(now) {
+		t.Errorf("Unexpected approval entry %+v", audit[1])
+	}
+	if audit, _ := s.GetOutboxAuditEntries("held-2"); len(audit) != 1 || audit[0].Email != nil {
+		t.Errorf("Expected one rejection entry without an email, got %+v", audit)
+	}
+}
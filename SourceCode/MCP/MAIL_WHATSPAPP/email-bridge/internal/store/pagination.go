@@ -0,0 +1,145 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+// ErrInvalidCursor is returned when a search cursor is malformed or was issued for a
+// different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Sort keys accepted in SearchCriteria.SortBy
+const (
+	SortByDate      = "date"
+	SortBySubject   = "subject"
+	SortByFrom      = "from"
+	SortByRelevance = "relevance"
+)
+
+// sortColumns maps sort keys to the SQL expression emails are ordered by
+var sortColumns = map[string]string{
+	SortByDate:      "e.date",
+	SortBySubject:   "e.subject",
+	SortByFrom:      "COALESCE(e.from_email, '')",
+	SortByRelevance: rankSQL,
+}
+
+// emailSort is the order of search results. Emails with the same sort key are ordered
+// by ID, so that (key, ID) identifies a position for keyset pagination.
+type emailSort struct {
+	by         string
+	descending bool
+}
+
+// pageCursor is the position after the last email of a page
+type pageCursor struct {
+	SortBy     string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	Key        string `json:"k"`
+	ID         string `json:"id"`
+}
+
+// resolveSort returns the sort of criteria. Relevance is the default for full-text
+// queries and newest first otherwise; subject and sender sort ascending by default.
+func resolveSort(criteria models.SearchCriteria, fullText bool) (emailSort, error) {
+	by := criteria.SortBy
+	if by == "" {
+		by = SortByDate
+		if fullText {
+			by = SortByRelevance
+		}
+	}
+	if by == SortByRelevance && !fullText {
+		// Without a full-text match there is no relevance to sort by
+		by = SortByDate
+	}
+	if _, ok := sortColumns[by]; !ok {
+		return emailSort{}, fmt.Errorf("unknown sort key %q", by)
+	}
+
+	switch criteria.SortOrder {
+	case "":
+		return emailSort{by: by, descending: by == SortByDate}, nil
+	case "asc":
+		return emailSort{by: by}, nil
+	case "desc":
+		return emailSort{by: by, descending: true}, nil
+	default:
+		return emailSort{}, fmt.Errorf("unknown sort order %q", criteria.SortOrder)
+	}
+}
+
+// sql returns the ORDER BY expression of the sort
+func (o emailSort) sql() string {
+	direction := " ASC"
+	if o.descending {
+		direction = " DESC"
+	}
+	return sortColumns[o.by] + direction + ", e.id" + direction
+}
+
+// key returns the sort key of an email as stored in a cursor
+func (o emailSort) key(email models.Email) string {
+	switch o.by {
+	case SortByDate:
+		return email.Date.Format(time.RFC3339Nano)
+	case SortBySubject:
+		return email.Subject
+	case SortByFrom:
+		return email.From.Email
+	default:
+		return strconv.FormatFloat(email.Rank, 'g', -1, 64)
+	}
+}
+
+// cursor returns the opaque cursor of the page continuing after an email
+func (o emailSort) cursor(email models.Email) string {
+	data, _ := json.Marshal(pageCursor{SortBy: o.by, Descending: o.descending, Key: o.key(email), ID: email.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// after returns the condition selecting the emails after a cursor
+func (o emailSort) after(cursor string) (string, []interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", nil, ErrInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return "", nil, ErrInvalidCursor
+	}
+	if c.SortBy != o.by || c.Descending != o.descending {
+		return "", nil, fmt.Errorf("%w: it was issued for a different sort order", ErrInvalidCursor)
+	}
+
+	var key interface{} = c.Key
+	switch o.by {
+	case SortByDate:
+		date, err := time.Parse(time.RFC3339Nano, c.Key)
+		if err != nil {
+			return "", nil, ErrInvalidCursor
+		}
+		key = date
+	case SortByRelevance:
+		rank, err := strconv.ParseFloat(c.Key, 64)
+		if err != nil {
+			return "", nil, ErrInvalidCursor
+		}
+		key = rank
+	}
+
+	column := sortColumns[o.by]
+	op := ">"
+	if o.descending {
+		op = "<"
+	}
+	clause := fmt.Sprintf("(%s %s ? OR (%s = ? AND e.id %s ?))", column, op, column, op)
+	return clause, []interface{}{key, key, c.ID}, nil
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+const reconJobColumns = "id, account_id, email_id, attachment_id, rule, source, filename, path, hash, sheet, " +
+	"status, attempts, row_count, error, created_at, updated_at, submitted_at"
+
+// StoreReconJob saves a recon job, replacing it if it exists
+func (s *SQLiteStore) StoreReconJob(job models.ReconJob) error {
+	_, err := s.db.Exec(`
+		INSERT OR REPLACE INTO recon_jobs (`+reconJobColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.AccountID, job.EmailID, job.AttachmentID, job.Rule, job.Source, job.Filename,
+		job.Path, job.Hash, job.Sheet, job.Status, job.Attempts, job.Rows, job.Error,
+		formatTimestamp(job.CreatedAt), formatTimestamp(job.UpdatedAt), formatTimestampPtr(job.SubmittedAt))
+	return err
+}
+
+// GetReconJob retrieves a recon job. It returns sql.ErrNoRows if there is none.
+func (s *SQLiteStore) GetReconJob(id string) (models.ReconJob, error) {
+	row := s.db.QueryRow("SELECT "+reconJobColumns+" FROM recon_jobs WHERE id = ?", id)
+	return scanReconJob(row)
+}
+
+// GetReconJobByAttachment retrieves the recon job of an attachment. It returns
+// sql.ErrNoRows if the attachment has none.
+func (s *SQLiteStore) GetReconJobByAttachment(attachmentID string) (models.ReconJob, error) {
+	row := s.db.QueryRow("SELECT "+reconJobColumns+" FROM recon_jobs WHERE attachment_id = ? ORDER BY created_at LIMIT 1", attachmentID)
+	return scanReconJob(row)
+}
+
+// GetReconJobs returns the recon jobs with a status in the order they were created. An
+// empty status returns all jobs.
+func (s *SQLiteStore) GetReconJobs(status string) ([]models.ReconJob, error) {
+	query := "SELECT " + reconJobColumns + " FROM recon_jobs"
+	var args []interface{}
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY created_at, id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.ReconJob
+	for rows.Next() {
+		job, err := scanReconJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// scanReconJob scans a row of reconJobColumns
+func scanReconJob(row rowScanner) (models.ReconJob, error) {
+	var job models.ReconJob
+	var createdAt, updatedAt string
+	var source, path, hash, sheet, jobError, submittedAt sql.NullString
+
+	err := row.Scan(&job.ID, &job.AccountID, &job.EmailID, &job.AttachmentID, &job.Rule, &source, &job.Filename,
+		&path, &hash, &sheet, &job.Status, &job.Attempts, &job.Rows, &jobError, &createdAt, &updatedAt, &submittedAt)
+	if err != nil {
+		return job, err
+	}
+
+	job.Source = source.String
+	job.Path = path.String
+	job.Hash = hash.String
+	job.Sheet = sheet.String
+	job.Error = jobError.String
+
+	if job.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return job, err
+	}
+	if job.UpdatedAt, err = parseTimestamp(updatedAt); err != nil {
+		return job, err
+	}
+	if job.SubmittedAt, err = parseTimestampPtr(submittedAt); err != nil {
+		return job, err
+	}
+
+	return job, nil
+}
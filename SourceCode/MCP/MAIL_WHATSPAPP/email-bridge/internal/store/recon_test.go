@@ -0,0 +1,76 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+func TestReconJobs(t *testing.T) {
+	s := newTestStore(t)
+	created := time.Date(2025, 4, 22, 9, 0, 0, 0, time.UTC)
+
+	for i, id := range []string{"recon-1", "recon-2"} {
+		job := models.ReconJob{
+			ID:           id,
+			AccountID:    "acct",
+			EmailID:      "acct-INBOX-" + id,
+			AttachmentID: "att-" + id,
+			Rule:         "benow",
+			Source:       "benow",
+			Filename:     "Benow File 1.xlsb",
+			Status:       models.ReconQueued,
+			CreatedAt:    created.Add(time.Duration(i) * time.Minute),
+			UpdatedAt:    created.Add(time.Duration(i) * time.Minute),
+		}
+		if err := s.StoreReconJob(job); err != nil {
+			t.Fatalf("Failed to store %s: %v", id, err)
+		}
+	}
+
+	// Storing the job again updates it
+	job, err := s.GetReconJobByAttachment("att-recon-1")
+	if err != nil {
+		t.Fatalf("GetReconJobByAttachment failed: %v", err)
+	}
+	submitted := created.Add(time.Hour)
+	job.Status = models.ReconSubmitted
+	job.Attempts = 1
+	job.Rows = 19320
+	job.Path = "attachments/sha256/ab/abcd"
+	job.Hash = "abcd"
+	job.Sheet = "Benow"
+	job.UpdatedAt = submitted
+	job.SubmittedAt = &submitted
+	if err := s.StoreReconJob(job); err != nil {
+		t.Fatalf("StoreReconJob failed: %v", err)
+	}
+
+	job, err = s.GetReconJob("recon-1")
+	if err != nil {
+		t.Fatalf("GetReconJob failed: %v", err)
+	}
+	if job.Status != models.ReconSubmitted || job.Rows != 19320 || job.Hash != "abcd" || job.Sheet != "Benow" ||
+		job.SubmittedAt == nil || !job.SubmittedAt.Equal(submitted) || !job.CreatedAt.Equal(created) {
+		t.Errorf("Job was not stored intact: %+v", job)
+	}
+
+	// Jobs are listed in the order they were created, optionally by status
+	jobs, err := s.GetReconJobs("")
+	if err != nil || len(jobs) != 2 || jobs[0].ID != "recon-1" || jobs[1].ID != "recon-2" {
+		t.Errorf("Unexpected jobs %v (%v)", jobs, err)
+	}
+	jobs, err = s.GetReconJobs(models.ReconQueued)
+	if err != nil || len(jobs) != 1 || jobs[0].ID != "recon-2" || jobs[0].SubmittedAt != nil {
+		t.Errorf("Expected only the queued job, got %v (%v)", jobs, err)
+	}
+
+	if _, err := s.GetReconJob("missing"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a missing job, got %v", err)
+	}
+	if _, err := s.GetReconJobByAttachment("att-missing"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for an attachment without a job, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+const mailRuleColumns = "id, name, account_id, enabled, priority, stop_processing, conditions, actions, created_at, updated_at"
+
+// StoreMailRule saves a mail rule, replacing it if it exists
+func (s *SQLiteStore) StoreMailRule(rule models.MailRule) error {
+	conditions, err := json.Marshal(rule.Conditions)
+	if err != nil {
+		return fmt.Errorf("failed to encode conditions: %w", err)
+	}
+	actions, err := json.Marshal(rule.Actions)
+	if err != nil {
+		return fmt.Errorf("failed to encode actions: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT OR REPLACE INTO mail_rules (`+mailRuleColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rule.ID, rule.Name, rule.AccountID, rule.Enabled, rule.Priority, rule.StopProcessing,
+		string(conditions), string(actions), formatTimestamp(rule.CreatedAt), formatTimestamp(rule.UpdatedAt))
+	return err
+}
+
+// GetMailRule retrieves a mail rule. It returns sql.ErrNoRows if there is none.
+func (s *SQLiteStore) GetMailRule(id string) (models.MailRule, error) {
+	row := s.db.QueryRow("SELECT "+mailRuleColumns+" FROM mail_rules WHERE id = ?", id)
+	return scanMailRule(row)
+}
+
+// GetMailRules returns all mail rules in the order they are evaluated: by priority,
+// then in the order they were created
+func (s *SQLiteStore) GetMailRules() ([]models.MailRule, error) {
+	rows, err := s.db.Query("SELECT " + mailRuleColumns + " FROM mail_rules ORDER BY priority, created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.MailRule
+	for rows.Next() {
+		rule, err := scanMailRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// DeleteMailRule deletes a mail rule. It returns sql.ErrNoRows if there is none.
+func (s *SQLiteStore) DeleteMailRule(id string) error {
+	result, err := s.db.Exec("DELETE FROM mail_rules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// scanMailRule scans a row of mailRuleColumns
+func scanMailRule(row rowScanner) (models.MailRule, error) {
+	var rule models.MailRule
+	var accountID sql.NullString
+	var conditions, actions, createdAt, updatedAt string
+
+	err := row.Scan(&rule.ID, &rule.Name, &accountID, &rule.Enabled, &rule.Priority, &rule.StopProcessing,
+		&conditions, &actions, &createdAt, &updatedAt)
+	if err != nil {
+		return rule, err
+	}
+	rule.AccountID = accountID.String
+
+	if err := json.Unmarshal([]byte(conditions), &rule.Conditions); err != nil {
+		return rule, fmt.Errorf("failed to decode conditions of rule %s: %w", rule.ID, err)
+	}
+	if err := json.Unmarshal([]byte(actions), &rule.Actions); err != nil {
+		return rule, fmt.Errorf("failed to decode actions of rule %s: %w", rule.ID, err)
+	}
+
+	if rule.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return rule, err
+	}
+	if rule.UpdatedAt, err = parseTimestamp(updatedAt); err != nil {
+		return rule, err
+	}
+
+	return rule, nil
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+func TestMailRules(t *testing.T) {
+	s := newTestStore(t)
+	created := time.Date(2025, 5, 2, 9, 0, 0, 0, time.UTC)
+
+	rules := []models.MailRule{
+		{
+			ID:       "rule-1",
+			Name:     "Archive newsletters",
+			Enabled:  true,
+			Priority: 10,
+			Conditions: models.RuleConditions{
+				Headers: map[string]string{"List-Id": "news"},
+			},
+			Actions: []models.RuleAction{{Type: models.RuleActionMarkRead}, {Type: models.RuleActionMove, Folder: "Newsletters"}},
+		},
+		{
+			ID:             "rule-2",
+			Name:           "Settlement files",
+			AccountID:      "acct",
+			Enabled:        false,
+			Priority:       1,
+			StopProcessing: true,
+			Conditions: models.RuleConditions{
+				From:              "@benow\\.in$",
+				AttachmentType:    "\\.xlsb$",
+				MinAttachmentSize: 1024,
+			},
+			Actions: []models.RuleAction{{Type: models.RuleActionForward, To: []models.Address{{Email: "recon@example.com"}}}},
+		},
+	}
+	for i, rule := range rules {
+		rule.CreatedAt = created.Add(time.Duration(i) * time.Minute)
+		rule.UpdatedAt = rule.CreatedAt
+		if err := s.StoreMailRule(rule); err != nil {
+			t.Fatalf("Failed to store %s: %v", rule.ID, err)
+		}
+	}
+
+	rule, err := s.GetMailRule("rule-2")
+	if err != nil {
+		t.Fatalf("GetMailRule failed: %v", err)
+	}
+	if rule.AccountID != "acct" || rule.Enabled || !rule.StopProcessing || rule.Conditions.MinAttachmentSize != 1024 ||
+		len(rule.Actions) != 1 || rule.Actions[0].To[0].Email != "recon@example.com" || !rule.CreatedAt.Equal(created.Add(time.Minute)) {
+		t.Errorf("Rule was not stored intact: %+v", rule)
+	}
+
+	// Storing the rule again updates it
+	rule.Enabled = true
+	rule.Priority = 20
+	if err := s.StoreMailRule(rule); err != nil {
+		t.Fatalf("StoreMailRule failed: %v", err)
+	}
+
+	// Rules are listed by priority
+	list, err := s.GetMailRules()
+	if err != nil || len(list) != 2 || list[0].ID != "rule-1" || list[1].ID != "rule-2" || !list[1].Enabled {
+		t.Errorf("Unexpected rules %+v (%v)", list, err)
+	}
+	if list[0].Conditions.Headers["List-Id"] != "news" || list[0].Actions[1].Folder != "Newsletters" {
+		t.Errorf("Rule was not stored intact: %+v", list[0])
+	}
+
+	if err := s.DeleteMailRule("rule-1"); err != nil {
+		t.Fatalf("DeleteMailRule failed: %v", err)
+	}
+	if _, err := s.GetMailRule("rule-1"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a deleted rule, got %v", err)
+	}
+	if err := s.DeleteMailRule("rule-1"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows deleting a missing rule, got %v", err)
+	}
+}
@@ -63,6 +63,8 @@ CREATE TABLE IF NOT EXISTS attachments (
     size INTEGER,
     content_id TEXT,
     path TEXT,
+    hash TEXT, -- SHA-256 of the content stored at path
+    section TEXT, -- IMAP body section of the MIME part, e.g. 1.2
     FOREIGN KEY (email_id) REFERENCES emails(id)
 );
 
@@ -72,8 +74,157 @@ CREATE TABLE IF NOT EXISTS sync_status (
     last_sync TIMESTAMP,
     uid_validity TEXT,
     last_uid INTEGER DEFAULT 0,
+    highest_mod_seq INTEGER DEFAULT 0, -- HIGHESTMODSEQ the folder's changes were synced up to
     PRIMARY KEY (account_id, folder_id),
     FOREIGN KEY (account_id) REFERENCES accounts(id),
     FOREIGN KEY (folder_id) REFERENCES folders(id)
 );
+
+CREATE TABLE IF NOT EXISTS oauth_tokens (
+    account_id TEXT PRIMARY KEY, -- accounts from config.json have no accounts row
+    access_token TEXT,
+    refresh_token TEXT,
+    expiry TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id TEXT PRIMARY KEY,
+    account_id TEXT,
+    email TEXT, -- the email as JSON
+    status TEXT, -- pending_approval, rejected, queued, sending, sent, bounced, failed or cancelled
+    attempts INTEGER DEFAULT 0,
+    last_error TEXT,
+    send_at TEXT, -- the time a scheduled message was scheduled for
+    next_attempt TEXT, -- UTC, in a fixed-width format so it sorts as text
+    created_at TEXT,
+    sent_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS outbox_due ON outbox (status, next_attempt);
+
+CREATE TABLE IF NOT EXISTS outbox_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    outbox_id TEXT,
+    action TEXT, -- submitted, edited, approved or rejected
+    actor TEXT, -- the API client that took the action
+    note TEXT,
+    email TEXT, -- the email as JSON after the action, if it concerned the content
+    created_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS outbox_audit_message ON outbox_audit (outbox_id, id);
+
+CREATE TABLE IF NOT EXISTS drafts (
+    id TEXT PRIMARY KEY,
+    account_id TEXT,
+    email TEXT, -- the latest revision as JSON
+    revision INTEGER DEFAULT 1,
+    folder TEXT, -- the server folder holding the latest revision, if it was appended
+    email_id TEXT, -- the ID of the latest revision in that folder, if known
+    created_at TEXT,
+    updated_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS recon_jobs (
+    id TEXT PRIMARY KEY,
+    account_id TEXT,
+    email_id TEXT,
+    attachment_id TEXT,
+    rule TEXT,
+    source TEXT,
+    filename TEXT,
+    path TEXT,
+    hash TEXT,
+    sheet TEXT,
+    status TEXT, -- queued, processing, submitted or failed
+    attempts INTEGER DEFAULT 0,
+    row_count INTEGER DEFAULT 0, -- records submitted
+    error TEXT,
+    created_at TEXT,
+    updated_at TEXT,
+    submitted_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS recon_jobs_status ON recon_jobs (status, created_at);
+CREATE INDEX IF NOT EXISTS recon_jobs_attachment ON recon_jobs (attachment_id);
+
+CREATE TABLE IF NOT EXISTS mail_rules (
+    id TEXT PRIMARY KEY,
+    name TEXT,
+    account_id TEXT, -- empty for rules that apply to all accounts
+    enabled INTEGER DEFAULT 1,
+    priority INTEGER DEFAULT 0,
+    stop_processing INTEGER DEFAULT 0,
+    conditions TEXT, -- as JSON
+    actions TEXT, -- as JSON
+    created_at TEXT,
+    updated_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL,
+    account_id TEXT,
+    folder TEXT,
+    old_folder TEXT,
+    email_id TEXT,
+    data TEXT, -- the email or folders, as JSON
+    created_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS events_created_at ON events (created_at);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id TEXT PRIMARY KEY,
+    account_id TEXT, -- empty for webhooks of all accounts
+    event_types TEXT, -- as JSON, empty for all event types
+    url TEXT,
+    secret TEXT, -- encrypted
+    enabled INTEGER DEFAULT 1,
+    created_at TEXT,
+    updated_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    webhook_id TEXT,
+    account_id TEXT,
+    event_type TEXT,
+    payload TEXT, -- the JSON body
+    status TEXT, -- queued, sending, delivered or dead
+    attempts INTEGER DEFAULT 0,
+    last_error TEXT,
+    response_status INTEGER,
+    next_attempt TEXT, -- UTC, in a fixed-width format so it sorts as text
+    created_at TEXT,
+    delivered_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (status, next_attempt);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook ON webhook_deliveries (webhook_id, created_at);
 `
+
+// FullTextSchema creates the full-text index of emails. It needs SQLite built with
+// FTS5, which go-sqlite3 enables with the sqlite_fts5 build tag.
+const FullTextSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS emails_fts USING fts5(
+    email_id UNINDEXED,
+    subject,
+    text_content,
+    html_content, -- with the markup removed
+    sender,
+    recipients,
+    attachments, -- filenames
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+`
+
+// Migrations contains the SQL statements that bring databases created with an
+// older schema up to date. Each statement must be safe to run on every start.
+var Migrations = []string{
+	`ALTER TABLE attachments ADD COLUMN section TEXT`,
+	`ALTER TABLE outbox ADD COLUMN send_at TEXT`,
+	`ALTER TABLE attachments ADD COLUMN hash TEXT`,
+	`ALTER TABLE sync_status ADD COLUMN highest_mod_seq INTEGER DEFAULT 0`,
+	`CREATE INDEX IF NOT EXISTS attachments_hash ON attachments(hash)`,
+}
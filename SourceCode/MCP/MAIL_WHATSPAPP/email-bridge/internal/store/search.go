@@ -0,0 +1,231 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+var (
+	// htmlTagPattern matches HTML tags, comments and the contents of style and script elements
+	htmlTagPattern = regexp.MustCompile(`(?is)<(style|script)[^>]*>.*?</(style|script)>|<!--.*?-->|<[^>]*>`)
+	whitespace     = regexp.MustCompile(`\s+`)
+)
+
+// initializeFullText creates the full-text index if SQLite supports FTS5 and indexes
+// emails stored before the index existed. Without FTS5, searches fall back to LIKE.
+func (s *SQLiteStore) initializeFullText() error {
+	if _, err := s.db.Exec(FullTextSchema); err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			fmt.Printf("Warning: SQLite was built without FTS5, full-text search falls back to LIKE\n")
+			return nil
+		}
+		return fmt.Errorf("failed to create full-text index: %w", err)
+	}
+	s.fullText = true
+
+	var indexed int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM emails_fts").Scan(&indexed); err != nil {
+		return err
+	}
+	if indexed > 0 {
+		return nil
+	}
+
+	rows, err := s.db.Query("SELECT id FROM emails")
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		email, err := s.GetEmail(id)
+		if err != nil {
+			return fmt.Errorf("failed to load email %s for indexing: %w", id, err)
+		}
+		if err := s.indexEmail(s.db, email); err != nil {
+			return fmt.Errorf("failed to index email %s: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+// rankSQL is the BM25 rank of a full-text match, weighted towards the subject and sender.
+// Lower ranks are better matches.
+const rankSQL = "bm25(emails_fts, 0, 10.0, 1.0, 1.0, 5.0, 2.0, 2.0)"
+
+// matchQuery returns the FTS5 query for the free text of criteria, or "" if the
+// full-text index isn't used
+func (s *SQLiteStore) matchQuery(criteria models.SearchCriteria) string {
+	if !s.fullText {
+		return ""
+	}
+	return fullTextQuery(criteria.Query)
+}
+
+// indexEmail adds an email to the full-text index
+func (s *SQLiteStore) indexEmail(db execer, email models.Email) error {
+	if !s.fullText {
+		return nil
+	}
+
+	var recipients []string
+	for _, addresses := range [][]models.Address{email.To, email.Cc, email.Bcc} {
+		for _, address := range addresses {
+			recipients = append(recipients, formatIndexAddress(address))
+		}
+	}
+
+	var filenames []string
+	for _, attachment := range email.Attachments {
+		filenames = append(filenames, attachment.Filename)
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO emails_fts (email_id, subject, text_content, html_content, sender, recipients, attachments)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		email.ID, email.Subject, email.TextContent, htmlText(email.HtmlContent),
+		formatIndexAddress(email.From), strings.Join(recipients, ", "), strings.Join(filenames, ", "))
+	return err
+}
+
+// unindexEmail removes an email from the full-text index
+func (s *SQLiteStore) unindexEmail(db execer, id string) error {
+	if !s.fullText {
+		return nil
+	}
+
+	_, err := db.Exec("DELETE FROM emails_fts WHERE email_id = ?", id)
+	return err
+}
+
+// formatIndexAddress returns the name and address of an email address as indexed text
+func formatIndexAddress(address models.Address) string {
+	if address.Name == "" {
+		return address.Email
+	}
+	return address.Name + " <" + address.Email + ">"
+}
+
+// htmlText returns the text of an HTML body without its markup
+func htmlText(content string) string {
+	if content == "" {
+		return ""
+	}
+	text := html.UnescapeString(htmlTagPattern.ReplaceAllString(content, " "))
+	return strings.TrimSpace(whitespace.ReplaceAllString(text, " "))
+}
+
+// fullTextQuery turns free text into an FTS5 query that matches emails containing every
+// word as a prefix. Words are quoted so user input can't cause FTS5 syntax errors.
+func fullTextQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// expressionSQL compiles a search expression into an SQL condition on the emails e
+// joined with their folder f
+func (s *SQLiteStore) expressionSQL(expr models.SearchExpression) (string, []interface{}, error) {
+	switch expr.Op {
+	case models.SearchAnd, models.SearchOr:
+		if len(expr.Children) == 0 {
+			return "", nil, fmt.Errorf("empty %s search expression", expr.Op)
+		}
+
+		var clauses []string
+		var args []interface{}
+		for _, child := range expr.Children {
+			clause, childArgs, err := s.expressionSQL(child)
+			if err != nil {
+				return "", nil, err
+			}
+			clauses = append(clauses, clause)
+			args = append(args, childArgs...)
+		}
+		return "(" + strings.Join(clauses, " "+strings.ToUpper(expr.Op)+" ") + ")", args, nil
+	case models.SearchNot:
+		if len(expr.Children) != 1 {
+			return "", nil, fmt.Errorf("not search expression needs one operand")
+		}
+		clause, args, err := s.expressionSQL(expr.Children[0])
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT " + clause, args, nil
+	case "":
+		return s.termSQL(expr.Field, expr.Value)
+	default:
+		return "", nil, fmt.Errorf("unknown search operator %q", expr.Op)
+	}
+}
+
+// termSQL compiles a single search term into an SQL condition
+func (s *SQLiteStore) termSQL(field string, value string) (string, []interface{}, error) {
+	like := "%" + value + "%"
+
+	switch field {
+	case models.SearchText:
+		if match := fullTextQuery(value); s.fullText && match != "" {
+			return "(e.id IN (SELECT email_id FROM emails_fts WHERE emails_fts MATCH ?))", []interface{}{match}, nil
+		}
+		return "(e.subject LIKE ? OR e.text_content LIKE ? OR e.html_content LIKE ?)", []interface{}{like, like, like}, nil
+	case models.SearchFrom:
+		return "(e.from_email LIKE ? OR e.from_name LIKE ?)", []interface{}{like, like}, nil
+	case models.SearchTo, models.SearchCc:
+		return "(EXISTS (SELECT 1 FROM recipients r WHERE r.email_id = e.id AND r.type = ? AND (r.email LIKE ? OR r.name LIKE ?)))",
+			[]interface{}{field, like, like}, nil
+	case models.SearchSubject:
+		return "(e.subject LIKE ?)", []interface{}{like}, nil
+	case models.SearchFolder:
+		return "(f.name = ? COLLATE NOCASE)", []interface{}{value}, nil
+	case models.SearchFilename:
+		return "(EXISTS (SELECT 1 FROM attachments a WHERE a.email_id = e.id AND a.filename LIKE ?))", []interface{}{like}, nil
+	case models.SearchHas:
+		if value != "attachment" {
+			return "", nil, fmt.Errorf("unsupported has:%s", value)
+		}
+		return "(e.has_attachments = 1)", nil, nil
+	case models.SearchIs:
+		switch value {
+		case "read":
+			return "(e.is_read = 1)", nil, nil
+		case "unread":
+			return "(e.is_read = 0)", nil, nil
+		}
+		return "", nil, fmt.Errorf("unsupported is:%s", value)
+	case models.SearchAfter, models.SearchBefore:
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid %s date %q: %w", field, value, err)
+		}
+		if field == models.SearchAfter {
+			return "(e.date >= ?)", []interface{}{date}, nil
+		}
+		return "(e.date < ?)", []interface{}{date}, nil
+	default:
+		return "", nil, fmt.Errorf("unknown search field %q", field)
+	}
+}
@@ -0,0 +1,319 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/crypto"
+	"github.com/user/email-bridge/internal/models"
+)
+
+// newTestStore returns an initialized store in a temporary database
+func newTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	dir := t.TempDir()
+	cc, err := crypto.NewCredentialCrypto(filepath.Join(dir, "master.key"))
+	if err != nil {
+		t.Fatalf("Failed to create crypto: %v", err)
+	}
+
+	s, err := NewSQLiteStore(filepath.Join(dir, "test.db"), cc)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	return s.(*SQLiteStore)
+}
+
+// searchTestEmails are stored by TestFullTextSearch, newest first
+func searchTestEmails() []models.Email {
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	return []models.Email{
+		{
+			ID: "acct-1", AccountID: "acct", Folder: "INBOX", Date: date,
+			From:        models.Address{Name: "Alice Finance", Email: "alice@example.com"},
+			To:          []models.Address{{Name: "Bob", Email: "bob@example.com"}},
+			Subject:     "Lunch plans",
+			TextContent: "Shall we talk about the invoice over lunch?",
+		},
+		{
+			ID: "acct-2", AccountID: "acct", Folder: "INBOX", Date: date.Add(-time.Hour),
+			From:           models.Address{Email: "billing@vendor.com"},
+			To:             []models.Address{{Name: "Carol Payables", Email: "carol@example.com"}},
+			Subject:        "Invoice 1042 overdue",
+			HtmlContent:    "<p>Your <b>invoice</b> is overdue.</p><style>p { color: red }</style>",
+			Attachments:    []models.Attachment{{ID: "acct-2-1", Filename: "statement_march.pdf"}},
+			HasAttachments: true,
+		},
+		{
+			ID: "acct-3", AccountID: "acct", Folder: "Archive", Date: date.Add(-2 * time.Hour),
+			From:        models.Address{Email: "news@example.org"},
+			Subject:     "Weekly digest",
+			TextContent: "Nothing about payments here.",
+		},
+	}
+}
+
+func TestFullTextSearch(t *testing.T) {
+	s := newTestStore(t)
+	if !s.fullText {
+		t.Skip("SQLite was built without FTS5; run the tests with -tags sqlite_fts5")
+	}
+
+	for _, email := range searchTestEmails() {
+		if err := s.StoreEmail(email); err != nil {
+			t.Fatalf("Failed to store email %s: %v", email.ID, err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"subject match ranks first", "invoice", []string{"acct-2", "acct-1"}},
+		{"prefix", "overd", []string{"acct-2"}},
+		{"all words", "invoice lunch", []string{"acct-1"}},
+		{"sender name", "finance", []string{"acct-1"}},
+		{"recipient", "payables", []string{"acct-2"}},
+		{"attachment filename", "statement", []string{"acct-2"}},
+		{"html markup is not indexed", "color", nil},
+		{"fts syntax is quoted", `"invoice OR NEAR(`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emails, err := s.SearchEmails(models.SearchCriteria{Query: tt.query})
+			if err != nil {
+				t.Fatalf("SearchEmails failed: %v", err)
+			}
+
+			var got []string
+			for _, email := range emails {
+				got = append(got, email.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	emails, err := s.SearchEmails(models.SearchCriteria{Query: "overdue", Folder: "INBOX"})
+	if err != nil || len(emails) != 1 {
+		t.Fatalf("Expected one result, got %v (%v)", emails, err)
+	}
+	if !strings.Contains(emails[0].Snippet, "<mark>") {
+		t.Errorf("Expected a highlighted snippet, got %q", emails[0].Snippet)
+	}
+	if emails[0].Rank == 0 {
+		t.Error("Expected the result to have a rank")
+	}
+
+	// Relevance-ranked results page by rank
+	first, err := s.SearchEmails(models.SearchCriteria{Query: "invoice", Limit: 1})
+	if err != nil || len(first) != 1 {
+		t.Fatalf("Expected one result, got %v (%v)", first, err)
+	}
+	next, err := s.SearchEmails(models.SearchCriteria{Query: "invoice", Limit: 1, Cursor: first[0].Cursor})
+	if err != nil || len(next) != 1 || next[0].ID != "acct-1" {
+		t.Fatalf("Expected acct-1 on the second page, got %v (%v)", next, err)
+	}
+	if count, err := s.CountEmails(models.SearchCriteria{Query: "invoice"}); err != nil || count != 2 {
+		t.Errorf("Expected 2 matches, got %d (%v)", count, err)
+	}
+
+	// Deleted emails are removed from the index
+	if err := s.DeleteEmail("acct-2"); err != nil {
+		t.Fatalf("Failed to delete email: %v", err)
+	}
+	emails, err = s.SearchEmails(models.SearchCriteria{Query: "statement"})
+	if err != nil {
+		t.Fatalf("SearchEmails failed: %v", err)
+	}
+	if len(emails) != 0 {
+		t.Errorf("Expected no results after delete, got %v", emails)
+	}
+}
+
+func TestFullTextQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"invoice", `"invoice"*`},
+		{"  invoice   march ", `"invoice"* "march"*`},
+		{`say "hi"`, `"say"* """hi"""*`},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := fullTextQuery(tt.query); got != tt.want {
+			t.Errorf("fullTextQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestHTMLText(t *testing.T) {
+	got := htmlText("<html><head><style>p { color: red }</style></head><body><p>Tom &amp; Jerry</p><!-- note --><br>End</body></html>")
+	if got != "Tom & Jerry End" {
+		t.Errorf("Unexpected text %q", got)
+	}
+}
+
+func TestSearchExpression(t *testing.T) {
+	s := newTestStore(t)
+	for _, email := range searchTestEmails() {
+		if err := s.StoreEmail(email); err != nil {
+			t.Fatalf("Failed to store email %s: %v", email.ID, err)
+		}
+	}
+
+	term := func(field, value string) models.SearchExpression {
+		return models.SearchExpression{Field: field, Value: value}
+	}
+
+	tests := []struct {
+		name string
+		expr models.SearchExpression
+		want []string
+	}{
+		{"sender name", term(models.SearchFrom, "finance"), []string{"acct-1"}},
+		{"recipient name", term(models.SearchTo, "payables"), []string{"acct-2"}},
+		{"cc is not to", term(models.SearchCc, "bob"), nil},
+		{"folder ignores case", term(models.SearchFolder, "archive"), []string{"acct-3"}},
+		{"attachment filename", term(models.SearchFilename, ".pdf"), []string{"acct-2"}},
+		{"has attachment", term(models.SearchHas, "attachment"), []string{"acct-2"}},
+		{"unread", term(models.SearchIs, "unread"), []string{"acct-1", "acct-2", "acct-3"}},
+		{"before is exclusive", term(models.SearchBefore, "2024-03-01"), nil},
+		{"after", term(models.SearchAfter, "2024-03-01"), []string{"acct-1", "acct-2", "acct-3"}},
+		{"text", term(models.SearchText, "payments"), []string{"acct-3"}},
+		{
+			"or",
+			models.SearchExpression{Op: models.SearchOr, Children: []models.SearchExpression{
+				term(models.SearchFrom, "alice"), term(models.SearchFolder, "Archive"),
+			}},
+			[]string{"acct-1", "acct-3"},
+		},
+		{
+			"not",
+			models.SearchExpression{Op: models.SearchNot, Children: []models.SearchExpression{
+				term(models.SearchFolder, "INBOX"),
+			}},
+			[]string{"acct-3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr := tt.expr
+			emails, err := s.SearchEmails(models.SearchCriteria{Expression: &expr})
+			if err != nil {
+				t.Fatalf("SearchEmails failed: %v", err)
+			}
+
+			var got []string
+			for _, email := range emails {
+				got = append(got, email.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := s.SearchEmails(models.SearchCriteria{Expression: &models.SearchExpression{Field: "starred", Value: "yes"}}); err == nil {
+		t.Error("Expected an error for an unknown search field")
+	}
+}
+
+func TestSearchPagination(t *testing.T) {
+	s := newTestStore(t)
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	subjects := []string{"delta", "alpha", "echo", "charlie", "bravo"}
+	for i, subject := range subjects {
+		email := models.Email{
+			ID: fmt.Sprintf("acct-%d", i), AccountID: "acct", Folder: "INBOX", Subject: subject,
+			// Two emails share each date to exercise the ID tiebreak
+			Date: date.Add(-time.Duration(i/2) * time.Hour),
+		}
+		if err := s.StoreEmail(email); err != nil {
+			t.Fatalf("Failed to store email %s: %v", email.ID, err)
+		}
+	}
+
+	// pages returns the IDs of every page of two emails
+	pages := func(criteria models.SearchCriteria) []string {
+		t.Helper()
+		var got []string
+		criteria.Limit = 2
+		for {
+			emails, err := s.SearchEmails(criteria)
+			if err != nil {
+				t.Fatalf("SearchEmails failed: %v", err)
+			}
+			var ids []string
+			for _, email := range emails {
+				ids = append(ids, email.ID)
+			}
+			got = append(got, strings.Join(ids, ","))
+			if len(emails) < criteria.Limit {
+				return got
+			}
+			criteria.Cursor = emails[len(emails)-1].Cursor
+		}
+	}
+
+	tests := []struct {
+		name     string
+		criteria models.SearchCriteria
+		want     []string
+	}{
+		{"newest first", models.SearchCriteria{}, []string{"acct-1,acct-0", "acct-3,acct-2", "acct-4"}},
+		{"oldest first", models.SearchCriteria{SortOrder: "asc"}, []string{"acct-4,acct-2", "acct-3,acct-0", "acct-1"}},
+		{"subject", models.SearchCriteria{SortBy: SortBySubject}, []string{"acct-1,acct-4", "acct-3,acct-0", "acct-2"}},
+		{"subject descending", models.SearchCriteria{SortBy: SortBySubject, SortOrder: "desc"}, []string{"acct-2,acct-0", "acct-3,acct-4", "acct-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pages(tt.criteria); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Expected pages %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	count, err := s.CountEmails(models.SearchCriteria{Subject: "a", Limit: 1})
+	if err != nil {
+		t.Fatalf("CountEmails failed: %v", err)
+	}
+	if count != 4 {
+		t.Errorf("Expected 4 emails with an a in the subject, got %d", count)
+	}
+
+	// Cursors only continue the sort they were issued for
+	emails, err := s.SearchEmails(models.SearchCriteria{Limit: 1})
+	if err != nil || len(emails) != 1 {
+		t.Fatalf("Expected one email, got %v (%v)", emails, err)
+	}
+	for _, criteria := range []models.SearchCriteria{
+		{Cursor: emails[0].Cursor, SortBy: SortBySubject},
+		{Cursor: "not a cursor"},
+	} {
+		if _, err := s.SearchEmails(criteria); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor for %+v, got %v", criteria, err)
+		}
+	}
+	if _, err := s.SearchEmails(models.SearchCriteria{SortBy: "size"}); err == nil {
+		t.Error("Expected an error for an unknown sort key")
+	}
+}
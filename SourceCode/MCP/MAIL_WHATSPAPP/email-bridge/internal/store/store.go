@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -24,13 +25,16 @@ type Store interface {
 	StoreEmail(email models.Email) error
 	GetEmail(id string) (models.Email, error)
 	SearchEmails(criteria models.SearchCriteria) ([]models.Email, error)
+	CountEmails(criteria models.SearchCriteria) (int, error)
 	UpdateEmailStatus(id string, status models.EmailStatus) error
 	MoveEmail(id string, folder string) error
 	DeleteEmail(id string) error
+	RemapEmails(deleted []string, emails []models.Email) error
 
 	// Attachment operations
 	StoreAttachment(attachment models.Attachment) error
 	GetAttachment(id string) (models.Attachment, error)
+	AttachmentHashReferenced(hash string) (bool, error)
 
 	// Folder operations
 	GetFolders(accountID string) ([]string, error)
@@ -44,6 +48,56 @@ type Store interface {
 	GetAccounts() ([]models.Account, error)
 	DeleteAccount(id string) error
 
+	// OAuth token operations
+	GetOAuthToken(accountID string) (models.OAuthToken, error)
+	StoreOAuthToken(token models.OAuthToken) error
+
+	// Outbox operations
+	QueueOutboxMessage(message models.OutboxMessage) error
+	GetOutboxMessage(id string) (models.OutboxMessage, error)
+	ClaimOutboxMessage(now time.Time, lease time.Duration) (models.OutboxMessage, error)
+	PendingOutboxMessages(accountID string) ([]models.OutboxMessage, error)
+	UpdateOutboxMessage(message models.OutboxMessage) error
+	CancelOutboxMessage(id string) error
+	EditPendingOutboxMessage(id string, email models.Email, entry models.OutboxAuditEntry) error
+	ReviewOutboxMessage(id string, status string, nextAttempt time.Time, entry models.OutboxAuditEntry) error
+	AddOutboxAuditEntry(entry models.OutboxAuditEntry) error
+	GetOutboxAuditEntries(outboxID string) ([]models.OutboxAuditEntry, error)
+
+	// Draft operations
+	StoreDraft(draft models.Draft) error
+	GetDraft(id string) (models.Draft, error)
+	GetDrafts(accountID string) ([]models.Draft, error)
+	DeleteDraft(id string) error
+
+	// Recon job operations
+	StoreReconJob(job models.ReconJob) error
+	GetReconJob(id string) (models.ReconJob, error)
+	GetReconJobs(status string) ([]models.ReconJob, error)
+	GetReconJobByAttachment(attachmentID string) (models.ReconJob, error)
+
+	// Mail rule operations
+	StoreMailRule(rule models.MailRule) error
+	GetMailRule(id string) (models.MailRule, error)
+	GetMailRules() ([]models.MailRule, error)
+	DeleteMailRule(id string) error
+
+	// Event log operations
+	AppendEvent(event models.Event) (int64, error)
+	GetEventsAfter(afterID int64, accountID, folder string, limit int) ([]models.Event, error)
+	DeleteEventsBefore(before time.Time) (int64, error)
+
+	// Webhook operations
+	StoreWebhook(webhook models.Webhook) error
+	GetWebhook(id string) (models.Webhook, error)
+	GetWebhooks() ([]models.Webhook, error)
+	DeleteWebhook(id string) error
+	StoreWebhookDelivery(delivery models.WebhookDelivery) error
+	GetWebhookDelivery(id string) (models.WebhookDelivery, error)
+	GetWebhookDeliveries(webhookID, status string, limit int) ([]models.WebhookDelivery, error)
+	ClaimWebhookDelivery(now time.Time, lease time.Duration) (models.WebhookDelivery, error)
+	DeleteWebhookDeliveriesBefore(before time.Time) (int64, error)
+
 	// Sync operations
 	GetSyncStatus(accountID, folderID string) (SyncStatus, error)
 	UpdateSyncStatus(status SyncStatus) error
@@ -55,6 +109,8 @@ type Store interface {
 type SQLiteStore struct {
 	db     *sql.DB
 	crypto *crypto.CredentialCrypto
+	// fullText is set when the FTS5 index is available
+	fullText bool
 }
 
 // NewSQLiteStore creates a new SQLite store
@@ -79,8 +135,18 @@ func NewSQLiteStore(path string, crypto *crypto.CredentialCrypto) (Store, error)
 // Initialize initializes the database
 func (s *SQLiteStore) Initialize() error {
 	// Execute the schema creation SQL
-	_, err := s.db.Exec(Schema)
-	return err
+	if _, err := s.db.Exec(Schema); err != nil {
+		return err
+	}
+
+	// Upgrade databases created with an older schema
+	for _, migration := range Migrations {
+		if _, err := s.db.Exec(migration); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return fmt.Errorf("failed to apply migration %q: %w", migration, err)
+		}
+	}
+
+	return s.initializeFullText()
 }
 
 // Close closes the database connection
@@ -100,9 +166,19 @@ func (s *SQLiteStore) StoreEmail(email models.Email) error {
 		}
 	}()
 
+	err = s.storeEmail(tx, email)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// storeEmail inserts an email with its recipients and attachments in a transaction
+func (s *SQLiteStore) storeEmail(tx *sql.Tx, email models.Email) error {
 	// Get folder ID or create if it doesn't exist
 	var folderID string
-	err = tx.QueryRow("SELECT id FROM folders WHERE account_id = ? AND name = ?",
+	err := tx.QueryRow("SELECT id FROM folders WHERE account_id = ? AND name = ?",
 		email.AccountID, email.Folder).Scan(&folderID)
 	if err == sql.ErrNoRows {
 		folderID = generateID()
@@ -166,16 +242,17 @@ func (s *SQLiteStore) StoreEmail(email models.Email) error {
 	for _, attachment := range email.Attachments {
 		attachment.EmailID = email.ID
 		_, err = tx.Exec(`
-			INSERT INTO attachments (id, email_id, filename, content_type, size, content_id, path)
-			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			INSERT INTO attachments (id, email_id, filename, content_type, size, content_id, path, hash, section)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			attachment.ID, attachment.EmailID, attachment.Filename, attachment.ContentType,
-			attachment.Size, attachment.ContentID, attachment.Path)
+			attachment.Size, attachment.ContentID, attachment.Path, attachment.Hash, attachment.Section)
 		if err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit()
+	// Add the email to the full-text index
+	return s.indexEmail(tx, email)
 }
 
 // GetEmail retrieves an email by ID
@@ -244,7 +321,7 @@ func (s *SQLiteStore) GetEmail(id string) (models.Email, error) {
 	// Query attachments if any
 	if email.HasAttachments {
 		attachRows, err := s.db.Query(`
-			SELECT id, filename, content_type, size, content_id, path
+			SELECT id, filename, content_type, size, content_id, path, hash, section
 			FROM attachments
 			WHERE email_id = ?`, id)
 		if err != nil {
@@ -254,14 +331,16 @@ func (s *SQLiteStore) GetEmail(id string) (models.Email, error) {
 
 		for attachRows.Next() {
 			var attachment models.Attachment
-			var contentID, path sql.NullString
+			var contentID, path, hash, section sql.NullString
 			if err := attachRows.Scan(&attachment.ID, &attachment.Filename, &attachment.ContentType,
-				&attachment.Size, &contentID, &path); err != nil {
+				&attachment.Size, &contentID, &path, &hash, &section); err != nil {
 				return email, err
 			}
 			attachment.EmailID = id
 			attachment.ContentID = contentID.String
 			attachment.Path = path.String
+			attachment.Hash = hash.String
+			attachment.Section = section.String
 			email.Attachments = append(email.Attachments, attachment)
 		}
 	}
@@ -272,13 +351,114 @@ func (s *SQLiteStore) GetEmail(id string) (models.Email, error) {
 // SearchEmails searches for emails based on criteria
 func (s *SQLiteStore) SearchEmails(criteria models.SearchCriteria) ([]models.Email, error) {
 	var emails []models.Email
-	var args []interface{}
+
+	// Free-text queries use the full-text index when it is available, ranking matches
+	// with BM25 weighted towards the subject and sender, and highlighting them in a snippet
+	matchQuery := s.matchQuery(criteria)
+
+	filter, args, err := s.searchFilter(criteria, matchQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := resolveSort(criteria, matchQuery != "")
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
 		SELECT e.id, e.account_id, e.message_id, f.name as folder_name, e.from_name, e.from_email,
-			e.subject, e.date, e.is_read, e.has_attachments
+			e.subject, e.date, e.is_read, e.has_attachments`
+	if matchQuery != "" {
+		query += ", " + rankSQL + ", snippet(emails_fts, -1, '<mark>', '</mark>', '...', 16)"
+	}
+	query += filter
+
+	// Continue after the last email of the previous page
+	if criteria.Cursor != "" {
+		clause, cursorArgs, err := order.after(criteria.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query += " AND " + clause
+		args = append(args, cursorArgs...)
+	}
+
+	// Add order by and limit
+	query += " ORDER BY " + order.sql()
+	if criteria.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, criteria.Limit)
+
+		if criteria.Offset > 0 {
+			query += " OFFSET ?"
+			args = append(args, criteria.Offset)
+		}
+	}
+
+	// Execute query
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Process results
+	for rows.Next() {
+		var email models.Email
+		var fromName, fromEmail sql.NullString
+		dest := []interface{}{&email.ID, &email.AccountID, &email.MessageID, &email.Folder,
+			&fromName, &fromEmail, &email.Subject, &email.Date, &email.IsRead, &email.HasAttachments}
+		if matchQuery != "" {
+			dest = append(dest, &email.Rank, &email.Snippet)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		email.From = models.Address{
+			Name:  fromName.String,
+			Email: fromEmail.String,
+		}
+		email.Cursor = order.cursor(email)
+
+		emails = append(emails, email)
+	}
+
+	return emails, nil
+}
+
+// CountEmails counts the emails matching criteria, ignoring its sort, cursor, limit and offset
+func (s *SQLiteStore) CountEmails(criteria models.SearchCriteria) (int, error) {
+	filter, args, err := s.searchFilter(criteria, s.matchQuery(criteria))
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*)"+filter, args...).Scan(&count)
+	return count, err
+}
+
+// searchFilter returns the FROM and WHERE clauses selecting the emails e, joined with
+// their folders f, that match criteria
+func (s *SQLiteStore) searchFilter(criteria models.SearchCriteria, matchQuery string) (string, []interface{}, error) {
+	var args []interface{}
+	var query string
+
+	if matchQuery != "" {
+		query = `
+		FROM emails_fts
+		JOIN emails e ON e.id = emails_fts.email_id
+		JOIN folders f ON e.folder_id = f.id
+		WHERE emails_fts MATCH ?`
+		args = append(args, matchQuery)
+	} else {
+		query = `
 		FROM emails e
 		JOIN folders f ON e.folder_id = f.id
 		WHERE 1=1`
+	}
 
 	// Add filters based on criteria
 	if criteria.AccountID != "" {
@@ -291,7 +471,7 @@ func (s *SQLiteStore) SearchEmails(criteria models.SearchCriteria) ([]models.Ema
 		args = append(args, criteria.Folder)
 	}
 
-	if criteria.Query != "" {
+	if criteria.Query != "" && matchQuery == "" {
 		query += " AND (e.subject LIKE ? OR e.text_content LIKE ? OR e.html_content LIKE ?)"
 		searchTerm := "%" + criteria.Query + "%"
 		args = append(args, searchTerm, searchTerm, searchTerm)
@@ -332,43 +512,16 @@ func (s *SQLiteStore) SearchEmails(criteria models.SearchCriteria) ([]models.Ema
 		args = append(args, *criteria.IsRead)
 	}
 
-	// Add order by and limit
-	query += " ORDER BY e.date DESC"
-	if criteria.Limit > 0 {
-		query += " LIMIT ?"
-		args = append(args, criteria.Limit)
-
-		if criteria.Offset > 0 {
-			query += " OFFSET ?"
-			args = append(args, criteria.Offset)
-		}
-	}
-
-	// Execute query
-	rows, err := s.db.Query(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	// Process results
-	for rows.Next() {
-		var email models.Email
-		var fromName, fromEmail sql.NullString
-		if err := rows.Scan(&email.ID, &email.AccountID, &email.MessageID, &email.Folder,
-			&fromName, &fromEmail, &email.Subject, &email.Date, &email.IsRead, &email.HasAttachments); err != nil {
-			return nil, err
-		}
-
-		email.From = models.Address{
-			Name:  fromName.String,
-			Email: fromEmail.String,
+	if criteria.Expression != nil {
+		clause, exprArgs, err := s.expressionSQL(*criteria.Expression)
+		if err != nil {
+			return "", nil, err
 		}
-
-		emails = append(emails, email)
+		query += " AND " + clause
+		args = append(args, exprArgs...)
 	}
 
-	return emails, nil
+	return query, args, nil
 }
 
 // UpdateEmailStatus updates the status of an email
@@ -484,8 +637,18 @@ func (s *SQLiteStore) DeleteEmail(id string) error {
 		}
 	}()
 
+	err = s.deleteEmail(tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deleteEmail deletes an email with its recipients and attachments in a transaction
+func (s *SQLiteStore) deleteEmail(tx *sql.Tx, id string) error {
 	// Delete recipients
-	_, err = tx.Exec("DELETE FROM recipients WHERE email_id = ?", id)
+	_, err := tx.Exec("DELETE FROM recipients WHERE email_id = ?", id)
 	if err != nil {
 		return err
 	}
@@ -502,36 +665,103 @@ func (s *SQLiteStore) DeleteEmail(id string) error {
 		return err
 	}
 
+	// Remove the email from the full-text index
+	return s.unindexEmail(tx, id)
+}
+
+// RemapEmails deletes the emails with the given IDs and stores emails in their place,
+// in a single transaction, so that either all of it happens or nothing does. Emails
+// may be stored under the IDs of deleted ones. Nothing is changed if the ID of one of
+// the emails is used by an email that isn't deleted.
+func (s *SQLiteStore) RemapEmails(deleted []string, emails []models.Email) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	isDeleted := make(map[string]bool, len(deleted))
+	for _, id := range deleted {
+		isDeleted[id] = true
+	}
+
+	// Check for collisions before anything is deleted
+	for _, email := range emails {
+		if isDeleted[email.ID] {
+			continue
+		}
+		var folder string
+		err = tx.QueryRow(`
+			SELECT f.name FROM emails e JOIN folders f ON e.folder_id = f.id
+			WHERE e.id = ?`, email.ID).Scan(&folder)
+		if err == nil {
+			err = fmt.Errorf("email ID %s is already used by an email in folder %s", email.ID, folder)
+			return err
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+		err = nil
+	}
+
+	for _, id := range deleted {
+		err = s.deleteEmail(tx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, email := range emails {
+		err = s.storeEmail(tx, email)
+		if err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
 // StoreAttachment stores an attachment
 func (s *SQLiteStore) StoreAttachment(attachment models.Attachment) error {
 	_, err := s.db.Exec(`
-		INSERT INTO attachments (id, email_id, filename, content_type, size, content_id, path)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO attachments (id, email_id, filename, content_type, size, content_id, path, hash, section)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
 		filename = excluded.filename,
 		content_type = excluded.content_type,
 		size = excluded.size,
 		content_id = excluded.content_id,
-		path = excluded.path`,
+		path = excluded.path,
+		hash = excluded.hash,
+		section = excluded.section`,
 		attachment.ID, attachment.EmailID, attachment.Filename, attachment.ContentType,
-		attachment.Size, attachment.ContentID, attachment.Path)
+		attachment.Size, attachment.ContentID, attachment.Path, attachment.Hash, attachment.Section)
 	return err
 }
 
+// AttachmentHashReferenced reports whether any stored attachment has the content with
+// a SHA-256 hash
+func (s *SQLiteStore) AttachmentHashReferenced(hash string) (bool, error) {
+	var referenced bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM attachments WHERE hash = ?)", hash).Scan(&referenced)
+	return referenced, err
+}
+
 // GetAttachment retrieves an attachment by ID
 func (s *SQLiteStore) GetAttachment(id string) (models.Attachment, error) {
 	var attachment models.Attachment
-	var contentID, path sql.NullString
+	var contentID, path, hash, section sql.NullString
 
 	err := s.db.QueryRow(`
-		SELECT id, email_id, filename, content_type, size, content_id, path
+		SELECT id, email_id, filename, content_type, size, content_id, path, hash, section
 		FROM attachments
 		WHERE id = ?`, id).Scan(
 		&attachment.ID, &attachment.EmailID, &attachment.Filename, &attachment.ContentType,
-		&attachment.Size, &contentID, &path)
+		&attachment.Size, &contentID, &path, &hash, &section)
 
 	if err != nil {
 		return attachment, err
@@ -539,6 +769,8 @@ func (s *SQLiteStore) GetAttachment(id string) (models.Attachment, error) {
 
 	attachment.ContentID = contentID.String
 	attachment.Path = path.String
+	attachment.Hash = hash.String
+	attachment.Section = section.String
 
 	return attachment, nil
 }
@@ -662,12 +894,14 @@ func (s *SQLiteStore) StoreAccount(account models.Account) error {
 			RefreshToken string    `json:"refresh_token"`
 			AccessToken  string    `json:"access_token"`
 			Expiry       time.Time `json:"expiry"`
+			TokenURL     string    `json:"token_url,omitempty"`
 		}{
 			ClientID:     account.OAuthConfig.ClientID,
 			ClientSecret: clientSecret,
 			RefreshToken: refreshToken,
 			AccessToken:  accessToken,
 			Expiry:       account.OAuthConfig.Expiry,
+			TokenURL:     account.OAuthConfig.TokenURL,
 		}
 
 		// Convert to JSON
@@ -751,6 +985,7 @@ func (s *SQLiteStore) GetAccount(id string) (models.Account, error) {
 			RefreshToken string    `json:"refresh_token"`
 			AccessToken  string    `json:"access_token"`
 			Expiry       time.Time `json:"expiry"`
+			TokenURL     string    `json:"token_url,omitempty"`
 		}
 
 		err = json.Unmarshal([]byte(oauthData.String), &oauthDataObj)
@@ -778,6 +1013,7 @@ func (s *SQLiteStore) GetAccount(id string) (models.Account, error) {
 			RefreshToken: refreshToken,
 			AccessToken:  accessToken,
 			Expiry:       oauthDataObj.Expiry,
+			TokenURL:     oauthDataObj.TokenURL,
 		}
 	}
 
@@ -852,6 +1088,12 @@ func (s *SQLiteStore) DeleteAccount(id string) error {
 		return err
 	}
 
+	// Delete refreshed OAuth tokens
+	_, err = tx.Exec("DELETE FROM oauth_tokens WHERE account_id = ?", id)
+	if err != nil {
+		return err
+	}
+
 	// For each folder, delete emails and related data
 	for _, folderID := range folderIDs {
 		// Get all email IDs in this folder
@@ -882,6 +1124,11 @@ func (s *SQLiteStore) DeleteAccount(id string) error {
 			if err != nil {
 				return err
 			}
+
+			err = s.unindexEmail(tx, emailID)
+			if err != nil {
+				return err
+			}
 		}
 
 		// Delete emails in this folder
@@ -906,12 +1153,70 @@ func (s *SQLiteStore) DeleteAccount(id string) error {
 	return tx.Commit()
 }
 
+// GetOAuthToken retrieves the latest OAuth token of an account.
+// It returns sql.ErrNoRows if no token has been stored.
+func (s *SQLiteStore) GetOAuthToken(accountID string) (models.OAuthToken, error) {
+	token := models.OAuthToken{AccountID: accountID}
+	var accessToken, refreshToken, expiry string
+
+	err := s.db.QueryRow(`
+		SELECT access_token, refresh_token, expiry
+		FROM oauth_tokens
+		WHERE account_id = ?`, accountID).Scan(&accessToken, &refreshToken, &expiry)
+	if err != nil {
+		return token, err
+	}
+
+	if token.AccessToken, err = s.crypto.Decrypt(accessToken); err != nil {
+		return token, err
+	}
+	if token.RefreshToken, err = s.crypto.Decrypt(refreshToken); err != nil {
+		return token, err
+	}
+
+	if expiry != "" {
+		if token.Expiry, err = time.Parse(time.RFC3339, expiry); err != nil {
+			return token, fmt.Errorf("failed to parse token expiry: %w", err)
+		}
+	}
+
+	return token, nil
+}
+
+// StoreOAuthToken stores the latest OAuth token of an account, encrypting the tokens
+func (s *SQLiteStore) StoreOAuthToken(token models.OAuthToken) error {
+	accessToken, err := s.crypto.Encrypt(token.AccessToken)
+	if err != nil {
+		return err
+	}
+	refreshToken, err := s.crypto.Encrypt(token.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	var expiry string
+	if !token.Expiry.IsZero() {
+		expiry = token.Expiry.Format(time.RFC3339)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO oauth_tokens (account_id, access_token, refresh_token, expiry)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(account_id) DO UPDATE SET
+		access_token = excluded.access_token,
+		refresh_token = excluded.refresh_token,
+		expiry = excluded.expiry`,
+		token.AccountID, accessToken, refreshToken, expiry)
+
+	return err
+}
+
 // Helper function to generate a unique ID
 func generateID() string {
 	b := make([]byte, 16)
 	_, err := rand.Read(b)
 	if err != nil {
-		return time.Now().Format("20060102150405") + strconv.FormatInt(rand.Int63(), 10)
+		return time.Now().Format("20060102150405") + strconv.FormatInt(time.Now().UnixNano(), 10)
 	}
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
 }
@@ -923,6 +1228,9 @@ type SyncStatus struct {
 	LastSync    time.Time `json:"last_sync"`
 	UIDValidity string    `json:"uid_validity"`
 	LastUID     uint32    `json:"last_uid"` // Last seen UID in this folder
+	// HighestModSeq is the folder's HIGHESTMODSEQ when its flag changes and expunges
+	// were last synced, or 0 if the server doesn't support CONDSTORE
+	HighestModSeq uint64 `json:"highest_mod_seq"`
 }
 
 // GetSyncStatus retrieves the sync status for a folder
@@ -931,11 +1239,11 @@ func (s *SQLiteStore) GetSyncStatus(accountID, folderID string) (SyncStatus, err
 	var lastSync string
 
 	err := s.db.QueryRow(`
-		SELECT account_id, folder_id, last_sync, uid_validity, last_uid
+		SELECT account_id, folder_id, last_sync, uid_validity, last_uid, COALESCE(highest_mod_seq, 0)
 		FROM sync_status
 		WHERE account_id = ? AND folder_id = ?`,
 		accountID, folderID).Scan(
-		&status.AccountID, &status.FolderID, &lastSync, &status.UIDValidity, &status.LastUID)
+		&status.AccountID, &status.FolderID, &lastSync, &status.UIDValidity, &status.LastUID, &status.HighestModSeq)
 
 	if err == sql.ErrNoRows {
 		// No sync status found, return empty status
@@ -964,13 +1272,14 @@ func (s *SQLiteStore) UpdateSyncStatus(status SyncStatus) error {
 	lastSync := status.LastSync.Format(time.RFC3339)
 
 	_, err := s.db.Exec(`
-		INSERT INTO sync_status (account_id, folder_id, last_sync, uid_validity, last_uid)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO sync_status (account_id, folder_id, last_sync, uid_validity, last_uid, highest_mod_seq)
+		VALUES (?, ?, ?, ?, ?, ?)
 		ON CONFLICT(account_id, folder_id) DO UPDATE SET
 		last_sync = excluded.last_sync,
 		uid_validity = excluded.uid_validity,
-		last_uid = excluded.last_uid`,
-		status.AccountID, status.FolderID, lastSync, status.UIDValidity, status.LastUID)
+		last_uid = excluded.last_uid,
+		highest_mod_seq = excluded.highest_mod_seq`,
+		status.AccountID, status.FolderID, lastSync, status.UIDValidity, status.LastUID, int64(status.HighestModSeq))
 
 	return err
 }
@@ -980,7 +1289,7 @@ func (s *SQLiteStore) GetAllSyncStatus(accountID string) ([]SyncStatus, error) {
 	var statuses []SyncStatus
 
 	rows, err := s.db.Query(`
-		SELECT account_id, folder_id, last_sync, uid_validity, last_uid
+		SELECT account_id, folder_id, last_sync, uid_validity, last_uid, COALESCE(highest_mod_seq, 0)
 		FROM sync_status
 		WHERE account_id = ?
 		ORDER BY folder_id`,
@@ -993,7 +1302,7 @@ func (s *SQLiteStore) GetAllSyncStatus(accountID string) ([]SyncStatus, error) {
 	for rows.Next() {
 		var status SyncStatus
 		var lastSync string
-		if err := rows.Scan(&status.AccountID, &status.FolderID, &lastSync, &status.UIDValidity, &status.LastUID); err != nil {
+		if err := rows.Scan(&status.AccountID, &status.FolderID, &lastSync, &status.UIDValidity, &status.LastUID, &status.HighestModSeq); err != nil {
 			return nil, err
 		}
 
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+func TestAttachmentHashes(t *testing.T) {
+	s := newTestStore(t)
+
+	email := models.Email{
+		ID: "acct-1", AccountID: "acct", Folder: "INBOX", Subject: "Statement",
+		Date:           time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		HasAttachments: true,
+		Attachments: []models.Attachment{
+			{ID: "acct-1-1", Filename: "statement.pdf", Path: "/data/sha256/ab/abc", Hash: "abc", Size: 3},
+		},
+	}
+	if err := s.StoreEmail(email); err != nil {
+		t.Fatalf("StoreEmail failed: %v", err)
+	}
+
+	stored, err := s.GetEmail(email.ID)
+	if err != nil || len(stored.Attachments) != 1 || stored.Attachments[0].Hash != "abc" {
+		t.Fatalf("Expected the attachment hash to be stored, got %+v (%v)", stored.Attachments, err)
+	}
+	if attachment, err := s.GetAttachment("acct-1-1"); err != nil || attachment.Hash != "abc" || attachment.Path != "/data/sha256/ab/abc" {
+		t.Errorf("Unexpected attachment %+v (%v)", attachment, err)
+	}
+
+	if referenced, err := s.AttachmentHashReferenced("abc"); err != nil || !referenced {
+		t.Errorf("Expected abc to be referenced, got %v (%v)", referenced, err)
+	}
+	if err := s.DeleteEmail(email.ID); err != nil {
+		t.Fatalf("DeleteEmail failed: %v", err)
+	}
+	if referenced, err := s.AttachmentHashReferenced("abc"); err != nil || referenced {
+		t.Errorf("Expected abc not to be referenced after deleting its email, got %v (%v)", referenced, err)
+	}
+}
+
+func TestSyncStatusModSeq(t *testing.T) {
+	s := newTestStore(t)
+
+	// Mod-sequences are 63-bit, beyond the range of UIDs
+	status := SyncStatus{
+		AccountID: "acct", FolderID: "INBOX", LastSync: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		UIDValidity: "1700000000", LastUID: 4211, HighestModSeq: 1 << 40,
+	}
+	if err := s.UpdateSyncStatus(status); err != nil {
+		t.Fatalf("UpdateSyncStatus failed: %v", err)
+	}
+
+	stored, err := s.GetSyncStatus("acct", "INBOX")
+	if err != nil || stored.HighestModSeq != 1<<40 || stored.LastUID != 4211 {
+		t.Errorf("Unexpected sync status %+v (%v)", stored, err)
+	}
+	if statuses, err := s.GetAllSyncStatus("acct"); err != nil || len(statuses) != 1 || statuses[0].HighestModSeq != 1<<40 {
+		t.Errorf("Unexpected sync statuses %+v (%v)", statuses, err)
+	}
+}
+
+// TestRemapEmails tests that emails can swap IDs, and that nothing is changed when a
+// new ID is used by an email that isn't deleted
+func TestRemapEmails(t *testing.T) {
+	s := newTestStore(t)
+
+	date := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, email := range []models.Email{
+		{ID: "acct-1", AccountID: "acct", Folder: "INBOX", Subject: "Alpha", Date: date},
+		{ID: "acct-2", AccountID: "acct", Folder: "INBOX", Subject: "Bravo", Date: date},
+		{ID: "acct-3", AccountID: "acct", Folder: "Archive", Subject: "Charlie", Date: date},
+	} {
+		if err := s.StoreEmail(email); err != nil {
+			t.Fatalf("StoreEmail failed: %v", err)
+		}
+	}
+
+	// acct-3 belongs to another folder, so neither email may be re-keyed
+	err := s.RemapEmails([]string{"acct-1", "acct-2"}, []models.Email{
+		{ID: "acct-2", AccountID: "acct", Folder: "INBOX", Subject: "Alpha", Date: date},
+		{ID: "acct-3", AccountID: "acct", Folder: "INBOX", Subject: "Bravo", Date: date},
+	})
+	if err == nil {
+		t.Fatalf("Expected the collision with acct-3 to fail")
+	}
+	for id, subject := range map[string]string{"acct-1": "Alpha", "acct-2": "Bravo", "acct-3": "Charlie"} {
+		if email, err := s.GetEmail(id); err != nil || email.Subject != subject {
+			t.Errorf("Expected %s to be left as %s, got %+v (%v)", id, subject, email, err)
+		}
+	}
+
+	err = s.RemapEmails([]string{"acct-1", "acct-2"}, []models.Email{
+		{ID: "acct-2", AccountID: "acct", Folder: "INBOX", Subject: "Alpha", Date: date},
+		{ID: "acct-1", AccountID: "acct", Folder: "INBOX", Subject: "Bravo", Date: date},
+	})
+	if err != nil {
+		t.Fatalf("RemapEmails failed: %v", err)
+	}
+	for id, subject := range map[string]string{"acct-1": "Bravo", "acct-2": "Alpha"} {
+		if email, err := s.GetEmail(id); err != nil || email.Subject != subject {
+			t.Errorf("Expected %s to be %s, got %+v (%v)", id, subject, email, err)
+		}
+	}
+	if emails, err := s.SearchEmails(models.SearchCriteria{Query: "Alpha"}); err != nil || len(emails) != 1 || emails[0].ID != "acct-2" {
+		t.Errorf("Expected the index to follow the new IDs, got %+v (%v)", emails, err)
+	}
+}
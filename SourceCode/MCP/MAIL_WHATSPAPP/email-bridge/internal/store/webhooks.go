@@ -0,0 +1,253 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+const webhookColumns = "id, account_id, event_types, url, secret, enabled, created_at, updated_at"
+
+const webhookDeliveryColumns = "id, webhook_id, account_id, event_type, payload, status, attempts, last_error, " +
+	"response_status, next_attempt, created_at, delivered_at"
+
+// StoreWebhook saves a webhook, replacing it if it exists. Its secret is encrypted.
+func (s *SQLiteStore) StoreWebhook(webhook models.Webhook) error {
+	eventTypes, err := json.Marshal(webhook.EventTypes)
+	if err != nil {
+		return fmt.Errorf("failed to encode event types: %w", err)
+	}
+	secret, err := s.crypto.Encrypt(webhook.Secret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt webhook secret: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT OR REPLACE INTO webhooks (`+webhookColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		webhook.ID, webhook.AccountID, string(eventTypes), webhook.URL, secret, webhook.Enabled,
+		formatTimestamp(webhook.CreatedAt), formatTimestamp(webhook.UpdatedAt))
+	return err
+}
+
+// GetWebhook retrieves a webhook. It returns sql.ErrNoRows if there is none.
+func (s *SQLiteStore) GetWebhook(id string) (models.Webhook, error) {
+	row := s.db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id)
+	return s.scanWebhook(row)
+}
+
+// GetWebhooks returns all webhooks in the order they were created
+func (s *SQLiteStore) GetWebhooks() ([]models.Webhook, error) {
+	rows, err := s.db.Query("SELECT " + webhookColumns + " FROM webhooks ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		webhook, err := s.scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook deletes a webhook with its deliveries. It returns sql.ErrNoRows if
+// there is none.
+func (s *SQLiteStore) DeleteWebhook(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scanWebhook scans a row of webhookColumns, decrypting the secret
+func (s *SQLiteStore) scanWebhook(row rowScanner) (models.Webhook, error) {
+	var webhook models.Webhook
+	var accountID, eventTypes, secret sql.NullString
+	var createdAt, updatedAt string
+
+	err := row.Scan(&webhook.ID, &accountID, &eventTypes, &webhook.URL, &secret, &webhook.Enabled, &createdAt, &updatedAt)
+	if err != nil {
+		return webhook, err
+	}
+	webhook.AccountID = accountID.String
+
+	if eventTypes.String != "" {
+		if err := json.Unmarshal([]byte(eventTypes.String), &webhook.EventTypes); err != nil {
+			return webhook, fmt.Errorf("failed to decode event types of webhook %s: %w", webhook.ID, err)
+		}
+	}
+	if webhook.Secret, err = s.crypto.Decrypt(secret.String); err != nil {
+		return webhook, fmt.Errorf("failed to decrypt secret of webhook %s: %w", webhook.ID, err)
+	}
+
+	if webhook.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return webhook, err
+	}
+	if webhook.UpdatedAt, err = parseTimestamp(updatedAt); err != nil {
+		return webhook, err
+	}
+
+	return webhook, nil
+}
+
+// StoreWebhookDelivery saves a webhook delivery, replacing it if it exists
+func (s *SQLiteStore) StoreWebhookDelivery(delivery models.WebhookDelivery) error {
+	_, err := s.db.Exec(`
+		INSERT OR REPLACE INTO webhook_deliveries (`+webhookDeliveryColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.ID, delivery.WebhookID, delivery.AccountID, delivery.EventType, string(delivery.Payload),
+		delivery.Status, delivery.Attempts, delivery.LastError, delivery.ResponseStatus,
+		formatTimestamp(delivery.NextAttempt), formatTimestamp(delivery.CreatedAt), formatTimestampPtr(delivery.DeliveredAt))
+	return err
+}
+
+// GetWebhookDelivery retrieves a webhook delivery. It returns sql.ErrNoRows if there
+// is none.
+func (s *SQLiteStore) GetWebhookDelivery(id string) (models.WebhookDelivery, error) {
+	row := s.db.QueryRow("SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE id = ?", id)
+	return scanWebhookDelivery(row)
+}
+
+// GetWebhookDeliveries returns up to limit deliveries, most recent first. A non-empty
+// webhook ID or status only returns the deliveries of that webhook or with that status.
+func (s *SQLiteStore) GetWebhookDeliveries(webhookID, status string, limit int) ([]models.WebhookDelivery, error) {
+	query := "SELECT " + webhookDeliveryColumns + " FROM webhook_deliveries WHERE 1 = 1"
+	var args []interface{}
+	if webhookID != "" {
+		query += " AND webhook_id = ?"
+		args = append(args, webhookID)
+	}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ClaimWebhookDelivery marks the queued delivery whose next attempt is due first as
+// sending and returns it. It returns sql.ErrNoRows if no delivery is due. A delivery
+// whose sending was interrupted, for example by a restart, is due again once its
+// claim lease expires.
+func (s *SQLiteStore) ClaimWebhookDelivery(now time.Time, lease time.Duration) (models.WebhookDelivery, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var delivery models.WebhookDelivery
+	delivery, err = scanWebhookDelivery(tx.QueryRow(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE status IN (?, ?) AND next_attempt <= ?
+		ORDER BY next_attempt, created_at
+		LIMIT 1`,
+		models.WebhookDeliveryQueued, models.WebhookDeliverySending, formatTimestamp(now)))
+	if err != nil {
+		return delivery, err
+	}
+
+	delivery.Status = models.WebhookDeliverySending
+	delivery.NextAttempt = now.Add(lease)
+	if _, err = tx.Exec("UPDATE webhook_deliveries SET status = ?, next_attempt = ? WHERE id = ?",
+		delivery.Status, formatTimestamp(delivery.NextAttempt), delivery.ID); err != nil {
+		return delivery, err
+	}
+
+	err = tx.Commit()
+	return delivery, err
+}
+
+// DeleteWebhookDeliveriesBefore removes the deliveries that were delivered before a
+// time and returns how many were removed. Dead deliveries are kept until they are
+// replayed or their webhook is deleted.
+func (s *SQLiteStore) DeleteWebhookDeliveriesBefore(before time.Time) (int64, error) {
+	result, err := s.db.Exec("DELETE FROM webhook_deliveries WHERE status = ? AND delivered_at < ?",
+		models.WebhookDeliveryDelivered, formatTimestamp(before))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// scanWebhookDelivery scans a row of webhookDeliveryColumns
+func scanWebhookDelivery(row rowScanner) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var accountID, payload, lastError, deliveredAt sql.NullString
+	var responseStatus sql.NullInt64
+	var nextAttempt, createdAt string
+
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &accountID, &delivery.EventType, &payload, &delivery.Status,
+		&delivery.Attempts, &lastError, &responseStatus, &nextAttempt, &createdAt, &deliveredAt)
+	if err != nil {
+		return delivery, err
+	}
+	delivery.AccountID = accountID.String
+	delivery.LastError = lastError.String
+	delivery.ResponseStatus = int(responseStatus.Int64)
+	if payload.String != "" {
+		delivery.Payload = json.RawMessage(payload.String)
+	}
+
+	if delivery.NextAttempt, err = parseTimestamp(nextAttempt); err != nil {
+		return delivery, err
+	}
+	if delivery.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return delivery, err
+	}
+	if delivery.DeliveredAt, err = parseTimestampPtr(deliveredAt); err != nil {
+		return delivery, err
+	}
+
+	return delivery, nil
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/models"
+)
+
+func TestWebhooks(t *testing.T) {
+	s := newTestStore(t)
+	created := time.Date(2025, 5, 2, 9, 0, 0, 0, time.UTC)
+
+	webhook := models.Webhook{
+		ID:         "webhook-1",
+		AccountID:  "acct",
+		EventTypes: []string{"new", "moved"},
+		URL:        "https://recon.example.com/hooks/email",
+		Secret:     "s3cret",
+		Enabled:    true,
+		CreatedAt:  created,
+		UpdatedAt:  created,
+	}
+	if err := s.StoreWebhook(webhook); err != nil {
+		t.Fatalf("StoreWebhook failed: %v", err)
+	}
+	if err := s.StoreWebhook(models.Webhook{ID: "webhook-2", URL: "https://example.com", CreatedAt: created.Add(time.Minute)}); err != nil {
+		t.Fatalf("StoreWebhook failed: %v", err)
+	}
+
+	// The secret is encrypted at rest
+	var secret string
+	s.db.QueryRow("SELECT secret FROM webhooks WHERE id = ?", webhook.ID).Scan(&secret)
+	if secret == "" || secret == webhook.Secret {
+		t.Errorf("Expected the secret to be encrypted, got %q", secret)
+	}
+
+	stored, err := s.GetWebhook(webhook.ID)
+	if err != nil {
+		t.Fatalf("GetWebhook failed: %v", err)
+	}
+	if stored.Secret != "s3cret" || stored.AccountID != "acct" || len(stored.EventTypes) != 2 || !stored.Enabled ||
+		!stored.CreatedAt.Equal(created) {
+		t.Errorf("Webhook was not stored intact: %+v", stored)
+	}
+	if list, err := s.GetWebhooks(); err != nil || len(list) != 2 || list[0].ID != "webhook-1" || list[1].EventTypes != nil {
+		t.Errorf("Unexpected webhooks %+v (%v)", list, err)
+	}
+
+	deliveries := []models.WebhookDelivery{
+		{ID: "delivery-1", WebhookID: "webhook-1", EventType: "new", Payload: []byte(`{"type":"new"}`),
+			Status: models.WebhookDeliveryQueued, NextAttempt: created.Add(2 * time.Minute), CreatedAt: created},
+		{ID: "delivery-2", WebhookID: "webhook-1", EventType: "moved", Payload: []byte(`{"type":"moved"}`),
+			Status: models.WebhookDeliveryQueued, NextAttempt: created, CreatedAt: created.Add(time.Minute)},
+		{ID: "delivery-3", WebhookID: "webhook-2", EventType: "new", Payload: []byte(`{"type":"new"}`),
+			Status: models.WebhookDeliveryDead, Attempts: 10, LastError: "webhook returned 500", ResponseStatus: 500,
+			NextAttempt: created, CreatedAt: created.Add(2 * time.Minute)},
+	}
+	for _, delivery := range deliveries {
+		if err := s.StoreWebhookDelivery(delivery); err != nil {
+			t.Fatalf("StoreWebhookDelivery failed: %v", err)
+		}
+	}
+
+	// Deliveries are claimed in the order they are due
+	now := created.Add(time.Minute)
+	claimed, err := s.ClaimWebhookDelivery(now, time.Minute)
+	if err != nil || claimed.ID != "delivery-2" || claimed.Status != models.WebhookDeliverySending ||
+		string(claimed.Payload) != `{"type":"moved"}` {
+		t.Fatalf("Unexpected claimed delivery %+v (%v)", claimed, err)
+	}
+	if _, err := s.ClaimWebhookDelivery(now, time.Minute); err != sql.ErrNoRows {
+		t.Errorf("Expected no delivery to be due, got %v", err)
+	}
+
+	delivered := now.Add(time.Second)
+	claimed.Status = models.WebhookDeliveryDelivered
+	claimed.Attempts = 1
+	claimed.DeliveredAt = &delivered
+	if err := s.StoreWebhookDelivery(claimed); err != nil {
+		t.Fatalf("StoreWebhookDelivery failed: %v", err)
+	}
+
+	dead, err := s.GetWebhookDeliveries("", models.WebhookDeliveryDead, 10)
+	if err != nil || len(dead) != 1 || dead[0].ID != "delivery-3" || dead[0].ResponseStatus != 500 || dead[0].LastError == "" {
+		t.Errorf("Unexpected dead deliveries %+v (%v)", dead, err)
+	}
+	log, err := s.GetWebhookDeliveries("webhook-1", "", 10)
+	if err != nil || len(log) != 2 || log[0].ID != "delivery-2" || log[0].DeliveredAt == nil {
+		t.Errorf("Unexpected delivery log %+v (%v)", log, err)
+	}
+
+	// Only delivered deliveries are pruned
+	if deleted, err := s.DeleteWebhookDeliveriesBefore(delivered.Add(time.Hour)); err != nil || deleted != 1 {
+		t.Errorf("Expected 1 delivery to be pruned, got %d (%v)", deleted, err)
+	}
+
+	// Deleting a webhook deletes its deliveries
+	if err := s.DeleteWebhook("webhook-1"); err != nil {
+		t.Fatalf("DeleteWebhook failed: %v", err)
+	}
+	if _, err := s.GetWebhookDelivery("delivery-1"); err != sql.ErrNoRows {
+		t.Errorf("Expected the webhook's deliveries to be deleted, got %v", err)
+	}
+	if _, err := s.GetWebhookDelivery("delivery-3"); err != nil {
+		t.Errorf("Expected other deliveries to be kept, got %v", err)
+	}
+	if err := s.DeleteWebhook("webhook-1"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows deleting a missing webhook, got %v", err)
+	}
+}
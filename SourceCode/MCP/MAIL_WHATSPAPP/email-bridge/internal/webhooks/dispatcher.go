@@ -0,0 +1,347 @@
+package webhooks
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/events"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+const (
+	// maxDeliveryAttempts is how many times a delivery is tried before it is dead
+	maxDeliveryAttempts = 10
+	// deliveryRetryDelay is the delay before the first retry, doubled after each attempt
+	deliveryRetryDelay = 30 * time.Second
+	// maxDeliveryRetryDelay caps the delay between retries
+	maxDeliveryRetryDelay = time.Hour
+	// deliverySendingLease is how long a delivery being sent stays claimed. A delivery
+	// whose sending was interrupted by a crash is sent again after it.
+	deliverySendingLease = 5 * time.Minute
+	// deliveryTimeout bounds a request to a webhook
+	deliveryTimeout = 10 * time.Second
+	// deliveryRetention is how long delivered deliveries stay in the log
+	deliveryRetention = 30 * 24 * time.Hour
+	// pruneInterval is how often delivered deliveries older than the retention are
+	// removed
+	pruneInterval = time.Hour
+)
+
+// ErrDeliveryNotDead is returned when replaying a delivery that is not dead
+var ErrDeliveryNotDead = errors.New("webhook delivery is not dead")
+
+// payload is the JSON body posted to a webhook: the event, as streamed from
+// GET /events, with the IDs of the delivery and the webhook
+type payload struct {
+	DeliveryID string `json:"delivery_id"`
+	WebhookID  string `json:"webhook_id"`
+	models.Event
+}
+
+// Dispatcher queues a delivery for each event a webhook subscribes to and sends the
+// deliveries one at a time in the background, in the order they are due
+type Dispatcher struct {
+	store        store.Store
+	httpClient   *http.Client
+	pollInterval time.Duration
+
+	mutex     sync.Mutex
+	queueMu   sync.Mutex
+	wake      chan struct{}
+	stopChan  chan struct{}
+	done      chan struct{}
+	running   bool
+	lastPrune time.Time
+}
+
+// NewDispatcher creates a dispatcher for the webhooks in the store
+func NewDispatcher(s store.Store) *Dispatcher {
+	return &Dispatcher{
+		store:        s,
+		httpClient:   &http.Client{Timeout: deliveryTimeout},
+		pollInterval: 10 * time.Second,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// HandleEvent queues a delivery of an event to each enabled webhook subscribed to it.
+// Webhooks are read from the store for each event, so changes made over the API apply
+// to the next event.
+func (d *Dispatcher) HandleEvent(emailEvent client.EmailEvent) {
+	webhooks, err := d.store.GetWebhooks()
+	if err != nil {
+		fmt.Printf("Warning: Failed to load webhooks: %v\n", err)
+		return
+	}
+
+	now := time.Now()
+	event := events.NewEvent(emailEvent, now)
+	queued := false
+	for i, webhook := range webhooks {
+		if !subscribes(webhook, event) {
+			continue
+		}
+
+		delivery := models.WebhookDelivery{
+			ID:          fmt.Sprintf("delivery_%d_%d", now.UnixNano(), i),
+			WebhookID:   webhook.ID,
+			AccountID:   event.AccountID,
+			EventType:   event.Type,
+			Status:      models.WebhookDeliveryQueued,
+			NextAttempt: now,
+			CreatedAt:   now,
+		}
+		delivery.Payload, err = json.Marshal(payload{DeliveryID: delivery.ID, WebhookID: webhook.ID, Event: event})
+		if err != nil {
+			fmt.Printf("Warning: Failed to encode %s event for webhook %s: %v\n", event.Type, webhook.ID, err)
+			continue
+		}
+
+		if err := d.store.StoreWebhookDelivery(delivery); err != nil {
+			fmt.Printf("Warning: Failed to queue %s event for webhook %s: %v\n", event.Type, webhook.ID, err)
+			continue
+		}
+		queued = true
+	}
+
+	if queued {
+		d.Notify()
+	}
+}
+
+// SetPollInterval sets how often the queue is checked for due retries
+func (d *Dispatcher) SetPollInterval(interval time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.pollInterval = interval
+}
+
+// Start starts sending queued deliveries in the background
+func (d *Dispatcher) Start() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.running {
+		return
+	}
+
+	d.running = true
+	d.stopChan = make(chan struct{})
+	d.done = make(chan struct{})
+	go d.run(d.stopChan, d.done, d.pollInterval)
+}
+
+// Stop stops the dispatcher, waiting for a delivery being sent to finish
+func (d *Dispatcher) Stop() {
+	d.mutex.Lock()
+	if !d.running {
+		d.mutex.Unlock()
+		return
+	}
+	d.running = false
+	close(d.stopChan)
+	done := d.done
+	d.mutex.Unlock()
+
+	<-done
+}
+
+// Notify wakes the dispatcher to send newly queued deliveries without waiting for the
+// next poll
+func (d *Dispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+		// A wake-up is already pending
+	}
+}
+
+// run sends due deliveries until stopChan is closed
+func (d *Dispatcher) run(stopChan <-chan struct{}, done chan<- struct{}, pollInterval time.Duration) {
+	defer close(done)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.sendDue(stopChan)
+		d.prune()
+
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// sendDue sends the queued deliveries whose next attempt is due
+func (d *Dispatcher) sendDue(stopChan <-chan struct{}) {
+	for {
+		select {
+		case <-stopChan:
+			return
+		default:
+		}
+
+		d.queueMu.Lock()
+		delivery, err := d.store.ClaimWebhookDelivery(time.Now(), deliverySendingLease)
+		d.queueMu.Unlock()
+		if err == sql.ErrNoRows {
+			return
+		}
+		if err != nil {
+			fmt.Printf("Warning: Failed to load webhook deliveries: %v\n", err)
+			return
+		}
+		d.send(delivery)
+	}
+}
+
+// send makes one attempt to deliver an event and records the outcome
+func (d *Dispatcher) send(delivery models.WebhookDelivery) {
+	webhook, err := d.store.GetWebhook(delivery.WebhookID)
+	if err == sql.ErrNoRows {
+		// The webhook was deleted with its deliveries
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case err != nil:
+		delivery.Status = models.WebhookDeliveryQueued
+		delivery.LastError = fmt.Sprintf("failed to load webhook: %v", err)
+		delivery.NextAttempt = now.Add(deliveryRetryDelay)
+	case !webhook.Enabled:
+		// Keep the delivery to replay once the webhook is enabled again
+		delivery.Status = models.WebhookDeliveryDead
+		delivery.LastError = "webhook is disabled"
+	default:
+		d.attempt(&delivery, webhook)
+	}
+
+	d.queueMu.Lock()
+	defer d.queueMu.Unlock()
+	if err := d.store.StoreWebhookDelivery(delivery); err != nil {
+		fmt.Printf("Warning: Failed to update webhook delivery %s: %v\n", delivery.ID, err)
+	}
+}
+
+// attempt posts a delivery to its webhook and sets its status from the outcome
+func (d *Dispatcher) attempt(delivery *models.WebhookDelivery, webhook models.Webhook) {
+	status, err := d.post(webhook, *delivery)
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+
+	switch {
+	case err == nil:
+		delivery.Status = models.WebhookDeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= maxDeliveryAttempts:
+		delivery.Status = models.WebhookDeliveryDead
+		delivery.LastError = err.Error()
+	default:
+		delivery.Status = models.WebhookDeliveryQueued
+		delivery.LastError = err.Error()
+		delivery.NextAttempt = now.Add(deliveryBackoff(delivery.Attempts))
+	}
+}
+
+// post posts a delivery's payload to its webhook, signed with the webhook's secret, and
+// returns the response status. Any status but 2xx is an error.
+func (d *Dispatcher) post(webhook models.Webhook, delivery models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "email-bridge-webhooks")
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("webhook request failed: %w", err)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// prune removes the delivered deliveries older than the retention, at most once per
+// prune interval
+func (d *Dispatcher) prune() {
+	now := time.Now()
+	if now.Sub(d.lastPrune) < pruneInterval {
+		return
+	}
+	d.lastPrune = now
+
+	if _, err := d.store.DeleteWebhookDeliveriesBefore(now.Add(-deliveryRetention)); err != nil {
+		fmt.Printf("Warning: Failed to remove old webhook deliveries: %v\n", err)
+	}
+}
+
+// Replay queues a dead delivery again with a fresh set of attempts. It returns
+// sql.ErrNoRows if there is no such delivery and ErrDeliveryNotDead if it is queued,
+// being sent or was delivered.
+func (d *Dispatcher) Replay(id string) (models.WebhookDelivery, error) {
+	d.queueMu.Lock()
+	delivery, err := d.store.GetWebhookDelivery(id)
+	if err != nil {
+		d.queueMu.Unlock()
+		return delivery, err
+	}
+	if delivery.Status != models.WebhookDeliveryDead {
+		d.queueMu.Unlock()
+		return delivery, ErrDeliveryNotDead
+	}
+
+	delivery.Status = models.WebhookDeliveryQueued
+	delivery.Attempts = 0
+	delivery.LastError = ""
+	delivery.ResponseStatus = 0
+	delivery.NextAttempt = time.Now()
+	err = d.store.StoreWebhookDelivery(delivery)
+	d.queueMu.Unlock()
+	if err != nil {
+		return delivery, err
+	}
+
+	d.Notify()
+	return delivery, nil
+}
+
+// deliveryBackoff returns the delay before retrying a delivery after a number of
+// attempts
+func deliveryBackoff(attempts int) time.Duration {
+	delay := deliveryRetryDelay
+	for i := 1; i < attempts && delay < maxDeliveryRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDeliveryRetryDelay {
+		delay = maxDeliveryRetryDelay
+	}
+	return delay
+}
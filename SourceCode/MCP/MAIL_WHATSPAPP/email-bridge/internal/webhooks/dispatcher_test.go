@@ -0,0 +1,265 @@
+package webhooks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/models"
+	"github.com/user/email-bridge/internal/store"
+)
+
+// webhookStore keeps webhooks and their deliveries in memory
+type webhookStore struct {
+	store.Store
+	mutex      sync.Mutex
+	webhooks   []models.Webhook
+	deliveries map[string]models.WebhookDelivery
+}
+
+func newWebhookStore(webhooks ...models.Webhook) *webhookStore {
+	return &webhookStore{webhooks: webhooks, deliveries: make(map[string]models.WebhookDelivery)}
+}
+
+func (s *webhookStore) GetWebhooks() ([]models.Webhook, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]models.Webhook(nil), s.webhooks...), nil
+}
+
+func (s *webhookStore) GetWebhook(id string) (models.Webhook, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, webhook := range s.webhooks {
+		if webhook.ID == id {
+			return webhook, nil
+		}
+	}
+	return models.Webhook{}, sql.ErrNoRows
+}
+
+func (s *webhookStore) StoreWebhookDelivery(delivery models.WebhookDelivery) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (s *webhookStore) GetWebhookDelivery(id string) (models.WebhookDelivery, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return delivery, sql.ErrNoRows
+	}
+	return delivery, nil
+}
+
+func (s *webhookStore) ClaimWebhookDelivery(now time.Time, lease time.Duration) (models.WebhookDelivery, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var due []models.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.Status == models.WebhookDeliveryQueued && !delivery.NextAttempt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	if len(due) == 0 {
+		return models.WebhookDelivery{}, sql.ErrNoRows
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	delivery := due[0]
+	delivery.Status = models.WebhookDeliverySending
+	delivery.NextAttempt = now.Add(lease)
+	s.deliveries[delivery.ID] = delivery
+	return delivery, nil
+}
+
+func (s *webhookStore) DeleteWebhookDeliveriesBefore(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// list returns the deliveries ordered by ID
+func (s *webhookStore) list() []models.WebhookDelivery {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var deliveries []models.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		deliveries = append(deliveries, delivery)
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+	return deliveries
+}
+
+// webhookReceiver records the requests posted to it, answering with a status
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func TestDispatcher(t *testing.T) {
+	receiver := &webhookReceiver{status: http.StatusNoContent}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	s := newWebhookStore(
+		models.Webhook{ID: "recon", AccountID: "acct", EventTypes: []string{"new"}, URL: server.URL, Secret: "s3cret", Enabled: true},
+		models.Webhook{ID: "other-account", AccountID: "other", URL: server.URL, Enabled: true},
+		models.Webhook{ID: "disabled", URL: server.URL, Enabled: false},
+	)
+	d := NewDispatcher(s)
+
+	email := models.Email{ID: "acct-1", AccountID: "acct", Folder: "INBOX", Subject: "Settlement", TextContent: "body"}
+	d.HandleEvent(client.EmailEvent{Type: client.EmailEventNew, Email: email})
+	d.HandleEvent(client.EmailEvent{Type: client.EmailEventRead, Email: email})
+
+	deliveries := s.list()
+	if len(deliveries) != 1 || deliveries[0].WebhookID != "recon" || deliveries[0].Status != models.WebhookDeliveryQueued {
+		t.Fatalf("Expected one delivery to the recon webhook, got %+v", deliveries)
+	}
+
+	d.sendDue(nil)
+
+	delivery, _ := s.GetWebhookDelivery(deliveries[0].ID)
+	if delivery.Status != models.WebhookDeliveryDelivered || delivery.Attempts != 1 || delivery.DeliveredAt == nil ||
+		delivery.ResponseStatus != http.StatusNoContent {
+		t.Errorf("Unexpected delivery %+v", delivery)
+	}
+
+	if len(receiver.requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(receiver.requests))
+	}
+	req, body := receiver.requests[0], receiver.bodies[0]
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil || req.Header.Get(HeaderSignature) != Sign("s3cret", timestamp, body) {
+		t.Errorf("Invalid signature %q for timestamp %q", req.Header.Get(HeaderSignature), req.Header.Get(HeaderTimestamp))
+	}
+	if req.Header.Get(HeaderDelivery) != delivery.ID || req.Header.Get(HeaderEvent) != "new" ||
+		req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected headers %v", req.Header)
+	}
+
+	var posted payload
+	if err := json.Unmarshal(body, &posted); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if posted.DeliveryID != delivery.ID || posted.WebhookID != "recon" || posted.Type != "new" || posted.AccountID != "acct" ||
+		posted.Email == nil || posted.Email.Subject != "Settlement" || posted.Email.TextContent != "" {
+		t.Errorf("Unexpected payload %s", body)
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	s := newWebhookStore(models.Webhook{ID: "recon", URL: server.URL, Secret: "s3cret", Enabled: true})
+	d := NewDispatcher(s)
+	d.HandleEvent(client.EmailEvent{Type: client.FolderEventCreated, AccountID: "acct", NewValue: "Settlements"})
+
+	// A failed delivery is retried after a delay
+	start := time.Now()
+	d.sendDue(nil)
+	delivery := s.list()[0]
+	if delivery.Status != models.WebhookDeliveryQueued || delivery.Attempts != 1 || delivery.ResponseStatus != 500 ||
+		delivery.LastError == "" || delivery.NextAttempt.Before(start.Add(deliveryRetryDelay)) {
+		t.Errorf("Expected the delivery to be retried later, got %+v", delivery)
+	}
+
+	// It is dead once it runs out of attempts
+	delivery.Attempts = maxDeliveryAttempts - 1
+	delivery.NextAttempt = time.Now()
+	s.StoreWebhookDelivery(delivery)
+	d.sendDue(nil)
+	delivery, _ = s.GetWebhookDelivery(delivery.ID)
+	if delivery.Status != models.WebhookDeliveryDead || delivery.Attempts != maxDeliveryAttempts {
+		t.Errorf("Expected the delivery to be dead, got %+v", delivery)
+	}
+
+	if _, err := d.Replay("missing"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows replaying a missing delivery, got %v", err)
+	}
+
+	// A replayed delivery starts over
+	receiver.status = http.StatusOK
+	replayed, err := d.Replay(delivery.ID)
+	if err != nil || replayed.Status != models.WebhookDeliveryQueued || replayed.Attempts != 0 {
+		t.Fatalf("Unexpected replayed delivery %+v (%v)", replayed, err)
+	}
+	d.sendDue(nil)
+	delivery, _ = s.GetWebhookDelivery(delivery.ID)
+	if delivery.Status != models.WebhookDeliveryDelivered || delivery.Attempts != 1 || delivery.LastError != "" {
+		t.Errorf("Expected the replayed delivery to be delivered, got %+v", delivery)
+	}
+	if _, err := d.Replay(delivery.ID); err != ErrDeliveryNotDead {
+		t.Errorf("Expected ErrDeliveryNotDead, got %v", err)
+	}
+
+	// Deliveries to a webhook disabled since they were queued are dead
+	d.HandleEvent(client.EmailEvent{Type: client.FolderEventDeleted, AccountID: "acct", OldValue: "Settlements"})
+	s.webhooks[0].Enabled = false
+	d.sendDue(nil)
+	for _, delivery := range s.list() {
+		if delivery.EventType == "folder_deleted" && delivery.Status != models.WebhookDeliveryDead {
+			t.Errorf("Expected the delivery to a disabled webhook to be dead, got %+v", delivery)
+		}
+	}
+	if len(receiver.requests) != 3 {
+		t.Errorf("Expected 3 requests, got %d", len(receiver.requests))
+	}
+}
+
+func TestDeliveryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{8, time.Hour},
+	}
+	for _, test := range tests {
+		if delay := deliveryBackoff(test.attempts); delay != test.expected {
+			t.Errorf("deliveryBackoff(%d) = %v, expected %v", test.attempts, delay, test.expected)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		webhook models.Webhook
+		valid   bool
+	}{
+		{models.Webhook{URL: "https://recon.example.com/hooks", EventTypes: []string{"new", "folder_synced"}}, true},
+		{models.Webhook{URL: "http://localhost:9000"}, true},
+		{models.Webhook{URL: "ftp://example.com"}, false},
+		{models.Webhook{URL: "/hooks"}, false},
+		{models.Webhook{URL: "https://example.com", EventTypes: []string{"arrived"}}, false},
+	}
+	for _, test := range tests {
+		if err := Validate(test.webhook); (err == nil) != test.valid {
+			t.Errorf("Validate(%+v) = %v, expected valid %v", test.webhook, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Package webhooks posts email and folder events to the HTTP endpoints subscribed to
+// them. Each event a webhook subscribes to is queued in the database as a delivery and
+// sent as a signed JSON POST in the background. Failed deliveries are retried with
+// exponential backoff, then kept in a dead-letter list until they are replayed.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/user/email-bridge/internal/client"
+	"github.com/user/email-bridge/internal/models"
+)
+
+// Headers of webhook requests
+const (
+	// HeaderSignature holds "sha256=" and the hex HMAC-SHA256 of the timestamp, a dot
+	// and the body, keyed with the webhook's secret
+	HeaderSignature = "X-Webhook-Signature"
+	// HeaderTimestamp holds the Unix time the request was signed at, so receivers can
+	// reject old requests
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// HeaderDelivery holds the delivery ID, which is the same on every attempt
+	HeaderDelivery = "X-Webhook-Delivery"
+	// HeaderEvent holds the event type
+	HeaderEvent = "X-Webhook-Event"
+)
+
+// Validate checks that a webhook has an http or https URL and subscribes to known
+// event types
+func Validate(webhook models.Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook needs an http or https URL")
+	}
+
+	for _, eventType := range webhook.EventTypes {
+		if !knownEventType(eventType) {
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+	}
+
+	return nil
+}
+
+// knownEventType reports whether an event type is one the event handler notifies
+func knownEventType(eventType string) bool {
+	for _, known := range client.EmailEventTypes {
+		if string(known) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribes reports whether a webhook is sent an event
+func subscribes(webhook models.Webhook, event models.Event) bool {
+	if !webhook.Enabled || (webhook.AccountID != "" && webhook.AccountID != event.AccountID) {
+		return false
+	}
+	if len(webhook.EventTypes) == 0 {
+		return true
+	}
+	for _, eventType := range webhook.EventTypes {
+		if eventType == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateSecret returns a random secret for signing a webhook's requests
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// Sign returns the signature of a request body sent at a Unix time, as sent in the
+// X-Webhook-Signature header. Receivers verify a request by computing it with their
+// copy of the secret and comparing it in constant time.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -6,7 +6,7 @@ set GOARCH=amd64
 set CGO_ENABLED=1
 
 cd %~dp0\..
-go build -o bin\email-bridge.exe cmd\server\main.go
+go build -tags sqlite_fts5 -o bin\email-bridge.exe cmd\server\main.go
 
 if %ERRORLEVEL% EQU 0 (
     echo Build successful! Binary located at bin\email-bridge.exe
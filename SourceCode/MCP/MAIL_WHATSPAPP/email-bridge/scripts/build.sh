@@ -11,7 +11,7 @@ cd "$(dirname "$0")/.."
 mkdir -p bin
 
 # Build the application
-go build -o bin/email-bridge cmd/server/main.go
+go build -tags sqlite_fts5 -o bin/email-bridge cmd/server/main.go
 
 if [ $? -eq 0 ]; then
     echo "Build successful! Binary located at bin/email-bridge"
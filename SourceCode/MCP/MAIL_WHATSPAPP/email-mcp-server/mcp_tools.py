@@ -15,9 +15,21 @@ logger = logging.getLogger(__name__)
 # Email Bridge API base URL
 EMAIL_BRIDGE_API_URL = os.getenv("EMAIL_BRIDGE_API_URL", "http://localhost:8080")
 
+# Identifies this server to the Email Bridge, which can hold its emails for approval
+EMAIL_BRIDGE_TOKEN = os.getenv("EMAIL_BRIDGE_TOKEN", "")
+CLIENT_HEADERS = {"Authorization": f"Bearer {EMAIL_BRIDGE_TOKEN}"} if EMAIL_BRIDGE_TOKEN else {}
+
 
 class EmailSearchParams(BaseModel):
     """Parameters for searching emails"""
+    q: Optional[str] = Field(
+        None,
+        description=(
+            "Gmail-style query, e.g. 'from:alice has:attachment after:2024-01-01 subject:\"invoice\" -is:read in:INBOX'. "
+            "Supports from:, to:, cc:, subject:, in:, filename:, has:attachment, is:read/unread, after:, before:, "
+            "AND, OR, NOT or -, and parentheses"
+        ),
+    )
     query: Optional[str] = Field(None, description="Search term to match in email content or subject")
     folder: Optional[str] = Field(None, description="Folder to search in")
     from_address: Optional[str] = Field(None, description="Sender email address")
@@ -29,6 +41,9 @@ class EmailSearchParams(BaseModel):
     is_read: Optional[bool] = Field(None, description="Filter by read/unread status")
     limit: int = Field(20, description="Maximum number of emails to return")
     offset: int = Field(0, description="Number of emails to skip")
+    sort_by: Optional[str] = Field(None, description="Sort by date, subject, from or relevance")
+    sort_order: Optional[str] = Field(None, description="Sort order, asc or desc")
+    cursor: Optional[str] = Field(None, description="next_cursor of the previous page, to continue after it")
 
 
 class EmailAddress(BaseModel):
@@ -46,6 +61,18 @@ class EmailCompose(BaseModel):
     text_content: str = Field(..., description="Plain text content")
     html_content: Optional[str] = Field(None, description="HTML content")
     attachment_paths: Optional[List[str]] = Field(None, description="Paths to attachments")
+    send_at: Optional[str] = Field(None, description="RFC 3339 time to send the email at; omit to send now")
+
+
+class EmailDraft(BaseModel):
+    """Parameters for saving a draft for a human to review and send"""
+    in_reply_to: Optional[str] = Field(None, description="ID of the email the draft replies to")
+    to: Optional[List[EmailAddress]] = Field(None, description="Recipients; defaults to the sender of in_reply_to")
+    cc: Optional[List[EmailAddress]] = Field(None, description="CC recipients")
+    bcc: Optional[List[EmailAddress]] = Field(None, description="BCC recipients")
+    subject: Optional[str] = Field(None, description="Email subject; defaults to Re: the subject of in_reply_to")
+    text_content: str = Field(..., description="Plain text content")
+    html_content: Optional[str] = Field(None, description="HTML content")
 
 
 class EmailReply(BaseModel):
@@ -110,6 +137,19 @@ def register_mcp_tools(app: FastAPI) -> None:
         """
         return send_email(params)
     
+    @app.post("/mcp/save_draft", tags=["MCP Tools"])
+    async def mcp_save_draft(params: EmailDraft) -> Dict[str, Any]:
+        """
+        Save a draft in the Drafts folder without sending it
+        
+        Args:
+            params: Draft parameters
+            
+        Returns:
+            Dict containing the saved draft
+        """
+        return save_draft(params)
+    
     @app.post("/mcp/reply_to_email", tags=["MCP Tools"])
     async def mcp_reply_to_email(params: EmailReply) -> Dict[str, Any]:
         """
@@ -159,6 +199,27 @@ def register_mcp_tools(app: FastAPI) -> None:
         """
         return download_attachment(attachment_id)
 
+    @app.get("/mcp/preview_attachment/{attachment_id}", tags=["MCP Tools"])
+    async def mcp_preview_attachment(
+        attachment_id: str,
+        sheet: Optional[str] = None,
+        limit: Optional[int] = None,
+        cursor: Optional[str] = None,
+    ) -> Dict[str, Any]:
+        """
+        Preview a spreadsheet attachment (.xlsx, .xlsb or .csv)
+        
+        Args:
+            attachment_id: Attachment ID
+            sheet: Sheet to read, defaults to the first sheet
+            limit: Number of rows, 20 by default and at most 1000
+            cursor: next_cursor of the previous page, to read the following rows
+            
+        Returns:
+            Dict containing the sheets, headers and a page of rows
+        """
+        return preview_attachment(attachment_id, sheet, limit, cursor)
+
 
 def search_emails(params: EmailSearchParams) -> Dict[str, Any]:
     """
@@ -173,6 +234,7 @@ def search_emails(params: EmailSearchParams) -> Dict[str, Any]:
     try:
         response = requests.get(
             f"{EMAIL_BRIDGE_API_URL}/emails",
+            headers=CLIENT_HEADERS,
             params=params.dict(exclude_none=True)
         )
         response.raise_for_status()
@@ -193,7 +255,7 @@ def get_email(email_id: str) -> Dict[str, Any]:
         Dict containing email details
     """
     try:
-        response = requests.get(f"{EMAIL_BRIDGE_API_URL}/emails/{email_id}")
+        response = requests.get(f"{EMAIL_BRIDGE_API_URL}/emails/{email_id}", headers=CLIENT_HEADERS)
         response.raise_for_status()
         return response.json()
     except requests.RequestException as e:
@@ -214,6 +276,7 @@ def send_email(params: EmailCompose) -> Dict[str, Any]:
     try:
         response = requests.post(
             f"{EMAIL_BRIDGE_API_URL}/emails",
+            headers=CLIENT_HEADERS,
             json=params.dict(exclude_none=True)
         )
         response.raise_for_status()
@@ -223,6 +286,29 @@ def send_email(params: EmailCompose) -> Dict[str, Any]:
         return {"error": str(e), "success": False}
 
 
+def save_draft(params: EmailDraft) -> Dict[str, Any]:
+    """
+    Save a draft without sending it
+    
+    Args:
+        params: Draft parameters
+        
+    Returns:
+        Dict containing the saved draft
+    """
+    try:
+        response = requests.post(
+            f"{EMAIL_BRIDGE_API_URL}/drafts",
+            headers=CLIENT_HEADERS,
+            json=params.dict(exclude_none=True)
+        )
+        response.raise_for_status()
+        return response.json()
+    except requests.RequestException as e:
+        logger.error(f"Error saving draft: {e}")
+        return {"error": str(e), "success": False}
+
+
 def reply_to_email(params: EmailReply) -> Dict[str, Any]:
     """
     Reply to an existing email
@@ -236,6 +322,7 @@ def reply_to_email(params: EmailReply) -> Dict[str, Any]:
     try:
         response = requests.post(
             f"{EMAIL_BRIDGE_API_URL}/emails/{params.email_id}/reply",
+            headers=CLIENT_HEADERS,
             json=params.dict(exclude_none=True)
         )
         response.raise_for_status()
@@ -258,6 +345,7 @@ def forward_email(params: EmailForward) -> Dict[str, Any]:
     try:
         response = requests.post(
             f"{EMAIL_BRIDGE_API_URL}/emails/{params.email_id}/forward",
+            headers=CLIENT_HEADERS,
             json=params.dict(exclude_none=True)
         )
         response.raise_for_status()
@@ -275,7 +363,7 @@ def list_folders() -> Dict[str, Any]:
         Dict containing folder list
     """
     try:
-        response = requests.get(f"{EMAIL_BRIDGE_API_URL}/folders")
+        response = requests.get(f"{EMAIL_BRIDGE_API_URL}/folders", headers=CLIENT_HEADERS)
         response.raise_for_status()
         return response.json()
     except requests.RequestException as e:
@@ -294,9 +382,41 @@ def download_attachment(attachment_id: str) -> Dict[str, Any]:
         Dict containing attachment details and local path
     """
     try:
-        response = requests.get(f"{EMAIL_BRIDGE_API_URL}/attachments/{attachment_id}")
+        response = requests.get(f"{EMAIL_BRIDGE_API_URL}/attachments/{attachment_id}", headers=CLIENT_HEADERS)
         response.raise_for_status()
         return response.json()
     except requests.RequestException as e:
         logger.error(f"Error downloading attachment: {e}")
-        return {"error": str(e), "attachment": None}
\ No newline at end of file
+        return {"error": str(e), "attachment": None}
+
+
+def preview_attachment(
+    attachment_id: str,
+    sheet: Optional[str] = None,
+    limit: Optional[int] = None,
+    cursor: Optional[str] = None,
+) -> Dict[str, Any]:
+    """
+    Preview a spreadsheet attachment
+    
+    Args:
+        attachment_id: Attachment ID
+        sheet: Sheet to read, defaults to the first sheet
+        limit: Number of rows
+        cursor: next_cursor of the previous page
+        
+    Returns:
+        Dict containing the sheets, headers and a page of rows
+    """
+    params = {"sheet": sheet, "limit": limit, "cursor": cursor}
+    try:
+        response = requests.get(
+            f"{EMAIL_BRIDGE_API_URL}/attachments/{attachment_id}/preview",
+            headers=CLIENT_HEADERS,
+            params={name: value for name, value in params.items() if value is not None}
+        )
+        response.raise_for_status()
+        return response.json()
+    except requests.RequestException as e:
+        logger.error(f"Error previewing attachment: {e}")
+        return {"error": str(e), "rows": []}